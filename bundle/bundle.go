@@ -0,0 +1,291 @@
+// Package bundle reads dataset bundles: a data set with everything needed to
+// load it and to check a server that has. A bundle is a bundle.json manifest
+// listing the RDF or JSON files, the DQL schema, optionally a GraphQL schema,
+// and queries with their expected results, each with a checksum. Paths are
+// relative to the manifest, so a bundle can point at files the repository
+// already has, e.g. ../data/goldendata.rdf.gz.
+//
+// The large files in this repository are kept in Git LFS. A file that was not
+// fetched is a small pointer with the checksum of the real one, which is
+// reported as such instead of as a checksum mismatch.
+package bundle
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ManifestName is the name of the manifest in a bundle directory.
+const ManifestName = "bundle.json"
+
+// File is a file of a bundle.
+type File struct {
+	// Path is relative to the manifest.
+	Path string `json:"path"`
+	// SHA256 is the hex checksum of the file as stored, compressed or not.
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	// URL is where the file can be downloaded from, if it isn't in the
+	// repository.
+	URL string `json:"url,omitempty"`
+}
+
+// Query is a query with its expected result.
+type Query struct {
+	Name  string `json:"name"`
+	Query File   `json:"query"`
+	// Expected holds the data of the response, as JSON.
+	Expected File `json:"expected"`
+}
+
+// Manifest describes a bundle.
+type Manifest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Data are the RDF or JSON files, plain or gzipped, that make up the
+	// data set. They are loaded in order.
+	Data          []File  `json:"data"`
+	Schema        File    `json:"schema"`
+	GraphQLSchema *File   `json:"graphql_schema,omitempty"`
+	Queries       []Query `json:"queries,omitempty"`
+	// LangSep joins predicates and language tags when the queries were
+	// written for the old loader, e.g. "." for type.object.name.en.
+	LangSep string `json:"lang_sep,omitempty"`
+	// Loader is a shell command that loads the bundle, run by Setup when no
+	// other loader is given. See Command.
+	Loader string `json:"loader,omitempty"`
+}
+
+// Bundle is a manifest and the directory its paths are relative to.
+type Bundle struct {
+	Manifest
+	// Dir is the directory of the manifest.
+	Dir string
+	// path is the manifest file.
+	path string
+}
+
+// Open reads a bundle. path is a manifest, or a directory with a bundle.json.
+func Open(path string) (*Bundle, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, ManifestName)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bu := &Bundle{Dir: filepath.Dir(path), path: path}
+	if err := json.Unmarshal(b, &bu.Manifest); err != nil {
+		return nil, fmt.Errorf("while reading %s: %v", path, err)
+	}
+	return bu, nil
+}
+
+// Save writes the manifest back.
+func (b *Bundle) Save() error {
+	js, err := json.MarshalIndent(b.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(b.path, append(js, '\n'), 0644)
+}
+
+// Path returns the path of f, relative to the working directory.
+func (b *Bundle) Path(f File) string {
+	return filepath.Join(b.Dir, filepath.FromSlash(f.Path))
+}
+
+// Paths returns the paths of files.
+func (b *Bundle) Paths(files []File) []string {
+	out := make([]string, len(files))
+	for i, f := range files {
+		out[i] = b.Path(f)
+	}
+	return out
+}
+
+// Files returns all the files of the bundle: the data, the schemas and the
+// queries with their expected results.
+func (b *Bundle) Files() []*File {
+	var out []*File
+	for i := range b.Data {
+		out = append(out, &b.Data[i])
+	}
+	out = append(out, &b.Schema)
+	if b.GraphQLSchema != nil {
+		out = append(out, b.GraphQLSchema)
+	}
+	for i := range b.Queries {
+		out = append(out, &b.Queries[i].Query, &b.Queries[i].Expected)
+	}
+	return out
+}
+
+// Format returns rdf or json for a data file, by its extension, or "".
+func Format(path string) string {
+	switch ext := filepath.Ext(strings.TrimSuffix(path, ".gz")); {
+	case ext == ".rdf", ext == ".nq", ext == ".nt":
+		return "rdf"
+	case ext == ".json":
+		return "json"
+	}
+	return ""
+}
+
+// Status is the state of a file on disk.
+type Status int
+
+const (
+	// Present means the file is there and matches its checksum, if it has
+	// one.
+	Present Status = iota
+	// Missing means there is no such file.
+	Missing
+	// Pointer means the file is a Git LFS pointer that wasn't fetched.
+	Pointer
+	// Corrupt means the size or checksum differ from the manifest.
+	Corrupt
+)
+
+func (s Status) String() string {
+	switch s {
+	case Present:
+		return "ok"
+	case Missing:
+		return "missing"
+	case Pointer:
+		return "not fetched"
+	}
+	return "corrupt"
+}
+
+// lfsPointer reads the checksum and size of the file a Git LFS pointer stands
+// for. ok is false if path is not a pointer.
+func lfsPointer(path string) (sum string, size int64, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, false
+	}
+	defer f.Close()
+	// Pointers are a few lines, well under 1KB.
+	s := bufio.NewScanner(io.LimitReader(f, 1024))
+	first := true
+	for s.Scan() {
+		line := s.Text()
+		if first && !strings.HasPrefix(line, "version https://git-lfs.github.com/spec/") {
+			return "", 0, false
+		}
+		first = false
+		switch {
+		case strings.HasPrefix(line, "oid sha256:"):
+			sum = strings.TrimPrefix(line, "oid sha256:")
+		case strings.HasPrefix(line, "size "):
+			size, _ = strconv.ParseInt(strings.TrimPrefix(line, "size "), 10, 64)
+		}
+	}
+	return sum, size, sum != ""
+}
+
+// Checksum returns the SHA-256 and size of a file. For a Git LFS pointer
+// they are those of the file it stands for, and pointer is true.
+func Checksum(path string) (sum string, size int64, pointer bool, err error) {
+	if sum, size, ok := lfsPointer(path); ok {
+		return sum, size, true, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, false, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err = io.Copy(h, f)
+	if err != nil {
+		return "", 0, false, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, false, nil
+}
+
+// Check returns the status of f on disk. The error explains a status other
+// than Present.
+func (b *Bundle) Check(f File) (Status, error) {
+	path := b.Path(f)
+	sum, size, pointer, err := Checksum(path)
+	switch {
+	case os.IsNotExist(err):
+		return Missing, fmt.Errorf("%s is missing", path)
+	case err != nil:
+		return Corrupt, err
+	case f.SHA256 != "" && sum != f.SHA256:
+		return Corrupt, fmt.Errorf("%s: checksum %s, want %s", path, sum, f.SHA256)
+	case f.Size != 0 && size != f.Size:
+		return Corrupt, fmt.Errorf("%s: size %d, want %d", path, size, f.Size)
+	case pointer:
+		return Pointer, fmt.Errorf("%s is a Git LFS pointer, run git lfs pull", path)
+	}
+	return Present, nil
+}
+
+// Validate checks the manifest and every file of the bundle, and returns all
+// the problems found.
+func (b *Bundle) Validate() []error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	if b.Name == "" {
+		add("%s: no name", b.path)
+	}
+	if len(b.Data) == 0 {
+		add("%s: no data files", b.path)
+	}
+	if b.Schema.Path == "" {
+		add("%s: no schema", b.path)
+	}
+	for _, f := range b.Data {
+		if Format(f.Path) == "" {
+			add("%s: data file %s is neither RDF nor JSON", b.path, f.Path)
+		}
+	}
+	names := make(map[string]bool)
+	for _, q := range b.Queries {
+		if q.Name == "" || names[q.Name] {
+			add("%s: query %s has no name or a duplicate one", b.path, q.Query.Path)
+		}
+		names[q.Name] = true
+	}
+	for _, f := range b.Files() {
+		if f.Path == "" {
+			continue
+		}
+		if _, err := b.Check(*f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Seal sets the checksum and size of every file from the files on disk.
+// Files that are Git LFS pointers get those of the file they stand for.
+func (b *Bundle) Seal() error {
+	for _, f := range b.Files() {
+		sum, size, _, err := Checksum(b.Path(*f))
+		if err != nil {
+			return err
+		}
+		f.SHA256, f.Size = sum, size
+	}
+	return nil
+}
+
+// ErrInvalid is returned by Setup for a bundle that doesn't validate.
+var ErrInvalid = errors.New("invalid bundle")
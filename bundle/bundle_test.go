@@ -0,0 +1,225 @@
+package bundle
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/mockdgraph"
+)
+
+const rdf = `<a> <name> "Alice" .
+<a> <friend> <b> .
+<b> <name> "Bob" .
+`
+
+// newBundle writes a small bundle to a temporary directory.
+func newBundle(t *testing.T) *Bundle {
+	dir := t.TempDir()
+	files := map[string]string{
+		"people.rdf":    rdf,
+		"people.json":   `[{"name": "Carol"}, {"name": "Dave"}, {"name": "Eve"}]`,
+		"people.schema": "name: string @index(exact) .\nfriend: [uid] .\n",
+		"q.in":          `{ q(func: eq(name, "Alice")) { name } }`,
+		"q.out":         `{"q": [{"name": "Alice"}]}`,
+		ManifestName: `{
+  "name": "people",
+  "data": [{"path": "people.rdf"}, {"path": "people.json"}],
+  "schema": {"path": "people.schema"},
+  "queries": [{"name": "q", "query": {"path": "q.in"}, "expected": {"path": "q.out"}}]
+}`,
+	}
+	for name, text := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644))
+	}
+	b, err := Open(dir)
+	require.NoError(t, err)
+	return b
+}
+
+func TestValidate(t *testing.T) {
+	b := newBundle(t)
+	require.Empty(t, b.Validate())
+	require.NoError(t, b.Seal())
+	require.NoError(t, b.Save())
+
+	b, err := Open(filepath.Join(b.Dir, ManifestName))
+	require.NoError(t, err)
+	require.Len(t, b.Data[0].SHA256, 64)
+	require.Equal(t, int64(len(rdf)), b.Data[0].Size)
+	require.Empty(t, b.Validate())
+
+	// A changed file no longer matches its checksum.
+	require.NoError(t, ioutil.WriteFile(b.Path(b.Schema), []byte("name: string .\n"), 0644))
+	st, err := b.Check(b.Schema)
+	require.Equal(t, Corrupt, st)
+	require.Error(t, err)
+
+	// A pointer that wasn't fetched is reported as such.
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:" +
+		b.Data[0].SHA256 + "\nsize " + strconv.Itoa(len(rdf)) + "\n"
+	require.NoError(t, ioutil.WriteFile(b.Path(b.Data[0]), []byte(pointer), 0644))
+	st, err = b.Check(b.Data[0])
+	require.Equal(t, Pointer, st)
+	require.Contains(t, err.Error(), "git lfs pull")
+
+	require.NoError(t, os.Remove(b.Path(b.Queries[0].Expected)))
+	st, _ = b.Check(b.Queries[0].Expected)
+	require.Equal(t, Missing, st)
+	require.Len(t, b.Validate(), 3)
+
+	b.Name, b.Data = "", []File{{Path: "people.csv"}}
+	errs := b.Validate()
+	require.Contains(t, errs[0].Error(), "no name")
+	require.Contains(t, errs[1].Error(), "neither RDF nor JSON")
+}
+
+func TestFormat(t *testing.T) {
+	for path, want := range map[string]string{
+		"1million.rdf.gz":   "rdf",
+		"donors.rdf":        "rdf",
+		"21million.json.gz": "json",
+		"products.json":     "json",
+		"Donations.csv":     "",
+		"labels_en.tar.gz":  "",
+		"data/../people.nq": "rdf",
+	} {
+		require.Equal(t, want, Format(path), path)
+	}
+}
+
+// TestShipped checks that the bundles in the repository are consistent. The
+// large files may be Git LFS pointers.
+func TestShipped(t *testing.T) {
+	for _, path := range []string{
+		"../indextest",
+		"../data/1million.bundle.json",
+		"../data/21million.bundle.json",
+		"../data/aml",
+		"../data/social",
+		"../donors/10schools",
+		"../donors/donorsCA",
+	} {
+		b, err := Open(path)
+		require.NoError(t, err)
+		for _, f := range b.Files() {
+			require.NotEmpty(t, f.SHA256, "%s in %s", f.Path, path)
+			st, err := b.Check(*f)
+			require.True(t, st == Present || st == Pointer, "%v", err)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	b := newBundle(t)
+	out := filepath.Join(b.Dir, "env.txt")
+	err := Setup(context.Background(), b,
+		Command(`echo "$BUNDLE_NAME $BUNDLE_DATA $BUNDLE_SCHEMA" > env.txt`))
+	require.NoError(t, err)
+	env, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	fields := strings.Fields(string(env))
+	require.Equal(t, "people", fields[0])
+	require.Len(t, fields, 3)
+	data := strings.Split(fields[1], ",")
+	require.Len(t, data, 2)
+	require.True(t, filepath.IsAbs(data[0]))
+	require.True(t, filepath.IsAbs(data[1]))
+	require.Equal(t, "people.schema", filepath.Base(fields[2]))
+
+	require.Error(t, Setup(context.Background(), b, Command("exit 3")))
+	// Without a loader, the one of the manifest runs.
+	require.Error(t, Setup(context.Background(), b, nil))
+	b.Loader = "true"
+	require.NoError(t, Setup(context.Background(), b, nil))
+
+	// Setup doesn't load an invalid bundle.
+	called := false
+	require.NoError(t, os.Remove(b.Path(b.Data[0])))
+	err = Setup(context.Background(), b, LoaderFunc(func(context.Context, *Bundle) error {
+		called = true
+		return nil
+	}))
+	require.Contains(t, err.Error(), ErrInvalid.Error())
+	require.False(t, called)
+}
+
+func TestRegister(t *testing.T) {
+	Register("test", LoaderFunc(func(context.Context, *Bundle) error { return nil }))
+	_, ok := Lookup("test")
+	require.True(t, ok)
+	_, ok = Lookup("missing")
+	require.False(t, ok)
+	require.Contains(t, Loaders(), "test")
+}
+
+func TestHTTPLoader(t *testing.T) {
+	s := mockdgraph.New(mockdgraph.Config{})
+	s.Start()
+	defer s.Close()
+
+	b := newBundle(t)
+	l := &HTTPLoader{Alpha: s.URL, Batch: 2}
+	require.NoError(t, l.Load(context.Background(), b))
+
+	reqs := s.Requests()
+	require.Len(t, reqs, 5)
+	require.Equal(t, "/alter", reqs[0].Path)
+	require.Contains(t, reqs[0].Body, "@index(exact)")
+	// Three N-Quads in batches of two, then three objects.
+	for _, r := range reqs[1:] {
+		require.Equal(t, "/mutate", r.Path)
+		require.Equal(t, "true", r.Params.Get("commitNow"))
+	}
+	require.Equal(t, "application/rdf", reqs[1].ContentType)
+	require.Equal(t, 2, strings.Count(reqs[1].Body, " .\n"))
+	require.Contains(t, reqs[2].Body, `"Bob"`)
+	require.Equal(t, "application/json", reqs[3].ContentType)
+	require.JSONEq(t, `{"set": [{"name": "Carol"}, {"name": "Dave"}]}`, reqs[3].Body)
+	require.JSONEq(t, `{"set": [{"name": "Eve"}]}`, reqs[4].Body)
+
+	schema, err := ioutil.ReadFile(b.Path(b.Schema))
+	require.NoError(t, err)
+	s.Fail("/alter", string(schema), "schema error")
+	err = l.Load(context.Background(), b)
+	require.Contains(t, err.Error(), "schema error")
+}
+
+func TestHTTPLoaderBlankNodes(t *testing.T) {
+	s := mockdgraph.New(mockdgraph.Config{})
+	s.Start()
+	defer s.Close()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"people.rdf":    "_:a <friend> _:b .\n_:a <name> \"Alice\" .\n_:b <name> \"Bob\" .\n",
+		"people.json":   `[{"uid": "_:a", "age": 30}, {"uid": "_:c", "friend": [{"uid": "_:b"}]}]`,
+		"people.schema": "name: string .\nfriend: [uid] .\nage: int .\n",
+		ManifestName: `{
+  "name": "people",
+  "data": [{"path": "people.rdf"}, {"path": "people.json"}],
+  "schema": {"path": "people.schema"}
+}`,
+	}
+	for name, text := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644))
+	}
+	b, err := Open(dir)
+	require.NoError(t, err)
+	l := &HTTPLoader{Alpha: s.URL, Batch: 2}
+	require.NoError(t, l.Load(context.Background(), b))
+
+	// _:a and _:b get 0x1 and 0x2 in the first mutation and keep them in
+	// the later ones; only _:c is new.
+	reqs := s.Requests()
+	require.Len(t, reqs, 4)
+	require.Contains(t, reqs[1].Body, "_:a <friend> _:b .")
+	require.Equal(t, "{ set {\n<0x2> <name> \"Bob\" .\n} }", reqs[2].Body)
+	require.JSONEq(t, `{"set": [{"uid": "0x1", "age": 30}, {"uid": "_:c", "friend": [{"uid": "0x2"}]}]}`, reqs[3].Body)
+}
@@ -0,0 +1,155 @@
+// This tool works with dataset bundles, see package bundle. It validates a
+// bundle against its checksums, lists the files it needs and whether they are
+// there, fills in the checksums of a new bundle, and loads a bundle into a
+// server:
+//
+//	./bundletool validate ../../indextest
+//	./bundletool needs ../../data/21million.bundle.json
+//	./bundletool seal ../../data/social
+//	./bundletool --loader http --alpha http://localhost:8080 setup ../../data/social
+//	./bundletool --exec 'dgraph live -f "$BUNDLE_DATA" -s "$BUNDLE_SCHEMA"' setup ../../donors/donorsCA
+//
+// setup loads with the shell command of --exec, the Go loader named by
+// --loader, or else the loader command of the manifest.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dgraph-io/benchmarks/bundle"
+)
+
+var (
+	execCmd = flag.String("exec", "", "Shell command that loads the bundle, with $BUNDLE_DATA, $BUNDLE_SCHEMA and so on set.")
+	loader  = flag.String("loader", "", "Go loader to load the bundle with, e.g. http.")
+	alpha   = flag.String("alpha", "http://localhost:8080", "Base URL of the alpha, for the http loader.")
+	batch   = flag.Int("batch", 1000, "N-Quads or JSON objects per mutation, for the http loader.")
+	timeout = flag.Duration("timeout", 0, "Time limit of setup. 0 means none.")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: bundletool [flags] validate|needs|seal|setup bundle...\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// size formats a number of bytes.
+func size(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func validate(b *bundle.Bundle) bool {
+	errs := b.Validate()
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if len(errs) == 0 {
+		fmt.Printf("%s: ok, %d data files, %d queries\n", b.Name, len(b.Data), len(b.Queries))
+	}
+	return len(errs) == 0
+}
+
+// needs lists the files of a bundle with their state. It returns false if any
+// is not ready to use.
+func needs(b *bundle.Bundle) bool {
+	ready := true
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\n", b.Name)
+	for _, f := range b.Files() {
+		st, _ := b.Check(*f)
+		if st != bundle.Present {
+			ready = false
+		}
+		total += f.Size
+		line := fmt.Sprintf("  %s\t%s\t%s", st, size(f.Size), b.Path(*f))
+		if f.URL != "" && st != bundle.Present {
+			line += "\t" + f.URL
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "  total\t%s\n", size(total))
+	w.Flush()
+	return ready
+}
+
+func setup(b *bundle.Bundle) error {
+	var l bundle.Loader
+	switch {
+	case *execCmd != "":
+		l = bundle.Command(*execCmd)
+	case *loader != "":
+		var ok bool
+		if l, ok = bundle.Lookup(*loader); !ok {
+			return fmt.Errorf("no loader %s, have %s", *loader, strings.Join(bundle.Loaders(), ", "))
+		}
+	}
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	if err := bundle.Setup(ctx, b, l); err != nil {
+		return err
+	}
+	log.Printf("Loaded %s in %s", b.Name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 2 {
+		usage()
+	}
+	bundle.Register("http", &bundle.HTTPLoader{Alpha: *alpha, Batch: *batch})
+
+	ok := true
+	for _, path := range flag.Args()[1:] {
+		b, err := bundle.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		switch flag.Arg(0) {
+		case "validate":
+			ok = validate(b) && ok
+		case "needs":
+			ok = needs(b) && ok
+		case "seal":
+			if err := b.Seal(); err != nil {
+				log.Fatal(err)
+			}
+			if err := b.Save(); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s: sealed %d files\n", b.Name, len(b.Files()))
+		case "setup":
+			if err := setup(b); err != nil {
+				log.Fatal(err)
+			}
+		default:
+			usage()
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,356 @@
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// Loader loads a bundle into a server. Setup validates the bundle before
+// calling it.
+type Loader interface {
+	Load(ctx context.Context, b *Bundle) error
+}
+
+// LoaderFunc adapts a function to a Loader.
+type LoaderFunc func(ctx context.Context, b *Bundle) error
+
+// Load calls f.
+func (f LoaderFunc) Load(ctx context.Context, b *Bundle) error {
+	return f(ctx, b)
+}
+
+var (
+	mu      sync.Mutex
+	loaders = make(map[string]Loader)
+)
+
+// Register makes a loader available by name, e.g. to bundletool --loader.
+func Register(name string, l Loader) {
+	mu.Lock()
+	defer mu.Unlock()
+	loaders[name] = l
+}
+
+// Lookup returns the loader registered under name.
+func Lookup(name string) (Loader, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	l, ok := loaders[name]
+	return l, ok
+}
+
+// Loaders returns the names of the registered loaders, sorted.
+func Loaders() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	var out []string
+	for name := range loaders {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Env returns the variables a shell loader gets, besides those of the
+// process. Paths are absolute.
+//
+//	BUNDLE_NAME            the name of the bundle
+//	BUNDLE_DIR             the directory of the manifest
+//	BUNDLE_DATA            the data files, separated by commas as dgraph live -f takes them
+//	BUNDLE_SCHEMA          the DQL schema
+//	BUNDLE_GRAPHQL_SCHEMA  the GraphQL schema, if there is one
+func (b *Bundle) Env() []string {
+	abs := func(f File) string {
+		p, err := filepath.Abs(b.Path(f))
+		if err != nil {
+			return b.Path(f)
+		}
+		return p
+	}
+	dir, _ := filepath.Abs(b.Dir)
+	var data []string
+	for _, f := range b.Data {
+		data = append(data, abs(f))
+	}
+	env := []string{
+		"BUNDLE_NAME=" + b.Name,
+		"BUNDLE_DIR=" + dir,
+		"BUNDLE_DATA=" + strings.Join(data, ","),
+		"BUNDLE_SCHEMA=" + abs(b.Schema),
+	}
+	if b.GraphQLSchema != nil {
+		env = append(env, "BUNDLE_GRAPHQL_SCHEMA="+abs(*b.GraphQLSchema))
+	}
+	return env
+}
+
+// Command returns a loader that runs a shell command in the bundle directory,
+// with the variables of Env, e.g.
+//
+//	dgraph live -f "$BUNDLE_DATA" -s "$BUNDLE_SCHEMA"
+func Command(command string) Loader {
+	return LoaderFunc(func(ctx context.Context, b *Bundle) error {
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Dir = b.Dir
+		cmd.Env = append(os.Environ(), b.Env()...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("while running %q: %v", command, err)
+		}
+		return nil
+	})
+}
+
+// Setup validates a bundle and loads it with l, or with the command of the
+// manifest if l is nil.
+func Setup(ctx context.Context, b *Bundle, l Loader) error {
+	if errs := b.Validate(); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return fmt.Errorf("%v: %s", ErrInvalid, strings.Join(msgs, "; "))
+	}
+	if l == nil {
+		if b.Loader == "" {
+			return fmt.Errorf("%s has no loader, give one", b.Name)
+		}
+		l = Command(b.Loader)
+	}
+	return l.Load(ctx, b)
+}
+
+// HTTPLoader loads a bundle through the HTTP API of an alpha: it sets the
+// schemas and runs the data as batches of mutations. It suits the small data
+// sets; use dgraph live or bulk for the others.
+type HTTPLoader struct {
+	// Alpha is the base URL, e.g. http://localhost:8080.
+	Alpha string
+	// Batch is the number of N-Quads or JSON objects per mutation.
+	Batch  int
+	Client *http.Client
+}
+
+// post sends body to path and returns the data of the response.
+func (h *HTTPLoader) post(ctx context.Context, path, contentType string, body []byte) (json.RawMessage, error) {
+	req, err := http.NewRequest("POST", strings.TrimSuffix(h.Alpha, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s: %s", path, res.Status, bytes.TrimSpace(b))
+	}
+	var r struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(b, &r) == nil && len(r.Errors) > 0 {
+		return nil, fmt.Errorf("%s: %s", path, r.Errors[0].Message)
+	}
+	return r.Data, nil
+}
+
+// Load implements Loader.
+func (h *HTTPLoader) Load(ctx context.Context, b *Bundle) error {
+	if h.Batch <= 0 {
+		h.Batch = 1000
+	}
+	schema, err := ioutil.ReadFile(b.Path(b.Schema))
+	if err != nil {
+		return err
+	}
+	if _, err := h.post(ctx, "/alter", "application/dql", schema); err != nil {
+		return err
+	}
+	if b.GraphQLSchema != nil {
+		sdl, err := ioutil.ReadFile(b.Path(*b.GraphQLSchema))
+		if err != nil {
+			return err
+		}
+		if _, err := h.post(ctx, "/admin/schema", "application/graphql", sdl); err != nil {
+			return err
+		}
+	}
+	// An alpha scopes blank nodes to a mutation, so those of earlier batches
+	// are sent by the uids they were given, across the files as dgraph live
+	// does.
+	blanks := make(map[string]string)
+	for _, f := range b.Data {
+		var err error
+		if Format(f.Path) == "json" {
+			err = h.loadJSON(ctx, b.Path(f), blanks)
+		} else {
+			err = h.loadRDF(ctx, b.Path(f), blanks)
+		}
+		if err != nil {
+			return fmt.Errorf("while loading %s: %v", f.Path, err)
+		}
+	}
+	return nil
+}
+
+const mutatePath = "/mutate?commitNow=true"
+
+// mutate runs a mutation and adds the uids given to its blank nodes to
+// blanks.
+func (h *HTTPLoader) mutate(ctx context.Context, contentType string, body []byte, blanks map[string]string) error {
+	data, err := h.post(ctx, mutatePath, contentType, body)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+	var r struct {
+		Uids map[string]string `json:"uids"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("%s: %v", mutatePath, err)
+	}
+	for label, uid := range r.Uids {
+		blanks["_:"+label] = uid
+	}
+	return nil
+}
+
+func (h *HTTPLoader) loadRDF(ctx context.Context, path string, blanks map[string]string) error {
+	r, err := nquad.Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var buf bytes.Buffer
+	n := 0
+	flush := func() error {
+		if n == 0 {
+			return nil
+		}
+		body := "{ set {\n" + buf.String() + "} }"
+		buf.Reset()
+		n = 0
+		return h.mutate(ctx, "application/rdf", []byte(body), blanks)
+	}
+	for {
+		nq, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", r.Line(), err)
+		}
+		if uid, ok := blanks[nq.Subject]; ok {
+			nq.Subject = uid
+		}
+		if uid, ok := blanks[nq.ObjectId]; ok {
+			nq.ObjectId = uid
+		}
+		buf.WriteString(nq.String())
+		buf.WriteByte('\n')
+		if n++; n == h.Batch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// loadJSON loads a JSON array of objects, plain or gzipped.
+func (h *HTTPLoader) loadJSON(ctx context.Context, path string, blanks map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var in io.Reader = bufio.NewReaderSize(f, 1<<20)
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	dec := json.NewDecoder(in)
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return fmt.Errorf("expected a JSON array")
+	}
+	var batch []interface{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		body, err := json.Marshal(map[string]interface{}{"set": batch})
+		if err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return h.mutate(ctx, "application/json", body, blanks)
+	}
+	for dec.More() {
+		var obj interface{}
+		if err := dec.Decode(&obj); err != nil {
+			return err
+		}
+		resolve(obj, blanks)
+		batch = append(batch, obj)
+		if len(batch) == h.Batch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// resolve replaces the blank nodes in the uid fields of a JSON value by the
+// uids in blanks.
+func resolve(v interface{}, blanks map[string]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, x := range v {
+			if id, ok := x.(string); ok && k == "uid" {
+				if uid, ok := blanks[id]; ok {
+					v[k] = uid
+				}
+				continue
+			}
+			resolve(x, blanks)
+		}
+	case []interface{}:
+		for _, x := range v {
+			resolve(x, blanks)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Package checkpoint records how far a long load got, so that a load that
+// died can resume instead of starting over. Loads send numbered batches,
+// possibly many at a time; a Tracker is told of every batch the server
+// acknowledged and saves the position in the input after the last batch that
+// was acknowledged along with all those before it. Batches in flight when the
+// load died are sent again on resume, so they should be idempotent, e.g.
+// upserts keyed on an xid.
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// Checkpoint is a position in the input of a load.
+type Checkpoint struct {
+	// File is the input file being read.
+	File string `json:"file"`
+	// Offset is the number of uncompressed bytes of File consumed, and
+	// NQuads the number of N-Quads read from it.
+	Offset int64 `json:"offset"`
+	NQuads int64 `json:"nquads"`
+	// Seq is the sequence number of the last batch acknowledged. Every
+	// batch before it was acknowledged too. Batches are numbered from 1.
+	Seq     uint64    `json:"seq"`
+	Updated time.Time `json:"updated"`
+}
+
+// Load reads a checkpoint saved by Save.
+func Load(path string) (*Checkpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("while parsing checkpoint %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes c to path, through a temporary file renamed over it, so that
+// a load dying while saving leaves the previous checkpoint.
+func (c *Checkpoint) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Skip moves r, reading File, past the N-Quads of c. Plain and gzipped RDF
+// is skipped by offset, JSON an N-Quad at a time.
+func (c *Checkpoint) Skip(r *nquad.Reader) error {
+	err := r.SkipTo(c.Offset)
+	if err != nquad.ErrNoSkip {
+		return err
+	}
+	for i := int64(0); i < c.NQuads; i++ {
+		if _, err := r.Next(); err != nil {
+			return fmt.Errorf("while skipping to N-Quad %d: %v", c.NQuads, err)
+		}
+	}
+	return nil
+}
+
+// Files returns the files a load resuming from c still has to read, with
+// c.File first, or an error if c.File isn't one of them. A nil c resumes
+// from the start.
+func (c *Checkpoint) Files(files []string) ([]string, error) {
+	if c == nil {
+		return files, nil
+	}
+	for i, f := range files {
+		if f == c.File {
+			return files[i:], nil
+		}
+	}
+	return nil, fmt.Errorf("the checkpoint is in %s, which isn't one of the files", c.File)
+}
+
+// Tracker keeps the checkpoint after the batches acknowledged so far,
+// without gaps, and saves it as it moves forward. Saving is throttled, since
+// a load may acknowledge many thousand batches a second; Flush saves the last
+// checkpoint when the load is done or stops.
+type Tracker struct {
+	path string
+	// Every and Interval throttle saving: the checkpoint is saved once it
+	// moved Every batches, or Interval after it was last saved. A load that
+	// dies resends at most the batches since.
+	Every    uint64
+	Interval time.Duration
+
+	mu      sync.Mutex
+	cp      Checkpoint
+	pending map[uint64]Checkpoint
+	// savedSeq and savedAt are the batch and the time of the last save.
+	savedSeq uint64
+	savedAt  time.Time
+}
+
+// NewTracker tracks the batches after start, or from the first batch for a
+// nil start, saving to path every 1000 batches or every second.
+func NewTracker(path string, start *Checkpoint) *Tracker {
+	t := &Tracker{path: path, Every: 1000, Interval: time.Second, pending: make(map[uint64]Checkpoint)}
+	if start != nil {
+		t.cp = *start
+		t.savedSeq = start.Seq
+	}
+	return t
+}
+
+// Ack records that batch seq was acknowledged, and that it ends at offset
+// and nquads of file. It returns the error of saving the checkpoint, if any.
+func (t *Tracker) Ack(seq uint64, file string, offset, nquads int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if seq <= t.cp.Seq {
+		return nil
+	}
+	t.pending[seq] = Checkpoint{File: file, Offset: offset, NQuads: nquads, Seq: seq}
+	moved := false
+	for {
+		next, ok := t.pending[t.cp.Seq+1]
+		if !ok {
+			break
+		}
+		delete(t.pending, next.Seq)
+		t.cp = next
+		moved = true
+	}
+	if !moved || (t.cp.Seq-t.savedSeq < t.Every && time.Since(t.savedAt) < t.Interval) {
+		return nil
+	}
+	return t.save()
+}
+
+// Flush saves the last checkpoint, if it moved since it was last saved.
+func (t *Tracker) Flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cp.Seq == t.savedSeq {
+		return nil
+	}
+	return t.save()
+}
+
+func (t *Tracker) save() error {
+	t.cp.Updated = time.Now()
+	if err := t.cp.Save(t.path); err != nil {
+		return err
+	}
+	t.savedSeq, t.savedAt = t.cp.Seq, t.cp.Updated
+	return nil
+}
+
+// Checkpoint returns the last checkpoint.
+func (t *Tracker) Checkpoint() Checkpoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cp
+}
+
+// Pending returns the number of batches acknowledged after a batch that
+// wasn't yet.
+func (t *Tracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
@@ -0,0 +1,119 @@
+package checkpoint
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+func TestTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "load.checkpoint")
+	tr := NewTracker(path, nil)
+
+	// Nothing is saved until the first batch is acknowledged.
+	require.NoError(t, tr.Ack(2, "a.rdf", 20, 2))
+	require.NoError(t, tr.Ack(3, "a.rdf", 30, 3))
+	require.Equal(t, 2, tr.Pending())
+	_, err := Load(path)
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, tr.Ack(1, "a.rdf", 10, 1))
+	require.Equal(t, 0, tr.Pending())
+	cp, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), cp.Seq)
+	require.Equal(t, int64(30), cp.Offset)
+	require.Equal(t, "a.rdf", cp.File)
+
+	// A gap holds the checkpoint back.
+	require.NoError(t, tr.Ack(5, "b.rdf", 10, 1))
+	cp, err = Load(path)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), cp.Seq)
+
+	// Resuming skips what was acknowledged.
+	tr = NewTracker(path, cp)
+	require.NoError(t, tr.Ack(3, "a.rdf", 0, 0))
+	require.NoError(t, tr.Ack(4, "b.rdf", 5, 1))
+	require.Equal(t, uint64(4), tr.Checkpoint().Seq)
+	require.Equal(t, "b.rdf", tr.Checkpoint().File)
+
+	files, err := cp.Files([]string{"a.rdf", "b.rdf"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.rdf", "b.rdf"}, files)
+	last := tr.Checkpoint()
+	files, err = last.Files([]string{"a.rdf", "b.rdf"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"b.rdf"}, files)
+	_, err = cp.Files([]string{"c.rdf"})
+	require.Error(t, err)
+}
+
+func TestThrottle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "load.checkpoint")
+	tr := NewTracker(path, nil)
+	tr.Every, tr.Interval = 3, time.Hour
+	saved := func() uint64 {
+		cp, err := Load(path)
+		require.NoError(t, err)
+		return cp.Seq
+	}
+
+	// The first checkpoint is saved, and then one every 3 batches.
+	for seq := uint64(1); seq <= 5; seq++ {
+		require.NoError(t, tr.Ack(seq, "a.rdf", int64(10*seq), int64(seq)))
+	}
+	require.Equal(t, uint64(4), saved())
+	require.Equal(t, uint64(5), tr.Checkpoint().Seq)
+	require.NoError(t, tr.Flush())
+	require.Equal(t, uint64(5), saved())
+
+	// Or once the interval passed.
+	tr.Interval = 0
+	require.NoError(t, tr.Ack(6, "a.rdf", 60, 6))
+	require.Equal(t, uint64(6), saved())
+
+	// Flush doesn't save a checkpoint that didn't move.
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, tr.Flush())
+	_, err := Load(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestSkip(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"data.rdf":  "<a> <name> \"A\" .\n# comment\n<b> <name> \"B\" .\n<c> <name> \"C\" .\n",
+		"data.json": `[{"uid": "a", "name": "A"}, {"uid": "b", "name": "B"}, {"uid": "c", "name": "C"}]`,
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+
+		// Read two N-Quads and checkpoint.
+		r, err := nquad.Open(path)
+		require.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			_, err := r.Next()
+			require.NoError(t, err)
+		}
+		cp := &Checkpoint{File: path, Offset: r.Offset(), NQuads: 2}
+		r.Close()
+
+		r, err = nquad.Open(path)
+		require.NoError(t, err)
+		require.NoError(t, cp.Skip(r), name)
+		nq, err := r.Next()
+		require.NoError(t, err)
+		require.Equal(t, "c", nq.Subject, name)
+		_, err = r.Next()
+		require.Equal(t, io.EOF, err)
+		r.Close()
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Config says what to derive from the input: predicates copied as they are,
+// and rules replacing paths with edges.
+type Config struct {
+	Copy  []string `json:"copy"`
+	Rules []*Rule  `json:"rules"`
+}
+
+// Rule replaces every path matching Pattern with the edge of Emit. A
+// pattern is a chain of variables joined by hops, each -pred-> for an edge
+// from left to right or <-pred- for one from right to left:
+//
+//	A -actor.film-> B -performance.film-> C
+//
+// Emit is an edge between the first and the last variable, in either
+// direction, e.g. A -acted_in-> C. Facets maps facet names to a scalar
+// predicate of an inner variable, as Var.pred: the value of the predicate on
+// the node the path goes through becomes a facet of the new edge.
+//
+// Every path gives an edge, so ends joined by more than one path get the
+// edge more than once. Dgraph keeps one of them.
+type Rule struct {
+	Pattern string            `json:"pattern"`
+	Emit    string            `json:"emit"`
+	Facets  map[string]string `json:"facets,omitempty"`
+
+	vars []string
+	hops []hop
+	// pred is the predicate of the new edge, and reverse is set when it
+	// goes from the last variable to the first.
+	pred    string
+	reverse bool
+	// facets lists the facets by the index of their variable.
+	facets map[int][]facetSource
+}
+
+// hop is the edge between variables i-1 and i of a pattern.
+type hop struct {
+	pred string
+	// reverse is set for <-pred-, where the triple's subject is variable i.
+	reverse bool
+}
+
+// facetSource is a facet of the new edge and the predicate it comes from.
+type facetSource struct {
+	name string
+	pred string
+}
+
+// defaultConfig is the projection of 21million.rdf.gz this tool always
+// made: actors get acted_in edges to their films, and films actors edges to
+// their actors, skipping the performance nodes in between.
+const defaultConfig = `{
+  "copy": ["name"],
+  "rules": [
+    {"pattern": "A -actor.film-> B -performance.film-> C", "emit": "A -acted_in-> C"},
+    {"pattern": "A -starring-> B -performance.actor-> C", "emit": "A -actors-> C"}
+  ]
+}`
+
+// parseArrow parses -pred-> or <-pred-.
+func parseArrow(s string) (hop, bool) {
+	switch {
+	case strings.HasPrefix(s, "<-") && strings.HasSuffix(s, "-") && len(s) > 3:
+		return hop{pred: s[2 : len(s)-1], reverse: true}, true
+	case strings.HasPrefix(s, "-") && strings.HasSuffix(s, "->") && len(s) > 3:
+		return hop{pred: s[1 : len(s)-2]}, true
+	}
+	return hop{}, false
+}
+
+func isVar(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePath parses a chain of variables and hops.
+func parsePath(s string) ([]string, []hop, error) {
+	f := strings.Fields(s)
+	if len(f) < 3 || len(f)%2 == 0 {
+		return nil, nil, fmt.Errorf("%q: expected Var -pred-> Var ...", s)
+	}
+	var vars []string
+	var hops []hop
+	for i, tok := range f {
+		if i%2 == 0 {
+			if !isVar(tok) {
+				return nil, nil, fmt.Errorf("%q: bad variable %q", s, tok)
+			}
+			vars = append(vars, tok)
+			continue
+		}
+		h, ok := parseArrow(tok)
+		if !ok {
+			return nil, nil, fmt.Errorf("%q: expected -pred-> or <-pred-, got %q", s, tok)
+		}
+		hops = append(hops, h)
+	}
+	return vars, hops, nil
+}
+
+// compile parses the pattern, emit and facets of r.
+func (r *Rule) compile() error {
+	var err error
+	if r.vars, r.hops, err = parsePath(r.Pattern); err != nil {
+		return err
+	}
+	seen := make(map[string]int)
+	for i, v := range r.vars {
+		if _, ok := seen[v]; ok {
+			return fmt.Errorf("%q: variable %s is used twice", r.Pattern, v)
+		}
+		seen[v] = i
+	}
+	ev, eh, err := parsePath(r.Emit)
+	if err != nil {
+		return err
+	}
+	first, last := r.vars[0], r.vars[len(r.vars)-1]
+	switch {
+	case len(eh) != 1:
+		return fmt.Errorf("%q: emit a single edge", r.Emit)
+	case ev[0] == first && ev[1] == last:
+		r.reverse = eh[0].reverse
+	case ev[0] == last && ev[1] == first:
+		r.reverse = !eh[0].reverse
+	default:
+		return fmt.Errorf("%q: emit an edge between %s and %s", r.Emit, first, last)
+	}
+	r.pred = eh[0].pred
+
+	r.facets = make(map[int][]facetSource)
+	for name, src := range r.Facets {
+		i := strings.Index(src, ".")
+		if i < 0 {
+			return fmt.Errorf("facet %s: expected Var.pred, got %q", name, src)
+		}
+		v, ok := seen[src[:i]]
+		if !ok || v == 0 || v == len(r.vars)-1 {
+			return fmt.Errorf("facet %s: %s is not an inner variable of %q", name, src[:i], r.Pattern)
+		}
+		r.facets[v] = append(r.facets[v], facetSource{name: name, pred: src[i+1:]})
+	}
+	return nil
+}
+
+// ParseConfig parses and checks a configuration.
+func ParseConfig(b []byte) (*Config, error) {
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if len(c.Rules) == 0 && len(c.Copy) == 0 {
+		return nil, fmt.Errorf("no rules and nothing to copy")
+	}
+	for _, r := range c.Rules {
+		if err := r.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// ReadConfig reads a configuration file.
+func ReadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseConfig(b)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing %s: %v", path, err)
+	}
+	return c, nil
+}
@@ -1,130 +1,144 @@
+// This tool derives a graph from an RDF or JSON data set, plain or gzipped,
+// by projecting paths onto new edges, e.g. to get denser benchmark graphs
+// out of 21million.rdf.gz. The projection is given by a JSON config:
+//
+//	{
+//	  "copy": ["name"],
+//	  "rules": [
+//	    {"pattern": "A -actor.film-> B -performance.film-> C", "emit": "A -acted_in-> C"},
+//	    {"pattern": "A -director.film-> F <-director.film- B", "emit": "A -worked_with-> B"},
+//	    {"pattern": "A -starring-> B -performance.actor-> C", "emit": "C -acted_in-> A",
+//	     "facets": {"character": "B.performance.character_note"}}
+//	  ]
+//	}
+//
+// copy lists predicates written as they are. Each rule replaces the paths
+// matching its pattern with an edge between their ends, with facets taken
+// from the values of the nodes in between. Without -config, name is copied
+// and the rules are the first above and
+// "A -starring-> B -performance.actor-> C" emitting "A -actors-> C", the
+// films of each actor and the actors of each film.
+//
+//	go run . -input ../data/21million.rdf.gz -output out.rdf.gz
+//	go run . -config denser.json -spill /tmp -input ../data/21million.rdf.gz
+//
+// The input is read once. Rules of more than one hop are joined after it,
+// in memory, or with -spill through partition files on disk, a partition
+// at a time, for inputs whose paths don't fit in memory.
 package main
 
 import (
 	"bufio"
 	"compress/gzip"
 	"flag"
-	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
-	"sync"
+	"strings"
 
-	"github.com/dgraph-io/dgraph/protos"
-	"github.com/dgraph-io/dgraph/rdf"
-	"github.com/dgraph-io/dgraph/x"
+	"github.com/dgraph-io/benchmarks/nquad"
 )
 
 var (
-	input  = flag.String("input", "", "Input .gz file")
-	output = flag.String("output", "out.rdf.gz", "Output .gz file")
+	input      = flag.String("input", "", "Input RDF or JSON file, plain or gzipped.")
+	output     = flag.String("output", "out.rdf.gz", "Output RDF file, gzipped if it ends in .gz.")
+	config     = flag.String("config", "", "JSON config of the projection. The default derives acted_in and actors from 21million.")
+	spill      = flag.String("spill", "", "Directory to spill the paths being joined to, instead of keeping them in memory.")
+	partitions = flag.Int("partitions", 64, "Number of partition files per join with -spill.")
 )
 
-func isRequired(nq protos.NQuad) bool {
-	switch nq.Predicate {
-	case "actor.film", "performance.film", "starring", "performance.actor":
-		return true
-	default:
-		return false
+// project reads the files through a projector made from cfg and writes the
+// result to w.
+func project(cfg *Config, files []string, w io.Writer, spillDir string, parts int) (*Projector, error) {
+	bw := bufio.NewWriterSize(w, 1<<20)
+	out := func(nq nquad.NQuad) error {
+		bw.WriteString(nq.String())
+		return bw.WriteByte('\n')
 	}
-	return false
-}
-
-func main() {
-	flag.Parse()
-	o, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE, 0755)
-	x.Check(err)
-	w := gzip.NewWriter(o)
-	m := &sync.Mutex{}
-
-	readFile := func(ch chan protos.NQuad) {
-		f, err := os.Open(*input)
-		x.Check(err)
-		r, err := gzip.NewReader(f)
-		x.Check(err)
-		defer r.Close()
-		defer f.Close()
-
-		bufreader := bufio.NewReader(r)
-		nline := 0
-		log.Println("Starting conversion")
+	p, err := NewProjector(cfg, out, spillDir, parts)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+	for _, path := range files {
+		r, err := nquad.Open(path)
+		if err != nil {
+			return nil, err
+		}
 		for {
-			line, err := bufreader.ReadString('\n')
-			if err != nil && err == io.EOF {
+			nq, err := r.Next()
+			if err == io.EOF {
 				break
 			}
-			nline++
-			if nline%1000000 == 0 {
-				log.Printf("Finished %v lines\n", nline)
+			if err == nil {
+				err = p.Add(nq)
 			}
-			nq, err := rdf.Parse(line)
-			x.Check(err)
-			if nq.Predicate == "name" {
-				m.Lock()
-				w.Write([]byte(line))
-				m.Unlock()
+			if err != nil {
+				r.Close()
+				return nil, err
 			}
-			if !isRequired(nq) {
-				continue
+			if r.Line()%1000000 == 0 {
+				log.Printf("Finished %v lines\n", r.Line())
 			}
-			ch <- nq
 		}
-		close(ch)
+		r.Close()
 	}
-
-	ch := make(chan protos.NQuad, 100000)
-	go readFile(ch)
-
-	actormp := make(map[string]string)
-	starringmp := make(map[string]string)
-	r1 := make(map[string]string)
-	r2 := make(map[string]string)
-	for nq := range ch {
-		if nq.Predicate == "actor.film" {
-			actormp[nq.ObjectId] = nq.Subject
-		} else if nq.Predicate == "starring" {
-			starringmp[nq.ObjectId] = nq.Subject
-		} else if nq.Predicate == "performance.film" {
-			if d, ok := actormp[nq.Subject]; ok {
-				writeOut(m, w, d, "acted_in", nq.ObjectId)
-				continue
-			}
-			r1[nq.Subject] = nq.ObjectId
-		} else if nq.Predicate == "performance.actor" {
-			if d, ok := starringmp[nq.Subject]; ok {
-				writeOut(m, w, d, "actors", nq.ObjectId)
-				continue
-			}
-			r2[nq.Subject] = nq.ObjectId
-		}
-		nq.String()
+	if err := p.Finish(); err != nil {
+		return nil, err
 	}
+	return p, bw.Flush()
+}
 
-	for k, v := range r1 {
-		if d, ok := actormp[k]; ok {
-			writeOut(m, w, d, "acted_in", v)
-		}
+func main() {
+	flag.Parse()
+	files := flag.Args()
+	if *input != "" {
+		files = append([]string{*input}, files...)
+	}
+	if len(files) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var cfg *Config
+	var err error
+	if *config == "" {
+		cfg, err = ParseConfig([]byte(defaultConfig))
+	} else {
+		cfg, err = ReadConfig(*config)
 	}
-	for k, v := range r2 {
-		if d, ok := starringmp[k]; ok {
-			writeOut(m, w, d, "actors", v)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dir := ""
+	if *spill != "" {
+		if dir, err = ioutil.TempDir(*spill, "convert"); err != nil {
+			log.Fatal(err)
 		}
+		defer os.RemoveAll(dir)
 	}
-	x.Check(w.Flush())
-	x.Check(w.Close())
-	x.Check(o.Close())
-}
-
-func writeVal(m *sync.Mutex, w *gzip.Writer, s, p, o string) {
-	str := fmt.Sprintf("<%v> <%v> \"%v\" .\n", s, p, o)
-	m.Lock()
-	defer m.Unlock()
-	w.Write([]byte(str))
-}
 
-func writeOut(m *sync.Mutex, w *gzip.Writer, s, p, o string) {
-	str := fmt.Sprintf("<%v> <%v> <%v> .\n", s, p, o)
-	m.Lock()
-	defer m.Unlock()
-	w.Write([]byte(str))
+	o, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var w io.WriteCloser = o
+	if strings.HasSuffix(*output, ".gz") {
+		w = gzip.NewWriter(o)
+	}
+	log.Println("Starting conversion")
+	p, err := project(cfg, files, w, dir, *partitions)
+	if err == nil && w != o {
+		err = w.Close()
+	}
+	if err == nil {
+		err = o.Close()
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		log.Fatal(err)
+	}
+	for i, r := range cfg.Rules {
+		log.Printf("%s => %s: %d edges", r.Pattern, r.Emit, p.Emitted[i])
+	}
 }
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	farm "github.com/dgryski/go-farm"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// record is an intermediate result, joined with others on key. For edges a
+// is the other end, for partial paths a is their first node and b their
+// facets so far, and for facet values a is the facet name and b the value.
+type record struct {
+	key, a, b string
+}
+
+// bucket holds records, split into partitions by the hash of their key so
+// that a partition of one bucket only joins with the same partition of the
+// others.
+type bucket interface {
+	add(r record) error
+	// partition returns the records of partition p. It is called once all
+	// records were added.
+	partition(p int) ([]record, error)
+	close() error
+}
+
+// memBucket keeps its records in memory, in a single partition.
+type memBucket struct {
+	recs []record
+}
+
+func (b *memBucket) add(r record) error {
+	b.recs = append(b.recs, r)
+	return nil
+}
+
+func (b *memBucket) partition(p int) ([]record, error) {
+	return b.recs, nil
+}
+
+func (b *memBucket) close() error {
+	b.recs = nil
+	return nil
+}
+
+// spillBucket writes its records to a file per partition.
+type spillBucket struct {
+	files []*os.File
+	bufs  []*bufio.Writer
+	tmp   [binary.MaxVarintLen64]byte
+}
+
+func newSpillBucket(dir string, parts int) (*spillBucket, error) {
+	b := &spillBucket{}
+	for i := 0; i < parts; i++ {
+		f, err := ioutil.TempFile(dir, "convert-*.spill")
+		if err != nil {
+			b.close()
+			return nil, err
+		}
+		b.files = append(b.files, f)
+		b.bufs = append(b.bufs, bufio.NewWriterSize(f, 64<<10))
+	}
+	return b, nil
+}
+
+func (b *spillBucket) add(r record) error {
+	w := b.bufs[farm.Fingerprint64([]byte(r.key))%uint64(len(b.files))]
+	for _, s := range []string{r.key, r.a, r.b} {
+		n := binary.PutUvarint(b.tmp[:], uint64(len(s)))
+		w.Write(b.tmp[:n])
+		if _, err := w.WriteString(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *spillBucket) partition(p int) ([]record, error) {
+	if err := b.bufs[p].Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := b.files[p].Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(b.files[p], 64<<10)
+	var out []record
+	var fields [3]string
+	for {
+		for i := range fields {
+			n, err := binary.ReadUvarint(br)
+			if err == io.EOF && i == 0 {
+				return out, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("while reading %s: %v", b.files[p].Name(), err)
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(br, buf); err != nil {
+				return nil, fmt.Errorf("while reading %s: %v", b.files[p].Name(), err)
+			}
+			fields[i] = string(buf)
+		}
+		out = append(out, record{fields[0], fields[1], fields[2]})
+	}
+}
+
+func (b *spillBucket) close() error {
+	var first error
+	for _, f := range b.files {
+		f.Close()
+		if err := os.Remove(f.Name()); err != nil && first == nil {
+			first = err
+		}
+	}
+	b.files, b.bufs = nil, nil
+	return first
+}
+
+// Projector applies a Config to a stream of N-Quads. Copied predicates and
+// rules with a single hop are written as the N-Quads are added; the others
+// are joined by Finish, a hop at a time. Without a spill directory the
+// intermediate records are kept in memory; with one they are written to
+// partition files, and each join reads back a partition at a time.
+type Projector struct {
+	cfg   *Config
+	copy  map[string]bool
+	out   func(nquad.NQuad) error
+	spill string
+	parts int
+
+	// Emitted counts the edges written by each rule.
+	Emitted []int
+
+	// edges[r][i] holds the edges of hop i of rule r, keyed by the node
+	// they join on, and vals[r][i] the facet values of variable i.
+	edges [][]bucket
+	vals  [][]bucket
+	// facetPreds maps predicates to the facets they are a source of.
+	facetPreds map[string][]facetRef
+	// hopPreds maps predicates to the hops they match.
+	hopPreds map[string][]hopRef
+}
+
+type hopRef struct{ rule, hop int }
+
+type facetRef struct {
+	rule, v int
+	name    string
+}
+
+// NewProjector returns a projector writing to out. With spill set, records
+// are spilled to parts partition files in that directory.
+func NewProjector(cfg *Config, out func(nquad.NQuad) error, spill string, parts int) (*Projector, error) {
+	if parts < 1 {
+		parts = 1
+	}
+	p := &Projector{
+		cfg:        cfg,
+		copy:       make(map[string]bool),
+		out:        out,
+		spill:      spill,
+		parts:      parts,
+		Emitted:    make([]int, len(cfg.Rules)),
+		edges:      make([][]bucket, len(cfg.Rules)),
+		vals:       make([][]bucket, len(cfg.Rules)),
+		facetPreds: make(map[string][]facetRef),
+		hopPreds:   make(map[string][]hopRef),
+	}
+	if spill == "" {
+		p.parts = 1
+	}
+	for _, pred := range cfg.Copy {
+		p.copy[pred] = true
+	}
+	for ri, r := range cfg.Rules {
+		for hi, h := range r.hops {
+			p.hopPreds[h.pred] = append(p.hopPreds[h.pred], hopRef{ri, hi})
+		}
+		for v, fs := range r.facets {
+			for _, f := range fs {
+				p.facetPreds[f.pred] = append(p.facetPreds[f.pred], facetRef{ri, v, f.name})
+			}
+		}
+		if len(r.hops) == 1 {
+			continue
+		}
+		p.edges[ri] = make([]bucket, len(r.hops))
+		p.vals[ri] = make([]bucket, len(r.vars))
+		for i := range r.hops {
+			b, err := p.newBucket()
+			if err != nil {
+				p.Close()
+				return nil, err
+			}
+			p.edges[ri][i] = b
+		}
+		for v := range r.facets {
+			b, err := p.newBucket()
+			if err != nil {
+				p.Close()
+				return nil, err
+			}
+			p.vals[ri][v] = b
+		}
+	}
+	return p, nil
+}
+
+func (p *Projector) newBucket() (bucket, error) {
+	if p.spill == "" {
+		return &memBucket{}, nil
+	}
+	return newSpillBucket(p.spill, p.parts)
+}
+
+// facetValue formats a value as a facet: quoted unless it is a number, a
+// bool or a date.
+func facetValue(nq nquad.NQuad) string {
+	switch strings.TrimPrefix(nq.Datatype, "xs:") {
+	case "int", "float", "double", "boolean", "dateTime":
+		return nq.ObjectValue
+	}
+	return nquad.Quote(nq.ObjectValue)
+}
+
+// emit writes the new edge of rule r from the first node of a path to the
+// last, with the facets encoded in facets.
+func (p *Projector) emit(r int, first, last, facets string) error {
+	rule := p.cfg.Rules[r]
+	nq := nquad.NQuad{Subject: first, Predicate: rule.pred, ObjectId: last, Facets: decodeFacets(facets)}
+	if rule.reverse {
+		nq.Subject, nq.ObjectId = last, first
+	}
+	p.Emitted[r]++
+	return p.out(nq)
+}
+
+// Add applies the configuration to an N-Quad.
+func (p *Projector) Add(nq nquad.NQuad) error {
+	if p.copy[nq.Predicate] {
+		if err := p.out(nq); err != nil {
+			return err
+		}
+	}
+	if !nq.IsEdge() {
+		for _, f := range p.facetPreds[nq.Predicate] {
+			err := p.vals[f.rule][f.v].add(record{key: nq.Subject, a: f.name, b: facetValue(nq)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, h := range p.hopPreds[nq.Predicate] {
+		rule := p.cfg.Rules[h.rule]
+		left, right := nq.Subject, nq.ObjectId
+		if rule.hops[h.hop].reverse {
+			left, right = right, left
+		}
+		var err error
+		switch {
+		case len(rule.hops) == 1:
+			err = p.emit(h.rule, left, right, "")
+		case h.hop == 0:
+			// The first hop joins the second on its right end.
+			err = p.edges[h.rule][0].add(record{key: right, a: left})
+		default:
+			err = p.edges[h.rule][h.hop].add(record{key: left, a: right})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeFacets reads the facets of a partial path, kept as name=value
+// lines.
+func decodeFacets(s string) []nquad.Facet {
+	var out []nquad.Facet
+	for _, line := range strings.Split(s, "\n") {
+		if i := strings.Index(line, "="); i > 0 {
+			out = append(out, nquad.Facet{Key: line[:i], Value: line[i+1:]})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// Finish joins the hops of the rules with more than one and writes their
+// edges.
+func (p *Projector) Finish() error {
+	for r, rule := range p.cfg.Rules {
+		if len(rule.hops) < 2 {
+			continue
+		}
+		paths := p.edges[r][0]
+		for i := 1; i < len(rule.hops); i++ {
+			var next bucket
+			if i < len(rule.hops)-1 {
+				var err error
+				if next, err = p.newBucket(); err != nil {
+					return err
+				}
+			}
+			err := p.join(r, i, paths, next)
+			paths.close()
+			if err != nil {
+				if next != nil {
+					next.close()
+				}
+				return err
+			}
+			paths = next
+		}
+	}
+	return nil
+}
+
+// join extends the paths ending in variable i of rule r, keyed by their
+// last node, with hop i, adding the facets of variable i. The longer paths
+// go to next, keyed by their new last node, or are emitted after the last
+// hop.
+func (p *Projector) join(r, i int, paths, next bucket) error {
+	edges, vals := p.edges[r][i], p.vals[r][i]
+	for part := 0; part < p.parts; part++ {
+		recs, err := edges.partition(part)
+		if err != nil {
+			return err
+		}
+		out := make(map[string][]string)
+		for _, e := range recs {
+			out[e.key] = append(out[e.key], e.a)
+		}
+		// The facets of each node, the first value of each.
+		facets := make(map[string]string)
+		if vals != nil {
+			recs, err := vals.partition(part)
+			if err != nil {
+				return err
+			}
+			seen := make(map[string]bool)
+			for _, v := range recs {
+				if k := v.key + "\x00" + v.a; !seen[k] {
+					seen[k] = true
+					facets[v.key] += v.a + "=" + v.b + "\n"
+				}
+			}
+		}
+		recs, err = paths.partition(part)
+		if err != nil {
+			return err
+		}
+		for _, path := range recs {
+			for _, to := range out[path.key] {
+				fs := path.b + facets[path.key]
+				if next == nil {
+					err = p.emit(r, path.a, to, fs)
+				} else {
+					err = next.add(record{key: to, a: path.a, b: fs})
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Close removes the spill files.
+func (p *Projector) Close() error {
+	var first error
+	for r := range p.edges {
+		for _, bs := range [][]bucket{p.edges[r], p.vals[r]} {
+			for _, b := range bs {
+				if b == nil {
+					continue
+				}
+				if err := b.close(); err != nil && first == nil {
+					first = err
+				}
+			}
+		}
+	}
+	return first
+}
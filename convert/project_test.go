@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const films = `<f1> <name> "Blade Runner" .
+<f1> <starring> <p1> .
+<f1> <starring> <p2> .
+<p1> <performance.actor> <a1> .
+<p1> <performance.film> <f1> .
+<p1> <performance.character_note> "replicant" .
+<p2> <performance.actor> <a2> .
+<p2> <performance.film> <f1> .
+<a1> <name> "Rutger Hauer" .
+<a1> <actor.film> <p1> .
+<a2> <actor.film> <p2> .
+<d1> <director.film> <f1> .
+<d1> <director.film> <f2> .
+<f2> <starring> <p3> .
+<p3> <performance.actor> <a1> .
+`
+
+func runProjection(t *testing.T, config, spill string) []string {
+	cfg, err := ParseConfig([]byte(config))
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "films.rdf")
+	require.NoError(t, ioutil.WriteFile(path, []byte(films), 0644))
+	var buf bytes.Buffer
+	_, err = project(cfg, []string{path}, &buf, spill, 4)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestDefaultConfig(t *testing.T) {
+	require.Equal(t, []string{
+		`<a1> <acted_in> <f1> .`,
+		`<a1> <name> "Rutger Hauer" .`,
+		`<a2> <acted_in> <f1> .`,
+		`<f1> <actors> <a1> .`,
+		`<f1> <actors> <a2> .`,
+		`<f1> <name> "Blade Runner" .`,
+		`<f2> <actors> <a1> .`,
+	}, runProjection(t, defaultConfig, ""))
+}
+
+func TestRules(t *testing.T) {
+	config := `{"rules": [
+	{"pattern": "A -starring-> B -performance.actor-> C", "emit": "C -played_in-> A",
+	 "facets": {"note": "B.performance.character_note"}},
+	{"pattern": "D -director.film-> F -starring-> P -performance.actor-> A", "emit": "A <-directed_actor- D"},
+	{"pattern": "A -actor.film-> P <-starring- F", "emit": "A -in-> F"},
+	{"pattern": "F <-director.film- D", "emit": "F -directed_by-> D"}
+]}`
+	want := []string{
+		`<a1> <in> <f1> .`,
+		`<a1> <played_in> <f1> (note="replicant") .`,
+		`<a1> <played_in> <f2> .`,
+		`<a2> <in> <f1> .`,
+		`<a2> <played_in> <f1> .`,
+		`<d1> <directed_actor> <a1> .`,
+		`<d1> <directed_actor> <a1> .`,
+		`<d1> <directed_actor> <a2> .`,
+		`<f1> <directed_by> <d1> .`,
+		`<f2> <directed_by> <d1> .`,
+	}
+	require.Equal(t, want, runProjection(t, config, ""))
+	// Spilling to disk gives the same edges.
+	require.Equal(t, want, runProjection(t, config, t.TempDir()))
+}
+
+func TestParseConfig(t *testing.T) {
+	for _, c := range []string{
+		`{}`,
+		`{"rules": [{"pattern": "A -p-> B", "emit": "A -q-> C"}]}`,
+		`{"rules": [{"pattern": "A -p-> A", "emit": "A -q-> A"}]}`,
+		`{"rules": [{"pattern": "A p B", "emit": "A -q-> B"}]}`,
+		`{"rules": [{"pattern": "A -p-> B -r-> C", "emit": "A -q-> B"}]}`,
+		`{"rules": [{"pattern": "A -p-> B -r-> C", "emit": "A -q-> C", "facets": {"f": "A.name"}}]}`,
+		`{"rules": [{"pattern": "A -p-> B -r-> C", "emit": "A -q-> C", "facets": {"f": "name"}}]}`,
+	} {
+		_, err := ParseConfig([]byte(c))
+		require.Error(t, err, c)
+	}
+}
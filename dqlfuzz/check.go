@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/dgraph-io/benchmarks/dqlref"
+)
+
+// Outcomes of comparing the server with the reference.
+const (
+	agree       = "agree"
+	mismatch    = "mismatch"
+	serverError = "server error"
+)
+
+// Result is the outcome of one query.
+type Result struct {
+	Outcome string
+	// Want is the reference answer and Got the server's, both canonical.
+	Want, Got interface{}
+	// Err is the server error.
+	Err error
+}
+
+// Checker runs queries against a server and the reference.
+type Checker struct {
+	Ref *dqlref.Evaluator
+	// Server returns the data of a server response.
+	Server func(query string) (map[string]interface{}, error)
+}
+
+// Check runs a query on both sides. It fails if the reference can't evaluate
+// the query, which then isn't worth sending.
+func (c *Checker) Check(blocks []*dqlref.Block) (Result, error) {
+	want, err := c.Ref.Eval(blocks)
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{Want: canonical(want, blocks)}
+	got, err := c.Server(dqlref.Format(blocks))
+	if err != nil {
+		res.Outcome, res.Err = serverError, err
+		return res, nil
+	}
+	res.Got = canonical(got, blocks)
+	res.Outcome = mismatch
+	if reflect.DeepEqual(res.Want, res.Got) {
+		res.Outcome = agree
+	}
+	return res, nil
+}
+
+// canonical sorts the lists of blocks that have no order, since the server
+// returns them in the order of its uids and the reference in the order of
+// the fingerprints. It also decodes numbers the same way on both sides.
+func canonical(data map[string]interface{}, blocks []*dqlref.Block) interface{} {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return data
+	}
+	for _, blk := range blocks {
+		if l, ok := v[blk.Key()].([]interface{}); ok {
+			v[blk.Key()] = canonicalList(l, blk)
+		}
+	}
+	// A block with no results may be missing or empty.
+	for k, l := range v {
+		if l, ok := l.([]interface{}); ok && len(l) == 0 {
+			delete(v, k)
+		}
+	}
+	return v
+}
+
+func canonicalList(l []interface{}, b *dqlref.Block) []interface{} {
+	for _, item := range l {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, f := range b.Fields {
+			if sub, ok := obj[f.Key()].([]interface{}); ok && f.IsBlock {
+				obj[f.Key()] = canonicalList(sub, f)
+			}
+		}
+	}
+	if b.Order != "" {
+		return orderedList(l, b)
+	}
+	return sortList(l)
+}
+
+func sortList(l []interface{}) []interface{} {
+	keys := make([]string, len(l))
+	for i, item := range l {
+		js, _ := json.Marshal(item)
+		keys[i] = string(js)
+	}
+	sort.Sort(byKey{l, keys})
+	return l
+}
+
+// orderedList compares an ordered list by its order key. The server breaks
+// ties in the order of its uids and the reference in the order of the
+// fingerprints, so items with equal keys are sorted, and where a page cuts a
+// run of them, each side may have kept different items of the run, so only
+// their keys are kept. Without the key in the items, only the items of a
+// whole list can be compared, and only the length of a page.
+func orderedList(l []interface{}, b *dqlref.Block) []interface{} {
+	hasKey := false
+	for _, f := range b.Fields {
+		hasKey = hasKey || (!f.IsBlock && f.Key() == b.Order)
+	}
+	paged := b.First != 0 || b.Offset != 0
+	if !hasKey {
+		if paged {
+			return []interface{}{len(l)}
+		}
+		return sortList(l)
+	}
+	keys := make([]string, len(l))
+	for i, item := range l {
+		obj, _ := item.(map[string]interface{})
+		js, _ := json.Marshal(obj[b.Order])
+		keys[i] = string(js)
+	}
+	cutStart := b.Offset > 0 || b.First < 0
+	cutEnd := b.First > 0
+	out := make([]interface{}, 0, len(l))
+	for i := 0; i < len(l); {
+		j := i + 1
+		for j < len(l) && keys[j] == keys[i] {
+			j++
+		}
+		if (i == 0 && cutStart) || (j == len(l) && cutEnd) {
+			for _, k := range keys[i:j] {
+				out = append(out, k)
+			}
+		} else {
+			out = append(out, sortList(l[i:j])...)
+		}
+		i = j
+	}
+	return out
+}
+
+type byKey struct {
+	l    []interface{}
+	keys []string
+}
+
+func (b byKey) Len() int           { return len(b.l) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.l[i], b.l[j] = b.l[j], b.l[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+// nodes returns the blocks and fields of a query in a fixed order, so that
+// the n-th node of a copy is the copy of the n-th node.
+func nodes(blocks []*dqlref.Block) []*dqlref.Block {
+	var out []*dqlref.Block
+	var walk func(b *dqlref.Block)
+	walk = func(b *dqlref.Block) {
+		out = append(out, b)
+		for _, f := range b.Fields {
+			walk(f)
+		}
+	}
+	for _, b := range blocks {
+		walk(b)
+	}
+	return out
+}
+
+func copyQuery(blocks []*dqlref.Block) []*dqlref.Block {
+	out := make([]*dqlref.Block, len(blocks))
+	for i, b := range blocks {
+		out[i] = b.Copy()
+	}
+	return out
+}
+
+// reductions returns the ways a node can be made simpler. Each changes the
+// node in place and reports whether it did anything.
+var reductions = []func(b *dqlref.Block) bool{
+	func(b *dqlref.Block) bool {
+		ok := b.Filter != nil
+		b.Filter = nil
+		return ok
+	},
+	func(b *dqlref.Block) bool {
+		if b.Filter == nil || b.Filter.Op == "" {
+			return false
+		}
+		b.Filter = b.Filter.Left
+		return true
+	},
+	func(b *dqlref.Block) bool {
+		if b.Filter == nil || b.Filter.Right == nil {
+			return false
+		}
+		b.Filter = b.Filter.Right
+		return true
+	},
+	func(b *dqlref.Block) bool {
+		ok := b.Order != ""
+		b.Order, b.Desc = "", false
+		// Pages only make sense with an order.
+		b.First, b.Offset = 0, 0
+		return ok
+	},
+	func(b *dqlref.Block) bool {
+		ok := b.First != 0
+		b.First = 0
+		return ok
+	},
+	func(b *dqlref.Block) bool {
+		ok := b.Offset != 0
+		b.Offset = 0
+		return ok
+	},
+}
+
+// candidates returns the queries that differ from blocks by one reduction,
+// one field or one root block fewer.
+func candidates(blocks []*dqlref.Block) [][]*dqlref.Block {
+	var out [][]*dqlref.Block
+	for i := range blocks {
+		if len(blocks) > 1 {
+			c := copyQuery(blocks)
+			out = append(out, append(c[:i], c[i+1:]...))
+		}
+	}
+	for n, node := range nodes(blocks) {
+		for _, reduce := range reductions {
+			c := copyQuery(blocks)
+			if reduce(nodes(c)[n]) {
+				out = append(out, c)
+			}
+		}
+		// Keep at least one field, or the block means something else.
+		for i := range node.Fields {
+			if len(node.Fields) == 1 {
+				break
+			}
+			c := copyQuery(blocks)
+			b := nodes(c)[n]
+			b.Fields = append(b.Fields[:i], b.Fields[i+1:]...)
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// varsUsed reports whether every variable is both defined and used, as
+// Dgraph requires. Dropping a block or a field can break either.
+func varsUsed(blocks []*dqlref.Block) bool {
+	defined, used := make(map[string]bool), make(map[string]bool)
+	for _, b := range nodes(blocks) {
+		if b.Var != "" {
+			defined[b.Var] = true
+		}
+		if b.Root != nil && b.Root.Name == "uid" {
+			for _, a := range b.Root.Args {
+				used[a] = true
+			}
+		}
+	}
+	return reflect.DeepEqual(defined, used)
+}
+
+// Minimize makes a query that had res as small as it can while the server
+// keeps giving the same outcome. It tries every candidate, keeps the first
+// that still fails, and starts over from it until none does.
+func (c *Checker) Minimize(blocks []*dqlref.Block, res Result) ([]*dqlref.Block, Result) {
+	last := res
+	for {
+		reduced := false
+		for _, cand := range candidates(blocks) {
+			if !varsUsed(cand) {
+				continue
+			}
+			res, err := c.Check(cand)
+			if err != nil || res.Outcome != last.Outcome {
+				continue
+			}
+			blocks, last, reduced = cand, res, true
+			break
+		}
+		if !reduced {
+			return blocks, last
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/dqlref"
+	"github.com/dgraph-io/benchmarks/dqlschema"
+	"github.com/dgraph-io/benchmarks/memgraph"
+	"github.com/dgraph-io/benchmarks/mockdgraph"
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+const testSchema = `
+name: string @index(hash, term) @lang .
+year: int @index(int) .
+director.film: [uid] @reverse @count .
+genre: [uid] @reverse .
+loc: geo @index(geo) .
+`
+
+func testData(t *testing.T, skip string) (*dqlschema.Schema, *memgraph.Graph) {
+	s, err := dqlschema.Parse(testSchema)
+	require.NoError(t, err)
+	g := memgraph.New()
+	for _, line := range []string{
+		`<d1> <name> "Ridley Scott"@en .`,
+		`<d1> <director.film> <f1> .`,
+		`<d1> <director.film> <f2> .`,
+		`<d1> <director.film> <f3> .`,
+		`<d2> <name> "James Cameron"@en .`,
+		`<d2> <director.film> <f4> .`,
+		`<f1> <name> "Alien"@en .`,
+		`<f1> <name> "Alien"@de .`,
+		`<f2> <name> "Blade Runner"@en .`,
+		`<f3> <name> "Gladiator"@en .`,
+		`<f4> <name> "Aliens"@en .`,
+		`<f1> <year> "1979" .`,
+		`<f2> <year> "1982" .`,
+		`<f3> <year> "2000" .`,
+		`<f4> <year> "1986" .`,
+		`<f2> <genre> <g1> .`,
+		`<f3> <genre> <g1> .`,
+		`<f4> <genre> <g1> .`,
+		`<f1> <genre> <g2> .`,
+		`<g1> <name> "Action"@en .`,
+		`<g2> <name> "Horror Science Fiction"@en .`,
+	} {
+		if line == skip {
+			continue
+		}
+		nq, err := nquad.Parse(line)
+		require.NoError(t, err)
+		g.Add(nq)
+	}
+	return s, g
+}
+
+func TestGenerate(t *testing.T) {
+	s, g := testData(t, "")
+	gen := NewGenerator(s, g, 1)
+	require.True(t, gen.Ready())
+	ref := dqlref.New(g, s.TypeMap())
+
+	funcs := make(map[string]bool)
+	for i := 0; i < 500; i++ {
+		q := gen.Query()
+		text := dqlref.Format(q)
+		parsed, err := dqlref.Parse(text)
+		require.NoError(t, err, text)
+		require.Equal(t, q, parsed, text)
+		require.True(t, varsUsed(q), text)
+		_, err = ref.Eval(q)
+		require.NoError(t, err, text)
+		for _, n := range nodes(q) {
+			if n.Root != nil {
+				funcs[n.Root.Name] = true
+			}
+		}
+		require.NotContains(t, text, "loc", "geo is not supported by the reference")
+	}
+	for _, f := range []string{"eq", "ge", "allofterms", "anyofterms", "has", "uid"} {
+		require.True(t, funcs[f], f)
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	s, g := testData(t, "")
+	// The server lost a name, so queries that read or match it differ.
+	_, lossy := testData(t, `<f3> <name> "Gladiator"@en .`)
+	server := dqlref.New(lossy, s.TypeMap())
+	c := &Checker{
+		Ref:    dqlref.New(g, s.TypeMap()),
+		Server: server.Run,
+	}
+
+	gen := NewGenerator(s, g, 3)
+	var found int
+	for i := 0; i < 200 && found < 5; i++ {
+		q := gen.Query()
+		res, err := c.Check(q)
+		require.NoError(t, err)
+		if res.Outcome == agree {
+			continue
+		}
+		found++
+		require.Equal(t, mismatch, res.Outcome)
+		min, minRes := c.Minimize(q, res)
+		require.Equal(t, mismatch, minRes.Outcome)
+		require.True(t, len(nodes(min)) <= len(nodes(q)))
+
+		// No single reduction of the result still differs.
+		for _, cand := range candidates(min) {
+			if !varsUsed(cand) {
+				continue
+			}
+			res, err := c.Check(cand)
+			if err == nil {
+				require.NotEqual(t, mismatch, res.Outcome, dqlref.Format(cand))
+			}
+		}
+	}
+	require.NotZero(t, found)
+}
+
+func TestCanonical(t *testing.T) {
+	blocks, err := dqlref.Parse(`{
+  q(func: has(name)) { name films: director.film (orderasc: year) { year } }
+}`)
+	require.NoError(t, err)
+	a := map[string]interface{}{"q": []interface{}{
+		map[string]interface{}{"name": "b", "films": []interface{}{
+			map[string]interface{}{"year": 2}, map[string]interface{}{"year": 1}}},
+		map[string]interface{}{"name": "a"},
+	}, "empty": []interface{}{}}
+	b := map[string]interface{}{"q": []interface{}{
+		map[string]interface{}{"name": "a"},
+		map[string]interface{}{"name": "b", "films": []interface{}{
+			map[string]interface{}{"year": 2}, map[string]interface{}{"year": 1}}},
+	}}
+	require.Equal(t, canonical(a, blocks), canonical(b, blocks))
+
+	// The order of the films matters.
+	b["q"].([]interface{})[1].(map[string]interface{})["films"] = []interface{}{
+		map[string]interface{}{"year": 1}, map[string]interface{}{"year": 2}}
+	require.NotEqual(t, canonical(a, blocks), canonical(b, blocks))
+}
+
+func TestCanonicalTies(t *testing.T) {
+	film := func(name string, year int) interface{} {
+		return map[string]interface{}{"name": name, "year": year}
+	}
+	check := func(query string, same bool, a, b []interface{}) {
+		blocks, err := dqlref.Parse(query)
+		require.NoError(t, err)
+		ca := canonical(map[string]interface{}{"q": a}, blocks)
+		cb := canonical(map[string]interface{}{"q": b}, blocks)
+		require.Equal(t, same, reflect.DeepEqual(ca, cb), "%s\n%v\n%v", query, ca, cb)
+	}
+	sorted := `{ q(func: has(year), orderasc: year) { name year } }`
+	// Ties come in uid order on the server and fingerprint order in the
+	// reference.
+	check(sorted, true,
+		[]interface{}{film("a", 1), film("b", 2), film("c", 2), film("d", 3)},
+		[]interface{}{film("a", 1), film("c", 2), film("b", 2), film("d", 3)})
+	check(sorted, false,
+		[]interface{}{film("a", 1), film("b", 2), film("c", 2), film("d", 3)},
+		[]interface{}{film("a", 1), film("c", 2), film("e", 2), film("d", 3)})
+	check(sorted, false,
+		[]interface{}{film("a", 1), film("b", 2)},
+		[]interface{}{film("b", 2), film("a", 1)})
+
+	// A page may cut a run of ties at different items.
+	paged := `{ q(func: has(year), orderasc: year, first: 3, offset: 1) { name year } }`
+	check(paged, true,
+		[]interface{}{film("b", 1), film("d", 2), film("e", 3)},
+		[]interface{}{film("c", 1), film("d", 2), film("f", 3)})
+	check(paged, false,
+		[]interface{}{film("b", 1), film("d", 2), film("e", 3)},
+		[]interface{}{film("b", 1), film("x", 2), film("e", 3)})
+	check(paged, false,
+		[]interface{}{film("b", 1), film("d", 2), film("e", 3)},
+		[]interface{}{film("b", 1), film("d", 2), film("e", 4)})
+
+	// Without the key, a page can only be compared by its length.
+	check(`{ q(func: has(year), orderasc: year, first: 2) { name } }`, true,
+		[]interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}},
+		[]interface{}{map[string]interface{}{"name": "c"}, map[string]interface{}{"name": "b"}})
+}
+
+func TestQuery(t *testing.T) {
+	s := mockdgraph.New(mockdgraph.Config{})
+	s.Start()
+	defer s.Close()
+	*alpha = s.URL + "/query"
+
+	q := "{\n\tq(func: has(name)) {\n\t\tname\n\t}\n}\n"
+	require.NoError(t, s.Respond("/query", q, `{"q": [{"name": "Alien"}]}`))
+	s.Fail("/query", "{ bad }", "line 1: unexpected }")
+
+	data, err := query(q)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"q": []interface{}{map[string]interface{}{"name": "Alien"}}}, data)
+
+	_, err = query("{ bad }")
+	require.EqualError(t, err, "line 1: unexpected }")
+	require.Equal(t, "application/dql", s.Requests()[0].ContentType)
+}
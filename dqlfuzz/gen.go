@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/benchmarks/dqlref"
+	"github.com/dgraph-io/benchmarks/dqlschema"
+	"github.com/dgraph-io/benchmarks/memgraph"
+)
+
+// maxSamples is the number of values kept per predicate to draw arguments
+// from.
+const maxSamples = 1000
+
+// field is a predicate as it is queried: name@en for a language of a @lang
+// predicate, ~name for a reverse edge.
+type field struct {
+	name string
+	p    *dqlschema.Predicate
+}
+
+// Generator makes random queries that are well typed for a schema, with
+// arguments taken from the data so that they match something.
+type Generator struct {
+	rnd *rand.Rand
+	// MaxDepth is the number of edges a query may follow from a root.
+	MaxDepth int
+	// MaxBlocks is the number of root blocks, including var blocks.
+	MaxBlocks int
+
+	scalars []field
+	edges   []field
+	samples map[string][]string
+	vars    int
+}
+
+// NewGenerator returns a generator for the predicates of s that have data in
+// g.
+func NewGenerator(s *dqlschema.Schema, g *memgraph.Graph, seed int64) *Generator {
+	gen := &Generator{
+		rnd:       rand.New(rand.NewSource(seed)),
+		MaxDepth:  2,
+		MaxBlocks: 3,
+		samples:   make(map[string][]string),
+	}
+	for _, name := range s.Names() {
+		p := s.Predicates[name]
+		switch {
+		case p.IsEdge():
+			if len(g.Edges[name]) == 0 {
+				continue
+			}
+			gen.edges = append(gen.edges, field{name, p})
+			if p.Reverse {
+				gen.edges = append(gen.edges, field{"~" + name, p})
+			}
+		case p.Type == "geo" || p.Type == "float32vector":
+			// Their arguments are left to indextest/cases.
+		default:
+			names := []string{name}
+			if p.Lang {
+				names = nil
+				for v := range g.Values {
+					if v == name || strings.HasPrefix(v, name+g.LangSep) {
+						names = append(names, v)
+					}
+				}
+				sort.Strings(names)
+			}
+			for _, n := range names {
+				if vals := sample(g.Values[n]); len(vals) > 0 {
+					gen.samples[n] = vals
+					gen.scalars = append(gen.scalars, field{n, p})
+				}
+			}
+		}
+	}
+	return gen
+}
+
+// sample returns the values of up to maxSamples subjects in m, the same ones
+// on every run.
+func sample(m map[uint64][]string) []string {
+	uids := make([]uint64, 0, len(m))
+	for u := range m {
+		uids = append(uids, u)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	step := len(uids)/maxSamples + 1
+	var out []string
+	for i := 0; i < len(uids); i += step {
+		out = append(out, m[uids[i]]...)
+	}
+	return out
+}
+
+func (gen *Generator) chance(p float64) bool {
+	return gen.rnd.Float64() < p
+}
+
+func (gen *Generator) value(f field) string {
+	vals := gen.samples[f.name]
+	return vals[gen.rnd.Intn(len(vals))]
+}
+
+// terms returns one to three terms of a value of f.
+func (gen *Generator) terms(f field) string {
+	terms := memgraph.Terms(gen.value(f))
+	if len(terms) == 0 {
+		return "the"
+	}
+	gen.rnd.Shuffle(len(terms), func(i, j int) { terms[i], terms[j] = terms[j], terms[i] })
+	if n := 1 + gen.rnd.Intn(3); n < len(terms) {
+		terms = terms[:n]
+	}
+	return strings.Join(terms, " ")
+}
+
+// fn returns a function that the index of f allows, or has.
+func (gen *Generator) fn(f field) *dqlref.Func {
+	var choices []string
+	for _, tok := range f.p.Index {
+		switch tok {
+		case "hash":
+			choices = append(choices, "eq")
+		case "exact", "int", "float", "year", "month", "day", "hour":
+			choices = append(choices, "eq", "lt", "le", "gt", "ge")
+		case "term":
+			choices = append(choices, "allofterms", "anyofterms")
+		}
+	}
+	if len(choices) == 0 || gen.chance(0.1) {
+		return &dqlref.Func{Name: "has", Pred: f.name}
+	}
+	fn := &dqlref.Func{Name: choices[gen.rnd.Intn(len(choices))], Pred: f.name}
+	switch fn.Name {
+	case "allofterms", "anyofterms":
+		fn.Args = []string{gen.terms(f)}
+	default:
+		fn.Args = []string{gen.value(f)}
+	}
+	return fn
+}
+
+// indexed returns the scalars that have an index, which root functions other
+// than has need.
+func (gen *Generator) indexed() []field {
+	var out []field
+	for _, f := range gen.scalars {
+		if len(f.p.Index) > 0 {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// all returns the scalars and the edges, for has.
+func (gen *Generator) all() []field {
+	out := append([]field(nil), gen.scalars...)
+	return append(out, gen.edges...)
+}
+
+func (gen *Generator) pick(fs []field) field {
+	return fs[gen.rnd.Intn(len(fs))]
+}
+
+func (gen *Generator) filter(depth int) *dqlref.Filter {
+	if depth < 2 && gen.chance(0.4) {
+		op := []string{"and", "or", "not"}[gen.rnd.Intn(3)]
+		f := &dqlref.Filter{Op: op, Left: gen.filter(depth + 1)}
+		if op != "not" {
+			f.Right = gen.filter(depth + 1)
+		}
+		return f
+	}
+	fs := gen.indexed()
+	if len(fs) == 0 || gen.chance(0.2) {
+		fs = gen.all()
+	}
+	return &dqlref.Filter{Func: gen.fn(gen.pick(fs))}
+}
+
+// sortable returns the scalars that can be ordered by.
+func (gen *Generator) sortable() []field {
+	var out []field
+	for _, f := range gen.scalars {
+		switch f.p.Type {
+		case "int", "float", "datetime", "date", "string":
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// args adds ordering, pagination and a filter to b, each at random.
+func (gen *Generator) args(b *dqlref.Block) {
+	if fs := gen.sortable(); len(fs) > 0 && gen.chance(0.3) {
+		b.Order = gen.pick(fs).name
+		b.Desc = gen.chance(0.5)
+		// Without an order, the page would depend on how uids were
+		// assigned, which differs between the server and the reference.
+		if gen.chance(0.5) {
+			b.First = 1 + gen.rnd.Intn(10)
+		}
+		if gen.chance(0.3) {
+			b.Offset = gen.rnd.Intn(5)
+		}
+	}
+	if gen.chance(0.3) {
+		b.Filter = gen.filter(0)
+	}
+}
+
+// fields fills b with values, counts and edges to follow.
+func (gen *Generator) fields(b *dqlref.Block, depth int) {
+	n := 1 + gen.rnd.Intn(4)
+	seen := make(map[string]bool)
+	for tries := 0; len(b.Fields) < n && tries < 4*n; tries++ {
+		var f *dqlref.Block
+		switch r := gen.rnd.Float64(); {
+		case r < 0.15:
+			f = &dqlref.Block{Name: "count(uid)"}
+		case r < 0.3 && len(gen.edges) > 0:
+			f = &dqlref.Block{Name: "count(" + gen.pick(gen.edges).name + ")"}
+		case r < 0.55 && len(gen.edges) > 0 && depth < gen.MaxDepth:
+			f = &dqlref.Block{Name: gen.pick(gen.edges).name, IsBlock: true}
+			gen.args(f)
+			gen.fields(f, depth+1)
+		case len(gen.scalars) > 0:
+			f = &dqlref.Block{Name: gen.pick(gen.scalars).name}
+		default:
+			f = &dqlref.Block{Name: "count(uid)"}
+		}
+		// Fields with the same key would overwrite each other.
+		if seen[f.Key()] {
+			continue
+		}
+		seen[f.Key()] = true
+		b.Fields = append(b.Fields, f)
+	}
+	// Ordered lists are compared by their order key, so it has to be in
+	// the answer.
+	if b.Order != "" && !seen[b.Order] {
+		b.Fields = append(b.Fields, &dqlref.Block{Name: b.Order})
+	}
+}
+
+// varBlock returns a var block that collects into a new variable the nodes it
+// matches, or those reached over an edge from them.
+func (gen *Generator) varBlock() (*dqlref.Block, string) {
+	gen.vars++
+	name := fmt.Sprintf("V%d", gen.vars)
+	b := &dqlref.Block{Name: "var", IsBlock: true}
+	gen.root(b)
+	if len(gen.edges) == 0 || gen.chance(0.3) {
+		b.Var = name
+		gen.fields(b, gen.MaxDepth)
+		return b, name
+	}
+	e := &dqlref.Block{Name: gen.pick(gen.edges).name, Var: name}
+	if gen.chance(0.3) {
+		e.Filter = gen.filter(0)
+	}
+	b.Fields = []*dqlref.Block{e}
+	return b, name
+}
+
+func (gen *Generator) root(b *dqlref.Block) {
+	fs := gen.indexed()
+	if len(fs) == 0 || gen.chance(0.15) {
+		fs = gen.all()
+	}
+	b.Root = gen.fn(gen.pick(fs))
+	gen.args(b)
+}
+
+// Query returns the root blocks of a new query.
+func (gen *Generator) Query() []*dqlref.Block {
+	var blocks []*dqlref.Block
+	// Dgraph rejects variables that are defined and not used, so the next
+	// block starts from the ones defined since the last.
+	var pending []string
+	n := 1 + gen.rnd.Intn(gen.MaxBlocks)
+	for i := 0; i < n || len(pending) > 0; i++ {
+		if i < n-1 && gen.chance(0.4) {
+			b, v := gen.varBlock()
+			blocks = append(blocks, b)
+			pending = append(pending, v)
+			continue
+		}
+		b := &dqlref.Block{Name: fmt.Sprintf("q%d", i), IsBlock: true}
+		if len(pending) > 0 {
+			b.Root = &dqlref.Func{Name: "uid", Args: pending}
+			pending = nil
+			gen.args(b)
+		} else {
+			gen.root(b)
+		}
+		gen.fields(b, 0)
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// Ready reports whether the generator has predicates to query.
+func (gen *Generator) Ready() bool {
+	return len(gen.scalars)+len(gen.edges) > 0
+}
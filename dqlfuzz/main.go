@@ -0,0 +1,181 @@
+// This tool fuzzes the query engine of Dgraph. It generates random queries
+// that are well typed for a schema, with index functions, filters, ordering,
+// pagination and var blocks, runs each against a server and against dqlref
+// over the same data set in memory, and shrinks every query whose answers
+// differ to a smaller one that still differs.
+//
+// Load the data set with the schema, then run:
+//
+//	./dqlfuzz --schema ../data/1million.schema --rdf ../data/1million.rdf.gz \
+//		--alpha http://localhost:8080/query --n 500 --seed 7
+//
+// Failing queries, minimized, are written to --out with both answers. Runs
+// are repeatable with the seed, which is printed at the start.
+//
+// The two sides break ties of an order differently, so ordered lists are
+// compared by their order key, and where a page cuts a run of equal keys
+// only the keys of the run are compared.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/benchmarks/dqlref"
+	"github.com/dgraph-io/benchmarks/dqlschema"
+	"github.com/dgraph-io/benchmarks/memgraph"
+)
+
+var (
+	schemaFile = flag.String("schema", "", "DQL schema the data set was loaded with.")
+	rdfFile    = flag.String("rdf", "", "Data set, plain or gzipped, that the server has loaded.")
+	langSep    = flag.String("lang-sep", "@", "Joins predicates and language tags: name@en, or name.en for data loaded by the old loader.")
+	alpha      = flag.String("alpha", "http://localhost:8080/query", "Dgraph query endpoint.")
+	num        = flag.Int("n", 100, "Number of queries to generate.")
+	seed       = flag.Int64("seed", 0, "Random seed. 0 picks one from the clock.")
+	depth      = flag.Int("depth", 2, "Maximum number of edges followed from a root.")
+	blocks     = flag.Int("blocks", 3, "Maximum number of root blocks in a query, including var blocks.")
+	outDir     = flag.String("out", "fuzz", "Folder for the minimized failing queries.")
+	dryRun     = flag.Bool("dry-run", false, "Print the queries and the reference answers without a server.")
+	timeout    = flag.Duration("timeout", time.Minute, "Timeout of each query.")
+)
+
+type response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// query runs a query against the server and returns its data.
+func query(q string) (map[string]interface{}, error) {
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Post(*alpha, "application/dql", bytes.NewBufferString(q))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	var res response
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("while parsing response: %v", err)
+	}
+	if len(res.Errors) > 0 {
+		var msgs []string
+		for _, e := range res.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return nil, fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+	return res.Data, nil
+}
+
+func indent(v interface{}) string {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// report writes a failing query, before and after minimizing, with both
+// answers to the minimized one.
+func report(path string, orig, min []*dqlref.Block, res Result) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# seed %d, %s\n", *seed, res.Outcome)
+	b.WriteString("# Minimized:\n")
+	b.WriteString(dqlref.Format(min))
+	b.WriteString("\n# Reference:\n")
+	b.WriteString(indent(res.Want))
+	if res.Err != nil {
+		fmt.Fprintf(&b, "\n# Server error: %v\n", res.Err)
+	} else {
+		b.WriteString("\n# Server:\n")
+		b.WriteString(indent(res.Got))
+	}
+	b.WriteString("\n# Generated:\n")
+	b.WriteString(dqlref.Format(orig))
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func main() {
+	flag.Parse()
+	if *schemaFile == "" || *rdfFile == "" {
+		log.Fatal("Both --schema and --rdf are required.")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	log.Printf("Seed %d", *seed)
+
+	s, err := dqlschema.ReadFile(*schemaFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g := memgraph.New()
+	g.LangSep = *langSep
+	if err := g.Load(*rdfFile); err != nil {
+		log.Fatal(err)
+	}
+	gen := NewGenerator(s, g, *seed)
+	gen.MaxDepth, gen.MaxBlocks = *depth, *blocks
+	if !gen.Ready() {
+		log.Fatalf("None of the predicates in %s has data in %s", *schemaFile, *rdfFile)
+	}
+	c := &Checker{Ref: dqlref.New(g, s.TypeMap()), Server: query}
+
+	if *dryRun {
+		for i := 0; i < *num; i++ {
+			q := gen.Query()
+			res, err := c.Ref.Eval(q)
+			if err != nil {
+				log.Fatalf("Reference failed on a generated query: %v\n%s", err, dqlref.Format(q))
+			}
+			fmt.Printf("%s%s\n\n", dqlref.Format(q), indent(res))
+		}
+		return
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for i := 0; i < *num; i++ {
+		q := gen.Query()
+		res, err := c.Check(q)
+		if err != nil {
+			log.Fatalf("Reference failed on a generated query: %v\n%s", err, dqlref.Format(q))
+		}
+		counts[res.Outcome]++
+		if res.Outcome == agree {
+			continue
+		}
+		min, minRes := c.Minimize(q, res)
+		path := filepath.Join(*outDir, fmt.Sprintf("query-%d.txt", i))
+		if err := report(path, q, min, minRes); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Query %d: %s, minimized to %d nodes from %d, see %s\n",
+			i, res.Outcome, len(nodes(min)), len(nodes(q)), path)
+	}
+	fmt.Printf("%d queries: %d agree, %d mismatches, %d server errors\n",
+		*num, counts[agree], counts[mismatch], counts[serverError])
+	if counts[agree] < *num {
+		os.Exit(1)
+	}
+}
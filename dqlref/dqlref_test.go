@@ -0,0 +1,345 @@
+package dqlref
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/memgraph"
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+func testGraph(t *testing.T) *memgraph.Graph {
+	g := memgraph.New()
+	g.LangSep = "."
+	for _, line := range []string{
+		`<0x1> <film.director.film> <0x10> .`,
+		`<0x1> <film.director.film> <0x11> .`,
+		`<0x1> <film.director.film> <0x12> .`,
+		`<0x10> <type.object.name> "The Good Film"@en .`,
+		`<0x11> <type.object.name> "A Bad Film"@en .`,
+		`<0x12> <type.object.name> "The Film, a Sequel"@en .`,
+		`<0x10> <film.film.initial_release_date> "1999-01-01" .`,
+		`<0x11> <film.film.initial_release_date> "1990-01-01" .`,
+	} {
+		nq, err := nquad.Parse(line)
+		require.NoError(t, err)
+		g.Add(nq)
+	}
+	return g
+}
+
+func eval(t *testing.T, g *memgraph.Graph, q string) map[string]interface{} {
+	res, err := New(g, map[string]string{"year": "int"}).Run(q)
+	require.NoError(t, err)
+	return res
+}
+
+func films(names ...string) map[string]interface{} {
+	var l []interface{}
+	for _, n := range names {
+		l = append(l, map[string]interface{}{"type.object.name.en": n})
+	}
+	return map[string]interface{}{"me": []interface{}{map[string]interface{}{"film.director.film": l}}}
+}
+
+func TestLegacy(t *testing.T) {
+	g := testGraph(t)
+
+	require.Equal(t, films("The Good Film", "The Film, a Sequel"), eval(t, g, `{
+ me(_uid_: 1) {
+  film.director.film @filter(allof("type.object.name.en", "the")) {
+   type.object.name.en
+  }
+ }
+}`))
+
+	require.Equal(t, films("A Bad Film", "The Film, a Sequel"), eval(t, g, `{
+ me(_uid_: 0x1) {
+  film.director.film @filter(allof("type.object.name.en", "the") && allof("type.object.name.en", "a") || anyof("type.object.name.en", "bad")) {
+   type.object.name.en
+  }
+ }
+}`))
+
+	// Sorting drops films without a date.
+	require.Equal(t, films("A Bad Film"), eval(t, g, `{
+ me(_uid_: 1) {
+  film.director.film(order: film.film.initial_release_date, first: 1) {
+   type.object.name.en
+  }
+ }
+}`))
+
+	require.Equal(t, map[string]interface{}{"me": []interface{}{map[string]interface{}{
+		"film.director.film": []interface{}{map[string]interface{}{"_count_": "2"}},
+	}}}, eval(t, g, `{
+ me(_uid_: 1) {
+  film.director.film @filter(allof("type.object.name.en", "the")) {
+   _count_
+  }
+ }
+}`))
+
+	require.Equal(t, map[string]interface{}{"me": []interface{}{
+		map[string]interface{}{"_uid_": "0x10"},
+		map[string]interface{}{"_uid_": "0x11"},
+	}}, eval(t, g, `{
+ me(anyof("type.object.name.en", "good bad")) {
+  _uid_
+ }
+}`))
+}
+
+func filmGraph(t *testing.T) *memgraph.Graph {
+	g := memgraph.New()
+	for _, line := range []string{
+		`<0x1> <name> "Ridley Scott"@en .`,
+		`<0x1> <director.film> <0x10> .`,
+		`<0x1> <director.film> <0x11> .`,
+		`<0x1> <director.film> <0x12> .`,
+		`<0x10> <name> "Alien"@en .`,
+		`<0x11> <name> "Blade Runner"@en .`,
+		`<0x12> <name> "Gladiator"@en .`,
+		`<0x10> <year> "1979" .`,
+		`<0x11> <year> "1982" .`,
+		`<0x12> <year> "2000" .`,
+		`<0x11> <genre> <0x20> .`,
+		`<0x12> <genre> <0x20> .`,
+		`<0x20> <name> "Action"@en .`,
+	} {
+		nq, err := nquad.Parse(line)
+		require.NoError(t, err)
+		g.Add(nq)
+	}
+	return g
+}
+
+func TestEval(t *testing.T) {
+	g := filmGraph(t)
+
+	require.JSONEq(t, `{"q": [{
+		"name@en": "Ridley Scott",
+		"films": [{"name@en": "Gladiator", "year": 2000}, {"name@en": "Blade Runner", "year": 1982}],
+		"count(director.film)": 3
+	}]}`, js(t, eval(t, g, `{
+  q(func: eq(name@en, "Ridley Scott")) {
+    name@en
+    films : director.film (orderdesc: year, first: 2) @filter(has(genre) or eq(year, 1979)) {
+      name@en
+      year
+    }
+    count(director.film)
+  }
+}`)))
+
+	// Variables, reverse edges, uid and count(uid).
+	require.JSONEq(t, `{
+		"films": [{"count": 2}, {"uid": "0x11"}, {"uid": "0x12"}],
+		"directors": [{"name@en": "Ridley Scott"}]
+	}`, js(t, eval(t, g, `{
+  directors(func: uid(D)) @filter(has(director.film)) {
+    name@en
+  }
+  var(func: anyofterms(name@en, "action drama")) {
+    F as ~genre {
+      D as ~director.film
+    }
+  }
+  films(func: uid(F)) @filter(not allofterms(name@en, "alien")) {
+    count(uid)
+    uid
+  }
+}`)))
+
+	// has(~p) holds for the objects of p.
+	require.JSONEq(t, `{
+		"q": [{"name@en": "Alien"}, {"name@en": "Blade Runner"}, {"name@en": "Gladiator"}],
+		"r": [{"name@en": "Blade Runner"}, {"name@en": "Gladiator"}]
+	}`, js(t, eval(t, g, `{
+  q(func: has(~director.film)) { name@en }
+  r(func: has(year)) @filter(has(~director.film) and has(genre)) { name@en }
+}`)))
+
+	require.JSONEq(t, `{"q": [{"year": 1982}, {"year": 2000}]}`, js(t, eval(t, g, `{
+  q(func: ge(year, 1980)) @filter(lt(year, "2001") and not gt(year, 2000)) {
+    year
+  }
+}`)))
+
+	require.JSONEq(t, `{"q": [{"count": 0}], "r": []}`, js(t, eval(t, g, `{
+  q(func: eq(name@en, "Nobody")) { count(uid) }
+  r(func: eq(name@en, "Nobody")) { name@en }
+}`)))
+
+	_, err := New(g, nil).Run(`{ q(func: intersects(loc, [[[1, 2], [3, 4], [1, 2]]])) { uid } }`)
+	require.Error(t, err)
+}
+
+func TestFormat(t *testing.T) {
+	g := filmGraph(t)
+	for _, q := range []string{
+		`{
+  q(func: eq(name@en, "Ridley Scott")) {
+    name@en
+    films : director.film (orderdesc: year, first: 2, offset: 1) @filter(has(genre) or not eq(year, 1979)) {
+      name@en
+      year
+    }
+    count(director.film)
+  }
+}`,
+		`{
+  films(func: uid(F), orderasc: year) @filter(not allofterms(name@en, "alien") and anyofterms(name@en, "blade \"runner\"")) {
+    count(uid)
+    uid
+  }
+  var(func: anyofterms(name@en, "action drama")) {
+    F as ~genre
+  }
+}`,
+	} {
+		blocks, err := Parse(q)
+		require.NoError(t, err)
+		printed := Format(blocks)
+		again, err := Parse(printed)
+		require.NoError(t, err, printed)
+		require.Equal(t, blocks, again, printed)
+		require.Equal(t, eval(t, g, q), eval(t, g, printed))
+
+		// Changing a copy leaves the original alone.
+		c := blocks[0].Copy()
+		c.Fields[0].Name = "changed"
+		c.Filter = nil
+		require.Equal(t, again[0], blocks[0])
+	}
+}
+
+func js(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestParseTypes(t *testing.T) {
+	require.Equal(t, map[string]string{
+		"type.object.name.en":            "string",
+		"film.film.initial_release_date": "date",
+		"year":                           "int",
+		"genre":                          "[uid]",
+	}, ParseTypes(`scalar (
+	type.object.name.en: string @index
+	film.film.initial_release_date: date @index
+)
+year: int @index(int) .
+<genre>: [uid] @reverse .
+type Film {
+  year
+}`))
+}
+
+func TestIndexFuncs(t *testing.T) {
+	g := memgraph.New()
+	for _, line := range []string{
+		`<a> <name> "Running with the Dogs" .`,
+		`<b> <name> "The Dog Runner" .`,
+		`<c> <name> "Cats" .`,
+		`<a> <released> "1999-05-01" .`,
+		`<b> <released> "2001-01-01T10:00:00Z" .`,
+		`<a> <loc> "{'type':'Point','coordinates':[-122.42,37.77]}"^^<geo:geojson> .`,
+		`<b> <loc> "{'type':'Point','coordinates':[-122.27,37.80]}"^^<geo:geojson> .`,
+		`<c> <loc> "{'type':'Polygon','coordinates':[[[-1,-1],[1,-1],[1,1],[-1,1],[-1,-1]]]}"^^<geo:geojson> .`,
+		`<a> <vec> "[1, 0]" .`,
+		`<b> <vec> "[0.9, 0.1]" .`,
+		`<c> <vec> "[0, 1]" .`,
+	} {
+		nq, err := nquad.Parse(line)
+		require.NoError(t, err)
+		g.Add(nq)
+	}
+	e := New(g, map[string]string{"released": "datetime", "loc": "geo"})
+
+	for _, c := range []struct{ q, want string }{
+		{`{ q(func: alloftext(name, "dog run")) { name } }`,
+			`{"q": [{"name": "Running with the Dogs"}]}`},
+		{`{ q(func: anyoftext(name, "dogs"), orderasc: name) { name } }`,
+			`{"q": [{"name": "Running with the Dogs"}, {"name": "The Dog Runner"}]}`},
+		{`{ q(func: anyoftext(name, "cat the")) { name } }`,
+			`{"q": [{"name": "Cats"}]}`},
+		{`{ q(func: regexp(name, /^the dog/i)) { name } }`,
+			`{"q": [{"name": "The Dog Runner"}]}`},
+		{`{ q(func: match(name, "Cat", 1)) { name } }`,
+			`{"q": [{"name": "Cats"}]}`},
+		{`{ q(func: ge(released, "2000")) { released } }`,
+			`{"q": [{"released": "2001-01-01T10:00:00Z"}]}`},
+		{`{ q(func: le(released, "1999-12-31")) { released } }`,
+			`{"q": [{"released": "1999-05-01T00:00:00Z"}]}`},
+		{`{ q(func: near(loc, [-122.41, 37.77], 1000)) { count(uid) } }`,
+			`{"q": [{"count": 1}]}`},
+		{`{ q(func: near(loc, [-122.41, 37.77], 20000)) { count(uid) } }`,
+			`{"q": [{"count": 2}]}`},
+		{`{ q(func: within(loc, [[[-123, 37], [-122, 37], [-122, 38], [-123, 38], [-123, 37]]])) { count(uid) } }`,
+			`{"q": [{"count": 2}]}`},
+		{`{ q(func: contains(loc, [0.5, 0.5])) { loc } }`,
+			`{"q": [{"loc": {"type": "Polygon", "coordinates": [[[-1,-1],[1,-1],[1,1],[-1,1],[-1,-1]]]}}]}`},
+		{`{ q(func: similar_to(vec, 2, "[1, 0.05]"), orderasc: name) { name } }`,
+			`{"q": [{"name": "Running with the Dogs"}, {"name": "The Dog Runner"}]}`},
+	} {
+		blocks, err := Parse(c.q)
+		require.NoError(t, err, c.q)
+		res, err := e.Eval(blocks)
+		require.NoError(t, err, c.q)
+		require.JSONEq(t, c.want, js(t, res), c.q)
+
+		// The printed query means the same.
+		again, err := Parse(Format(blocks))
+		require.NoError(t, err, Format(blocks))
+		require.Equal(t, blocks, again)
+	}
+
+	e.Metrics = map[string]string{"vec": "cosine"}
+	res, err := e.Run(`{ q(func: similar_to(vec, 1, "[0, 2]")) { name } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q": [{"name": "Cats"}]}`, js(t, res))
+}
+
+func TestLists(t *testing.T) {
+	g := memgraph.New()
+	for _, line := range []string{
+		`<a> <name> "Alien" .`,
+		`<a> <tags> "horror" .`,
+		`<a> <tags> "science fiction" .`,
+		`<a> <years> "1979" .`,
+		`<a> <years> "2003" .`,
+		`<b> <name> "Heat" .`,
+		`<b> <name> "Heat (1995)" .`,
+		`<b> <tags> "crime" .`,
+	} {
+		nq, err := nquad.Parse(line)
+		require.NoError(t, err)
+		g.Add(nq)
+	}
+	e := New(g, map[string]string{"tags": "[string]", "years": "[int]"})
+
+	for _, c := range []struct{ q, want string }{
+		// Any value of a list matches.
+		{`{ q(func: eq(tags, "science fiction")) { name tags } }`,
+			`{"q": [{"name": "Alien", "tags": ["horror", "science fiction"]}]}`},
+		{`{ q(func: anyofterms(tags, "crime horror"), orderasc: name) { name } }`,
+			`{"q": [{"name": "Alien"}, {"name": "Heat (1995)"}]}`},
+		{`{ q(func: gt(years, 2000)) { years } }`,
+			`{"q": [{"years": [1979, 2003]}]}`},
+		// A list of one value is still a list.
+		{`{ q(func: eq(tags, "crime")) { tags } }`,
+			`{"q": [{"tags": ["crime"]}]}`},
+		// Other predicates keep the last value.
+		{`{ q(func: has(tags), orderasc: name) { name } }`,
+			`{"q": [{"name": "Alien"}, {"name": "Heat (1995)"}]}`},
+		{`{ q(func: eq(name, "Heat")) { name } }`, `{"q": []}`},
+	} {
+		res, err := e.Run(c.q)
+		require.NoError(t, err, c.q)
+		require.JSONEq(t, c.want, js(t, res), c.q)
+	}
+}
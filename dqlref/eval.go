@@ -0,0 +1,571 @@
+package dqlref
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/benchmarks/memgraph"
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// Evaluator runs queries against a graph.
+type Evaluator struct {
+	g *memgraph.Graph
+	// types maps predicates to their schema type, e.g. int, datetime or
+	// [string], for comparing and formatting values. Predicates not in it
+	// are strings.
+	types map[string]string
+	rev   map[string]map[uint64][]uint64
+	// Metrics maps float32vector predicates to the metric of their index:
+	// euclidean, the default, cosine or dotproduct.
+	Metrics map[string]string
+}
+
+// New returns an evaluator for g. types maps predicates to their schema type,
+// in brackets for lists, and may be nil.
+func New(g *memgraph.Graph, types map[string]string) *Evaluator {
+	if types == nil {
+		types = make(map[string]string)
+	}
+	return &Evaluator{g: g, types: types, rev: make(map[string]map[uint64][]uint64)}
+}
+
+type run struct {
+	*Evaluator
+	vars map[string][]uint64
+}
+
+// Run evaluates a query and returns its data, as decoded from the JSON a
+// server would return.
+func (e *Evaluator) Run(query string) (map[string]interface{}, error) {
+	blocks, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(blocks)
+}
+
+// Eval evaluates parsed root blocks.
+func (e *Evaluator) Eval(blocks []*Block) (map[string]interface{}, error) {
+	r := &run{Evaluator: e, vars: make(map[string][]uint64)}
+	out := make(map[string]interface{})
+
+	// Evaluate blocks once the variables they use are defined, since a block
+	// may use a variable defined further down.
+	pending := blocks
+	for len(pending) > 0 {
+		var later []*Block
+		for _, b := range pending {
+			if !r.ready(b) {
+				later = append(later, b)
+				continue
+			}
+			res, err := r.root(b)
+			if err != nil {
+				return nil, err
+			}
+			// Variables defined on edges that were never reached are empty.
+			defined := make(map[string]bool)
+			b.vars(make(map[string]bool), defined)
+			for v := range defined {
+				if _, ok := r.vars[v]; !ok {
+					r.vars[v] = nil
+				}
+			}
+			if b.Name == "var" {
+				continue
+			}
+			if res == nil && b.Legacy {
+				continue
+			}
+			if res == nil {
+				res = []interface{}{}
+			}
+			out[b.Key()] = res
+		}
+		if len(later) == len(pending) {
+			return nil, fmt.Errorf("undefined or circular variables in %s", later[0].Key())
+		}
+		pending = later
+	}
+
+	// Round trip through JSON, so that the result compares equal to a
+	// decoded server response.
+	js, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	var res map[string]interface{}
+	return res, json.Unmarshal(js, &res)
+}
+
+func usedVars(f *Func, out map[string]bool) {
+	if f != nil && f.Name == "uid" {
+		for _, a := range f.Args {
+			if _, err := strconv.ParseUint(a, 0, 64); err != nil {
+				out[a] = true
+			}
+		}
+	}
+}
+
+func (b *Block) vars(used, defined map[string]bool) {
+	usedVars(b.Root, used)
+	var walk func(f *Filter)
+	walk = func(f *Filter) {
+		if f == nil {
+			return
+		}
+		usedVars(f.Func, used)
+		walk(f.Left)
+		walk(f.Right)
+	}
+	walk(b.Filter)
+	if b.Var != "" {
+		defined[b.Var] = true
+	}
+	for _, c := range b.Fields {
+		c.vars(used, defined)
+	}
+}
+
+// ready reports whether all variables used by b, and not defined inside it,
+// have been computed.
+func (r *run) ready(b *Block) bool {
+	used, defined := make(map[string]bool), make(map[string]bool)
+	b.vars(used, defined)
+	for v := range used {
+		if _, ok := r.vars[v]; !ok && !defined[v] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *run) root(b *Block) ([]interface{}, error) {
+	var uids []uint64
+	for _, u := range b.UIDs {
+		if n, err := strconv.ParseUint(u, 0, 64); err == nil {
+			uids = append(uids, n)
+		} else {
+			uids = append(uids, nquad.Fingerprint(u))
+		}
+	}
+	if b.Root != nil {
+		found, err := r.rootFunc(b.Root)
+		if err != nil {
+			return nil, err
+		}
+		uids = append(uids, found...)
+	}
+	uids, err := r.process(b, memgraph.Sorted(uids))
+	if err != nil {
+		return nil, err
+	}
+	if b.Var != "" {
+		r.vars[b.Var] = uids
+	}
+	if len(uids) == 0 && !b.Legacy {
+		// A root block still counts when nothing matched.
+		for _, f := range b.Fields {
+			if f.Name == "count(uid)" {
+				key := "count"
+				if f.Alias != "" {
+					key = f.Alias
+				}
+				return []interface{}{map[string]interface{}{key: 0}}, nil
+			}
+		}
+	}
+	return r.children(b, uids)
+}
+
+func (r *run) uidArgs(f *Func) []uint64 {
+	var out []uint64
+	for _, a := range f.Args {
+		if u, err := strconv.ParseUint(a, 0, 64); err == nil {
+			out = append(out, u)
+			continue
+		}
+		out = append(out, r.vars[a]...)
+	}
+	return memgraph.Sorted(out)
+}
+
+func (r *run) rootFunc(f *Func) ([]uint64, error) {
+	switch f.Name {
+	case "uid":
+		return r.uidArgs(f), nil
+	case "similar_to":
+		return r.similar(f)
+	}
+	var out []uint64
+	for _, u := range r.subjects(f.Pred) {
+		ok, err := r.match(f, u)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+// typeOf returns the type of the values of pred, and whether it is a list.
+func (e *Evaluator) typeOf(pred string) (string, bool) {
+	t := e.types[strings.SplitN(pred, "@", 2)[0]]
+	if strings.HasPrefix(t, "[") {
+		return strings.Trim(t, "[]"), true
+	}
+	return t, false
+}
+
+// values returns the values of pred that Dgraph keeps for uid: all of them
+// for a list, else the last one.
+func (e *Evaluator) values(uid uint64, pred string) []string {
+	vals := e.g.Values[pred][uid]
+	if _, list := e.typeOf(pred); list || len(vals) == 0 {
+		return vals
+	}
+	return vals[len(vals)-1:]
+}
+
+// compare compares two values of pred by its type.
+func (e *Evaluator) compare(pred, a, b string) int {
+	typ, _ := e.typeOf(pred)
+	switch typ {
+	case "datetime", "date":
+		ta, okA := parseTime(a)
+		tb, okB := parseTime(b)
+		if okA && okB {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+			return 0
+		}
+	case "int", "float":
+		fa, errA := strconv.ParseFloat(a, 64)
+		fb, errB := strconv.ParseFloat(b, 64)
+		if errA == nil && errB == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func (r *run) match(f *Func, uid uint64) (bool, error) {
+	switch f.Name {
+	case "uid":
+		for _, u := range r.uidArgs(f) {
+			if u == uid {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "has":
+		if strings.HasPrefix(f.Pred, "~") {
+			return len(r.edges(uid, f.Pred)) > 0, nil
+		}
+		if _, ok := r.g.Edges[f.Pred][uid]; ok {
+			return true, nil
+		}
+		return len(r.values(uid, f.Pred)) > 0, nil
+	}
+	if len(f.Args) == 0 {
+		return false, nil
+	}
+	// A list matches if any of its values does.
+	for _, v := range r.values(uid, f.Pred) {
+		if ok, err := r.matchValue(f, v); ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (r *run) matchValue(f *Func, v string) (bool, error) {
+	switch f.Name {
+	case "eq":
+		for _, a := range f.Args {
+			if r.compare(f.Pred, v, a) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "lt", "le", "gt", "ge":
+		c := r.compare(f.Pred, v, f.Args[0])
+		switch f.Name {
+		case "lt":
+			return c < 0, nil
+		case "le":
+			return c <= 0, nil
+		case "gt":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "allofterms", "anyofterms":
+		return memgraph.HasTerms(v, strings.Join(f.Args, " "), f.Name == "anyofterms"), nil
+	case "alloftext", "anyoftext":
+		return memgraph.HasFullText(v, strings.Join(f.Args, " "), f.Name == "anyoftext"), nil
+	case "regexp":
+		re, err := regexpArg(f.Args[0])
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(v), nil
+	case "match":
+		if len(f.Args) != 2 {
+			return false, fmt.Errorf("match takes a string and a distance")
+		}
+		d, err := strconv.Atoi(f.Args[1])
+		if err != nil {
+			return false, fmt.Errorf("match: %v", err)
+		}
+		return levenshtein(v, f.Args[0]) <= d, nil
+	case "near", "within", "contains":
+		return matchGeo(f, v)
+	case "similar_to":
+		return false, fmt.Errorf("similar_to is only supported at the root")
+	}
+	return false, fmt.Errorf("unsupported function %s", f.Name)
+}
+
+func (r *run) keep(f *Filter, uid uint64) (bool, error) {
+	switch f.Op {
+	case "not":
+		ok, err := r.keep(f.Left, uid)
+		return !ok, err
+	case "and", "or":
+		a, err := r.keep(f.Left, uid)
+		if err != nil || a == (f.Op == "or") {
+			return a, err
+		}
+		return r.keep(f.Right, uid)
+	}
+	return r.match(f.Func, uid)
+}
+
+// process filters, sorts and paginates uids, which come sorted.
+func (r *run) process(b *Block, uids []uint64) ([]uint64, error) {
+	out := make([]uint64, 0, len(uids))
+	for _, u := range uids {
+		if b.Filter != nil {
+			ok, err := r.keep(b.Filter, u)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		out = append(out, u)
+	}
+	if b.Order != "" {
+		vals := make(map[uint64]string)
+		var with, without []uint64
+		for _, u := range out {
+			if v, ok := r.g.Value(u, b.Order); ok {
+				vals[u] = v
+				with = append(with, u)
+			} else {
+				without = append(without, u)
+			}
+		}
+		sort.SliceStable(with, func(i, j int) bool {
+			c := r.compare(b.Order, vals[with[i]], vals[with[j]])
+			if b.Desc {
+				return c > 0
+			}
+			return c < 0
+		})
+		// Nodes without a value come last, or not at all in the old syntax,
+		// which sorted using the index.
+		out = with
+		if !b.Legacy {
+			out = append(out, without...)
+		}
+	}
+	if b.Offset > 0 {
+		if b.Offset >= len(out) {
+			return nil, nil
+		}
+		out = out[b.Offset:]
+	}
+	switch {
+	case b.First > 0 && b.First < len(out):
+		out = out[:b.First]
+	case b.First < 0 && -b.First < len(out):
+		out = out[len(out)+b.First:]
+	}
+	return out, nil
+}
+
+// edges returns the sorted objects of pred from uid, following ~pred in
+// reverse.
+func (r *run) edges(uid uint64, pred string) []uint64 {
+	if !strings.HasPrefix(pred, "~") {
+		return r.g.Neighbors(uid, pred)
+	}
+	return memgraph.Sorted(r.reverse(pred[1:])[uid])
+}
+
+// subjects returns the sorted uids that have pred; for ~pred those are the
+// objects of pred.
+func (r *run) subjects(pred string) []uint64 {
+	if !strings.HasPrefix(pred, "~") {
+		return r.g.Subjects(pred)
+	}
+	var out []uint64
+	for u := range r.reverse(pred[1:]) {
+		out = append(out, u)
+	}
+	return memgraph.Sorted(out)
+}
+
+func (r *run) reverse(pred string) map[uint64][]uint64 {
+	m, ok := r.rev[pred]
+	if !ok {
+		m = r.g.Reverse(pred)
+		r.rev[pred] = m
+	}
+	return m
+}
+
+func (r *run) value(pred, v string) interface{} {
+	typ, _ := r.typeOf(pred)
+	switch typ {
+	case "int":
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	case "bool":
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	case "datetime", "date":
+		if t, ok := parseTime(v); ok {
+			return t.Format(time.RFC3339Nano)
+		}
+	case "geo":
+		var g interface{}
+		if err := json.Unmarshal([]byte(strings.Replace(v, "'", `"`, -1)), &g); err == nil {
+			return g
+		}
+	}
+	return v
+}
+
+func (r *run) node(b *Block, uid uint64) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	for _, f := range b.Fields {
+		switch {
+		case f.Name == "uid" || f.Name == "_uid_":
+			out[f.Key()] = fmt.Sprintf("%#x", uid)
+		case f.Name == "count(uid)" || f.Name == "_count_":
+			// Handled by children.
+		case strings.HasPrefix(f.Name, "count("):
+			pred := strings.TrimSuffix(strings.TrimPrefix(f.Name, "count("), ")")
+			if n := len(r.edges(uid, pred)); n > 0 {
+				out[f.Key()] = n
+			}
+		case strings.HasPrefix(f.Name, "val("), strings.HasPrefix(f.Name, "uid("):
+			return nil, fmt.Errorf("unsupported field %s", f.Name)
+		case !f.IsBlock && f.Var == "":
+			vals := r.values(uid, f.Name)
+			if _, list := r.typeOf(f.Name); list && len(vals) > 0 {
+				l := make([]interface{}, len(vals))
+				for i, v := range vals {
+					l[i] = r.value(f.Name, v)
+				}
+				out[f.Key()] = l
+			} else if len(vals) > 0 {
+				out[f.Key()] = r.value(f.Name, vals[0])
+			}
+		default:
+			uids, err := r.process(f, r.edges(uid, f.Name))
+			if err != nil {
+				return nil, err
+			}
+			if f.Var != "" {
+				r.vars[f.Var] = memgraph.Sorted(append(r.vars[f.Var], uids...))
+			}
+			kids, err := r.children(f, uids)
+			if err != nil {
+				return nil, err
+			}
+			if len(kids) > 0 {
+				out[f.Key()] = kids
+			}
+		}
+	}
+	return out, nil
+}
+
+// children returns the list for a block, or nil if it is empty.
+func (r *run) children(b *Block, uids []uint64) ([]interface{}, error) {
+	var out []interface{}
+	for _, f := range b.Fields {
+		if len(uids) == 0 {
+			break
+		}
+		switch f.Name {
+		case "_count_":
+			out = append(out, map[string]interface{}{"_count_": strconv.Itoa(len(uids))})
+		case "count(uid)":
+			key := "count"
+			if f.Alias != "" {
+				key = f.Alias
+			}
+			out = append(out, map[string]interface{}{key: len(uids)})
+		}
+	}
+	for _, u := range uids {
+		n, err := r.node(b, u)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) > 0 {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// ParseTypes reads the predicate types from a DQL schema, e.g. "year: int
+// @index(int) ." or the older "year: int" lines inside scalar ( ... ).
+// Lists are typed in brackets, e.g. [string].
+func ParseTypes(schema string) map[string]string {
+	types := make(map[string]string)
+	for _, line := range strings.Split(schema, "\n") {
+		line = strings.TrimSpace(line)
+		i := strings.Index(line, ":")
+		if i < 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "type ") {
+			continue
+		}
+		pred := strings.Trim(strings.TrimSpace(line[:i]), "<>")
+		f := strings.Fields(line[i+1:])
+		if pred == "" || strings.ContainsAny(pred, " {}()") || len(f) == 0 {
+			continue
+		}
+		types[pred] = strings.TrimSuffix(f[0], ".")
+	}
+	return types
+}
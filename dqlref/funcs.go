@@ -0,0 +1,267 @@
+package dqlref
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/benchmarks/memgraph"
+)
+
+// timeLayouts are the datetime forms a value may have, longest first.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// regexpArg compiles a /pattern/flags argument.
+func regexpArg(arg string) (*regexp.Regexp, error) {
+	i := strings.LastIndex(arg, "/")
+	if !strings.HasPrefix(arg, "/") || i == 0 {
+		return nil, fmt.Errorf("invalid regular expression %s", arg)
+	}
+	pattern, flags := arg[1:i], arg[i+1:]
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// levenshtein returns the edit distance between a and b, in runes.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// geometry is a GeoJSON value. Coordinates are decoded by type.
+type geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// parseGeo reads a GeoJSON value. RDF files often quote its keys with
+// single quotes.
+func parseGeo(s string) (geometry, error) {
+	var g geometry
+	err := json.Unmarshal([]byte(strings.Replace(s, "'", `"`, -1)), &g)
+	return g, err
+}
+
+type point [2]float64 // longitude, latitude
+
+func (g geometry) point() (point, bool) {
+	var p point
+	return p, g.Type == "Point" && json.Unmarshal(g.Coordinates, &p) == nil
+}
+
+// polygons returns the rings of a Polygon or of each part of a MultiPolygon.
+func (g geometry) polygons() [][][]point {
+	switch g.Type {
+	case "Polygon":
+		var p [][]point
+		if json.Unmarshal(g.Coordinates, &p) == nil {
+			return [][][]point{p}
+		}
+	case "MultiPolygon":
+		var mp [][][]point
+		if json.Unmarshal(g.Coordinates, &mp) == nil {
+			return mp
+		}
+	}
+	return nil
+}
+
+// earthRadius is the mean radius of the earth in meters.
+const earthRadius = 6371008.8
+
+// distance returns the great circle distance between a and b in meters.
+func distance(a, b point) float64 {
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+	lat1, lat2 := rad(a[1]), rad(b[1])
+	dlat, dlon := lat2-lat1, rad(b[0]-a[0])
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// inRing reports whether p is inside a ring, by ray casting.
+func inRing(p point, ring []point) bool {
+	in := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > p[1]) != (b[1] > p[1]) &&
+			p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+			in = !in
+		}
+	}
+	return in
+}
+
+// inPolygon reports whether p is inside the outer ring of a polygon and
+// outside its holes.
+func inPolygon(p point, rings [][]point) bool {
+	if len(rings) == 0 || !inRing(p, rings[0]) {
+		return false
+	}
+	for _, hole := range rings[1:] {
+		if inRing(p, hole) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchGeo evaluates near, within and contains on a GeoJSON value.
+func matchGeo(f *Func, v string) (bool, error) {
+	g, err := parseGeo(v)
+	if err != nil {
+		// Not a geo value.
+		return false, nil
+	}
+	switch f.Name {
+	case "near":
+		if len(f.Args) != 2 {
+			return false, fmt.Errorf("near takes a point and a distance")
+		}
+		var at point
+		if err := json.Unmarshal([]byte(f.Args[0]), &at); err != nil {
+			return false, fmt.Errorf("near: %v", err)
+		}
+		d, err := strconv.ParseFloat(f.Args[1], 64)
+		if err != nil {
+			return false, fmt.Errorf("near: %v", err)
+		}
+		p, ok := g.point()
+		return ok && distance(p, at) <= d, nil
+	case "within":
+		var poly [][]point
+		if len(f.Args) != 1 || json.Unmarshal([]byte(f.Args[0]), &poly) != nil {
+			return false, fmt.Errorf("within takes a polygon")
+		}
+		p, ok := g.point()
+		return ok && inPolygon(p, poly), nil
+	case "contains":
+		var at point
+		if len(f.Args) != 1 || json.Unmarshal([]byte(f.Args[0]), &at) != nil {
+			return false, fmt.Errorf("contains takes a point")
+		}
+		for _, poly := range g.polygons() {
+			if inPolygon(at, poly) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported function %s", f.Name)
+}
+
+// vectorDistance returns how far apart two vectors are by metric, smaller
+// being more similar.
+func vectorDistance(metric string, a, b []float64) float64 {
+	var dot, na, nb, sq float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+		sq += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	switch metric {
+	case "cosine":
+		if na == 0 || nb == 0 {
+			return 1
+		}
+		return 1 - dot/math.Sqrt(na*nb)
+	case "dotproduct":
+		return -dot
+	}
+	return math.Sqrt(sq)
+}
+
+// similar returns the k nodes whose vector for f.Pred is closest to the one
+// in f, exactly.
+func (r *run) similar(f *Func) ([]uint64, error) {
+	if len(f.Args) != 2 {
+		return nil, fmt.Errorf("similar_to takes a count and a vector")
+	}
+	k, err := strconv.Atoi(f.Args[0])
+	if err != nil {
+		return nil, fmt.Errorf("similar_to: %v", err)
+	}
+	var q []float64
+	if err := json.Unmarshal([]byte(f.Args[1]), &q); err != nil {
+		return nil, fmt.Errorf("similar_to: %v", err)
+	}
+	type hit struct {
+		uid uint64
+		d   float64
+	}
+	var hits []hit
+	for u, vals := range r.g.Values[f.Pred] {
+		var vec []float64
+		if json.Unmarshal([]byte(vals[len(vals)-1]), &vec) != nil {
+			continue
+		}
+		hits = append(hits, hit{u, vectorDistance(r.Metrics[f.Pred], q, vec)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].d != hits[j].d {
+			return hits[i].d < hits[j].d
+		}
+		return hits[i].uid < hits[j].uid
+	})
+	if k < len(hits) {
+		hits = hits[:k]
+	}
+	out := make([]uint64, len(hits))
+	for i, h := range hits {
+		out[i] = h.uid
+	}
+	return memgraph.Sorted(out), nil
+}
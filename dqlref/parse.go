@@ -0,0 +1,460 @@
+// Package dqlref evaluates a subset of DQL over a memgraph.Graph, to serve as
+// a reference for what a Dgraph server should answer. It covers the root
+// functions uid, eq, lt, le, gt, ge, allofterms, anyofterms, alloftext,
+// anyoftext, regexp, match, has, near, within, contains and similar_to,
+// @filter with and, or and not, nested and reverse edges, aliases, uid
+// variables, count, first and offset, and orderasc and orderdesc. The old
+// syntax used by indextest is accepted too: _uid_ as root argument and field,
+// allof and anyof, _count_ and order.
+//
+// Fulltext functions stem English only. The geo functions handle points, and
+// polygons for contains, with straight edges in longitude and latitude.
+// similar_to computes the exact nearest neighbours, which an approximate
+// index may not all find.
+package dqlref
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Func is a function call in a root or a filter, e.g. eq(name@en, "Alien").
+type Func struct {
+	Name string
+	// Pred is the predicate argument, if the function has one.
+	Pred string
+	// Args are the other arguments: values, uids or variable names.
+	Args []string
+}
+
+// Filter is a tree of functions joined by and, or and not.
+type Filter struct {
+	Op          string // and, or, not, or "" for a function
+	Func        *Func
+	Left, Right *Filter // Right is nil for not
+}
+
+// Block is a query block, or a field inside one. Fields without braces are
+// values, uid, count(...) or var references.
+type Block struct {
+	Name  string
+	Alias string
+	Var   string // set by "Var as"
+	Root  *Func  // func: of a root block
+	UIDs  []string
+	// Order is the predicate to sort by, with Desc set for orderdesc.
+	Order  string
+	Desc   bool
+	First  int
+	Offset int
+	Filter *Filter
+	// Legacy is set for the old syntax, which also changes the output.
+	Legacy  bool
+	IsBlock bool
+	Fields  []*Block
+}
+
+// Key returns the name of the block in the response.
+func (b *Block) Key() string {
+	if b.Alias != "" {
+		return b.Alias
+	}
+	return b.Name
+}
+
+type parser struct {
+	toks []string
+	pos  int
+}
+
+func isNameChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._~@-$", r)
+}
+
+func lex(s string) ([]string, error) {
+	var toks []string
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		c := rs[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '#':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case strings.ContainsRune("{}():,[]!", c):
+			toks = append(toks, string(c))
+			i++
+		case c == '&' || c == '|':
+			if i+1 >= len(rs) || rs[i+1] != c {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			toks = append(toks, string(rs[i:i+2]))
+			i += 2
+		case c == '/':
+			// A regular expression, /pattern/flags.
+			j := i + 1
+			for j < len(rs) && rs[j] != '/' {
+				if rs[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("unterminated regular expression")
+			}
+			j++
+			for j < len(rs) && unicode.IsLetter(rs[j]) {
+				j++
+			}
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		case c == '<':
+			j := i + 1
+			for j < len(rs) && rs[j] != '>' {
+				j++
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("unterminated <")
+			}
+			// <pred> is the same as pred.
+			toks = append(toks, string(rs[i+1:j]))
+			i = j + 1
+		case c == '"':
+			var b strings.Builder
+			b.WriteRune('"')
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+				}
+				b.WriteRune(rs[j])
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, b.String())
+			i = j + 1
+		case isNameChar(c):
+			j := i
+			for j < len(rs) && isNameChar(rs[j]) {
+				j++
+			}
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return toks, nil
+}
+
+func (p *parser) peek() string {
+	return p.peekAt(0)
+}
+
+func (p *parser) peekAt(n int) string {
+	if p.pos+n < len(p.toks) {
+		return p.toks[p.pos+n]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) expect(t string) error {
+	if got := p.next(); got != t {
+		return fmt.Errorf("expected %q, got %q", t, got)
+	}
+	return nil
+}
+
+// Parse parses a query into its root blocks.
+func Parse(query string) ([]*Block, error) {
+	toks, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var blocks []*Block
+	for p.peek() != "}" {
+		if p.peek() == "" {
+			return nil, fmt.Errorf("unterminated query")
+		}
+		b, err := p.block(true)
+		if err != nil {
+			return nil, err
+		}
+		if !b.IsBlock {
+			return nil, fmt.Errorf("root %s has no fields", b.Name)
+		}
+		blocks = append(blocks, b)
+	}
+	p.next()
+	if p.peek() != "" {
+		return nil, fmt.Errorf("unexpected %q after query", p.peek())
+	}
+	return blocks, nil
+}
+
+func (p *parser) block(root bool) (*Block, error) {
+	b := &Block{}
+	if p.peekAt(1) == "as" {
+		b.Var = p.next()
+		p.next()
+	}
+	b.Name = p.next()
+	if !root && p.peek() == ":" {
+		p.next()
+		b.Alias, b.Name = b.Name, p.next()
+	}
+	if b.Name == "" || strings.ContainsAny(b.Name[:1], "{}():,") {
+		return nil, fmt.Errorf("expected a name, got %q", b.Name)
+	}
+
+	if !root && (b.Name == "count" || b.Name == "uid" || b.Name == "val") && p.peek() == "(" {
+		// count(pred), count(uid) and the like are values.
+		p.next()
+		arg := p.next()
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		b.Name = b.Name + "(" + arg + ")"
+		return b, nil
+	}
+
+	for {
+		switch t := p.peek(); {
+		case t == "(":
+			if err := p.args(b, root); err != nil {
+				return nil, err
+			}
+			continue
+		case t == "@filter":
+			p.next()
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			f, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			b.Filter = f
+			continue
+		case strings.HasPrefix(t, "@"):
+			return nil, fmt.Errorf("unsupported directive %s", t)
+		}
+		break
+	}
+	if p.peek() != "{" {
+		return b, nil
+	}
+	p.next()
+	b.IsBlock = true
+	for p.peek() != "}" {
+		if p.peek() == "" {
+			return nil, fmt.Errorf("unterminated block %s", b.Name)
+		}
+		f, err := p.block(false)
+		if err != nil {
+			return nil, err
+		}
+		if f.Name == "_uid_" || f.Name == "_count_" {
+			b.Legacy = true
+		}
+		b.Fields = append(b.Fields, f)
+	}
+	p.next()
+	return b, nil
+}
+
+func (p *parser) args(b *Block, root bool) error {
+	p.next() // (
+	if root && p.peekAt(1) == "(" {
+		// Old style root function, e.g. me(anyof("name", "good bad")).
+		fn, err := p.fn()
+		if err != nil {
+			return err
+		}
+		b.Root, b.Legacy = fn, true
+		return p.expect(")")
+	}
+	for p.peek() != ")" {
+		key := p.next()
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		var err error
+		switch key {
+		case "func":
+			b.Root, err = p.fn()
+		case "_uid_", "id":
+			b.UIDs = append(b.UIDs, p.next())
+			b.Legacy = key == "_uid_"
+		case "orderasc", "order":
+			b.Order = p.next()
+			b.Legacy = b.Legacy || key == "order"
+		case "orderdesc":
+			b.Order, b.Desc = p.next(), true
+		case "first":
+			b.First, err = strconv.Atoi(p.next())
+		case "offset":
+			b.Offset, err = strconv.Atoi(p.next())
+		default:
+			return fmt.Errorf("unsupported argument %s", key)
+		}
+		if err != nil {
+			return fmt.Errorf("argument %s: %v", key, err)
+		}
+		if p.peek() == "," {
+			p.next()
+		}
+	}
+	p.next()
+	return nil
+}
+
+func unquote(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		return s[1:]
+	}
+	return s
+}
+
+func (p *parser) fn() (*Func, error) {
+	f := &Func{Name: p.next()}
+	switch f.Name {
+	case "allof":
+		f.Name = "allofterms"
+	case "anyof":
+		f.Name = "anyofterms"
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for first := true; p.peek() != ")"; first = false {
+		t := p.next()
+		switch {
+		case t == "":
+			return nil, fmt.Errorf("unterminated %s", f.Name)
+		case t == ",":
+			continue
+		case t == "[" && geoFuncs[f.Name]:
+			// Coordinates are kept as JSON.
+			arg, err := p.brackets()
+			if err != nil {
+				return nil, err
+			}
+			f.Args = append(f.Args, arg)
+		case t == "[":
+			// eq(pred, [a, b]) is the same as eq(pred, a, b).
+			continue
+		case t == "]":
+			continue
+		case first && f.Name != "uid":
+			f.Pred = unquote(t)
+		default:
+			f.Args = append(f.Args, unquote(t))
+		}
+	}
+	p.next()
+	switch f.Name {
+	case "uid", "eq", "lt", "le", "gt", "ge", "allofterms", "anyofterms",
+		"alloftext", "anyoftext", "regexp", "match", "has", "similar_to",
+		"near", "within", "contains":
+	default:
+		return nil, fmt.Errorf("unsupported function %s", f.Name)
+	}
+	return f, nil
+}
+
+var geoFuncs = map[string]bool{"near": true, "within": true, "contains": true}
+
+// brackets returns the tokens up to the bracket that closes an opened one,
+// joined into JSON.
+func (p *parser) brackets() (string, error) {
+	var b strings.Builder
+	b.WriteString("[")
+	for depth := 1; depth > 0; {
+		t := p.next()
+		switch t {
+		case "":
+			return "", fmt.Errorf("unterminated [")
+		case "[":
+			depth++
+		case "]":
+			depth--
+		}
+		b.WriteString(t)
+	}
+	return b.String(), nil
+}
+
+func (p *parser) or() (*Filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" || p.peek() == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (*Filter, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" || p.peek() == "&&" {
+		p.next()
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (*Filter, error) {
+	switch p.peek() {
+	case "not", "!":
+		p.next()
+		f, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Op: "not", Left: f}, nil
+	case "(":
+		p.next()
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	}
+	fn, err := p.fn()
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{Func: fn}, nil
+}
@@ -0,0 +1,170 @@
+package dqlref
+
+import (
+	"strconv"
+	"strings"
+)
+
+// pred returns a predicate as written in a query, in angle brackets if it
+// has characters the lexer doesn't take in a name.
+func pred(p string) string {
+	for _, r := range p {
+		if !isNameChar(r) {
+			return "<" + p + ">"
+		}
+	}
+	return p
+}
+
+// quote quotes a value the way lex reads it back.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// raw reports whether the i-th argument of f is written without quotes.
+func (f *Func) raw(i int) bool {
+	switch f.Name {
+	case "uid", "regexp", "near", "within", "contains":
+		return true
+	case "match":
+		return i == 1
+	case "similar_to":
+		return i == 0
+	}
+	return false
+}
+
+// String returns the function as written in a query. Values are quoted;
+// uids, variables, regular expressions, coordinates and counts are not.
+func (f *Func) String() string {
+	var args []string
+	if f.Pred != "" {
+		args = append(args, pred(f.Pred))
+	}
+	for i, a := range f.Args {
+		if f.raw(i) {
+			args = append(args, a)
+		} else {
+			args = append(args, quote(a))
+		}
+	}
+	return f.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// String returns the filter as written in a query, with parentheses around
+// every and and or.
+func (f *Filter) String() string {
+	switch f.Op {
+	case "not":
+		return "not " + f.Left.String()
+	case "and", "or":
+		return "(" + f.Left.String() + " " + f.Op + " " + f.Right.String() + ")"
+	}
+	return f.Func.String()
+}
+
+// String returns the block as written in a query, indented by depth tabs.
+// It uses the current syntax, so blocks parsed from the old one print
+// differently.
+func (b *Block) String() string {
+	var sb strings.Builder
+	b.write(&sb, 0, true)
+	return sb.String()
+}
+
+func (b *Block) write(sb *strings.Builder, depth int, root bool) {
+	sb.WriteString(strings.Repeat("\t", depth))
+	if b.Var != "" {
+		sb.WriteString(b.Var + " as ")
+	}
+	if b.Alias != "" {
+		sb.WriteString(b.Alias + ": ")
+	}
+	if root || strings.Contains(b.Name, "(") {
+		// count(pred) and the like are written as they were parsed.
+		sb.WriteString(b.Name)
+	} else {
+		sb.WriteString(pred(b.Name))
+	}
+
+	var args []string
+	if b.Root != nil {
+		args = append(args, "func: "+b.Root.String())
+	}
+	for _, u := range b.UIDs {
+		args = append(args, "id: "+u)
+	}
+	if b.Order != "" {
+		dir := "orderasc"
+		if b.Desc {
+			dir = "orderdesc"
+		}
+		args = append(args, dir+": "+pred(b.Order))
+	}
+	if b.First != 0 {
+		args = append(args, "first: "+strconv.Itoa(b.First))
+	}
+	if b.Offset != 0 {
+		args = append(args, "offset: "+strconv.Itoa(b.Offset))
+	}
+	if len(args) > 0 {
+		sb.WriteString("(" + strings.Join(args, ", ") + ")")
+	}
+	if b.Filter != nil {
+		sb.WriteString(" @filter(" + b.Filter.String() + ")")
+	}
+	if !b.IsBlock {
+		sb.WriteString("\n")
+		return
+	}
+	sb.WriteString(" {\n")
+	for _, f := range b.Fields {
+		f.write(sb, depth+1, false)
+	}
+	sb.WriteString(strings.Repeat("\t", depth) + "}\n")
+}
+
+// Format returns a query made of root blocks.
+func Format(blocks []*Block) string {
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for _, b := range blocks {
+		b.write(&sb, 1, true)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Copy returns a deep copy of b, for changing a query without changing the
+// parsed one.
+func (b *Block) Copy() *Block {
+	c := *b
+	if b.Root != nil {
+		c.Root = b.Root.copy()
+	}
+	c.UIDs = append([]string(nil), b.UIDs...)
+	c.Filter = b.Filter.Copy()
+	c.Fields = nil
+	for _, f := range b.Fields {
+		c.Fields = append(c.Fields, f.Copy())
+	}
+	return &c
+}
+
+func (f *Func) copy() *Func {
+	c := *f
+	c.Args = append([]string(nil), f.Args...)
+	return &c
+}
+
+// Copy returns a deep copy of f, which may be nil.
+func (f *Filter) Copy() *Filter {
+	if f == nil {
+		return nil
+	}
+	c := &Filter{Op: f.Op, Left: f.Left.Copy(), Right: f.Right.Copy()}
+	if f.Func != nil {
+		c.Func = f.Func.copy()
+	}
+	return c
+}
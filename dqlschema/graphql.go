@@ -0,0 +1,107 @@
+package dqlschema
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// graphqlScalars maps DQL types to GraphQL scalars.
+var graphqlScalars = map[string]string{
+	"string":   "String",
+	"int":      "Int",
+	"float":    "Float",
+	"bool":     "Boolean",
+	"datetime": "DateTime",
+	"geo":      "Point",
+}
+
+// graphqlName makes a valid GraphQL name of s.
+func graphqlName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// GraphQL writes a GraphQL schema for the inferred types. Fields are named
+// after their predicate without the Type. prefix, with @dgraph(pred: ...)
+// when the predicate has another name. Edges point to the most common type
+// of their targets and are left out, with a comment, when the targets have
+// none. A field is required when every node of the type has it, and gets
+// @search by the suggested tokenizers.
+func (in *Inference) GraphQL(w io.Writer) error {
+	s := in.Schema()
+	types := make([]string, 0, len(in.Fields))
+	for t := range in.Fields {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	var b strings.Builder
+	for i, t := range types {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		name := graphqlName(t)
+		b.WriteString("type " + name)
+		if name != t {
+			fmt.Fprintf(&b, " @dgraph(type: %q)", t)
+		}
+		b.WriteString(" {\n")
+		var lines []string
+		taken := make(map[string]bool)
+		for _, pred := range s.Types[t] {
+			p := s.Predicates[pred]
+			field := graphqlName(strings.TrimPrefix(pred, t+"."))
+			var typ string
+			if p.IsEdge() {
+				target := in.Preds[pred].Target()
+				if target == "" {
+					lines = append(lines, fmt.Sprintf("# %s: edges to nodes without a type", pred))
+					continue
+				}
+				typ = graphqlName(target)
+			} else {
+				typ = graphqlScalars[p.Type]
+			}
+			if p.List {
+				typ = "[" + typ + "]"
+			}
+			if in.Fields[t][pred] == in.Types[t] {
+				typ += "!"
+			}
+			line := field + ": " + typ
+			if field != strings.TrimPrefix(pred, t+".") || !strings.HasPrefix(pred, t+".") {
+				line += fmt.Sprintf(" @dgraph(pred: %q)", pred)
+			}
+			switch {
+			case p.IsEdge() || len(p.Index) == 0:
+			case p.Type == "string" || p.Type == "datetime":
+				line += " @search(by: [" + strings.Join(p.Index, ", ") + "])"
+			default:
+				// Numbers, bools and points have a single search.
+				line += " @search"
+			}
+			taken[field] = true
+			lines = append(lines, line)
+		}
+		id := "id"
+		for taken[id] {
+			id = "_" + id
+		}
+		fmt.Fprintf(&b, "  %s: ID!\n", id)
+		for _, l := range lines {
+			b.WriteString("  " + l + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
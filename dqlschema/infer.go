@@ -0,0 +1,418 @@
+package dqlschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// typePred is the predicate holding the types of a node.
+const typePred = "dgraph.type"
+
+// The number of string values per predicate whose distinct count is kept,
+// and of edge targets whose types are looked up.
+const (
+	distinctSample = 10000
+	targetSample   = 1000
+)
+
+// PredStats is what was seen of a predicate in a data set.
+type PredStats struct {
+	Name string
+	// Count is the number of triples.
+	Count int
+	// Kinds counts the triples by the type of their value: int, float,
+	// bool, datetime, geo, string or uid.
+	Kinds map[string]int
+	// List is set once a node has more than one value for the predicate in
+	// the same language.
+	List   bool
+	Langs  map[string]int
+	Facets map[string]int
+	// Targets counts the types of a sample of the nodes edges point to.
+	Targets map[string]int
+
+	words    int
+	strings  int
+	sampled  int
+	distinct map[string]struct{}
+	subjects map[uint64]uint64 // the value of each node, until List is set
+	targets  []uint64
+}
+
+// Type returns the inferred type: uid if most triples are edges, and for
+// values the widest of the kinds seen, where ints widen to floats and any
+// other mix to string.
+func (p *PredStats) Type() string {
+	if p.Kinds["uid"] > p.Count-p.Kinds["uid"] {
+		return "uid"
+	}
+	var kinds []string
+	for k := range p.Kinds {
+		if k != "uid" {
+			kinds = append(kinds, k)
+		}
+	}
+	sort.Strings(kinds)
+	switch {
+	case len(kinds) == 1:
+		return kinds[0]
+	case len(kinds) == 2 && kinds[0] == "float" && kinds[1] == "int":
+		return "float"
+	}
+	return "string"
+}
+
+// Mixed reports whether the predicate holds values of more than one kind
+// that don't widen to each other, or both values and edges.
+func (p *PredStats) Mixed() bool {
+	t := p.Type()
+	for k := range p.Kinds {
+		if k != t && !(t == "float" && k == "int") {
+			return true
+		}
+	}
+	return false
+}
+
+// AvgWords is the average number of words of the string values.
+func (p *PredStats) AvgWords() float64 {
+	if p.strings == 0 {
+		return 0
+	}
+	return float64(p.words) / float64(p.strings)
+}
+
+// Distinct is the share of distinct values among the first string values.
+func (p *PredStats) Distinct() float64 {
+	if p.sampled == 0 {
+		return 0
+	}
+	return float64(len(p.distinct)) / float64(p.sampled)
+}
+
+// Target returns the most common type of the nodes edges point to, or "".
+func (p *PredStats) Target() string {
+	best, n := "", 0
+	for t, c := range p.Targets {
+		if c > n || c == n && t < best {
+			best, n = t, c
+		}
+	}
+	return best
+}
+
+// Index suggests tokenizers for the predicate: for strings hash for a few
+// repeated values, fulltext for long text, term for a few words and hash for
+// the rest, and the tokenizer of the same name for the other scalars.
+func (p *PredStats) Index() []string {
+	switch t := p.Type(); t {
+	case "string":
+		switch w := p.AvgWords(); {
+		case p.sampled >= 20 && p.Distinct() < 0.1:
+			return []string{"hash"}
+		case w >= 8:
+			return []string{"fulltext"}
+		case w >= 2:
+			return []string{"term"}
+		}
+		return []string{"hash"}
+	case "int", "float", "bool", "geo":
+		return []string{t}
+	case "datetime":
+		return []string{"year"}
+	}
+	return nil
+}
+
+// Inference is the result of scanning a data set.
+type Inference struct {
+	Preds map[string]*PredStats
+	// Types maps each type to the number of its nodes, and Fields each type
+	// to the number of its nodes with each predicate.
+	Types  map[string]int
+	Fields map[string]map[string]int
+
+	ids   map[string]int32
+	names []string
+	types map[uint64][]string
+	preds map[uint64][]int32
+}
+
+// NewInference returns an empty Inference to Add N-Quads to.
+func NewInference() *Inference {
+	return &Inference{
+		Preds: make(map[string]*PredStats),
+		ids:   make(map[string]int32),
+		types: make(map[uint64][]string),
+		preds: make(map[uint64][]int32),
+	}
+}
+
+// Add records an N-Quad.
+func (in *Inference) Add(nq nquad.NQuad) {
+	s := nquad.Fingerprint(nq.Subject)
+	if nq.Predicate == typePred {
+		if !nq.IsEdge() && !contains(in.types[s], nq.ObjectValue) {
+			in.types[s] = append(in.types[s], nq.ObjectValue)
+		}
+		return
+	}
+	p, ok := in.Preds[nq.Predicate]
+	if !ok {
+		p = &PredStats{
+			Name:     nq.Predicate,
+			Kinds:    make(map[string]int),
+			Langs:    make(map[string]int),
+			Facets:   make(map[string]int),
+			distinct: make(map[string]struct{}),
+			subjects: make(map[uint64]uint64),
+		}
+		in.Preds[nq.Predicate] = p
+		in.ids[nq.Predicate] = int32(len(in.names))
+		in.names = append(in.names, nq.Predicate)
+	}
+	id := in.ids[nq.Predicate]
+	if !containsID(in.preds[s], id) {
+		in.preds[s] = append(in.preds[s], id)
+	}
+
+	p.Count++
+	for _, f := range nq.Facets {
+		p.Facets[f.Key]++
+	}
+	if nq.Lang != "" {
+		p.Langs[nq.Lang]++
+	} else if !p.List {
+		// Values in different languages, and repeats of a triple, don't
+		// make a list.
+		o := nquad.Fingerprint(nq.ObjectId + "\x00" + nq.ObjectValue)
+		if prev, ok := p.subjects[s]; !ok {
+			p.subjects[s] = o
+		} else if prev != o {
+			p.List = true
+			p.subjects = nil
+		}
+	}
+	if nq.IsEdge() {
+		p.Kinds["uid"]++
+		if len(p.targets) < targetSample {
+			p.targets = append(p.targets, nquad.Fingerprint(nq.ObjectId))
+		}
+		return
+	}
+	kind := "string"
+	if nq.Lang == "" {
+		kind = ValueKind(nq.ObjectValue, nq.Datatype)
+	}
+	p.Kinds[kind]++
+	if kind != "string" {
+		return
+	}
+	p.strings++
+	p.words += len(strings.Fields(nq.ObjectValue))
+	if p.sampled < distinctSample {
+		p.sampled++
+		p.distinct[nq.ObjectValue] = struct{}{}
+	}
+}
+
+// ReadFrom adds the N-Quads of r until it ends.
+func (in *Inference) ReadFrom(r *nquad.Reader) error {
+	for {
+		nq, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", r.Line(), err)
+		}
+		in.Add(nq)
+	}
+}
+
+// Finish works out the types and edge targets once everything was added.
+func (in *Inference) Finish() {
+	in.Types = make(map[string]int)
+	in.Fields = make(map[string]map[string]int)
+	for s, ts := range in.types {
+		for _, t := range ts {
+			in.Types[t]++
+			if in.Fields[t] == nil {
+				in.Fields[t] = make(map[string]int)
+			}
+			for _, id := range in.preds[s] {
+				in.Fields[t][in.names[id]]++
+			}
+		}
+	}
+	for _, p := range in.Preds {
+		p.Targets = make(map[string]int)
+		for _, o := range p.targets {
+			for _, t := range in.types[o] {
+				p.Targets[t]++
+			}
+		}
+	}
+}
+
+// Schema returns the inferred schema, with suggested indexes.
+func (in *Inference) Schema() *Schema {
+	s := &Schema{
+		Predicates: make(map[string]*Predicate, len(in.Preds)),
+		Types:      make(map[string][]string, len(in.Fields)),
+	}
+	for name, ps := range in.Preds {
+		s.Predicates[name] = &Predicate{
+			Name:  name,
+			Type:  ps.Type(),
+			List:  ps.List,
+			Index: ps.Index(),
+			Lang:  len(ps.Langs) > 0 && ps.Type() == "string",
+		}
+	}
+	for t, fields := range in.Fields {
+		for f := range fields {
+			s.Types[t] = append(s.Types[t], f)
+		}
+		sort.Strings(s.Types[t])
+	}
+	return s
+}
+
+// DQL writes the inferred schema, with the facets and mixed kinds of each
+// predicate as comments.
+func (in *Inference) DQL(w io.Writer) error {
+	s := in.Schema()
+	var b strings.Builder
+	for _, name := range s.Names() {
+		b.WriteString(s.Predicates[name].String())
+		ps := in.Preds[name]
+		var notes []string
+		if len(ps.Facets) > 0 {
+			notes = append(notes, "facets: "+strings.Join(sortedKeys(ps.Facets), ", "))
+		}
+		if ps.Mixed() {
+			var kinds []string
+			for _, k := range sortedKeys(ps.Kinds) {
+				kinds = append(kinds, fmt.Sprintf("%s %d", k, ps.Kinds[k]))
+			}
+			notes = append(notes, "mixed: "+strings.Join(kinds, ", "))
+		}
+		if len(notes) > 0 {
+			b.WriteString(" # " + strings.Join(notes, "; "))
+		}
+		b.WriteByte('\n')
+	}
+	s.Predicates = nil
+	b.WriteString(s.String())
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func sortedKeys(m map[string]int) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func contains(l []string, s string) bool {
+	for _, x := range l {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(l []int32, id int32) bool {
+	for _, x := range l {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+// datatypes maps the datatypes of RDF literals to kinds.
+var datatypes = map[string]string{
+	"int":                "int",
+	"integer":            "int",
+	"long":               "int",
+	"float":              "float",
+	"double":             "float",
+	"decimal":            "float",
+	"boolean":            "bool",
+	"dateTime":           "datetime",
+	"date":               "datetime",
+	"geojson":            "geo",
+	"string":             "string",
+	"langString":         "string",
+	"normalizedString":   "string",
+	"nonNegativeInteger": "int",
+	"positiveInteger":    "int",
+}
+
+// timeLayouts are the datetime forms recognized in untyped literals.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ValueKind returns the kind of a literal, int, float, bool, datetime, geo or
+// string, from its datatype if it has one and from the value otherwise.
+// Numbers with leading zeros, such as zip codes, are strings.
+func ValueKind(v, datatype string) string {
+	if datatype != "" {
+		name := datatype
+		if i := strings.LastIndexAny(name, ":#/"); i >= 0 {
+			name = name[i+1:]
+		}
+		if k, ok := datatypes[name]; ok {
+			return k
+		}
+		return "string"
+	}
+	if v == "" {
+		return "string"
+	}
+	digits := strings.TrimLeft(v, "-+")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return "string"
+	}
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return "int"
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil && !strings.ContainsAny(v, "nN") {
+		return "float"
+	}
+	if v == "true" || v == "false" {
+		return "bool"
+	}
+	for _, l := range timeLayouts {
+		if _, err := time.Parse(l, v); err == nil {
+			return "datetime"
+		}
+	}
+	if v[0] == '{' && strings.Contains(v, "coordinates") {
+		var g struct {
+			Type        string
+			Coordinates json.RawMessage
+		}
+		if json.Unmarshal([]byte(v), &g) == nil && g.Type != "" && len(g.Coordinates) > 0 {
+			return "geo"
+		}
+	}
+	return "string"
+}
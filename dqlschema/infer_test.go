@@ -0,0 +1,152 @@
+package dqlschema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+const films = `
+_:f1 <dgraph.type> "Film" .
+_:f1 <name> "Blade Runner"@en .
+_:f1 <name> "Der Blade Runner"@de .
+_:f1 <initial_release_date> "1982-06-25" .
+_:f1 <rating> "8" .
+_:f1 <director.film> _:d1 .
+_:f1 <genre> _:g1 (weight=1) .
+_:f1 <genre> _:g2 .
+_:f1 <genre> _:g2 .
+_:f2 <dgraph.type> "Film" .
+_:f2 <name> "Alien"@en .
+_:f2 <rating> "8.5"^^<xs:float> .
+_:f2 <code> "00501" .
+_:f2 <code> "12" .
+_:f2 <location> "{\"type\":\"Point\",\"coordinates\":[1,2]}"^^<geo:geojson> .
+_:d1 <dgraph.type> "Director" .
+_:d1 <Director.name> "Ridley Scott" .
+_:d1 <Director.bio> "an English film director and producer of science fiction films" .
+_:d1 <Director.active> "true" .
+_:g1 <genre.name> "Science fiction" .
+`
+
+func inferString(t *testing.T, rdf string) *Inference {
+	in := NewInference()
+	require.NoError(t, in.ReadFrom(nquad.NewReader(strings.NewReader(rdf))))
+	in.Finish()
+	return in
+}
+
+func TestInfer(t *testing.T) {
+	in := inferString(t, films)
+	s := in.Schema()
+
+	require.Equal(t, &Predicate{Name: "name", Type: "string", Index: []string{"term"}, Lang: true}, s.Predicates["name"])
+	require.Equal(t, &Predicate{Name: "initial_release_date", Type: "datetime", Index: []string{"year"}}, s.Predicates["initial_release_date"])
+	require.Equal(t, "float", s.Predicates["rating"].Type)
+	require.Equal(t, &Predicate{Name: "code", Type: "string", List: true, Index: []string{"hash"}}, s.Predicates["code"])
+	require.Equal(t, "geo", s.Predicates["location"].Type)
+	require.Equal(t, []string{"fulltext"}, s.Predicates["Director.bio"].Index)
+	require.Equal(t, "bool", s.Predicates["Director.active"].Type)
+
+	// The repeated edge doesn't make director.film a list, the second genre
+	// does.
+	require.Equal(t, &Predicate{Name: "director.film", Type: "uid"}, s.Predicates["director.film"])
+	require.Equal(t, &Predicate{Name: "genre", Type: "uid", List: true}, s.Predicates["genre"])
+	require.Equal(t, "Director", in.Preds["director.film"].Target())
+	require.Equal(t, "", in.Preds["genre"].Target())
+	require.Equal(t, map[string]int{"weight": 1}, in.Preds["genre"].Facets)
+	require.True(t, in.Preds["code"].Mixed())
+	require.False(t, in.Preds["rating"].Mixed())
+
+	require.Equal(t, map[string]int{"Film": 2, "Director": 1}, in.Types)
+	require.Equal(t, []string{"code", "director.film", "genre", "initial_release_date", "location", "name", "rating"}, s.Types["Film"])
+	require.Equal(t, 2, in.Fields["Film"]["rating"])
+	require.Equal(t, 1, in.Fields["Film"]["code"])
+	_, ok := s.Predicates[typePred]
+	require.False(t, ok)
+}
+
+func TestValueKind(t *testing.T) {
+	for v, want := range map[string]string{
+		"12":                   "int",
+		"-12":                  "int",
+		"1.5":                  "float",
+		"0.5":                  "float",
+		"007":                  "string",
+		"NaN":                  "string",
+		"false":                "bool",
+		"2006-01-02T15:04:05Z": "datetime",
+		"2006-01-02":           "datetime",
+		`{"type":"Polygon","coordinates":[[[1,2],[3,4],[1,2]]]}`: "geo",
+		`{"coordinates":1}`: "string",
+		"":                  "string",
+	} {
+		require.Equal(t, want, ValueKind(v, ""), v)
+	}
+	require.Equal(t, "int", ValueKind("1", "http://www.w3.org/2001/XMLSchema#integer"))
+	require.Equal(t, "string", ValueKind("1", "xs:string"))
+}
+
+func TestInferOutput(t *testing.T) {
+	in := inferString(t, films)
+	var dql strings.Builder
+	require.NoError(t, in.DQL(&dql))
+	require.Contains(t, dql.String(), "genre: [uid] . # facets: weight\n")
+	require.Contains(t, dql.String(), "code: [string] @index(hash) . # mixed: int 1, string 1\n")
+
+	// The schema parses back.
+	s, err := Parse(dql.String())
+	require.NoError(t, err)
+	require.Equal(t, in.Schema(), s)
+
+	var gql strings.Builder
+	require.NoError(t, in.GraphQL(&gql))
+	require.Equal(t, `type Director {
+  id: ID!
+  active: Boolean! @search
+  bio: String! @search(by: [fulltext])
+  name: String! @search(by: [term])
+}
+
+type Film {
+  id: ID!
+  code: [String] @dgraph(pred: "code") @search(by: [hash])
+  director_film: Director @dgraph(pred: "director.film")
+  # genre: edges to nodes without a type
+  initial_release_date: DateTime @dgraph(pred: "initial_release_date") @search(by: [year])
+  location: Point @dgraph(pred: "location") @search
+  name: String! @dgraph(pred: "name") @search(by: [term])
+  rating: Float! @dgraph(pred: "rating") @search
+}
+`, gql.String())
+}
+
+func TestInferDonors(t *testing.T) {
+	r, err := nquad.Open("../donors/10schools/donors.rdf")
+	require.NoError(t, err)
+	defer r.Close()
+	in := NewInference()
+	require.NoError(t, in.ReadFrom(r))
+	in.Finish()
+
+	// Compare with the hand written schema, which also has predicates the
+	// data doesn't use.
+	want, err := ReadFile("../donors/10schools/donors.schema")
+	require.NoError(t, err)
+	got := in.Schema()
+	for name, p := range want.Predicates {
+		if got.Predicates[name] == nil {
+			continue
+		}
+		require.Equal(t, p.Type, got.Predicates[name].Type, name)
+		if p.IsEdge() {
+			require.Equal(t, p.List, got.Predicates[name].List, name)
+		}
+	}
+	require.Equal(t, "School", in.Preds["Project.school"].Target())
+	require.Equal(t, []string{"term"}, got.Predicates["Project.title"].Index)
+	require.Equal(t, []string{"hash"}, got.Predicates["Project.grade"].Index)
+}
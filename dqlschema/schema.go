@@ -0,0 +1,342 @@
+// Package dqlschema parses the DQL schema files used in this repository, such
+// as data/1million.schema, data/goldendata.schema or vector/products.schema,
+// into predicates with their type, list flag, tokenizers and directives. It
+// also reads the older form used by indextest/schema.txt, where predicates
+// are listed inside scalar ( ... ) and a bare @index picks the default
+// tokenizer of the type. Type definitions are parsed too.
+//
+// Schemas can also be inferred from a data set, see Inference, and written
+// out as DQL or GraphQL.
+package dqlschema
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Predicate is one predicate of a schema.
+type Predicate struct {
+	Name string
+	// Type is the scalar type, e.g. string, int or uid. The older date type
+	// is kept as written.
+	Type string
+	// List is set for [type].
+	List bool
+	// Index lists the tokenizers, e.g. hash and term.
+	Index []string
+	// Options holds the arguments of the tokenizers, such as the metric of
+	// hnsw, by name.
+	Options map[string]string
+	Lang    bool
+	Reverse bool
+	Count   bool
+	Upsert  bool
+}
+
+// HasIndex reports whether p is indexed with tokenizer tok.
+func (p *Predicate) HasIndex(tok string) bool {
+	for _, t := range p.Index {
+		if t == tok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEdge reports whether p points to other nodes.
+func (p *Predicate) IsEdge() bool {
+	return p.Type == "uid"
+}
+
+// Schema is a parsed schema file.
+type Schema struct {
+	Predicates map[string]*Predicate
+	// Types maps type names to their fields.
+	Types map[string][]string
+}
+
+// defaultIndex is the tokenizer a bare @index stands for.
+var defaultIndex = map[string]string{
+	"string":   "term",
+	"int":      "int",
+	"float":    "float",
+	"bool":     "bool",
+	"datetime": "year",
+	"date":     "year",
+	"geo":      "geo",
+}
+
+// ReadFile parses a schema file.
+func ReadFile(path string) (*Schema, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("while parsing %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Parse parses a schema.
+func Parse(schema string) (*Schema, error) {
+	s := &Schema{
+		Predicates: make(map[string]*Predicate),
+		Types:      make(map[string][]string),
+	}
+	var typ string // the type whose fields are being read
+	inType := false
+	for no, line := range strings.Split(schema, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 && !strings.Contains(line[:i], `"`) {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case inType:
+			if strings.HasPrefix(line, "}") {
+				inType = false
+				continue
+			}
+			// Fields are a name, optionally with a type in the older form.
+			f := strings.Trim(strings.Fields(strings.SplitN(line, ":", 2)[0])[0], "<>")
+			s.Types[typ] = append(s.Types[typ], f)
+			continue
+		case strings.HasPrefix(line, "type ") && strings.HasSuffix(line, "{"):
+			typ = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "type "), "{"))
+			s.Types[typ] = nil
+			inType = true
+			continue
+		case strings.HasPrefix(line, "scalar"), line == "(", line == ")":
+			// The older scalar ( ... ) wrapper, or scalar pred: type.
+			line = strings.TrimSpace(strings.TrimLeft(strings.TrimPrefix(line, "scalar"), "( "))
+			if line == "" || line == ")" {
+				continue
+			}
+		}
+		p, err := parsePredicate(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", no+1, err)
+		}
+		s.Predicates[p.Name] = p
+	}
+	if inType {
+		return nil, fmt.Errorf("unterminated type %s", typ)
+	}
+	return s, nil
+}
+
+func parsePredicate(line string) (*Predicate, error) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("expected pred: type, got %q", line)
+	}
+	p := &Predicate{Name: strings.Trim(strings.TrimSpace(line[:i]), "<>")}
+	rest := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line[i+1:]), "."))
+	if p.Name == "" || rest == "" {
+		return nil, fmt.Errorf("expected pred: type, got %q", line)
+	}
+	end := strings.IndexAny(rest, " \t@")
+	if end < 0 {
+		end = len(rest)
+	}
+	p.Type, rest = rest[:end], rest[end:]
+	if strings.HasPrefix(p.Type, "[") {
+		p.List = true
+		p.Type = strings.Trim(p.Type, "[]")
+	}
+
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		if rest[0] != '@' {
+			return nil, fmt.Errorf("unexpected %q in %s", rest, p.Name)
+		}
+		end := strings.IndexAny(rest, " \t(")
+		if end < 0 {
+			end = len(rest)
+		}
+		dir := rest[1:end]
+		rest = rest[end:]
+		var args string
+		if strings.HasPrefix(rest, "(") {
+			n, err := closing(rest)
+			if err != nil {
+				return nil, fmt.Errorf("@%s of %s: %v", dir, p.Name, err)
+			}
+			args, rest = rest[1:n], rest[n+1:]
+		}
+		switch dir {
+		case "index":
+			p.Index, p.Options = tokenizers(args)
+			if len(p.Index) == 0 && defaultIndex[p.Type] != "" {
+				p.Index = []string{defaultIndex[p.Type]}
+			}
+		case "lang":
+			p.Lang = true
+		case "reverse":
+			p.Reverse = true
+		case "count":
+			p.Count = true
+		case "upsert":
+			p.Upsert = true
+		}
+	}
+	return p, nil
+}
+
+// closing returns the index of the parenthesis closing the one s starts with.
+func closing(s string) (int, error) {
+	depth := 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unbalanced parentheses")
+}
+
+// tokenizers returns the names in an @index argument list and the options
+// of those that take some, e.g. "hash, hnsw(metric: \"euclidean\")" gives
+// hash and hnsw, and metric euclidean.
+func tokenizers(args string) ([]string, map[string]string) {
+	var out []string
+	var opts map[string]string
+	depth, start := 0, 0
+	add := func(s string) {
+		s = strings.TrimSpace(s)
+		if i := strings.Index(s, "("); i >= 0 {
+			for _, kv := range strings.Split(strings.TrimSuffix(s[i+1:], ")"), ",") {
+				kv := strings.SplitN(kv, ":", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				if opts == nil {
+					opts = make(map[string]string)
+				}
+				opts[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			}
+			s = strings.TrimSpace(s[:i])
+		}
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	for i, c := range args {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(args[start:i])
+				start = i + 1
+			}
+		}
+	}
+	add(args[start:])
+	return out, opts
+}
+
+// Names returns the predicate names, sorted.
+func (s *Schema) Names() []string {
+	out := make([]string, 0, len(s.Predicates))
+	for name := range s.Predicates {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// TypeMap maps each predicate to its type, in brackets for lists, as
+// dqlref.New takes it.
+func (s *Schema) TypeMap() map[string]string {
+	out := make(map[string]string, len(s.Predicates))
+	for name, p := range s.Predicates {
+		if p.List {
+			out[name] = "[" + p.Type + "]"
+		} else {
+			out[name] = p.Type
+		}
+	}
+	return out
+}
+
+// predName writes a predicate name, in angle brackets unless it is made of
+// letters, digits, dots and underscores.
+func predName(name string) string {
+	for _, c := range name {
+		if !(c == '.' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return "<" + name + ">"
+		}
+	}
+	return name
+}
+
+// String formats p as a line of a schema, without a newline.
+func (p *Predicate) String() string {
+	var b strings.Builder
+	b.WriteString(predName(p.Name))
+	b.WriteString(": ")
+	if p.List {
+		b.WriteString("[" + p.Type + "]")
+	} else {
+		b.WriteString(p.Type)
+	}
+	if len(p.Index) > 0 {
+		toks := make([]string, len(p.Index))
+		for i, t := range p.Index {
+			toks[i] = t
+			if t == "hnsw" && len(p.Options) > 0 {
+				var opts []string
+				for k, v := range p.Options {
+					opts = append(opts, fmt.Sprintf("%s: %q", k, v))
+				}
+				sort.Strings(opts)
+				toks[i] += "(" + strings.Join(opts, ", ") + ")"
+			}
+		}
+		b.WriteString(" @index(" + strings.Join(toks, ", ") + ")")
+	}
+	for _, d := range []struct {
+		on   bool
+		name string
+	}{{p.Lang, "lang"}, {p.Reverse, "reverse"}, {p.Count, "count"}, {p.Upsert, "upsert"}} {
+		if d.on {
+			b.WriteString(" @" + d.name)
+		}
+	}
+	b.WriteString(" .")
+	return b.String()
+}
+
+// String formats the schema: the predicates, sorted, then the types.
+func (s *Schema) String() string {
+	var b strings.Builder
+	for _, name := range s.Names() {
+		b.WriteString(s.Predicates[name].String())
+		b.WriteByte('\n')
+	}
+	types := make([]string, 0, len(s.Types))
+	for t := range s.Types {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		fmt.Fprintf(&b, "\ntype %s {\n", predName(t))
+		for _, f := range s.Types[t] {
+			fmt.Fprintf(&b, "\t%s\n", predName(f))
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
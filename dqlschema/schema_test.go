@@ -0,0 +1,60 @@
+package dqlschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse(`
+# Films.
+director.film        : [uid] @reverse @count .
+initial_release_date : datetime @index(year) .
+name                 : string @index(hash, term, trigram, fulltext) @lang .
+<email>: string @index(exact) @upsert .
+Product.embedding: float32vector @index(hnsw(metric: "euclidean", exponent: "4")) .
+
+type Film {
+	name
+	initial_release_date
+}
+`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Product.embedding", "director.film", "email", "initial_release_date", "name"}, s.Names())
+
+	require.Equal(t, &Predicate{Name: "director.film", Type: "uid", List: true, Reverse: true, Count: true},
+		s.Predicates["director.film"])
+	require.Equal(t, &Predicate{Name: "name", Type: "string", Index: []string{"hash", "term", "trigram", "fulltext"}, Lang: true},
+		s.Predicates["name"])
+	require.True(t, s.Predicates["email"].Upsert)
+	require.Equal(t, []string{"hnsw"}, s.Predicates["Product.embedding"].Index)
+	require.Equal(t, map[string]string{"metric": "euclidean", "exponent": "4"}, s.Predicates["Product.embedding"].Options)
+	require.True(t, s.Predicates["initial_release_date"].HasIndex("year"))
+	require.Equal(t, []string{"name", "initial_release_date"}, s.Types["Film"])
+	require.Equal(t, "datetime", s.TypeMap()["initial_release_date"])
+}
+
+func TestParseFiles(t *testing.T) {
+	// The older form, with a bare @index.
+	s, err := ReadFile("../indextest/schema.txt")
+	require.NoError(t, err)
+	require.Equal(t, []string{"term"}, s.Predicates["type.object.name.en"].Index)
+	require.Equal(t, "date", s.Predicates["film.film.initial_release_date"].Type)
+
+	s, err = ReadFile("../vector/products.schema")
+	require.NoError(t, err)
+	require.Equal(t, "float32vector", s.Predicates["Product.embedding"].Type)
+	require.Equal(t, []string{"hash", "term"}, s.Predicates["Product.name"].Index)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, schema := range []string{
+		"name string .",
+		"name: string @index(term .",
+		"type Film {\n name\n",
+	} {
+		_, err := Parse(schema)
+		require.Error(t, err, schema)
+	}
+}
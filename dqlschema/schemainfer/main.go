@@ -0,0 +1,93 @@
+// This tool infers a schema from RDF or JSON data sets, plain or gzipped: the
+// type, cardinality, languages and facets of each predicate and the
+// predicates of each dgraph.type. It writes a DQL schema, and a GraphQL
+// schema, with suggested indexes:
+//
+//	./schemainfer --graphql donors.graphql ../../donors/10schools/donors.rdf
+//	./schemainfer --dql 21million.schema --report ../../data/21million.rdf.gz
+//
+// The suggestions are a starting point: check the indexes against the
+// queries that will be run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dgraph-io/benchmarks/dqlschema"
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+var (
+	dql     = flag.String("dql", "-", "Output file of the DQL schema, - for stdout, or empty for none.")
+	graphql = flag.String("graphql", "", "Output file of the GraphQL schema, - for stdout, or empty for none.")
+	report  = flag.Bool("report", false, "Print what was seen of each predicate to stderr.")
+)
+
+func write(path string, fn func(io.Writer) error) error {
+	if path == "" {
+		return nil
+	}
+	if path == "-" {
+		return fn(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func printReport(in *dqlschema.Inference) {
+	w := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "predicate\ttriples\ttype\tlist\tlangs\tfacets\twords\tdistinct")
+	s := in.Schema()
+	for _, name := range s.Names() {
+		p := in.Preds[name]
+		fmt.Fprintf(w, "%s\t%d\t%s\t%v\t%d\t%d\t%.1f\t%.2f\n", name, p.Count, p.Type(), p.List,
+			len(p.Langs), len(p.Facets), p.AvgWords(), p.Distinct())
+	}
+	w.Flush()
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: schemainfer [flags] file...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	in := dqlschema.NewInference()
+	for _, path := range flag.Args() {
+		r, err := nquad.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = in.ReadFrom(r)
+		r.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+	in.Finish()
+	if *report {
+		printReport(in)
+	}
+	if err := write(*dql, in.DQL); err != nil {
+		log.Fatal(err)
+	}
+	if err := write(*graphql, in.GraphQL); err != nil {
+		log.Fatal(err)
+	}
+}
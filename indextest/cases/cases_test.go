@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/dqlref"
+	"github.com/dgraph-io/benchmarks/memgraph"
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+func TestCases(t *testing.T) {
+	_, s, err := withVectorIndex(`
+name: string @index(hash, exact, term, fulltext, trigram) @lang .
+year: int @index(int) .
+rating: float @index(float) .
+released: datetime @index(year) .
+loc: geo @index(geo) .
+Product.embedding: float32vector .
+`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"hnsw"}, s.Predicates["Product.embedding"].Index)
+	require.Equal(t, "euclidean", s.Predicates["Product.embedding"].Options["metric"])
+
+	g := memgraph.New()
+	for _, line := range []string{
+		`<a> <name> "Running with the Dogs"@en .`,
+		`<b> <name> "The Dog Runner"@en .`,
+		`<b> <name> "Der Hundeläufer"@de .`,
+		`<a> <year> "1999" .`,
+		`<b> <year> "2001" .`,
+		`<a> <rating> "7.5" .`,
+		`<a> <released> "1999-05-01" .`,
+		`<a> <loc> "{'type':'Point','coordinates':[-122.42,37.77]}"^^<geo:geojson> .`,
+		`<a> <Product.embedding> "[1, 0]" .`,
+		`<b> <Product.embedding> "[0.9, 0.1]" .`,
+	} {
+		nq, err := nquad.Parse(line)
+		require.NoError(t, err)
+		g.Add(nq)
+	}
+	gen := &generator{s: s, g: g, rnd: rand.New(rand.NewSource(1)), uids: make(map[string][]uint64)}
+	for _, name := range s.Names() {
+		gen.predicate(s.Predicates[name])
+	}
+
+	e := dqlref.New(g, s.TypeMap())
+	funcs := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, c := range gen.cases {
+		require.False(t, names[c.Name], c.Name)
+		names[c.Name] = true
+		funcs[c.Blocks[0].Root.Name] = true
+		text := dqlref.Format(c.Blocks)
+		_, err := dqlref.Parse(text)
+		require.NoError(t, err, text)
+		res, err := e.Eval(c.Blocks)
+		require.NoError(t, err, text)
+		require.NotEmpty(t, res["q"], text)
+		if strings.HasPrefix(c.Name, "year_") {
+			require.Contains(t, text, "released")
+		}
+	}
+	for _, f := range []string{"eq", "ge", "lt", "allofterms", "anyofterms", "alloftext",
+		"anyoftext", "regexp", "match", "near", "within", "similar_to"} {
+		require.True(t, funcs[f], f)
+	}
+}
@@ -0,0 +1,362 @@
+// This tool generates index test cases for every tokenizer in a schema file:
+// hash, exact, term, fulltext, trigram, int, float, datetime, bool, geo and
+// float32vector. For each it samples values from the data set, builds
+// queries with the functions the index serves, and computes their answers
+// from the RDF held in memory with dqlref. index_test.go runs the cases with
+// --cases against a server that loaded the same data and schema.
+//
+//	go run ./cases --schema ../data/1million.schema --rdf ../data/1million.rdf.gz
+//	go run ./cases --schema ../vector/products.schema --rdf ../vector/products.rdf.gz
+//
+// Each query counts the matches and lists the first sorted values, which
+// doesn't depend on the uids the server assigned. Vector predicates without
+// an index get --vector-index, and the schema to load is written next to the
+// cases.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/benchmarks/dqlref"
+	"github.com/dgraph-io/benchmarks/dqlschema"
+	"github.com/dgraph-io/benchmarks/memgraph"
+)
+
+var (
+	schemaFile  = flag.String("schema", "", "DQL schema of the data set.")
+	rdfFile     = flag.String("rdf", "", "Data set, plain or gzipped.")
+	outDir      = flag.String("out", "", "Folder for the cases. Defaults to data/<schema name>.")
+	langSep     = flag.String("lang-sep", "@", "Joins predicates and language tags: name@en, or name.en for data loaded by the old loader.")
+	num         = flag.Int("n", 3, "Number of cases per function and predicate.")
+	seed        = flag.Int64("seed", 1, "Random seed for sampling values.")
+	first       = flag.Int("first", 20, "Number of sorted values listed per case.")
+	k           = flag.Int("k", 10, "Number of neighbours asked for by similar_to.")
+	vectorIndex = flag.String("vector-index", `hnsw(metric: "euclidean")`, "Index for float32vector predicates that have none.")
+	label       = flag.String("label", "", "Predicate listed for the neighbours found by similar_to. Defaults to the first string predicate with data.")
+)
+
+// Case is a generated query, named for its tokenizer, function and
+// predicate.
+type Case struct {
+	Name   string
+	Blocks []*dqlref.Block
+}
+
+type generator struct {
+	s   *dqlschema.Schema
+	g   *memgraph.Graph
+	rnd *rand.Rand
+	// uids of each value predicate, sorted, to sample from.
+	uids  map[string][]uint64
+	cases []Case
+}
+
+func (gen *generator) sample(pred string) string {
+	uids, ok := gen.uids[pred]
+	if !ok {
+		for u := range gen.g.Values[pred] {
+			uids = append(uids, u)
+		}
+		uids = memgraph.Sorted(uids)
+		gen.uids[pred] = uids
+	}
+	vals := gen.g.Values[pred][uids[gen.rnd.Intn(len(uids))]]
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	return vals[gen.rnd.Intn(len(vals))]
+}
+
+// preds returns the value predicates that stand for p in the data: p, or
+// p@lang for each language of a @lang predicate.
+func (gen *generator) preds(p *dqlschema.Predicate) []string {
+	var out []string
+	for v := range gen.g.Values {
+		if v == p.Name || (p.Lang && strings.HasPrefix(v, p.Name+gen.g.LangSep)) {
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+var wordRe = regexp.MustCompile(`[\pL\pN]{3,}`)
+
+// funcs returns the functions the tokenizer serves, for a value of pred.
+func (gen *generator) funcs(tok, pred, v string) []*dqlref.Func {
+	fn := func(name string, args ...string) *dqlref.Func {
+		return &dqlref.Func{Name: name, Pred: pred, Args: args}
+	}
+	switch tok {
+	case "hash":
+		return []*dqlref.Func{fn("eq", v)}
+	case "exact", "int", "float", "year", "month", "day", "hour":
+		return []*dqlref.Func{fn("eq", v), fn("ge", v), fn("lt", v)}
+	case "bool":
+		return []*dqlref.Func{fn("eq", v)}
+	case "term", "fulltext":
+		var words []string
+		for _, w := range memgraph.Terms(v) {
+			// Stop words are not in the fulltext index.
+			if tok == "term" || len(memgraph.FullTextTerms(w)) > 0 {
+				words = append(words, w)
+			}
+		}
+		if len(words) == 0 {
+			return nil
+		}
+		gen.rnd.Shuffle(len(words), func(i, j int) { words[i], words[j] = words[j], words[i] })
+		if len(words) > 2 {
+			words = words[:2]
+		}
+		q := strings.Join(words, " ")
+		if tok == "term" {
+			return []*dqlref.Func{fn("allofterms", q), fn("anyofterms", q)}
+		}
+		return []*dqlref.Func{fn("alloftext", q), fn("anyoftext", q)}
+	case "trigram":
+		words := wordRe.FindAllString(v, -1)
+		if len(words) == 0 {
+			return nil
+		}
+		w := words[gen.rnd.Intn(len(words))]
+		return []*dqlref.Func{
+			fn("regexp", "/"+regexp.QuoteMeta(w)+"/"),
+			fn("regexp", "/"+regexp.QuoteMeta(strings.ToUpper(w))+"/i"),
+			fn("match", v, "2"),
+		}
+	case "geo":
+		return gen.geoFuncs(pred, v)
+	case "hnsw":
+		return []*dqlref.Func{fn("similar_to", strconv.Itoa(*k), v)}
+	}
+	return nil
+}
+
+type geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func (gen *generator) geoFuncs(pred, v string) []*dqlref.Func {
+	var g geometry
+	if json.Unmarshal([]byte(strings.Replace(v, "'", `"`, -1)), &g) != nil {
+		return nil
+	}
+	var at [2]float64
+	switch g.Type {
+	case "Point":
+		if json.Unmarshal(g.Coordinates, &at) != nil {
+			return nil
+		}
+	case "Polygon":
+		var rings [][][2]float64
+		if json.Unmarshal(g.Coordinates, &rings) != nil || len(rings) == 0 || len(rings[0]) == 0 {
+			return nil
+		}
+		// The mean of the vertices is inside convex polygons at least.
+		for _, p := range rings[0] {
+			at[0] += p[0] / float64(len(rings[0]))
+			at[1] += p[1] / float64(len(rings[0]))
+		}
+		pt := fmt.Sprintf("[%g,%g]", at[0], at[1])
+		return []*dqlref.Func{{Name: "contains", Pred: pred, Args: []string{pt}}}
+	default:
+		return nil
+	}
+	pt := fmt.Sprintf("[%g,%g]", at[0], at[1])
+	d := 0.1
+	box := fmt.Sprintf("[[[%g,%g],[%g,%g],[%g,%g],[%g,%g],[%g,%g]]]",
+		at[0]-d, at[1]-d, at[0]+d, at[1]-d, at[0]+d, at[1]+d, at[0]-d, at[1]+d, at[0]-d, at[1]-d)
+	return []*dqlref.Func{
+		{Name: "near", Pred: pred, Args: []string{pt, "10000"}},
+		{Name: "within", Pred: pred, Args: []string{box}},
+	}
+}
+
+// labelPred returns the predicate listed for similar_to results.
+func (gen *generator) labelPred() string {
+	if *label != "" {
+		return *label
+	}
+	for _, name := range gen.s.Names() {
+		if p := gen.s.Predicates[name]; p.Type == "string" {
+			if preds := gen.preds(p); len(preds) > 0 {
+				return preds[0]
+			}
+		}
+	}
+	return ""
+}
+
+// query returns the blocks of a case for fn on pred.
+func (gen *generator) query(fn *dqlref.Func, typ string) []*dqlref.Block {
+	if fn.Name == "similar_to" {
+		b := &dqlref.Block{Name: "q", Root: fn, IsBlock: true}
+		if l := gen.labelPred(); l != "" {
+			b.Fields = []*dqlref.Block{{Name: l}}
+		} else {
+			b.Fields = []*dqlref.Block{{Name: "count(uid)"}}
+		}
+		return []*dqlref.Block{b}
+	}
+	count := &dqlref.Block{Name: "q", Root: fn, IsBlock: true,
+		Fields: []*dqlref.Block{{Name: "count(uid)"}}}
+	switch typ {
+	case "geo", "bool":
+		// Geo values and bools don't sort.
+		return []*dqlref.Block{count}
+	}
+	vals := &dqlref.Block{Name: "vals", Root: fn, IsBlock: true, Order: fn.Pred, First: *first,
+		Fields: []*dqlref.Block{{Name: fn.Pred}}}
+	return []*dqlref.Block{count, vals}
+}
+
+var unsafe = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+func (gen *generator) predicate(p *dqlschema.Predicate) {
+	preds := gen.preds(p)
+	if len(preds) == 0 {
+		log.Printf("%s: no values, skipped", p.Name)
+		return
+	}
+	for _, tok := range p.Index {
+		seen := make(map[string]bool)
+		for i := 0; i < *num; i++ {
+			pred := preds[gen.rnd.Intn(len(preds))]
+			v := gen.sample(pred)
+			for _, fn := range gen.funcs(tok, pred, v) {
+				blocks := gen.query(fn, p.Type)
+				text := dqlref.Format(blocks)
+				if seen[text] {
+					continue
+				}
+				seen[text] = true
+				gen.cases = append(gen.cases, Case{
+					Name:   fmt.Sprintf("%s_%s_%s_%d", tok, fn.Name, strings.Trim(unsafe.ReplaceAllString(pred, "_"), "_"), len(seen)),
+					Blocks: blocks,
+				})
+			}
+		}
+	}
+}
+
+func encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+// withVectorIndex adds --vector-index to the float32vector predicates of a
+// schema that have no index, and returns the new schema, also parsed.
+func withVectorIndex(text string) (string, *dqlschema.Schema, error) {
+	s, err := dqlschema.Parse(text)
+	if err != nil {
+		return "", nil, err
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		l := strings.TrimSpace(line)
+		for _, p := range s.Predicates {
+			if p.Type != "float32vector" || len(p.Index) > 0 {
+				continue
+			}
+			if strings.HasPrefix(l, p.Name+":") || strings.HasPrefix(l, "<"+p.Name+">") {
+				lines[i] = fmt.Sprintf("%s: float32vector @index(%s) .", p.Name, *vectorIndex)
+			}
+		}
+	}
+	text = strings.Join(lines, "\n")
+	s, err = dqlschema.Parse(text)
+	return text, s, err
+}
+
+func main() {
+	flag.Parse()
+	if *schemaFile == "" || *rdfFile == "" {
+		log.Fatal("Both --schema and --rdf are required.")
+	}
+	if *outDir == "" {
+		*outDir = filepath.Join("data", strings.TrimSuffix(filepath.Base(*schemaFile), filepath.Ext(*schemaFile)))
+	}
+	text, err := ioutil.ReadFile(*schemaFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	schema, s, err := withVectorIndex(string(text))
+	if err != nil {
+		log.Fatalf("While reading %s: %v", *schemaFile, err)
+	}
+
+	g := memgraph.New()
+	g.LangSep = *langSep
+	if err := g.Load(*rdfFile); err != nil {
+		log.Fatal(err)
+	}
+	e := dqlref.New(g, s.TypeMap())
+	e.Metrics = make(map[string]string)
+	for name, p := range s.Predicates {
+		if m := p.Options["metric"]; m != "" {
+			e.Metrics[name] = m
+		}
+	}
+	gen := &generator{s: s, g: g, rnd: rand.New(rand.NewSource(*seed)), uids: make(map[string][]uint64)}
+	for _, name := range s.Names() {
+		gen.predicate(s.Predicates[name])
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	// Regenerating replaces all the cases.
+	for _, pattern := range []string{"*.in", "*.out"} {
+		old, err := filepath.Glob(filepath.Join(*outDir, pattern))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, f := range old {
+			if err := os.Remove(f); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(*outDir, "schema"), []byte(schema), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	written := 0
+	for _, c := range gen.cases {
+		res, err := e.Eval(c.Blocks)
+		if err != nil {
+			log.Fatalf("%s: %v", c.Name, err)
+		}
+		out, err := encode(res)
+		if err != nil {
+			log.Fatal(err)
+		}
+		prefix := filepath.Join(*outDir, c.Name)
+		if err := ioutil.WriteFile(prefix+".in", []byte(dqlref.Format(c.Blocks)), 0644); err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(prefix+".out", out, 0644); err != nil {
+			log.Fatal(err)
+		}
+		written++
+	}
+	fmt.Printf("Wrote %d cases and the schema to %s\n", written, *outDir)
+}
@@ -0,0 +1,128 @@
+// This tool computes the expected answer to every indextest query from the
+// golden data set held in memory, and writes it to the .out file next to the
+// .in file, or checks the .out files that are there. It replaces
+// loader_golden.sh, which needed a running Dgraph and a Python check per file.
+//
+//	go run ./golden --rdf ../data/goldendata.rdf.gz            # verify
+//	go run ./golden --rdf ../data/goldendata.rdf.gz --write    # regenerate
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/dgraph-io/benchmarks/dqlref"
+	"github.com/dgraph-io/benchmarks/memgraph"
+)
+
+var (
+	rdfFile = flag.String("rdf", "../data/goldendata.rdf.gz", "Golden data set, plain or gzipped.")
+	dataDir = flag.String("data", "data", "Folder with the .in queries and .out answers.")
+	write   = flag.Bool("write", false, "Write the .out files instead of verifying them.")
+	langSep = flag.String("lang-sep", ".", "Joins predicates and language tags, as the loader did: name.en or name@en.")
+)
+
+// count returns the number of objects in a response, for the log.
+func count(v interface{}) int {
+	n := 0
+	switch v := v.(type) {
+	case map[string]interface{}:
+		n++
+		for _, c := range v {
+			n += count(c)
+		}
+	case []interface{}:
+		for _, c := range v {
+			n += count(c)
+		}
+	}
+	return n
+}
+
+func encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+func main() {
+	flag.Parse()
+	files, err := filepath.Glob(filepath.Join(*dataDir, "*.in"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(files) == 0 {
+		log.Fatalf("No .in files in %s", *dataDir)
+	}
+
+	g := memgraph.New()
+	g.LangSep = *langSep
+	if err := g.Load(*rdfFile); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Loaded %d edge and %d value predicates from %s", len(g.Edges), len(g.Values), *rdfFile)
+	e := dqlref.New(g, nil)
+
+	var failed int
+	for _, in := range files {
+		name := strings.TrimSuffix(in, ".in")
+		q, err := ioutil.ReadFile(in)
+		if err != nil {
+			log.Fatal(err)
+		}
+		got, err := e.Run(string(q))
+		if err != nil {
+			log.Fatalf("%s: %v", in, err)
+		}
+		out, err := encode(got)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if *write {
+			if err := ioutil.WriteFile(name+".out", out, 0644); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s: wrote %d objects\n", name, count(got))
+			continue
+		}
+
+		want, err := ioutil.ReadFile(name + ".out")
+		if os.IsNotExist(err) {
+			fmt.Printf("%s: missing .out, run with --write\n", name)
+			failed++
+			continue
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Compare decoded values, so that formatting doesn't matter.
+		var w, o interface{}
+		if err := json.Unmarshal(want, &w); err != nil {
+			log.Fatalf("%s.out: %v", name, err)
+		}
+		if err := json.Unmarshal(out, &o); err != nil {
+			log.Fatal(err)
+		}
+		if !reflect.DeepEqual(w, o) {
+			fmt.Printf("%s: DIFFERS, expected %d objects, computed %d\n", name, count(w), count(o))
+			failed++
+			continue
+		}
+		fmt.Printf("%s: OK, %d objects\n", name, count(o))
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d files failed", failed, len(files))
+	}
+}
@@ -6,55 +6,115 @@ package indextest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"io/ioutil"
 	//	"log"
 	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/bundle"
+	"github.com/dgraph-io/benchmarks/dqlref"
+	"github.com/dgraph-io/benchmarks/memgraph"
 )
 
 var (
-	dgraph = flag.String("d", "http://127.0.0.1:8236/query", "Dgraph server address")
+	dgraph    = flag.String("d", "http://127.0.0.1:8236/query", "Dgraph server address")
+	reference = flag.String("reference", "", "RDF file to compute the expected answers from, instead of the .out files.")
+	langSep   = flag.String("lang-sep", ".", "Joins predicates and language tags in the reference graph.")
+	cases     = flag.String("cases", "", "Folder of cases written by ./cases, e.g. data/1million, for TestIndexes.")
+	minRecall = flag.Float64("min-recall", 0.9, "Fraction of the exact neighbours similar_to must find.")
+	bundleDir = flag.String("bundle", "", "Dataset bundle, e.g. . or ../data/1million.bundle.json, whose queries TestBundle runs.")
+	load      = flag.String("load", "", "Shell command that loads --bundle before TestBundle, see bundle.Command.")
+
+	refOnce sync.Once
+	ref     *dqlref.Evaluator
+	refErr  error
 )
 
-func testHelper(t *testing.T, prefix string) {
+// expected returns the expected answer to a query, from the .out file or
+// from the reference evaluator.
+func expected(t *testing.T, prefix string, input []byte) map[string]interface{} {
 	var r map[string]interface{}
-
-	input, err := ioutil.ReadFile(prefix + ".in")
-	require.NoError(t, err)
-	expectedOutput, err := ioutil.ReadFile(prefix + ".out")
-	require.NoError(t, err)
-
-	// Checking expected output.
-	require.NoError(t, json.Unmarshal(expectedOutput, &r))
-	_, found := r["me"]
-	require.True(t, found)
-	expectedJS, err := json.Marshal(r["me"])
+	if *reference == "" {
+		expectedOutput, err := ioutil.ReadFile(prefix + ".out")
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(expectedOutput, &r))
+		return r
+	}
+	refOnce.Do(func() {
+		g := memgraph.New()
+		g.LangSep = *langSep
+		if refErr = g.Load(*reference); refErr == nil {
+			ref = dqlref.New(g, nil)
+		}
+	})
+	require.NoError(t, refErr)
+	r, err := ref.Run(string(input))
 	require.NoError(t, err)
+	return r
+}
 
-	// Post the query.
-	var client http.Client
-	req, err := http.NewRequest("POST", *dgraph, bytes.NewReader(input))
-
+// post posts a query and returns the data of the response.
+func post(t *testing.T, q []byte) map[string]interface{} {
+	res, err := http.Post(*dgraph, "application/dql", bytes.NewReader(q))
 	require.NoError(t, err)
-	res, err := client.Do(req)
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
 	require.NoError(t, err)
+	var r map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &r), string(body))
+	require.Empty(t, r["errors"])
+	// Older servers answer without the data envelope.
+	data, ok := r["data"].(map[string]interface{})
+	if !ok {
+		delete(r, "extensions")
+		delete(r, "server_latency")
+		data = r
+	}
+	return data
+}
 
-	body, err := ioutil.ReadAll(res.Body)
+// checkData compares the data of a response with the expected data. The
+// similar_to index is approximate, so for those queries each block need only
+// have --min-recall of the expected neighbours.
+func checkData(t *testing.T, q, want []byte, data map[string]interface{}) {
+	if !strings.Contains(string(q), "similar_to(") {
+		got, err := json.Marshal(data)
+		require.NoError(t, err)
+		require.JSONEq(t, string(want), string(got))
+		return
+	}
+	var w map[string][]interface{}
+	require.NoError(t, json.Unmarshal(want, &w))
+	for block, wantList := range w {
+		got, _ := data[block].([]interface{})
+		require.True(t, recall(wantList, got) >= *minRecall,
+			"recall %.2f in %s, want %v, got %v", recall(wantList, got), block, wantList, got)
+	}
+}
+
+func testHelper(t *testing.T, prefix string) {
+	input, err := ioutil.ReadFile(prefix + ".in")
 	require.NoError(t, err)
 
-	// Check the response.
-	require.NoError(t, json.Unmarshal(body, &r))
-	_, found = r["me"]
+	// Checking expected output.
+	r := expected(t, prefix, input)
+	_, found := r["me"]
 	require.True(t, found)
-
-	js, err := json.Marshal(r["me"])
+	want, err := json.Marshal(map[string]interface{}{"me": r["me"]})
 	require.NoError(t, err)
 
-	require.JSONEq(t, string(expectedJS), string(js))
+	data := post(t, input)
+	_, found = data["me"]
+	require.True(t, found)
+	checkData(t, input, want, map[string]interface{}{"me": data["me"]})
 }
 
 func TestFilterStrings(t *testing.T) {
@@ -82,3 +142,73 @@ func TestGenerator(t *testing.T) {
 		})
 	}
 }
+
+// recall returns the fraction of the objects in want that are also in got.
+func recall(want, got []interface{}) float64 {
+	if len(want) == 0 {
+		return 1
+	}
+	have := make(map[string]int)
+	for _, g := range got {
+		js, _ := json.Marshal(g)
+		have[string(js)]++
+	}
+	var found int
+	for _, w := range want {
+		js, _ := json.Marshal(w)
+		if have[string(js)] > 0 {
+			have[string(js)]--
+			found++
+		}
+	}
+	return float64(found) / float64(len(want))
+}
+
+// TestIndexes runs the cases generated for each tokenizer of a schema. The
+// server must have loaded the data set with the schema written next to them.
+func TestIndexes(t *testing.T) {
+	if *cases == "" {
+		t.Skip("No --cases folder given")
+	}
+	files, err := filepath.Glob(filepath.Join(*cases, "*.in"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	for _, in := range files {
+		prefix := strings.TrimSuffix(in, ".in")
+		t.Run(filepath.Base(prefix), func(t *testing.T) {
+			query, err := ioutil.ReadFile(in)
+			require.NoError(t, err)
+			want, err := ioutil.ReadFile(prefix + ".out")
+			require.NoError(t, err)
+			checkData(t, query, want, post(t, query))
+		})
+	}
+}
+
+// TestBundle runs the queries of a dataset bundle. With --load the bundle is
+// validated and loaded first, else the server must have it already.
+func TestBundle(t *testing.T) {
+	if *bundleDir == "" {
+		t.Skip("No --bundle given")
+	}
+	b, err := bundle.Open(*bundleDir)
+	require.NoError(t, err)
+	if *load != "" {
+		require.NoError(t, bundle.Setup(context.Background(), b, bundle.Command(*load)))
+	}
+	require.NotEmpty(t, b.Queries)
+	for _, q := range b.Queries {
+		q := q
+		t.Run(q.Name, func(t *testing.T) {
+			for _, f := range []bundle.File{q.Query, q.Expected} {
+				_, err := b.Check(f)
+				require.NoError(t, err)
+			}
+			query, err := ioutil.ReadFile(b.Path(q.Query))
+			require.NoError(t, err)
+			want, err := ioutil.ReadFile(b.Path(q.Expected))
+			require.NoError(t, err)
+			checkData(t, query, want, post(t, query))
+		})
+	}
+}
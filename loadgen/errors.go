@@ -0,0 +1,79 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrorClass is the kind of failure of a request.
+type ErrorClass int
+
+const (
+	// TransportError means the request failed or didn't return HTTP 200.
+	TransportError ErrorClass = iota
+	// ServerError means the response carried errors.
+	ServerError
+	// ValidationFailure means the response was wrong.
+	ValidationFailure
+	numClasses
+)
+
+var classNames = [numClasses]string{"transport", "server", "validation"}
+
+func (c ErrorClass) String() string {
+	return classNames[c]
+}
+
+// Classify returns ValidationFailure for a *ValidationError and
+// TransportError for anything else.
+func Classify(err error) ErrorClass {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return ValidationFailure
+	}
+	return TransportError
+}
+
+// ErrorCounts counts failures per class. It is safe for concurrent use.
+type ErrorCounts struct {
+	n [numClasses]uint64
+}
+
+// Add counts one failure of class c.
+func (e *ErrorCounts) Add(c ErrorClass) {
+	atomic.AddUint64(&e.n[c], 1)
+}
+
+// Get returns the number of failures of class c.
+func (e *ErrorCounts) Get(c ErrorClass) uint64 {
+	return atomic.LoadUint64(&e.n[c])
+}
+
+// Total returns the number of failures of all classes.
+func (e *ErrorCounts) Total() uint64 {
+	var t uint64
+	for c := ErrorClass(0); c < numClasses; c++ {
+		t += e.Get(c)
+	}
+	return t
+}
+
+// Map returns the failures keyed by class name, e.g. for sending to another
+// process.
+func (e *ErrorCounts) Map() map[string]uint64 {
+	m := make(map[string]uint64, numClasses)
+	for c := ErrorClass(0); c < numClasses; c++ {
+		m[c.String()] = e.Get(c)
+	}
+	return m
+}
+
+func (e *ErrorCounts) String() string {
+	parts := make([]string, 0, numClasses)
+	for c := ErrorClass(0); c < numClasses; c++ {
+		parts = append(parts, fmt.Sprintf("%s: %d", c, e.Get(c)))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,62 @@
+package loadgen
+
+import (
+	"flag"
+	"os"
+	"strings"
+)
+
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ", ") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// ValidationFlags are the command line flags that configure validators. The
+// fields are exported for a coordinator to send them to its workers.
+type ValidationFlags struct {
+	MinNodes int
+	Asserts  stringList
+	Golden   string
+	Record   string
+}
+
+// Register adds the flags to fs.
+func (f *ValidationFlags) Register(fs *flag.FlagSet) {
+	fs.IntVar(&f.MinNodes, "min-nodes", 0,
+		"Fail responses with fewer entities than this.")
+	fs.Var(&f.Asserts, "assert",
+		`JSON path assertion on the response data, e.g. "len(debug/0/actor.film) >= 1". Can be repeated.`)
+	fs.StringVar(&f.Golden, "golden", "",
+		"Folder with golden responses, as written by --record-golden, to compare against.")
+	fs.StringVar(&f.Record, "record-golden", "",
+		"Folder to write the first response for each key to, for --golden.")
+}
+
+// Validators builds the validators selected by the flags.
+func (f *ValidationFlags) Validators() (Validators, error) {
+	var vs Validators
+	if f.MinNodes > 0 {
+		vs = append(vs, MinNodes(f.MinNodes))
+	}
+	for _, expr := range f.Asserts {
+		v, err := Assert(expr)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	if f.Golden != "" {
+		vs = append(vs, Golden(f.Golden))
+	}
+	if f.Record != "" {
+		if err := os.MkdirAll(f.Record, 0755); err != nil {
+			return nil, err
+		}
+		vs = append(vs, Record(f.Record))
+	}
+	return vs, nil
+}
@@ -0,0 +1,111 @@
+package loadgen
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// growth is the ratio between the bounds of consecutive histogram buckets,
+// which bounds the relative error of quantiles to 2%.
+const growth = 1.02
+
+var logGrowth = math.Log(growth)
+
+// Histogram is a latency histogram with logarithmic buckets. Histograms from
+// several runners can be merged, and they marshal to compact JSON.
+type Histogram struct {
+	// Buckets maps a bucket index to its count. Bucket i holds latencies in
+	// [growth^i, growth^(i+1)) microseconds.
+	Buckets map[int]uint64 `json:"buckets"`
+	Count   uint64         `json:"count"`
+	// Sum, Min and Max are in seconds.
+	Sum float64 `json:"sum"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// NewHistogram returns an empty histogram.
+func NewHistogram() *Histogram {
+	return &Histogram{Buckets: make(map[int]uint64)}
+}
+
+func bucket(d time.Duration) int {
+	us := float64(d) / float64(time.Microsecond)
+	if us < 1 {
+		return 0
+	}
+	return int(math.Log(us) / logGrowth)
+}
+
+// Record adds a latency.
+func (h *Histogram) Record(d time.Duration) {
+	s := d.Seconds()
+	if h.Count == 0 || s < h.Min {
+		h.Min = s
+	}
+	if s > h.Max {
+		h.Max = s
+	}
+	h.Count++
+	h.Sum += s
+	h.Buckets[bucket(d)]++
+}
+
+// Merge adds all the latencies recorded in o.
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.Count == 0 {
+		return
+	}
+	if h.Count == 0 || o.Min < h.Min {
+		h.Min = o.Min
+	}
+	if o.Max > h.Max {
+		h.Max = o.Max
+	}
+	h.Count += o.Count
+	h.Sum += o.Sum
+	for b, c := range o.Buckets {
+		h.Buckets[b] += c
+	}
+}
+
+// Mean returns the average latency.
+func (h *Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return seconds(h.Sum / float64(h.Count))
+}
+
+// Quantile returns the latency below which a fraction q of the latencies fall.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	if q >= 1 {
+		return seconds(h.Max)
+	}
+	keys := make([]int, 0, len(h.Buckets))
+	for b := range h.Buckets {
+		keys = append(keys, b)
+	}
+	sort.Ints(keys)
+
+	rank := uint64(math.Ceil(q * float64(h.Count)))
+	var seen uint64
+	for _, b := range keys {
+		seen += h.Buckets[b]
+		if seen >= rank {
+			// Report the middle of the bucket, clamped to what was seen.
+			us := math.Pow(growth, float64(b)+0.5)
+			s := math.Min(math.Max(us/1e6, h.Min), h.Max)
+			return seconds(s)
+		}
+	}
+	return seconds(h.Max)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,34 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram(t *testing.T) {
+	a, b := NewHistogram(), NewHistogram()
+	for i := 1; i <= 1000; i++ {
+		h := a
+		if i%2 == 0 {
+			h = b
+		}
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	// Merging survives a JSON round trip, as used by the coordinator.
+	buf, err := json.Marshal(b)
+	require.NoError(t, err)
+	var c Histogram
+	require.NoError(t, json.Unmarshal(buf, &c))
+	a.Merge(&c)
+
+	require.Equal(t, uint64(1000), a.Count)
+	require.Equal(t, time.Millisecond, a.Quantile(0))
+	require.Equal(t, time.Second, a.Quantile(1))
+	require.InDelta(t, 500*time.Millisecond, a.Quantile(0.5), float64(10*time.Millisecond))
+	require.InDelta(t, 990*time.Millisecond, a.Quantile(0.99), float64(20*time.Millisecond))
+	require.InDelta(t, 500.5*float64(time.Millisecond), float64(a.Mean()), float64(time.Millisecond))
+}
@@ -0,0 +1,78 @@
+package loadgen
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are the client side metrics of a load run. Latencies are recorded
+// twice, as seen by the client and as reported by the server in
+// extensions.server_latency, so that dashboards can show them side by side.
+type Metrics struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	inflight prometheus.Gauge
+}
+
+// NewMetrics creates the metrics and registers them with reg.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "loadgen_requests_total",
+			Help: "Requests sent, by query template.",
+		}, []string{"template"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "loadgen_errors_total",
+			Help: "Failed requests, by query template and error class.",
+		}, []string{"template", "class"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "loadgen_latency_seconds",
+			Help:    "Request latency as observed by the client or reported by the server.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"template", "source"}),
+		inflight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "loadgen_inflight_requests",
+			Help: "Requests sent and not yet answered.",
+		}),
+	}
+	reg.MustRegister(m.requests, m.errors, m.latency, m.inflight)
+	return m
+}
+
+// Start records a request for template. Call the returned function once the
+// response has been read.
+func (m *Metrics) Start(template string) func() {
+	m.requests.WithLabelValues(template).Inc()
+	m.inflight.Inc()
+	return m.inflight.Dec
+}
+
+// Observe records the client and server latency of a successful request. A
+// zero server latency is not recorded.
+func (m *Metrics) Observe(template string, client, server time.Duration) {
+	m.latency.WithLabelValues(template, "client").Observe(client.Seconds())
+	if server > 0 {
+		m.latency.WithLabelValues(template, "server").Observe(server.Seconds())
+	}
+}
+
+// Error records a failed request.
+func (m *Metrics) Error(template string, c ErrorClass) {
+	m.errors.WithLabelValues(template, c.String()).Inc()
+}
+
+// ServeMetrics exposes the default registry on addr at /metrics. It doesn't
+// block.
+func ServeMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Fatal(http.ListenAndServe(addr, mux))
+	}()
+	log.Printf("Serving metrics on %s/metrics", addr)
+}
@@ -0,0 +1,294 @@
+// Package loadgen holds the pieces shared by the load generators in
+// throughputtest and loadtest.
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Result is a decoded response to a single request.
+type Result struct {
+	// Key identifies the request, e.g. the query template and the uid it was
+	// built from. It is used to find golden responses, so requests whose
+	// answers differ need different keys.
+	Key string
+	// Data is the data field of the response.
+	Data interface{}
+}
+
+// Validator checks a single response.
+type Validator interface {
+	Name() string
+	Validate(r *Result) error
+}
+
+// ValidationError is returned by Validators when a response is wrong.
+type ValidationError struct {
+	Validator string
+	Key       string
+	Err       error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s failed for %q: %v", e.Validator, e.Key, e.Err)
+}
+
+// Validators runs a list of validators, stopping at the first failure.
+type Validators []Validator
+
+// Validate returns a *ValidationError for the first failing validator.
+func (vs Validators) Validate(r *Result) error {
+	for _, v := range vs {
+		if err := v.Validate(r); err != nil {
+			return &ValidationError{Validator: v.Name(), Key: r.Key, Err: err}
+		}
+	}
+	return nil
+}
+
+// CountNodes returns the number of entities in a response, counting every
+// JSON object like numChildren does for the protocol buffer response.
+func CountNodes(v interface{}) int {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := 1
+		for _, child := range v {
+			c += CountNodes(child)
+		}
+		return c
+	case []interface{}:
+		c := 0
+		for _, child := range v {
+			c += CountNodes(child)
+		}
+		return c
+	}
+	return 0
+}
+
+type minNodes int
+
+func (m minNodes) Name() string { return "min-nodes" }
+
+func (m minNodes) Validate(r *Result) error {
+	// The data object itself isn't an entity.
+	if n := CountNodes(r.Data) - 1; n < int(m) {
+		return fmt.Errorf("got %d nodes, want at least %d", n, int(m))
+	}
+	return nil
+}
+
+// MinNodes fails responses with fewer than n entities.
+func MinNodes(n int) Validator {
+	return minNodes(n)
+}
+
+// lookup walks a slash separated path such as "me/0/actor.film". Slashes are
+// used because predicate names contain dots.
+func lookup(v interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return v, nil
+	}
+	for _, p := range strings.Split(path, "/") {
+		switch cur := v.(type) {
+		case map[string]interface{}:
+			next, ok := cur[p]
+			if !ok {
+				return nil, fmt.Errorf("no key %q", p)
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(cur) {
+				return nil, fmt.Errorf("no index %q in array of length %d", p, len(cur))
+			}
+			v = cur[i]
+		default:
+			return nil, fmt.Errorf("can't descend into %v with %q", v, p)
+		}
+	}
+	return v, nil
+}
+
+type assertion struct {
+	expr  string
+	path  string
+	op    string
+	isLen bool
+	n     int
+	value interface{}
+}
+
+var ops = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// Assert parses a JSON path assertion. The supported forms are
+//
+//	me/0/name@en                   the value exists and isn't null
+//	me/0/name@en == "Blade Runner" the value equals the JSON literal
+//	len(me/0/actor.film) >= 10     the array length compares to the integer
+//
+// == and != compare JSON values, len() accepts all of == != >= <= > <.
+func Assert(expr string) (Validator, error) {
+	a := &assertion{expr: expr}
+	s := strings.TrimSpace(expr)
+	for _, op := range ops {
+		if i := strings.Index(s, " "+op+" "); i >= 0 {
+			a.op = op
+			a.path = strings.TrimSpace(s[:i])
+			s = strings.TrimSpace(s[i+len(op)+2:])
+			break
+		}
+	}
+	if a.op == "" {
+		a.path = s
+		return a, nil
+	}
+	if strings.HasPrefix(a.path, "len(") && strings.HasSuffix(a.path, ")") {
+		a.isLen = true
+		a.path = a.path[4 : len(a.path)-1]
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid length in assertion %q: %v", expr, err)
+		}
+		a.n = n
+		return a, nil
+	}
+	if a.op != "==" && a.op != "!=" {
+		return nil, fmt.Errorf("operator %s needs len() in assertion %q", a.op, expr)
+	}
+	if err := json.Unmarshal([]byte(s), &a.value); err != nil {
+		return nil, fmt.Errorf("invalid JSON value in assertion %q: %v", expr, err)
+	}
+	return a, nil
+}
+
+func (a *assertion) Name() string { return "assert" }
+
+func (a *assertion) Validate(r *Result) error {
+	v, err := lookup(r.Data, a.path)
+	if err != nil {
+		return fmt.Errorf("%s: %v", a.expr, err)
+	}
+	switch {
+	case a.op == "":
+		if v == nil {
+			return fmt.Errorf("%s: value is null", a.expr)
+		}
+		return nil
+	case a.isLen:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: not an array", a.expr)
+		}
+		if !compareInt(len(arr), a.op, a.n) {
+			return fmt.Errorf("%s: length is %d", a.expr, len(arr))
+		}
+		return nil
+	}
+	if reflect.DeepEqual(v, a.value) != (a.op == "==") {
+		return fmt.Errorf("%s: got %v", a.expr, v)
+	}
+	return nil
+}
+
+func compareInt(a int, op string, b int) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	}
+	return false
+}
+
+type golden struct {
+	dir   string
+	cache sync.Map // key -> interface{}
+}
+
+// Golden compares the data of each response with the file response-<Key> in
+// dir, as written by Record. Keys without a golden file are not checked.
+func Golden(dir string) Validator {
+	return &golden{dir: dir}
+}
+
+func (g *golden) Name() string { return "golden" }
+
+func (g *golden) Validate(r *Result) error {
+	want, ok := g.cache.Load(r.Key)
+	if !ok {
+		b, err := ioutil.ReadFile(filepath.Join(g.dir, "response-"+r.Key))
+		if err != nil {
+			g.cache.Store(r.Key, nil)
+			return nil
+		}
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return fmt.Errorf("invalid golden file for %q: %v", r.Key, err)
+		}
+		g.cache.Store(r.Key, v)
+		want = v
+	}
+	if want == nil {
+		return nil
+	}
+	// Round trip the response so numbers compare the same way.
+	b, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	var got interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("response differs from golden file")
+	}
+	return nil
+}
+
+type record struct {
+	dir  string
+	seen sync.Map // key -> struct{}
+}
+
+// Record writes the data of the first response for each key to
+// response-<Key> in dir, for a later run to compare with Golden. Run it
+// against a cluster known to answer correctly. Files already in dir are
+// kept.
+func Record(dir string) Validator {
+	return &record{dir: dir}
+}
+
+func (rc *record) Name() string { return "record" }
+
+func (rc *record) Validate(r *Result) error {
+	if _, loaded := rc.seen.LoadOrStore(r.Key, struct{}{}); loaded {
+		return nil
+	}
+	path := filepath.Join(rc.dir, "response-"+r.Key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	b, err := json.MarshalIndent(r.Data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
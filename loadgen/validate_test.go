@@ -0,0 +1,87 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func result(t *testing.T, key, data string) *Result {
+	var v interface{}
+	require.NoError(t, json.Unmarshal([]byte(data), &v))
+	return &Result{Key: key, Data: v}
+}
+
+const debugData = `{"debug": [{"name@en": "Tom Hanks", "actor.film": [
+	{"performance.film": [{"name@en": "Big"}]},
+	{"performance.film": [{"name@en": "Splash"}]}
+]}]}`
+
+func TestCountNodes(t *testing.T) {
+	r := result(t, "0x1", debugData)
+	// data, the actor, two performances and two films.
+	require.Equal(t, 6, CountNodes(r.Data))
+	require.NoError(t, MinNodes(5).Validate(r))
+	require.Error(t, MinNodes(6).Validate(r))
+}
+
+func TestAssert(t *testing.T) {
+	r := result(t, "0x1", debugData)
+	for _, expr := range []string{
+		`debug/0/name@en`,
+		`debug/0/name@en == "Tom Hanks"`,
+		`debug/0/name@en != "Meg Ryan"`,
+		`len(debug/0/actor.film) >= 2`,
+		`len(debug) == 1`,
+		`debug/0/actor.film/1/performance.film/0/name@en == "Splash"`,
+	} {
+		v, err := Assert(expr)
+		require.NoError(t, err, expr)
+		require.NoError(t, v.Validate(r), expr)
+	}
+	for _, expr := range []string{
+		`debug/1`,
+		`debug/0/name@en == "Meg Ryan"`,
+		`len(debug/0/actor.film) > 2`,
+	} {
+		v, err := Assert(expr)
+		require.NoError(t, err, expr)
+		require.Error(t, v.Validate(r), expr)
+	}
+	_, err := Assert(`debug/0/name@en > 1`)
+	require.Error(t, err)
+}
+
+func TestGolden(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "response-0x1"), []byte(debugData), 0644))
+
+	vs := Validators{Golden(dir)}
+	require.NoError(t, vs.Validate(result(t, "0x1", debugData)))
+	// Keys without a golden file pass.
+	require.NoError(t, vs.Validate(result(t, "0x2", `{}`)))
+
+	err := vs.Validate(result(t, "0x1", `{"debug": []}`))
+	require.Error(t, err)
+	require.Equal(t, ValidationFailure, Classify(err))
+
+	var errs ErrorCounts
+	errs.Add(Classify(err))
+	errs.Add(TransportError)
+	require.Equal(t, "transport: 1, server: 0, validation: 1", errs.String())
+}
+
+func TestRecord(t *testing.T) {
+	dir := t.TempDir()
+	rec := Validators{Record(dir)}
+	require.NoError(t, rec.Validate(result(t, "0x1", debugData)))
+	// Only the first response of a key is written.
+	require.NoError(t, rec.Validate(result(t, "0x1", `{"debug": []}`)))
+
+	vs := Validators{Golden(dir)}
+	require.NoError(t, vs.Validate(result(t, "0x1", debugData)))
+	require.Error(t, vs.Validate(result(t, "0x1", `{"debug": []}`)))
+}
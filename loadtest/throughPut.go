@@ -17,21 +17,32 @@ import (
 	"sync"
 	"time"
 
+	"github.com/dgraph-io/benchmarks/loadgen"
 	"github.com/dgraph-io/dgraph/x"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
-	numUser    = flag.Int("numuser", 1, "number of users hitting simultaneously")
-	numReq     = flag.Int("numreq", 10, "number of request per user")
-	serverAddr = flag.String("ip", ":8081", "IP addr of server")
-	avg        chan float64
-	jsonP      chan float64
-	serverP    chan float64
-	parsingP   chan float64
-	totalP     chan float64
-	glog       = x.Log("Pinger")
+	numUser     = flag.Int("numuser", 1, "number of users hitting simultaneously")
+	numReq      = flag.Int("numreq", 10, "number of request per user")
+	serverAddr  = flag.String("ip", ":8081", "IP addr of server")
+	metricsAddr = flag.String("metrics", "", "Serve client metrics for Prometheus on this address, e.g. :9099")
+	avg         chan float64
+	jsonP       chan float64
+	serverP     chan float64
+	parsingP    chan float64
+	totalP      chan float64
+	glog        = x.Log("Pinger")
+	validation  loadgen.ValidationFlags
+	validators  loadgen.Validators
+	errCounts   loadgen.ErrorCounts
+	metrics     = loadgen.NewMetrics(prometheus.DefaultRegisterer)
 )
 
+func init() {
+	validation.Register(flag.CommandLine)
+}
+
 func runUser(wg *sync.WaitGroup) {
 	var ti, proT, parT, jsonT, totT time.Duration
 	var query = `{
@@ -55,20 +66,39 @@ func runUser(wg *sync.WaitGroup) {
 
 		t0 := time.Now()
 		//fmt.Println(i)
+		done := metrics.Start("me")
 		resp, err := client.Do(r)
 		t1 := time.Now()
 		if err != nil {
-			glog.WithField("Err", resp.Status).Fatalf("Error in query")
+			done()
+			glog.WithField("Err", err).Error("Error in query")
+			errCounts.Add(loadgen.TransportError)
+			metrics.Error("me", loadgen.TransportError)
+			continue
 		} else {
 			body, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
 				log.Fatalf("Couldn't parse response body. %+v", err)
 			}
 			resp.Body.Close()
+			done()
+			dat = nil
 			err = json.Unmarshal(body, &dat)
 			if err != nil {
 				glog.Fatalf("Error in reply")
 			}
+			if errs, ok := dat["errors"]; ok {
+				glog.WithField("Err", errs).Error("Error in reply")
+				errCounts.Add(loadgen.ServerError)
+				metrics.Error("me", loadgen.ServerError)
+				continue
+			}
+			if err := validators.Validate(&loadgen.Result{Key: "m.0f4vbz", Data: map[string]interface{}{"me": dat["me"]}}); err != nil {
+				glog.WithError(err).Error("Invalid reply")
+				errCounts.Add(loadgen.ValidationFailure)
+				metrics.Error("me", loadgen.ValidationFailure)
+				continue
+			}
 			//fmt.Println(dat["server_latency"])
 			ti += t1.Sub(t0)
 			// json:1.144568ms parsing:4.031346ms processing:3.726298ms total:8.904975ms
@@ -83,6 +113,7 @@ func runUser(wg *sync.WaitGroup) {
 			parT += par
 			tot, _ := time.ParseDuration(latency["total"].(string))
 			totT += tot
+			metrics.Observe("me", t1.Sub(t0), tot)
 		}
 		//		fmt.Println("user", i)
 	}
@@ -98,6 +129,13 @@ func runUser(wg *sync.WaitGroup) {
 
 func main() {
 	flag.Parse()
+	var err error
+	if validators, err = validation.Validators(); err != nil {
+		log.Fatal(err)
+	}
+	if *metricsAddr != "" {
+		loadgen.ServeMetrics(*metricsAddr)
+	}
 	var totTime, serTi, jsonTi, parTi, totTi float64
 	var wg sync.WaitGroup
 	avg = make(chan float64, *numUser)
@@ -139,5 +177,6 @@ func main() {
 	fmt.Println("Json time : ", jsonTi, jsonTi/float64(*numUser*(*numReq)))
 	fmt.Println("Processing  time : ", serTi, serTi/float64(*numUser*(*numReq)))
 	fmt.Println("Parsing time : ", parTi, parTi/float64(*numUser*(*numReq)))
+	fmt.Println("Errors : ", errCounts.String())
 
 }
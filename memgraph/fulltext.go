@@ -0,0 +1,342 @@
+package memgraph
+
+import "strings"
+
+// stopWords are the English stop words dropped by the fulltext tokenizer.
+var stopWords = make(map[string]bool)
+
+func init() {
+	for _, w := range strings.Fields(`i me my myself we our ours ourselves you
+	your yours yourself yourselves he him his himself she her hers herself it
+	its itself they them their theirs themselves what which who whom this that
+	these those am is are was were be been being have has had having do does
+	did doing would should could ought i'm you're he's she's it's we're they're
+	i've you've we've they've i'd you'd he'd she'd we'd they'd i'll you'll
+	he'll she'll we'll they'll isn't aren't wasn't weren't hasn't haven't
+	hadn't doesn't don't didn't won't wouldn't shan't shouldn't can't cannot
+	couldn't mustn't let's that's who's what's here's there's when's where's
+	why's how's a an the and but if or because as until while of at by for
+	with about against between into through during before after above below to
+	from up down in out on off over under again further then once here there
+	when where why how all any both each few more most other some such no nor
+	not only own same so than too very`) {
+		stopWords[w] = true
+	}
+}
+
+// FullTextTerms returns the distinct terms of s as indexed by the fulltext
+// tokenizer for English: the terms of Terms without stop words, stemmed.
+func FullTextTerms(s string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range strings.Fields(Normalize(s)) {
+		if stopWords[t] {
+			continue
+		}
+		t = Stem(t)
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// HasFullText is HasTerms for the fulltext tokenizer.
+func HasFullText(value, query string, any bool) bool {
+	return hasAll(FullTextTerms(value), FullTextTerms(query), any)
+}
+
+// Stem returns the stem of an English word, lower case, by the Porter2
+// (Snowball English) algorithm that the fulltext tokenizer uses.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	if s, ok := stemExceptions[word]; ok {
+		return s
+	}
+	w := &stemWord{b: []byte(strings.TrimPrefix(word, "'"))}
+	w.markY()
+	w.regions()
+	w.step0()
+	w.step1a()
+	if stemInvariants[string(w.b)] {
+		return w.String()
+	}
+	w.step1b()
+	w.step1c()
+	w.step2()
+	w.step3()
+	w.step4()
+	w.step5()
+	return w.String()
+}
+
+var stemExceptions = map[string]string{
+	"skis": "ski", "skies": "sky", "dying": "die", "lying": "lie",
+	"tying": "tie", "idly": "idl", "gently": "gentl", "ugly": "ugli",
+	"early": "earli", "only": "onli", "singly": "singl", "sky": "sky",
+	"news": "news", "howe": "howe", "atlas": "atlas", "cosmos": "cosmos",
+	"bias": "bias", "andes": "andes",
+}
+
+// stemInvariants are left alone after step 1a.
+var stemInvariants = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true,
+	"earring": true, "proceed": true, "exceed": true, "succeed": true,
+}
+
+type stemWord struct {
+	b      []byte
+	r1, r2 int
+}
+
+func (w *stemWord) String() string {
+	return strings.Replace(string(w.b), "Y", "y", -1)
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiouy", c) >= 0
+}
+
+func (w *stemWord) vowel(i int) bool {
+	return isVowel(w.b[i])
+}
+
+// markY marks a y at the start or after a vowel as a consonant, Y.
+func (w *stemWord) markY() {
+	for i, c := range w.b {
+		if c == 'y' && (i == 0 || w.vowel(i-1)) {
+			w.b[i] = 'Y'
+		}
+	}
+}
+
+// region returns the position after the first non-vowel that follows a
+// vowel, from start on.
+func (w *stemWord) region(start int) int {
+	for i := start + 1; i < len(w.b); i++ {
+		if !w.vowel(i) && w.vowel(i-1) {
+			return i + 1
+		}
+	}
+	return len(w.b)
+}
+
+func (w *stemWord) regions() {
+	w.r1 = -1
+	for _, p := range []string{"gener", "commun", "arsen"} {
+		if strings.HasPrefix(string(w.b), p) {
+			w.r1 = len(p)
+		}
+	}
+	if w.r1 < 0 {
+		w.r1 = w.region(0)
+	}
+	w.r2 = w.region(w.r1)
+	if w.r1 >= len(w.b) {
+		w.r2 = len(w.b)
+	}
+}
+
+func (w *stemWord) has(suffix string) bool {
+	return strings.HasSuffix(string(w.b), suffix)
+}
+
+// longest returns the longest of suffixes that w ends with.
+func (w *stemWord) longest(suffixes ...string) string {
+	best := ""
+	for _, s := range suffixes {
+		if len(s) > len(best) && w.has(s) {
+			best = s
+		}
+	}
+	return best
+}
+
+func (w *stemWord) trim(n int) {
+	w.b = w.b[:len(w.b)-n]
+}
+
+func (w *stemWord) replace(suffix, with string) {
+	w.trim(len(suffix))
+	w.b = append(w.b, with...)
+}
+
+// inR1 and inR2 report whether a suffix of length n lies in R1 or R2.
+func (w *stemWord) inR1(n int) bool { return len(w.b)-n >= w.r1 }
+func (w *stemWord) inR2(n int) bool { return len(w.b)-n >= w.r2 }
+
+// hasVowelBefore reports whether the word without its last n letters has a
+// vowel.
+func (w *stemWord) hasVowelBefore(n int) bool {
+	for i := 0; i < len(w.b)-n; i++ {
+		if w.vowel(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// shortSyllable reports whether the word ends in a short syllable.
+func (w *stemWord) shortSyllable() bool {
+	n := len(w.b)
+	if n == 2 {
+		return w.vowel(0) && !w.vowel(1)
+	}
+	if n < 3 {
+		return false
+	}
+	last := w.b[n-1]
+	return !w.vowel(n-3) && w.vowel(n-2) && !w.vowel(n-1) &&
+		last != 'w' && last != 'x' && last != 'Y'
+}
+
+func (w *stemWord) short() bool {
+	return w.r1 >= len(w.b) && w.shortSyllable()
+}
+
+func (w *stemWord) step0() {
+	if s := w.longest("'", "'s", "'s'"); s != "" {
+		w.trim(len(s))
+	}
+}
+
+func (w *stemWord) step1a() {
+	switch s := w.longest("sses", "ied", "ies", "us", "ss", "s"); s {
+	case "sses":
+		w.replace(s, "ss")
+	case "ied", "ies":
+		if len(w.b) > 4 {
+			w.replace(s, "i")
+		} else {
+			w.replace(s, "ie")
+		}
+	case "s":
+		if w.hasVowelBefore(2) {
+			w.trim(1)
+		}
+	}
+}
+
+func (w *stemWord) step1b() {
+	s := w.longest("eed", "eedly", "ed", "edly", "ing", "ingly")
+	switch s {
+	case "":
+		return
+	case "eed", "eedly":
+		if w.inR1(len(s)) {
+			w.replace(s, "ee")
+		}
+		return
+	}
+	if !w.hasVowelBefore(len(s)) {
+		return
+	}
+	w.trim(len(s))
+	switch {
+	case w.has("at"), w.has("bl"), w.has("iz"):
+		w.b = append(w.b, 'e')
+	case w.longest("bb", "dd", "ff", "gg", "mm", "nn", "pp", "rr", "tt") != "":
+		w.trim(1)
+	case w.short():
+		w.b = append(w.b, 'e')
+	}
+}
+
+func (w *stemWord) step1c() {
+	n := len(w.b)
+	if n > 2 && (w.b[n-1] == 'y' || w.b[n-1] == 'Y') && !w.vowel(n-2) {
+		w.b[n-1] = 'i'
+	}
+}
+
+var step2Suffixes = map[string]string{
+	"tional": "tion", "enci": "ence", "anci": "ance", "abli": "able",
+	"entli": "ent", "izer": "ize", "ization": "ize", "ational": "ate",
+	"ation": "ate", "ator": "ate", "alism": "al", "aliti": "al", "alli": "al",
+	"fulness": "ful", "ousli": "ous", "ousness": "ous", "iveness": "ive",
+	"iviti": "ive", "biliti": "ble", "bli": "ble", "ogi": "og", "fulli": "ful",
+	"lessli": "less", "li": "",
+}
+
+var step3Suffixes = map[string]string{
+	"tional": "tion", "ational": "ate", "alize": "al", "icate": "ic",
+	"iciti": "ic", "ical": "ic", "ful": "", "ness": "", "ative": "",
+}
+
+func keys(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+var step2Keys, step3Keys = keys(step2Suffixes), keys(step3Suffixes)
+
+func (w *stemWord) step2() {
+	s := w.longest(step2Keys...)
+	if s == "" || !w.inR1(len(s)) {
+		return
+	}
+	n := len(w.b) - len(s)
+	switch s {
+	case "ogi":
+		if n == 0 || w.b[n-1] != 'l' {
+			return
+		}
+	case "li":
+		if n == 0 || strings.IndexByte("cdeghkmnrt", w.b[n-1]) < 0 {
+			return
+		}
+	}
+	w.replace(s, step2Suffixes[s])
+}
+
+func (w *stemWord) step3() {
+	s := w.longest(step3Keys...)
+	if s == "" || !w.inR1(len(s)) {
+		return
+	}
+	if s == "ative" && !w.inR2(len(s)) {
+		return
+	}
+	w.replace(s, step3Suffixes[s])
+}
+
+func (w *stemWord) step4() {
+	s := w.longest("al", "ance", "ence", "er", "ic", "able", "ible", "ant",
+		"ement", "ment", "ent", "ism", "ate", "iti", "ous", "ive", "ize", "ion")
+	if s == "" || !w.inR2(len(s)) {
+		return
+	}
+	if s == "ion" {
+		n := len(w.b) - 3
+		if n == 0 || (w.b[n-1] != 's' && w.b[n-1] != 't') {
+			return
+		}
+	}
+	w.trim(len(s))
+}
+
+func (w *stemWord) step5() {
+	switch {
+	case w.has("e"):
+		if w.inR2(1) {
+			w.trim(1)
+			return
+		}
+		if w.inR1(1) {
+			w.trim(1)
+			if w.shortSyllable() {
+				w.b = append(w.b, 'e')
+			}
+		}
+	case w.has("l"):
+		if w.inR2(1) && w.has("ll") {
+			w.trim(1)
+		}
+	}
+}
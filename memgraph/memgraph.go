@@ -0,0 +1,224 @@
+// Package memgraph holds an RDF data set in memory, as edges and values keyed
+// by predicate and uid, for tools that compute the answers Dgraph should give
+// without running it. Uids are the nquad fingerprints of the node ids.
+package memgraph
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// Graph is a loaded data set.
+type Graph struct {
+	// Edges maps a predicate to the objects of each subject, in the order
+	// they were read.
+	Edges map[string]map[uint64][]uint64
+	// Values maps a predicate to the values of each subject, without
+	// duplicates, the one read last at the end. Dgraph keeps them all for
+	// list predicates, and only the last for others. Values with a language
+	// tag are under the predicate, LangSep and the tag, e.g. name@en.
+	Values map[string]map[uint64][]string
+	// LangSep joins predicates and language tags. The old loader used the
+	// golden data set with ".", giving type.object.name.en.
+	LangSep string
+}
+
+// New returns an empty graph.
+func New() *Graph {
+	return &Graph{
+		Edges:   make(map[string]map[uint64][]uint64),
+		Values:  make(map[string]map[uint64][]string),
+		LangSep: "@",
+	}
+}
+
+// Load reads a plain or gzipped RDF file into a new graph.
+func Load(path string) (*Graph, error) {
+	g := New()
+	return g, g.Load(path)
+}
+
+// Load adds the N-Quads in a plain or gzipped RDF file.
+func (g *Graph) Load(path string) error {
+	return nquad.Each(path, func(nq nquad.NQuad) error {
+		g.Add(nq)
+		return nil
+	})
+}
+
+// Add adds an N-Quad. A value the subject already has for the predicate is
+// moved to the end, as the last one read.
+func (g *Graph) Add(nq nquad.NQuad) {
+	src := nquad.Fingerprint(nq.Subject)
+	if nq.IsEdge() {
+		m, ok := g.Edges[nq.Predicate]
+		if !ok {
+			m = make(map[uint64][]uint64)
+			g.Edges[nq.Predicate] = m
+		}
+		m[src] = append(m[src], nquad.Fingerprint(nq.ObjectId))
+		return
+	}
+	pred := nq.Predicate
+	if nq.Lang != "" {
+		pred += g.LangSep + nq.Lang
+	}
+	m, ok := g.Values[pred]
+	if !ok {
+		m = make(map[uint64][]string)
+		g.Values[pred] = m
+	}
+	vals := m[src]
+	for i, v := range vals {
+		if v == nq.ObjectValue {
+			vals = append(vals[:i], vals[i+1:]...)
+			break
+		}
+	}
+	m[src] = append(vals, nq.ObjectValue)
+}
+
+// Value returns the last value of pred for uid, the one Dgraph keeps for a
+// predicate that isn't a list.
+func (g *Graph) Value(uid uint64, pred string) (string, bool) {
+	vals := g.Values[pred][uid]
+	if len(vals) == 0 {
+		return "", false
+	}
+	return vals[len(vals)-1], true
+}
+
+// Neighbors returns the objects of uid for pred, sorted and without
+// duplicates, like a Dgraph posting list.
+func (g *Graph) Neighbors(uid uint64, pred string) []uint64 {
+	return Sorted(g.Edges[pred][uid])
+}
+
+// Expand follows pred from every uid and returns all the objects, keeping
+// duplicates.
+func (g *Graph) Expand(uids []uint64, pred string) []uint64 {
+	m := g.Edges[pred]
+	var out []uint64
+	for _, u := range uids {
+		out = append(out, m[u]...)
+	}
+	return out
+}
+
+// Reverse returns the edges of pred from object to subjects.
+func (g *Graph) Reverse(pred string) map[uint64][]uint64 {
+	out := make(map[uint64][]uint64)
+	for src, dsts := range g.Edges[pred] {
+		for _, d := range dsts {
+			out[d] = append(out[d], src)
+		}
+	}
+	return out
+}
+
+// Subjects returns the sorted uids that have pred, as an edge or a value.
+func (g *Graph) Subjects(pred string) []uint64 {
+	var out []uint64
+	for u := range g.Edges[pred] {
+		out = append(out, u)
+	}
+	for u := range g.Values[pred] {
+		out = append(out, u)
+	}
+	return Sorted(out)
+}
+
+// Sorted returns the uids sorted and without duplicates.
+func Sorted(uids []uint64) []uint64 {
+	out := append([]uint64(nil), uids...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	n := 0
+	for i, u := range out {
+		if i == 0 || u != out[n-1] {
+			out[n] = u
+			n++
+		}
+	}
+	return out[:n]
+}
+
+// UniqueUIDs returns the unique uids in the values of m, with the number of
+// times each appears.
+func UniqueUIDs(m map[uint64][]uint64) ([]uint64, []int) {
+	uniq := make(map[uint64]int)
+	for _, v := range m {
+		for _, u := range v {
+			uniq[u]++
+		}
+	}
+	out := make([]uint64, 0, len(uniq))
+	outCount := make([]int, 0, len(uniq))
+	for k, v := range uniq {
+		out = append(out, k)
+		outCount = append(outCount, v)
+	}
+	return out, outCount
+}
+
+// Normalize does the unicode normalization of the term tokenizer: it removes
+// nonspacing marks, replaces punctuation with spaces and lower cases.
+func Normalize(in string) string {
+	// We need a new transformer for each input as it cannot be reused.
+	filter := func(r rune) bool {
+		return unicode.Is(unicode.Mn, r) // Mn: nonspacing marks (to be removed)
+	}
+	transformer := transform.Chain(norm.NFD, transform.RemoveFunc(filter), norm.NFC)
+	out, _, err := transform.Bytes(transformer, []byte(in))
+	if err != nil {
+		out = []byte(in)
+	}
+	out = bytes.Map(func(r rune) rune {
+		if unicode.IsPunct(r) {
+			return ' '
+		}
+		return unicode.ToLower(r)
+	}, out)
+	return string(out)
+}
+
+// Terms returns the distinct terms of s, as indexed by the term tokenizer.
+func Terms(s string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range strings.Fields(Normalize(s)) {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// HasTerms reports whether value contains all, or with any set, at least one
+// of the terms in query.
+func HasTerms(value, query string, any bool) bool {
+	return hasAll(Terms(value), Terms(query), any)
+}
+
+func hasAll(terms, want []string, any bool) bool {
+	have := make(map[string]bool)
+	for _, t := range terms {
+		have[t] = true
+	}
+	if len(want) == 0 {
+		return false
+	}
+	for _, t := range want {
+		if have[t] == any {
+			return any
+		}
+	}
+	return !any
+}
@@ -0,0 +1,70 @@
+package memgraph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+func TestGraph(t *testing.T) {
+	g := New()
+	g.LangSep = "."
+	for _, line := range []string{
+		`<m.1> <film.director.film> <m.2> .`,
+		`<m.1> <film.director.film> <m.3> .`,
+		`<m.1> <film.director.film> <m.2> .`,
+		`<m.2> <type.object.name> "The Look Of A Man"@en .`,
+		`<m.3> <film.film.initial_release_date> "1990-12-01" .`,
+		`<m.3> <tag> "b" .`,
+		`<m.3> <tag> "a" .`,
+		`<m.3> <tag> "b" .`,
+	} {
+		nq, err := nquad.Parse(line)
+		require.NoError(t, err)
+		g.Add(nq)
+	}
+	m1, m2, m3 := nquad.Fingerprint("m.1"), nquad.Fingerprint("m.2"), nquad.Fingerprint("m.3")
+
+	require.Equal(t, Sorted([]uint64{m2, m3}), g.Neighbors(m1, "film.director.film"))
+	require.Len(t, g.Expand([]uint64{m1}, "film.director.film"), 3)
+	require.Equal(t, []uint64{m1, m1}, g.Reverse("film.director.film")[m2])
+	v, ok := g.Value(m2, "type.object.name.en")
+	require.True(t, ok)
+	require.Equal(t, "The Look Of A Man", v)
+	require.Equal(t, []uint64{m3}, g.Subjects("film.film.initial_release_date"))
+
+	// Every value is kept, the last one read at the end.
+	require.Equal(t, []string{"a", "b"}, g.Values["tag"][m3])
+	v, _ = g.Value(m3, "tag")
+	require.Equal(t, "b", v)
+}
+
+func TestTerms(t *testing.T) {
+	require.Equal(t, []string{"saying", "good", "bye", "oneday"}, Terms("Saying good-bye, oneday"))
+	require.Equal(t, []string{"cafe"}, Terms("Café"))
+	require.True(t, HasTerms("The Look Of A Man", "the a", false))
+	require.False(t, HasTerms("The Look Of A Man", "the bad", false))
+	require.True(t, HasTerms("Bad Manners", "good bad", true))
+	require.False(t, HasTerms("Manners", "good bad", true))
+}
+
+func TestStem(t *testing.T) {
+	for word, stem := range map[string]string{
+		"consign": "consign", "consigned": "consign", "consigning": "consign",
+		"consignment": "consign", "consistency": "consist", "consistently": "consist",
+		"consolation": "consol", "consolatory": "consolatori", "consolidated": "consolid",
+		"consolingly": "consol", "conspicuously": "conspicu", "conspiracy": "conspiraci",
+		"conspirators": "conspir", "constables": "constabl", "constancy": "constanc",
+		"caresses": "caress", "ponies": "poni", "ties": "tie", "cats": "cat",
+		"agreed": "agre", "hopping": "hop", "sized": "size", "filing": "file",
+		"happy": "happi", "relational": "relat", "generously": "generous",
+		"running": "run", "skies": "sky", "gas": "gas", "gaps": "gap", "by": "by",
+	} {
+		require.Equal(t, stem, Stem(word), word)
+	}
+	require.Equal(t, []string{"run", "dog", "park"}, FullTextTerms("The running dogs of the park"))
+	require.True(t, HasFullText("Dogs running in a park", "run dog", false))
+	require.False(t, HasFullText("Dogs running in a park", "the", true))
+}
@@ -0,0 +1,427 @@
+// Package mockdgraph is a stand-in for the HTTP API of a Dgraph alpha. It
+// serves /query, /mutate, /alter and /graphql with canned or recorded
+// responses, adds the usual extensions.server_latency block, can inject
+// latency, errors and transaction aborts, and keeps a log of every request it
+// receives. It lets the benchmark tools in this repository be tested without a
+// running cluster.
+//
+// Only the HTTP API is mocked. The tools here all talk to Dgraph over HTTP;
+// those using the gRPC API through dgo still need a real alpha.
+package mockdgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config controls the behaviour of the mock server.
+type Config struct {
+	// Latency is added to the handling of every request.
+	Latency time.Duration
+	// Jitter adds a uniformly random extra delay in [0, Jitter).
+	Jitter time.Duration
+	// ErrorRate is the fraction of requests answered with a Dgraph error.
+	ErrorRate float64
+	// HTTPErrorRate is the fraction of requests answered with a 503.
+	HTTPErrorRate float64
+	// AbortRate is the fraction of mutations answered with a txn abort.
+	AbortRate float64
+	// Seed seeds the random source used for jitter and fault injection.
+	Seed int64
+	// Upstream, if set, is the base URL of a real alpha. Requests without a
+	// fixture are forwarded to it and the response is recorded.
+	Upstream string
+}
+
+// Error is a single entry of the errors array in a Dgraph response.
+type Error struct {
+	Message    string            `json:"message"`
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+// Fixture is a canned response for a request, keyed by path and body.
+type Fixture struct {
+	Path   string          `json:"path"`
+	Body   string          `json:"body"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []Error         `json:"errors,omitempty"`
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Path        string
+	Params      url.Values
+	ContentType string
+	Body        string
+	// Query is the DQL text, also when the body was a JSON envelope.
+	Query    string
+	Received time.Time
+}
+
+// Server is the mock alpha. It implements http.Handler.
+type Server struct {
+	// URL is set by Start to the base URL of the running server.
+	URL string
+
+	cfg      Config
+	client   *http.Client
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	fixtures map[string]Fixture
+	requests []Request
+	ts       *httptest.Server
+	// uid is the last uid given to a blank node.
+	uid uint64
+}
+
+// New returns a server with no fixtures. Use Start, or mount it as a handler.
+func New(cfg Config) *Server {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Server{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: time.Minute},
+		rnd:      rand.New(rand.NewSource(seed)),
+		fixtures: make(map[string]Fixture),
+	}
+}
+
+// Start serves on a random local port and sets URL.
+func (s *Server) Start() string {
+	s.ts = httptest.NewServer(s)
+	s.URL = s.ts.URL
+	return s.URL
+}
+
+// Close stops a server started with Start.
+func (s *Server) Close() {
+	if s.ts != nil {
+		s.ts.Close()
+	}
+}
+
+// normalize collapses whitespace so that fixtures match regardless of the
+// indentation of the query.
+func normalize(body string) string {
+	return strings.Join(strings.Fields(body), " ")
+}
+
+func key(path, body string) string {
+	return path + "\x00" + normalize(body)
+}
+
+// Respond registers data as the response for body posted to path. data is
+// marshalled to JSON unless it already is JSON text, given as a string, []byte
+// or json.RawMessage.
+func (s *Server) Respond(path, body string, data interface{}) error {
+	raw, err := toJSON(data)
+	if err != nil {
+		return err
+	}
+	s.Add(Fixture{Path: path, Body: body, Data: raw})
+	return nil
+}
+
+// Fail registers a Dgraph error as the response for body posted to path.
+func (s *Server) Fail(path, body, message string) {
+	s.Add(Fixture{Path: path, Body: body, Errors: []Error{{
+		Message:    message,
+		Extensions: map[string]string{"code": "ErrorInvalidRequest"},
+	}}})
+}
+
+// Add registers a fixture, replacing any fixture with the same key.
+func (s *Server) Add(f Fixture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures[key(f.Path, f.Body)] = f
+}
+
+// Fixtures returns all the registered and recorded fixtures.
+func (s *Server) Fixtures() []Fixture {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Fixture, 0, len(s.fixtures))
+	for _, f := range s.fixtures {
+		out = append(out, f)
+	}
+	return out
+}
+
+// Load reads fixtures from a JSON file written by Save.
+func (s *Server) Load(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var fs []Fixture
+	if err := json.Unmarshal(b, &fs); err != nil {
+		return fmt.Errorf("while parsing fixtures %s: %v", file, err)
+	}
+	for _, f := range fs {
+		s.Add(f)
+	}
+	return nil
+}
+
+// Save writes all fixtures, including recorded ones, to a JSON file.
+func (s *Server) Save(file string) error {
+	b, err := json.MarshalIndent(s.Fixtures(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0644)
+}
+
+// Requests returns a copy of the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Request, len(s.requests))
+	copy(out, s.requests)
+	return out
+}
+
+// Reset forgets the received requests.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// roll returns true with probability p.
+func (s *Server) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rnd.Float64() < p
+}
+
+func (s *Server) delay() time.Duration {
+	d := s.cfg.Latency
+	if s.cfg.Jitter > 0 {
+		s.mu.Lock()
+		d += time.Duration(s.rnd.Int63n(int64(s.cfg.Jitter)))
+		s.mu.Unlock()
+	}
+	return d
+}
+
+// queryText extracts the DQL from a request body. Dgraph accepts either the
+// raw query or a JSON envelope of the form {"query": ..., "variables": ...}.
+func queryText(contentType, body string) string {
+	if !strings.HasPrefix(contentType, "application/json") {
+		return body
+	}
+	var env struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal([]byte(body), &env); err != nil || env.Query == "" {
+		return body
+	}
+	return env.Query
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := Request{
+		Path:        r.URL.Path,
+		Params:      r.URL.Query(),
+		ContentType: r.Header.Get("Content-Type"),
+		Body:        string(b),
+		Received:    start,
+	}
+	req.Query = queryText(req.ContentType, req.Body)
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	switch req.Path {
+	case "/query", "/mutate", "/alter", "/graphql":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	time.Sleep(s.delay())
+	if s.roll(s.cfg.HTTPErrorRate) {
+		http.Error(w, "injected failure", http.StatusServiceUnavailable)
+		return
+	}
+
+	var res response
+	switch {
+	case s.roll(s.cfg.ErrorRate):
+		res.Errors = []Error{{
+			Message:    "injected error",
+			Extensions: map[string]string{"code": "ErrorInvalidRequest"},
+		}}
+	case req.Path == "/mutate" && s.roll(s.cfg.AbortRate):
+		res.Errors = []Error{{
+			Message:    "Transaction has been aborted. Please retry",
+			Extensions: map[string]string{"code": "ErrorAborted"},
+		}}
+	default:
+		f, err := s.lookup(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		res.Data, res.Errors = f.Data, f.Errors
+	}
+
+	processing := time.Since(start)
+	res.Extensions = &extensions{
+		ServerLatency: latency{
+			ParsingNs:    1000,
+			ProcessingNs: processing.Nanoseconds(),
+			EncodingNs:   1000,
+			TotalNs:      processing.Nanoseconds() + 2000,
+		},
+		Txn: txn{StartTs: uint64(start.UnixNano())},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// lookup finds the fixture for a request, falling back to the upstream server
+// and then to a default successful response. The default response of a
+// mutation holds uids for its blank nodes.
+func (s *Server) lookup(req Request) (Fixture, error) {
+	k := key(req.Path, req.Query)
+	s.mu.Lock()
+	f, ok := s.fixtures[k]
+	s.mu.Unlock()
+	if ok {
+		return f, nil
+	}
+	if s.cfg.Upstream != "" {
+		return s.record(req)
+	}
+	f = Fixture{Path: req.Path, Body: req.Query}
+	switch req.Path {
+	case "/query", "/graphql":
+		f.Data = json.RawMessage(`{}`)
+	case "/mutate":
+		data, err := json.Marshal(map[string]interface{}{
+			"code": "Success", "message": "Done", "uids": s.assign(req.Body),
+		})
+		if err != nil {
+			return Fixture{}, err
+		}
+		f.Data = data
+	case "/alter":
+		f.Data = json.RawMessage(`{"code":"Success","message":"Done"}`)
+	}
+	return f, nil
+}
+
+var blankRE = regexp.MustCompile(`_:[^\s"<>]+`)
+
+// assign gives a new uid to each blank node of a mutation, as an alpha does:
+// the same label in another mutation is another node.
+func (s *Server) assign(body string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uids := make(map[string]string)
+	for _, b := range blankRE.FindAllString(body, -1) {
+		if _, ok := uids[b[2:]]; !ok {
+			s.uid++
+			uids[b[2:]] = fmt.Sprintf("%#x", s.uid)
+		}
+	}
+	return uids
+}
+
+// record forwards the request to the upstream server and stores the reply as
+// a fixture.
+func (s *Server) record(req Request) (Fixture, error) {
+	u := strings.TrimRight(s.cfg.Upstream, "/") + req.Path
+	if len(req.Params) > 0 {
+		u += "?" + req.Params.Encode()
+	}
+	hreq, err := http.NewRequest("POST", u, bytes.NewBufferString(req.Body))
+	if err != nil {
+		return Fixture{}, err
+	}
+	if req.ContentType != "" {
+		hreq.Header.Set("Content-Type", req.ContentType)
+	}
+	resp, err := s.client.Do(hreq)
+	if err != nil {
+		return Fixture{}, fmt.Errorf("while forwarding to upstream: %v", err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Fixture{}, err
+	}
+	var res response
+	if err := json.Unmarshal(b, &res); err != nil {
+		return Fixture{}, fmt.Errorf("while parsing upstream response: %v", err)
+	}
+	f := Fixture{Path: req.Path, Body: req.Query, Data: res.Data, Errors: res.Errors}
+	s.Add(f)
+	return f, nil
+}
+
+type latency struct {
+	ParsingNs    int64 `json:"parsing_ns"`
+	ProcessingNs int64 `json:"processing_ns"`
+	EncodingNs   int64 `json:"encoding_ns"`
+	TotalNs      int64 `json:"total_ns"`
+}
+
+type txn struct {
+	StartTs uint64 `json:"start_ts"`
+}
+
+type extensions struct {
+	ServerLatency latency `json:"server_latency"`
+	Txn           txn     `json:"txn"`
+}
+
+type response struct {
+	Data       json.RawMessage `json:"data,omitempty"`
+	Errors     []Error         `json:"errors,omitempty"`
+	Extensions *extensions     `json:"extensions,omitempty"`
+}
+
+func toJSON(data interface{}) (json.RawMessage, error) {
+	switch d := data.(type) {
+	case json.RawMessage:
+		return d, nil
+	case []byte:
+		return json.RawMessage(d), nil
+	case string:
+		return json.RawMessage(d), nil
+	}
+	b, err := json.Marshal(data)
+	return json.RawMessage(b), err
+}
+
+// ListenAndServe serves on addr until the listener fails.
+func (s *Server) ListenAndServe(addr string) error {
+	fmt.Fprintf(os.Stderr, "Mock dgraph listening on %s\n", addr)
+	return http.ListenAndServe(addr, s)
+}
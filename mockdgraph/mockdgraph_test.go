@@ -0,0 +1,119 @@
+package mockdgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type result struct {
+	Data       map[string]interface{} `json:"data"`
+	Errors     []Error                `json:"errors"`
+	Extensions struct {
+		ServerLatency map[string]int64 `json:"server_latency"`
+	} `json:"extensions"`
+}
+
+func post(t *testing.T, url, contentType, body string) result {
+	resp, err := http.Post(url, contentType, bytes.NewBufferString(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var r result
+	require.NoError(t, json.Unmarshal(b, &r))
+	return r
+}
+
+func TestCannedResponse(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Start()
+	defer s.Close()
+
+	q := `{
+  me(func: uid(0x1)) {
+    name
+  }
+}`
+	require.NoError(t, s.Respond("/query", q, map[string]interface{}{
+		"me": []map[string]string{{"name": "Alice"}},
+	}))
+
+	// Whitespace differences don't matter.
+	r := post(t, s.URL+"/query", "application/dql", `{ me(func: uid(0x1)) { name } }`)
+	require.Empty(t, r.Errors)
+	require.Equal(t, "Alice", r.Data["me"].([]interface{})[0].(map[string]interface{})["name"])
+	require.Contains(t, r.Extensions.ServerLatency, "total_ns")
+
+	// The JSON envelope is unwrapped before matching.
+	r = post(t, s.URL+"/query", "application/json", `{"query": "{ me(func: uid(0x1)) { name } }"}`)
+	require.NotNil(t, r.Data["me"])
+
+	reqs := s.Requests()
+	require.Len(t, reqs, 2)
+	require.Equal(t, "/query", reqs[1].Path)
+	require.Equal(t, "{ me(func: uid(0x1)) { name } }", reqs[1].Query)
+}
+
+func TestInjectedFaults(t *testing.T) {
+	s := New(Config{Latency: 20 * time.Millisecond, AbortRate: 1, Seed: 1})
+	s.Start()
+	defer s.Close()
+
+	start := time.Now()
+	r := post(t, s.URL+"/mutate?commitNow=true", "application/rdf", `{ set { _:a <name> "A" . } }`)
+	require.True(t, time.Since(start) >= 20*time.Millisecond)
+	require.Len(t, r.Errors, 1)
+	require.Equal(t, "ErrorAborted", r.Errors[0].Extensions["code"])
+	require.Equal(t, "true", s.Requests()[0].Params.Get("commitNow"))
+
+	// Aborts only apply to mutations.
+	r = post(t, s.URL+"/query", "application/dql", `{ q(func: has(name)) { uid } }`)
+	require.Empty(t, r.Errors)
+
+	s.Fail("/query", `{ bad }`, "syntax error")
+	r = post(t, s.URL+"/query", "application/dql", `{ bad }`)
+	require.Equal(t, "syntax error", r.Errors[0].Message)
+}
+
+func TestMutationUids(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Start()
+	defer s.Close()
+
+	r := post(t, s.URL+"/mutate?commitNow=true", "application/rdf", `{ set { _:a <friend> _:b . _:a <name> "A" . } }`)
+	require.Equal(t, map[string]interface{}{"a": "0x1", "b": "0x2"}, r.Data["uids"])
+	// A blank node is scoped to its mutation.
+	r = post(t, s.URL+"/mutate?commitNow=true", "application/json", `{"set": [{"uid": "_:a", "name": "A"}]}`)
+	require.Equal(t, map[string]interface{}{"a": "0x3"}, r.Data["uids"])
+}
+
+func TestRecordAndLoad(t *testing.T) {
+	up := New(Config{Seed: 1})
+	require.NoError(t, up.Respond("/query", `{ q(func: has(name)) { count(uid) } }`, `{"q":[{"count":3}]}`))
+	up.Start()
+	defer up.Close()
+
+	rec := New(Config{Seed: 1, Upstream: up.URL})
+	rec.Start()
+	r := post(t, rec.URL+"/query", "application/dql", `{ q(func: has(name)) { count(uid) } }`)
+	require.NotNil(t, r.Data["q"])
+	rec.Close()
+
+	file := filepath.Join(t.TempDir(), "fixtures.json")
+	require.NoError(t, rec.Save(file))
+
+	s := New(Config{Seed: 1})
+	require.NoError(t, s.Load(file))
+	s.Start()
+	defer s.Close()
+	r = post(t, s.URL+"/query", "application/dql", `{ q(func: has(name)) { count(uid) } }`)
+	require.Equal(t, float64(3), r.Data["q"].([]interface{})[0].(map[string]interface{})["count"])
+}
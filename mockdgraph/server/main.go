@@ -0,0 +1,63 @@
+// This tool runs the mock Dgraph server as a standalone process, so that the
+// benchmark tools can be pointed at it instead of a real cluster.
+//
+// To record responses from a real cluster and replay them later:
+//
+//	./server --addr :8236 --upstream http://localhost:8080 --record fixtures.json
+//	./server --addr :8236 --fixtures fixtures.json --latency 5ms --abort-rate 0.1
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dgraph-io/benchmarks/mockdgraph"
+)
+
+var (
+	addr      = flag.String("addr", ":8080", "Address to listen on.")
+	fixtures  = flag.String("fixtures", "", "JSON file with canned responses.")
+	record    = flag.String("record", "", "Write all fixtures to this file on exit.")
+	upstream  = flag.String("upstream", "", "Forward unknown requests to this Dgraph server and record the replies.")
+	latency   = flag.Duration("latency", 0, "Latency added to every request.")
+	jitter    = flag.Duration("jitter", 0, "Random extra latency up to this value.")
+	errRate   = flag.Float64("error-rate", 0, "Fraction of requests answered with a Dgraph error.")
+	httpRate  = flag.Float64("http-error-rate", 0, "Fraction of requests answered with HTTP 503.")
+	abortRate = flag.Float64("abort-rate", 0, "Fraction of mutations answered with a txn abort.")
+	seed      = flag.Int64("seed", 0, "Seed for fault injection. 0 picks one from the clock.")
+)
+
+func main() {
+	flag.Parse()
+	s := mockdgraph.New(mockdgraph.Config{
+		Latency:       *latency,
+		Jitter:        *jitter,
+		ErrorRate:     *errRate,
+		HTTPErrorRate: *httpRate,
+		AbortRate:     *abortRate,
+		Seed:          *seed,
+		Upstream:      *upstream,
+	})
+	if *fixtures != "" {
+		if err := s.Load(*fixtures); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *record != "" {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			if err := s.Save(*record); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Wrote %d fixtures to %s", len(s.Fixtures()), *record)
+			os.Exit(0)
+		}()
+	}
+	log.Fatal(s.ListenAndServe(*addr))
+}
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/dgraph-io/benchmarks/checkpoint"
 	"github.com/dgraph-io/dgraph/rdf"
 	"github.com/dgryski/go-farm"
 	"github.com/jmcvetta/neoism"
@@ -39,11 +40,41 @@ type counters struct {
 	ignored   uint64
 }
 
+// line is a line of the input, numbered from the first line of the first
+// file, with the uncompressed bytes of its file read up to its end.
+type line struct {
+	text   string
+	seq    uint64
+	offset int64
+	no     int64
+}
+
+// nquad is a parsed line.
+type nquad struct {
+	rdf.NQuad
+	line
+}
+
 type state struct {
-	input chan string
-	cnq   chan rdf.NQuad
+	input chan line
+	cnq   chan nquad
 	ctr   *counters
 	mod   uint64
+
+	// Every line handled, empty or ignored ones too, is acknowledged to the
+	// tracker, if there is one, as a batch of its own. The tracker saves the
+	// checkpoint every so many lines, and once the file is done.
+	file    string
+	tracker *checkpoint.Tracker
+}
+
+func (s *state) ack(l line) {
+	if s.tracker == nil {
+		return
+	}
+	if err := s.tracker.Ack(l.seq, s.file, l.offset, l.no); err != nil {
+		glog.WithError(err).Fatal("While saving the checkpoint.")
+	}
 }
 
 func (s *state) printCounters(ticker *time.Ticker) {
@@ -68,49 +99,67 @@ func (s *state) printCounters(ticker *time.Ticker) {
 	}
 }
 
-func (s *state) readLines(r io.Reader) {
-	var buf []string
-	scanner := bufio.NewScanner(r)
+// readLines reads the lines of r after start, which has the sequence number
+// of the last line before them and their offset and number in the file. It
+// returns the last line read.
+func (s *state) readLines(r io.Reader, start line) line {
+	var buf []line
+	br := bufio.NewReaderSize(r, 1<<20)
+	next := start
+	scan := func() bool {
+		text, err := br.ReadString('\n')
+		if err == io.EOF && len(text) == 0 {
+			return false
+		}
+		if err != nil && err != io.EOF {
+			glog.WithError(err).Fatal("While reading file.")
+		}
+		next.seq++
+		next.no++
+		next.offset += int64(len(text))
+		next.text = strings.TrimRight(text, "\r\n")
+		return true
+	}
 	// Randomize lines to avoid contention on same subject.
 	for i := 0; i < 1000; i++ {
-		if scanner.Scan() {
-			buf = append(buf, scanner.Text())
+		if scan() {
+			buf = append(buf, next)
 		} else {
 			break
 		}
 	}
 	ln := len(buf)
-	for scanner.Scan() {
+	for scan() {
 		k := rand.Intn(ln)
 		s.input <- buf[k]
-		buf[k] = scanner.Text()
+		buf[k] = next
 		atomic.AddUint64(&s.ctr.read, 1)
 	}
-	if err := scanner.Err(); err != nil {
-		glog.WithError(err).Fatal("While reading file.")
-	}
 	for i := 0; i < len(buf); i++ {
 		s.input <- buf[i]
 	}
 	close(s.input)
+	next.text = ""
+	return next
 }
 
 func (s *state) parseStream(done chan error) {
-	for line := range s.input {
-		line = strings.Trim(line, " \t")
-		if len(line) == 0 {
+	for l := range s.input {
+		text := strings.Trim(l.text, " \t")
+		if len(text) == 0 {
 			glog.Info("Empty line.")
+			s.ack(l)
 			continue
 		}
 
-		glog.Debugf("Got line: %q", line)
-		nq, err := rdf.Parse(line)
+		glog.Debugf("Got line: %q", text)
+		nq, err := rdf.Parse(text)
 		if err != nil {
-			glog.WithError(err).Errorf("While parsing: %q", line)
+			glog.WithError(err).Errorf("While parsing: %q", text)
 			done <- err
 			return
 		}
-		s.cnq <- nq
+		s.cnq <- nquad{nq, l}
 		atomic.AddUint64(&s.ctr.parsed, 1)
 	}
 	done <- nil
@@ -137,6 +186,7 @@ func (s *state) handleNQuads(db *neoism.Database, wg *sync.WaitGroup) {
 		if farm.Fingerprint64([]byte(nq.Subject))%s.mod != 0 {
 			// Ignore due to mod sampling.
 			atomic.AddUint64(&s.ctr.ignored, 1)
+			s.ack(nq.line)
 			continue
 		}
 
@@ -165,25 +215,32 @@ func (s *state) handleNQuads(db *neoism.Database, wg *sync.WaitGroup) {
 		}
 
 		atomic.AddUint64(&s.ctr.processed, 1)
+		s.ack(nq.line)
 	}
 	wg.Done()
 }
 
-// Blocking function.
-func HandleRdfReader(
-	db *neoism.Database, reader io.Reader, mod uint64) (uint64, error) {
+// Blocking function. The lines of reader, from file, are read after start,
+// and acknowledged to tracker, if not nil, once handled. It returns the
+// number of N-Quads processed and the last line read.
+func HandleRdfReader(db *neoism.Database, reader io.Reader, mod uint64,
+	file string, start line, tracker *checkpoint.Tracker) (uint64, line, error) {
 
 	s := new(state)
 	s.ctr = new(counters)
+	s.file, s.tracker = file, tracker
 	ticker := time.NewTicker(time.Second)
 	go s.printCounters(ticker)
 
 	// Producer: Start buffering input to channel.
 	s.mod = mod
-	s.input = make(chan string, 10000)
-	go s.readLines(reader)
+	s.input = make(chan line, 10000)
+	last := make(chan line, 1)
+	go func() {
+		last <- s.readLines(reader, start)
+	}()
 
-	s.cnq = make(chan rdf.NQuad, 10000)
+	s.cnq = make(chan nquad, 10000)
 	numr := runtime.GOMAXPROCS(-1)
 	done := make(chan error, numr)
 	for i := 0; i < numr; i++ {
@@ -207,7 +264,12 @@ func HandleRdfReader(
 	// Okay, we've stopped input to cnq, and closed it.
 	// Now wait for handleNQuads to finish.
 	wg.Wait()
+	if tracker != nil {
+		if err := tracker.Flush(); err != nil {
+			return 0, line{}, err
+		}
+	}
 
 	ticker.Stop()
-	return atomic.LoadUint64(&s.ctr.processed), nil
+	return atomic.LoadUint64(&s.ctr.processed), <-last, nil
 }
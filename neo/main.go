@@ -20,12 +20,15 @@ import (
 	"compress/gzip"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"runtime"
 	"strings"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/dgraph-io/benchmarks/checkpoint"
 	"github.com/jmcvetta/neoism"
 )
 
@@ -34,6 +37,9 @@ var rdfGzips = flag.String("rdfgzips", "",
 	"Comma separated gzip files containing RDF data")
 var mod = flag.Uint64("mod", 1, "Only pick entities, where uid % mod == 0.")
 var threads = flag.Int("threads", 1, "Use these many threads.")
+var cpFile = flag.String("checkpoint", "neoloader.checkpoint",
+	"File to record the last line loaded, with all lines before it, in, every 1000 lines or every second. Empty for none.")
+var resume = flag.Bool("resume", false, "Resume from the -checkpoint file, if there is one.")
 
 func main() {
 	flag.Parse()
@@ -54,11 +60,37 @@ func main() {
 		log.Fatal(err)
 	}
 
-	files := strings.Split(*rdfGzips, ",")
-	for _, path := range files {
-		if len(path) == 0 {
-			continue
+	var files []string
+	for _, path := range strings.Split(*rdfGzips, ",") {
+		if len(path) > 0 {
+			files = append(files, path)
 		}
+	}
+	var start *checkpoint.Checkpoint
+	if *resume {
+		start, err = checkpoint.Load(*cpFile)
+		switch {
+		case os.IsNotExist(err):
+			glog.WithField("checkpoint", *cpFile).Info("No checkpoint, starting from the beginning")
+		case err != nil:
+			glog.WithError(err).Fatal("Unable to read the checkpoint.")
+		}
+		// Lines in flight are handled again, which GetOrCreateNode makes
+		// safe for nodes. Edges may be related twice.
+	}
+	if files, err = start.Files(files); err != nil {
+		glog.WithError(err).Fatal("Unable to resume.")
+	}
+	var tracker *checkpoint.Tracker
+	if *cpFile != "" {
+		tracker = checkpoint.NewTracker(*cpFile, start)
+	}
+
+	var last line
+	if start != nil {
+		last.seq = start.Seq
+	}
+	for i, path := range files {
 		glog.WithField("path", path).Info("Handling...")
 		f, err := os.Open(path)
 		if err != nil {
@@ -70,10 +102,20 @@ func main() {
 			glog.WithError(err).Fatal("Unable to create gzip reader.")
 		}
 
-		count, err := HandleRdfReader(db, r, *mod)
+		from := line{seq: last.seq}
+		if i == 0 && start != nil {
+			// Skip the lines loaded before.
+			if _, err := io.CopyN(ioutil.Discard, r, start.Offset); err != nil {
+				glog.WithError(err).Fatal("Unable to skip to the checkpoint.")
+			}
+			from.offset, from.no = start.Offset, start.NQuads
+			glog.WithField("seq", start.Seq).WithField("offset", start.Offset).Info("Resuming")
+		}
+		count, l, err := HandleRdfReader(db, r, *mod, path, from, tracker)
 		if err != nil {
 			glog.WithError(err).Fatal("While handling rdf reader.")
 		}
+		last = l
 		glog.WithField("count", count).Info("RDFs parsed")
 
 		r.Close()
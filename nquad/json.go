@@ -0,0 +1,232 @@
+package nquad
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// jsonReader turns the objects of a Dgraph JSON data set, such as
+// 21million.json.gz or a JSON export, into N-Quads. The input is an array of
+// objects, or a single object. Keys are predicates, optionally with @lang;
+// pred|facet keys hold facets, in a nested object those of the edge to it;
+// nested objects are edges to other nodes, with their uid or a new blank
+// node; and numbers, bools and GeoJSON values get their datatype.
+type jsonReader struct {
+	dec     *json.Decoder
+	started bool
+	array   bool
+	queue   []NQuad
+	objects int
+	// file numbers the reader, so that the blank nodes of objects without a
+	// uid differ between files.
+	file  int64
+	blank int
+}
+
+var jsonFiles int64
+
+// NewJSONReader reads N-Quads from a JSON data set. Objects without a uid get
+// blank nodes of the form _:json<file>.<n>, where file numbers the readers of
+// the process.
+func NewJSONReader(r io.Reader) *Reader {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &Reader{js: &jsonReader{dec: dec, file: atomic.AddInt64(&jsonFiles, 1)}}
+}
+
+// next returns the next N-Quad, flattening the next object when the ones
+// before are used up.
+func (j *jsonReader) next() (NQuad, error) {
+	for len(j.queue) == 0 {
+		if err := j.read(); err != nil {
+			return NQuad{}, err
+		}
+	}
+	nq := j.queue[0]
+	j.queue = j.queue[1:]
+	return nq, nil
+}
+
+// read flattens the next top-level object into the queue.
+func (j *jsonReader) read() error {
+	if !j.started {
+		j.started = true
+		t, err := j.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case json.Delim('['):
+			j.array = true
+		case json.Delim('{'):
+			// A single object: read it whole, from the start.
+			var obj map[string]interface{}
+			if err := j.decodeRest(&obj); err != nil {
+				return err
+			}
+			return j.flatten(obj)
+		default:
+			return fmt.Errorf("expected a JSON array or object, got %v", t)
+		}
+	}
+	if !j.array || !j.dec.More() {
+		return io.EOF
+	}
+	var obj map[string]interface{}
+	if err := j.dec.Decode(&obj); err != nil {
+		return fmt.Errorf("object %d: %v", j.objects+1, err)
+	}
+	return j.flatten(obj)
+}
+
+// decodeRest reads the members of an object whose { was already read.
+func (j *jsonReader) decodeRest(obj *map[string]interface{}) error {
+	*obj = make(map[string]interface{})
+	for j.dec.More() {
+		t, err := j.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("expected a key, got %v", t)
+		}
+		var v interface{}
+		if err := j.dec.Decode(&v); err != nil {
+			return err
+		}
+		(*obj)[key] = v
+	}
+	_, err := j.dec.Token()
+	return err
+}
+
+func (j *jsonReader) flatten(obj map[string]interface{}) error {
+	j.objects++
+	_, _, err := j.node(obj, "")
+	return err
+}
+
+// node adds the N-Quads of an object reached by the edge parent, if any, and
+// returns its id and the facets it gives that edge.
+func (j *jsonReader) node(obj map[string]interface{}, parent string) (string, []Facet, error) {
+	id, _ := obj["uid"].(string)
+	if id == "" {
+		j.blank++
+		id = fmt.Sprintf("_:json%d.%d", j.file, j.blank)
+	}
+	// Facets by predicate, and for list items by index.
+	facets := make(map[string]map[string][]Facet)
+	keys := make([]string, 0, len(obj))
+	for k, v := range obj {
+		i := strings.Index(k, "|")
+		if i < 0 {
+			keys = append(keys, k)
+			continue
+		}
+		pred, name := k[:i], k[i+1:]
+		if facets[pred] == nil {
+			facets[pred] = make(map[string][]Facet)
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			// List facets map the index of each item to its value.
+			for idx, fv := range m {
+				facets[pred][idx] = append(facets[pred][idx], Facet{Key: name, Value: facetValue(fv)})
+			}
+			continue
+		}
+		facets[pred][""] = append(facets[pred][""], Facet{Key: name, Value: facetValue(v)})
+	}
+	sort.Strings(keys)
+	// As in Dgraph, parent|facet keys also hold the facets of the edge.
+	var edge []Facet
+	if parent != "" {
+		edge = facets[parent][""]
+	}
+	for _, k := range keys {
+		if k == "uid" {
+			continue
+		}
+		pred, lang := k, ""
+		if i := strings.LastIndex(k, "@"); i > 0 {
+			pred, lang = k[:i], k[i+1:]
+		}
+		items, list := obj[k].([]interface{})
+		if !list {
+			items = []interface{}{obj[k]}
+		}
+		for i, v := range items {
+			nq := NQuad{Subject: id, Predicate: pred, Lang: lang}
+			nq.Facets = facets[k][""]
+			if list {
+				nq.Facets = facets[k][strconv.Itoa(i)]
+			}
+			nq.Facets = append([]Facet(nil), nq.Facets...)
+			ok, err := j.object(&nq, v)
+			if err != nil {
+				return "", nil, fmt.Errorf("%s of %s: %v", k, id, err)
+			}
+			if ok {
+				sortFacets(nq.Facets)
+				j.queue = append(j.queue, nq)
+			}
+		}
+	}
+	return id, edge, nil
+}
+
+// object sets the object of nq from a JSON value. It returns false for null.
+func (j *jsonReader) object(nq *NQuad, v interface{}) (bool, error) {
+	switch v := v.(type) {
+	case nil:
+		return false, nil
+	case string:
+		nq.ObjectValue = v
+	case json.Number:
+		nq.ObjectValue = v.String()
+		nq.Datatype = "xs:float"
+		if _, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			nq.Datatype = "xs:int"
+		}
+	case bool:
+		nq.ObjectValue = strconv.FormatBool(v)
+		nq.Datatype = "xs:boolean"
+	case map[string]interface{}:
+		if _, ok := v["coordinates"]; ok && v["type"] != nil {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return false, err
+			}
+			nq.ObjectValue = string(b)
+			nq.Datatype = "geo:geojson"
+			break
+		}
+		id, facets, err := j.node(v, nq.Predicate)
+		if err != nil {
+			return false, err
+		}
+		nq.ObjectId = id
+		nq.Facets = append(nq.Facets, facets...)
+	default:
+		return false, fmt.Errorf("unsupported value %v", v)
+	}
+	return true, nil
+}
+
+// facetValue formats a facet as written in RDF: strings quoted, the rest
+// as is.
+func facetValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return Quote(s)
+	}
+	return fmt.Sprint(v)
+}
+
+func sortFacets(fs []Facet) {
+	sort.Slice(fs, func(i, j int) bool { return fs[i].Key < fs[j].Key })
+}
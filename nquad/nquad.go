@@ -0,0 +1,316 @@
+// Package nquad parses and formats the RDF N-Quad lines used by the Dgraph
+// data sets in this repository, including language tags, datatypes and
+// facets, and streams them from plain or gzipped files, RDF or Dgraph JSON.
+package nquad
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	farm "github.com/dgryski/go-farm"
+)
+
+// Facet is a key value pair attached to an N-Quad. Value is kept as written,
+// e.g. `"since 2010"`, `10`, `true` or `2006-01-02T15:04:05`.
+type Facet struct {
+	Key   string
+	Value string
+}
+
+// NQuad is a single parsed line. Exactly one of ObjectId and ObjectValue is
+// meaningful: ObjectId is set for edges to other nodes.
+type NQuad struct {
+	// Subject is the node id without angle brackets. Blank nodes keep their
+	// _: prefix.
+	Subject   string
+	Predicate string
+	ObjectId  string
+	// ObjectValue is the unescaped literal value.
+	ObjectValue string
+	// Datatype is the IRI after ^^, without angle brackets, e.g. xs:int.
+	Datatype string
+	Lang     string
+	Label    string
+	Facets   []Facet
+}
+
+// IsEdge reports whether the object is a node rather than a literal.
+func (nq NQuad) IsEdge() bool {
+	return len(nq.ObjectId) > 0
+}
+
+// Fingerprint maps a node id to a uint64. Ids of the form 0x... are parsed,
+// anything else is fingerprinted like the old rdf.GetUid did.
+func Fingerprint(id string) uint64 {
+	if strings.HasPrefix(id, "0x") {
+		if u, err := strconv.ParseUint(id[2:], 16, 64); err == nil {
+			return u
+		}
+	}
+	return farm.Fingerprint64([]byte(id))
+}
+
+func formatNode(id string) string {
+	if strings.HasPrefix(id, "_:") || id == "*" ||
+		strings.HasPrefix(id, "uid(") || strings.HasPrefix(id, "val(") {
+		return id
+	}
+	return "<" + id + ">"
+}
+
+// Quote escapes a literal value for use in an N-Quad.
+func Quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// String formats the N-Quad as a line, without the trailing newline.
+func (nq NQuad) String() string {
+	var b strings.Builder
+	b.WriteString(formatNode(nq.Subject))
+	b.WriteByte(' ')
+	b.WriteString(formatNode(nq.Predicate))
+	b.WriteByte(' ')
+	if nq.IsEdge() {
+		b.WriteString(formatNode(nq.ObjectId))
+	} else {
+		b.WriteString(Quote(nq.ObjectValue))
+		if nq.Lang != "" {
+			b.WriteByte('@')
+			b.WriteString(nq.Lang)
+		} else if nq.Datatype != "" {
+			b.WriteString("^^<")
+			b.WriteString(nq.Datatype)
+			b.WriteByte('>')
+		}
+	}
+	if nq.Label != "" {
+		b.WriteByte(' ')
+		b.WriteString(formatNode(nq.Label))
+	}
+	if len(nq.Facets) > 0 {
+		b.WriteString(" (")
+		for i, f := range nq.Facets {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(f.Key)
+			b.WriteByte('=')
+			b.WriteString(f.Value)
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(" .")
+	return b.String()
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at column %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// node reads an <iri>, a _:blank node, or the uid(v)/val(v) and * forms used
+// in upserts and deletes.
+func (p *parser) node() (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return "", p.errorf("unexpected end of line")
+	}
+	rest := p.s[p.pos:]
+	switch {
+	case rest[0] == '<':
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			return "", p.errorf("unterminated IRI")
+		}
+		p.pos += end + 1
+		return rest[1:end], nil
+	case rest[0] == '*':
+		p.pos++
+		return "*", nil
+	case strings.HasPrefix(rest, "_:"), strings.HasPrefix(rest, "uid("),
+		strings.HasPrefix(rest, "val("):
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		p.pos += end
+		return rest[:end], nil
+	}
+	return "", p.errorf("expected a node, got %q", rest[:1])
+}
+
+// literal reads a double quoted string and unescapes it.
+func (p *parser) literal() (string, error) {
+	var b bytes.Buffer
+	p.pos++ // opening quote
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if p.pos+1 >= len(p.s) {
+				return "", p.errorf("dangling escape")
+			}
+			e := p.s[p.pos+1]
+			p.pos += 2
+			switch e {
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case '"', '\'', '\\':
+				b.WriteByte(e)
+			case 'u', 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if p.pos+n > len(p.s) {
+					return "", p.errorf("short unicode escape")
+				}
+				r, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+				if err != nil {
+					return "", p.errorf("invalid unicode escape")
+				}
+				b.WriteRune(rune(r))
+				p.pos += n
+			default:
+				return "", p.errorf("invalid escape \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated literal")
+}
+
+// facets reads (k1=v1, k2="v 2").
+func (p *parser) facets() ([]Facet, error) {
+	p.pos++ // (
+	var out []Facet
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("unterminated facets")
+		}
+		if p.s[p.pos] == ')' {
+			p.pos++
+			return out, nil
+		}
+		if p.s[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		eq := strings.IndexByte(p.s[p.pos:], '=')
+		if eq < 0 {
+			return nil, p.errorf("facet without value")
+		}
+		key := strings.TrimSpace(p.s[p.pos : p.pos+eq])
+		p.pos += eq + 1
+		p.skipSpace()
+		start := p.pos
+		if p.pos < len(p.s) && p.s[p.pos] == '"' {
+			if _, err := p.literal(); err != nil {
+				return nil, err
+			}
+		} else {
+			for p.pos < len(p.s) && p.s[p.pos] != ',' && p.s[p.pos] != ')' {
+				p.pos++
+			}
+		}
+		out = append(out, Facet{Key: key, Value: strings.TrimSpace(p.s[start:p.pos])})
+	}
+}
+
+// Parse parses a single N-Quad line. Blank lines and comments are an error;
+// use Reader to skip them.
+func Parse(line string) (NQuad, error) {
+	var nq NQuad
+	var err error
+	p := &parser{s: strings.TrimSpace(line)}
+	if nq.Subject, err = p.node(); err != nil {
+		return nq, err
+	}
+	if nq.Predicate, err = p.node(); err != nil {
+		return nq, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		if nq.ObjectValue, err = p.literal(); err != nil {
+			return nq, err
+		}
+		switch {
+		case strings.HasPrefix(p.s[p.pos:], "@"):
+			end := strings.IndexAny(p.s[p.pos:], " \t")
+			if end < 0 {
+				return nq, p.errorf("missing terminator")
+			}
+			nq.Lang = p.s[p.pos+1 : p.pos+end]
+			p.pos += end
+		case strings.HasPrefix(p.s[p.pos:], "^^"):
+			p.pos += 2
+			if nq.Datatype, err = p.node(); err != nil {
+				return nq, err
+			}
+		}
+	} else if nq.ObjectId, err = p.node(); err != nil {
+		return nq, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) && p.s[p.pos] == '<' {
+		if nq.Label, err = p.node(); err != nil {
+			return nq, err
+		}
+		p.skipSpace()
+	}
+	if p.pos < len(p.s) && p.s[p.pos] == '(' {
+		if nq.Facets, err = p.facets(); err != nil {
+			return nq, err
+		}
+		p.skipSpace()
+	}
+	if p.pos >= len(p.s) || p.s[p.pos] != '.' {
+		return nq, p.errorf("missing terminator")
+	}
+	return nq, nil
+}
@@ -0,0 +1,186 @@
+package nquad
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want NQuad
+	}{
+		{`<m.0abc>	<film.director.film>	<m.0def>	.`,
+			NQuad{Subject: "m.0abc", Predicate: "film.director.film", ObjectId: "m.0def"}},
+		{`_:a <name> "The Look Of A Man"@en .`,
+			NQuad{Subject: "_:a", Predicate: "name", ObjectValue: "The Look Of A Man", Lang: "en"}},
+		{`<0x1> <age> "42"^^<xs:int> .`,
+			NQuad{Subject: "0x1", Predicate: "age", ObjectValue: "42", Datatype: "xs:int"}},
+		{`_:a <quote> "say \"hi\"\né" .`,
+			NQuad{Subject: "_:a", Predicate: "quote", ObjectValue: "say \"hi\"\né"}},
+		{`_:a <friend> _:b (since=2006-01-02T15:04:05, close=true, note="a, b") .`,
+			NQuad{Subject: "_:a", Predicate: "friend", ObjectId: "_:b", Facets: []Facet{
+				{"since", "2006-01-02T15:04:05"}, {"close", "true"}, {"note", `"a, b"`}}}},
+		{`<a> <b> "c" <label> .`,
+			NQuad{Subject: "a", Predicate: "b", ObjectValue: "c", Label: "label"}},
+		{`uid(v) <name> * .`,
+			NQuad{Subject: "uid(v)", Predicate: "name", ObjectId: "*"}},
+	}
+	for _, tc := range tests {
+		got, err := Parse(tc.line)
+		require.NoError(t, err, tc.line)
+		require.Equal(t, tc.want, got, tc.line)
+
+		// Formatting and parsing again gives the same N-Quad.
+		again, err := Parse(got.String())
+		require.NoError(t, err, got.String())
+		require.Equal(t, got, again)
+	}
+
+	for _, line := range []string{
+		`<a> <b> "c"`,
+		`<a> <b> "c .`,
+		`<a> <b>`,
+		`a b c .`,
+	} {
+		_, err := Parse(line)
+		require.Error(t, err, line)
+	}
+}
+
+func TestReader(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte("# comment\n<a> <name> \"A B\" .\n\n<a> <friend> <b> .\n"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	path := filepath.Join(t.TempDir(), "data.rdf.gz")
+	require.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	nq, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "A B", nq.ObjectValue)
+	require.Equal(t, 2, r.Line())
+	offset := r.Offset()
+	nq, err = r.Next()
+	require.NoError(t, err)
+	require.True(t, nq.IsEdge())
+	_, err = r.Next()
+	require.Equal(t, io.EOF, err)
+
+	// Reading resumes from an offset.
+	r2, err := Open(path)
+	require.NoError(t, err)
+	defer r2.Close()
+	require.NoError(t, r2.SkipTo(offset))
+	require.Equal(t, 2, r2.Line())
+	nq, err = r2.Next()
+	require.NoError(t, err)
+	require.Equal(t, "b", nq.ObjectId)
+	require.Error(t, r2.SkipTo(offset+100))
+
+	r3, err := Open(path)
+	require.NoError(t, err)
+	defer r3.Close()
+	require.Error(t, r3.SkipTo(offset-1))
+}
+
+func TestSkipToEnd(t *testing.T) {
+	// The last line has no newline.
+	data := "<a> <name> \"A\" .\n<b> <name> \"B\" ."
+	path := filepath.Join(t.TempDir(), "data.rdf")
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	for i := 0; i < 2; i++ {
+		_, err := r.Next()
+		require.NoError(t, err)
+	}
+	end := r.Offset()
+	require.Equal(t, int64(len(data)), end)
+
+	r2, err := Open(path)
+	require.NoError(t, err)
+	defer r2.Close()
+	require.NoError(t, r2.SkipTo(end))
+	require.Equal(t, 2, r2.Line())
+	_, err = r2.Next()
+	require.Equal(t, io.EOF, err)
+
+	r3, err := Open(path)
+	require.NoError(t, err)
+	defer r3.Close()
+	require.Error(t, r3.SkipTo(end+1))
+}
+
+func TestFingerprint(t *testing.T) {
+	require.Equal(t, uint64(0x1f), Fingerprint("0x1f"))
+	// Other ids are fingerprinted, like the golden data does for freebase ids.
+	require.Equal(t, uint64(0x3b0de646eaf32b75), Fingerprint("m.06pj8"))
+}
+
+func TestJSONReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(` [
+  {"uid": "_:a", "name": "Alice Smith", "name@fr": "Alice", "age": 30, "score": 1.5,
+   "dgraph.type": ["Person"], "active": true,
+   "friend": [{"uid": "_:b", "name": "Bob", "friend|close": true}, {"uid": "0x2"}],
+   "friend|since": {"0": "2010", "1": 2011},
+   "loc": {"type": "Point", "coordinates": [1.5, 2]},
+   "nickname": null},
+  {"name": "Nobody"}
+]`), 0644))
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	var lines []string
+	for {
+		nq, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		lines = append(lines, nq.String())
+	}
+	require.Equal(t, []string{
+		`_:a <active> "true"^^<xs:boolean> .`,
+		`_:a <age> "30"^^<xs:int> .`,
+		`_:a <dgraph.type> "Person" .`,
+		`_:b <name> "Bob" .`,
+		`_:a <friend> _:b (close=true, since="2010") .`,
+		`_:a <friend> <0x2> (since=2011) .`,
+		`_:a <loc> "{\"coordinates\":[1.5,2],\"type\":\"Point\"}"^^<geo:geojson> .`,
+		`_:a <name> "Alice Smith" .`,
+		`_:a <name> "Alice"@fr .`,
+		`_:a <score> "1.5"^^<xs:float> .`,
+		fmt.Sprintf(`_:json%d.1 <name> "Nobody" .`, r.js.file),
+	}, lines)
+	require.Equal(t, 2, r.Line())
+
+	// Another file gets other blank nodes.
+	first := lines[len(lines)-1]
+	r = NewJSONReader(strings.NewReader(`[{"name": "Nobody"}]`))
+	nq, err := r.Next()
+	require.NoError(t, err)
+	require.NotEqual(t, first, nq.String())
+
+	r = NewJSONReader(strings.NewReader(`{"uid": "_:x", "name": "X"}`))
+	nq, err = r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "X", nq.ObjectValue)
+	_, err = r.Next()
+	require.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,186 @@
+package nquad
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Reader streams N-Quads from an RDF file, skipping blank lines and comments,
+// or from a JSON data set.
+type Reader struct {
+	r      *bufio.Reader
+	js     *jsonReader
+	closer []io.Closer
+	line   int
+	offset int64
+}
+
+// NewReader reads N-Quads from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 1<<20)}
+}
+
+// isJSON reports whether the input starts with [ or {, which no RDF line does.
+func isJSON(br *bufio.Reader) bool {
+	for n := 1; n <= 4096; n++ {
+		b, _ := br.Peek(n)
+		if len(b) < n {
+			return false
+		}
+		switch b[n-1] {
+		case ' ', '\t', '\r', '\n':
+		case '[', '{':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// Open opens a plain or gzipped RDF or JSON file. Gzip and JSON are detected
+// from the contents, not the file name.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(f, 1<<20)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		f.Close()
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		gbr := bufio.NewReaderSize(gz, 1<<20)
+		r := &Reader{r: gbr}
+		if isJSON(gbr) {
+			r = NewJSONReader(gbr)
+		}
+		r.closer = []io.Closer{gz, f}
+		return r, nil
+	}
+	r := &Reader{r: br}
+	if isJSON(br) {
+		r = NewJSONReader(br)
+	}
+	r.closer = []io.Closer{f}
+	return r, nil
+}
+
+// Next returns the next N-Quad, or io.EOF at the end of the input.
+func (r *Reader) Next() (NQuad, error) {
+	if r.js != nil {
+		return r.js.next()
+	}
+	for {
+		line, err := r.r.ReadString('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return NQuad{}, err
+		}
+		r.line++
+		r.offset += int64(len(line))
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		nq, perr := Parse(line)
+		if perr != nil {
+			return nq, fmt.Errorf("line %d: %v: %q", r.line, perr, line)
+		}
+		return nq, nil
+	}
+}
+
+// Line returns the number of the last line read, starting at 1. For JSON it
+// is the number of the last top-level object read.
+func (r *Reader) Line() int {
+	if r.js != nil {
+		return r.js.objects
+	}
+	return r.line
+}
+
+// Offset returns the number of uncompressed bytes consumed so far.
+func (r *Reader) Offset() int64 {
+	if r.js != nil {
+		return r.js.dec.InputOffset()
+	}
+	return r.offset
+}
+
+// ErrNoSkip is returned by SkipTo for JSON input, which can only be skipped an
+// N-Quad at a time.
+var ErrNoSkip = errors.New("nquad: can't skip to an offset in JSON input")
+
+// SkipTo skips the input up to offset, an Offset returned while reading the
+// same input before, so that Next continues from there. Offset must be at the
+// end of a line.
+func (r *Reader) SkipTo(offset int64) error {
+	if r.js != nil {
+		return ErrNoSkip
+	}
+	for r.offset < offset {
+		line, err := r.r.ReadString('\n')
+		if len(line) > 0 {
+			r.line++
+		}
+		r.offset += int64(len(line))
+		if err == io.EOF {
+			// The last line may have no newline.
+			if r.offset < offset {
+				return fmt.Errorf("offset %d is past the end of the input, at %d", offset, r.offset)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if r.offset != offset {
+		return fmt.Errorf("offset %d is not at the end of a line", offset)
+	}
+	return nil
+}
+
+// Close closes the underlying files.
+func (r *Reader) Close() error {
+	var first error
+	for _, c := range r.closer {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Each calls fn for every N-Quad in the file at path.
+func Each(path string, fn func(NQuad) error) error {
+	r, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for {
+		nq, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if err := fn(nq); err != nil {
+			return err
+		}
+	}
+}
@@ -30,6 +30,10 @@ var (
 	glog       = x.Log("PbBenchmark")
 	serverAddr = flag.String("ip", "http://127.0.0.1:8080/query",
 		"Addr of server for http request")
+	actorFile = flag.String("actors", "../throughputtest/listofactors",
+		"File with actor xids, one per line. Lines starting with # are skipped.")
+	directorFile = flag.String("directors", "../throughputtest/listofdirectors",
+		"File with director xids, one per line. Lines starting with # are skipped.")
 )
 
 func checkErr(err error, msg string) {
@@ -185,23 +189,29 @@ func main() {
 
 	var directors, actors []string
 
-	af, err := os.Open("../throughputtest/listofactors")
+	af, err := os.Open(*actorFile)
 	checkErr(err, "Error while opening file")
 	defer af.Close()
 
 	scanner := bufio.NewScanner(af)
 	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "#") {
+			continue
+		}
 		actors = append(actors, scanner.Text())
 	}
 
 	testQuery(actors, "actors", qa1, qa2)
 
-	df, err := os.Open("../throughputtest/listofdirectors")
+	df, err := os.Open(*directorFile)
 	checkErr(err, "Error while opening file")
 	defer df.Close()
 
 	scanner = bufio.NewScanner(df)
 	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "#") {
+			continue
+		}
 		directors = append(directors, scanner.Text())
 	}
 
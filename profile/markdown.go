@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// counts formats counts by name, largest first, as name count, ....
+func counts(m map[string]int64) string {
+	var names []string
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if m[names[i]] != m[names[j]] {
+			return m[names[i]] > m[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	var parts []string
+	for _, n := range names {
+		parts = append(parts, fmt.Sprintf("%s %d", n, m[n]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// degrees formats a distribution as p50 / p99 / max.
+func degrees(d *Distribution) string {
+	if d == nil || d.Nodes == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d / %d / %d", d.P50, d.P99, d.Max)
+}
+
+// cell escapes the pipes of a table cell.
+func cell(s string) string {
+	return strings.Replace(s, "|", `\|`, -1)
+}
+
+// Markdown writes the profile as Markdown, for a README next to the data.
+func (pr *Profile) Markdown(w io.Writer) error {
+	var b strings.Builder
+	var files []string
+	for _, f := range pr.Files {
+		files = append(files, "`"+f+"`")
+	}
+	fmt.Fprintf(&b, "# Profile of %s\n\n", strings.Join(files, ", "))
+
+	b.WriteString("| | |\n|---|---:|\n")
+	fmt.Fprintf(&b, "| Triples | %d |\n", pr.Triples)
+	fmt.Fprintf(&b, "| Nodes | %d |\n", pr.Nodes)
+	fmt.Fprintf(&b, "| Edges | %d |\n", pr.Edges)
+	fmt.Fprintf(&b, "| Predicates | %d |\n", len(pr.Predicates))
+	fmt.Fprintf(&b, "| Components | %d |\n\n", pr.Components.Count)
+
+	b.WriteString("## Degrees\n\n")
+	b.WriteString("| | mean | p50 | p90 | p99 | p99.9 | max |\n|---|---:|---:|---:|---:|---:|---:|\n")
+	for _, d := range []struct {
+		name string
+		d    Distribution
+	}{{"Out", pr.OutDegree}, {"In", pr.InDegree}} {
+		fmt.Fprintf(&b, "| %s | %.2f | %d | %d | %d | %d | %d |\n",
+			d.name, d.d.Mean, d.d.P50, d.d.P90, d.d.P99, d.d.P999, d.d.Max)
+	}
+
+	b.WriteString("\n## Predicates\n\n")
+	b.WriteString("Degrees are p50 / p99 / max.\n\n")
+	b.WriteString("| Predicate | Triples | Subjects | Objects | Types | Languages | Out degree | In degree |\n")
+	b.WriteString("|---|---:|---:|---:|---|---|---|---|\n")
+	for _, p := range pr.Predicates {
+		fmt.Fprintf(&b, "| `%s` | %d | %d | %d | %s | %s | %s | %s |\n", cell(p.Name), p.Triples,
+			p.Subjects, p.Objects, counts(p.Types), cell(counts(p.Langs)), degrees(&p.OutDegree), degrees(p.InDegree))
+	}
+
+	if len(pr.Supernodes) > 0 {
+		b.WriteString("\n## Supernodes\n\n")
+		b.WriteString("| Node | Out | In |\n|---|---:|---:|\n")
+		for _, n := range pr.Supernodes {
+			fmt.Fprintf(&b, "| `%s` | %d | %d |\n", cell(n.ID), n.Out, n.In)
+		}
+	}
+
+	b.WriteString("\n## Components\n\n")
+	var largest []string
+	for _, s := range pr.Components.Largest {
+		largest = append(largest, fmt.Sprint(s))
+	}
+	fmt.Fprintf(&b, "Largest: %s nodes.\n\n", strings.Join(largest, ", "))
+	b.WriteString("| Nodes | Components |\n|---|---:|\n")
+	for _, s := range pr.Components.Sizes {
+		r := fmt.Sprint(s.Min)
+		if s.Max > s.Min {
+			r = fmt.Sprintf("%d-%d", s.Min, s.Max)
+		}
+		fmt.Fprintf(&b, "| %s | %d |\n", r, s.Count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+
+	farm "github.com/dgryski/go-farm"
+
+	"github.com/dgraph-io/benchmarks/dqlschema"
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// Profile is the shape of a data set.
+type Profile struct {
+	// Files are the names of the files profiled, without their directory.
+	Files   []string `json:"files"`
+	Triples int64    `json:"triples"`
+	// Nodes counts the subjects and the objects of edges, and Edges the
+	// triples between them.
+	Nodes int   `json:"nodes"`
+	Edges int64 `json:"edges"`
+	// OutDegree and InDegree are the number of edges from and to each node,
+	// over all nodes.
+	OutDegree  Distribution `json:"out_degree"`
+	InDegree   Distribution `json:"in_degree"`
+	Predicates []*Predicate `json:"predicates"`
+	// Supernodes are the nodes with the most edges.
+	Supernodes []Supernode `json:"supernodes"`
+	Components Components  `json:"components"`
+}
+
+// Predicate is the shape of a predicate.
+type Predicate struct {
+	Name    string `json:"name"`
+	Triples int64  `json:"triples"`
+	// Subjects and Objects count the distinct subjects and objects, nodes
+	// and values.
+	Subjects int `json:"distinct_subjects"`
+	Objects  int `json:"distinct_objects"`
+	// Types counts the triples by the type of their object: uid for edges,
+	// or int, float, bool, datetime, geo or string for values.
+	Types map[string]int64 `json:"types"`
+	// Langs counts the values by language tag, for tagged values.
+	Langs map[string]int64 `json:"langs,omitempty"`
+	// OutDegree is the number of triples of each subject, and InDegree the
+	// number of edges to each object node, if there are edges.
+	OutDegree Distribution  `json:"out_degree"`
+	InDegree  *Distribution `json:"in_degree,omitempty"`
+}
+
+// Distribution summarizes a distribution of degrees over some nodes.
+type Distribution struct {
+	Nodes int     `json:"nodes"`
+	Min   int     `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   int     `json:"p50"`
+	P90   int     `json:"p90"`
+	P99   int     `json:"p99"`
+	P999  int     `json:"p999"`
+	Max   int     `json:"max"`
+}
+
+// Supernode is a node and its degrees.
+type Supernode struct {
+	ID  string `json:"id"`
+	Out int    `json:"out"`
+	In  int    `json:"in"`
+}
+
+// Components are the weakly connected components of the graph of edges.
+// Nodes without edges, such as those with only values, are components of
+// one.
+type Components struct {
+	Count int `json:"count"`
+	// Largest are the sizes of the largest components, and Sizes counts the
+	// components by size, in powers of two.
+	Largest []int        `json:"largest"`
+	Sizes   []SizeBucket `json:"sizes"`
+}
+
+// SizeBucket counts the components of Min to Max nodes.
+type SizeBucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Count int `json:"count"`
+}
+
+// predData is what is kept of a predicate while reading.
+type predData struct {
+	triples int64
+	types   map[string]int64
+	langs   map[string]int64
+	// subjects and objects are the subject and the object node of every
+	// triple, and values the hashes of the values, with their language.
+	subjects []int32
+	objects  []int32
+	values   []uint64
+}
+
+// Profiler builds a profile of the N-Quads added to it. It keeps about 12
+// bytes per triple, besides the ids of the nodes, and works out the
+// distributions by sorting.
+type Profiler struct {
+	ids   map[string]int32
+	names []string
+	// out and in are the edges from and to each node.
+	out, in []int32
+	// parent is a union-find forest of the nodes, for the components.
+	parent []int32
+	preds  map[string]*predData
+	files  []string
+
+	triples, edges int64
+}
+
+// NewProfiler returns an empty profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{ids: make(map[string]int32), preds: make(map[string]*predData)}
+}
+
+func (p *Profiler) node(id string) int32 {
+	n, ok := p.ids[id]
+	if !ok {
+		n = int32(len(p.names))
+		p.ids[id] = n
+		p.names = append(p.names, id)
+		p.out = append(p.out, 0)
+		p.in = append(p.in, 0)
+		p.parent = append(p.parent, n)
+	}
+	return n
+}
+
+func (p *Profiler) find(n int32) int32 {
+	for p.parent[n] != n {
+		p.parent[n] = p.parent[p.parent[n]]
+		n = p.parent[n]
+	}
+	return n
+}
+
+// Add adds an N-Quad to the profile.
+func (p *Profiler) Add(nq nquad.NQuad) {
+	d, ok := p.preds[nq.Predicate]
+	if !ok {
+		d = &predData{types: make(map[string]int64), langs: make(map[string]int64)}
+		p.preds[nq.Predicate] = d
+	}
+	p.triples++
+	d.triples++
+	s := p.node(nq.Subject)
+	d.subjects = append(d.subjects, s)
+	if !nq.IsEdge() {
+		d.types[dqlschema.ValueKind(nq.ObjectValue, nq.Datatype)]++
+		if nq.Lang != "" {
+			d.langs[nq.Lang]++
+		}
+		d.values = append(d.values, farm.Fingerprint64([]byte(nq.ObjectValue+"@"+nq.Lang)))
+		return
+	}
+	o := p.node(nq.ObjectId)
+	d.types["uid"]++
+	d.objects = append(d.objects, o)
+	p.edges++
+	p.out[s]++
+	p.in[o]++
+	if a, b := p.find(s), p.find(o); a != b {
+		p.parent[a] = b
+	}
+}
+
+// AddFile adds the N-Quads of a plain or gzipped RDF or JSON file.
+func (p *Profiler) AddFile(path string) error {
+	p.files = append(p.files, filepath.Base(path))
+	return nquad.Each(path, func(nq nquad.NQuad) error {
+		p.Add(nq)
+		return nil
+	})
+}
+
+// JSON writes the profile as indented JSON.
+func (pr *Profile) JSON(w io.Writer) error {
+	b, err := json.MarshalIndent(pr, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// distribution summarizes degrees, which it sorts.
+func distribution(degrees []int) Distribution {
+	if len(degrees) == 0 {
+		return Distribution{}
+	}
+	sort.Ints(degrees)
+	// The nearest rank percentile.
+	pc := func(q float64) int {
+		i := int(math.Ceil(q*float64(len(degrees)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return degrees[i]
+	}
+	sum := 0
+	for _, d := range degrees {
+		sum += d
+	}
+	return Distribution{
+		Nodes: len(degrees),
+		Min:   degrees[0],
+		Mean:  float64(sum) / float64(len(degrees)),
+		P50:   pc(0.5),
+		P90:   pc(0.9),
+		P99:   pc(0.99),
+		P999:  pc(0.999),
+		Max:   degrees[len(degrees)-1],
+	}
+}
+
+// runs sorts ids and returns the number of times each distinct id occurs.
+func runs(ids []int32) []int {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var out []int
+	for i := 0; i < len(ids); {
+		j := i + 1
+		for j < len(ids) && ids[j] == ids[i] {
+			j++
+		}
+		out = append(out, j-i)
+		i = j
+	}
+	return out
+}
+
+func distinct(hashes []uint64) int {
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	n := 0
+	for i, h := range hashes {
+		if i == 0 || h != hashes[i-1] {
+			n++
+		}
+	}
+	return n
+}
+
+// Profile works out the profile, with the top nodes with the most edges
+// and sizes of the largest components. It frees what was kept of the
+// predicates, so nothing can be added after it.
+func (p *Profiler) Profile(top int) *Profile {
+	pr := &Profile{
+		Files:   p.files,
+		Triples: p.triples,
+		Nodes:   len(p.names),
+		Edges:   p.edges,
+	}
+	var names []string
+	for name := range p.preds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		d := p.preds[name]
+		pp := &Predicate{Name: name, Triples: d.triples, Types: d.types}
+		if len(d.langs) > 0 {
+			pp.Langs = d.langs
+		}
+		out := runs(d.subjects)
+		pp.Subjects = len(out)
+		pp.OutDegree = distribution(out)
+		if len(d.objects) > 0 {
+			in := runs(d.objects)
+			pp.Objects = len(in)
+			dist := distribution(in)
+			pp.InDegree = &dist
+		}
+		pp.Objects += distinct(d.values)
+		pr.Predicates = append(pr.Predicates, pp)
+		delete(p.preds, name)
+	}
+
+	out := make([]int, len(p.names))
+	in := make([]int, len(p.names))
+	byDegree := make([]int32, len(p.names))
+	for n := range p.names {
+		out[n], in[n] = int(p.out[n]), int(p.in[n])
+		byDegree[n] = int32(n)
+	}
+	sort.Slice(byDegree, func(i, j int) bool {
+		a, b := byDegree[i], byDegree[j]
+		if da, db := p.out[a]+p.in[a], p.out[b]+p.in[b]; da != db {
+			return da > db
+		}
+		return a < b
+	})
+	for _, n := range byDegree {
+		if len(pr.Supernodes) == top || p.out[n]+p.in[n] == 0 {
+			break
+		}
+		pr.Supernodes = append(pr.Supernodes, Supernode{ID: p.names[n], Out: int(p.out[n]), In: int(p.in[n])})
+	}
+	pr.OutDegree = distribution(out)
+	pr.InDegree = distribution(in)
+	pr.Components = p.components(top)
+	return pr
+}
+
+// components counts the nodes of each component.
+func (p *Profiler) components(top int) Components {
+	sizes := make(map[int32]int)
+	for n := range p.parent {
+		sizes[p.find(int32(n))]++
+	}
+	var all []int
+	for _, s := range sizes {
+		all = append(all, s)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(all)))
+	c := Components{Count: len(all)}
+	if len(all) > top {
+		c.Largest = all[:top]
+	} else {
+		c.Largest = all
+	}
+	// all is in decreasing order, so the buckets are built from the last.
+	for i := len(all) - 1; i >= 0; i-- {
+		s := all[i]
+		if k := len(c.Sizes); k == 0 || s > c.Sizes[k-1].Max {
+			lo := 1
+			for lo*2 <= s {
+				lo *= 2
+			}
+			c.Sizes = append(c.Sizes, SizeBucket{Min: lo, Max: 2*lo - 1})
+		}
+		c.Sizes[len(c.Sizes)-1].Count++
+	}
+	return c
+}
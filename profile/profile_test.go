@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const films = `<f1> <name> "Blade Runner"@en .
+<f1> <name> "Der Blade Runner"@de .
+<f1> <released> "1982-06-25" .
+<f1> <starring> <p1> .
+<f1> <starring> <p2> .
+<f1> <genre> <g1> .
+<f2> <name> "Alien"@en .
+<f2> <released> "1979" .
+<f2> <genre> <g1> .
+<f2> <starring> <p3> .
+<p1> <actor> <a1> .
+<p2> <actor> <a2> .
+<p3> <actor> <a1> .
+<a1> <name> "Rutger Hauer" .
+<a2> <name> "Sean Young" .
+<g1> <name> "Science fiction"@en .
+<x1> <name> "Alone" .
+`
+
+func profile(t *testing.T) *Profile {
+	path := filepath.Join(t.TempDir(), "films.rdf")
+	require.NoError(t, ioutil.WriteFile(path, []byte(films), 0644))
+	p := NewProfiler()
+	require.NoError(t, p.AddFile(path))
+	return p.Profile(3)
+}
+
+func TestProfile(t *testing.T) {
+	pr := profile(t)
+	require.Equal(t, []string{"films.rdf"}, pr.Files)
+	require.Equal(t, int64(17), pr.Triples)
+	require.Equal(t, int64(8), pr.Edges)
+	require.Equal(t, 9, pr.Nodes)
+
+	preds := make(map[string]*Predicate)
+	var names []string
+	for _, p := range pr.Predicates {
+		preds[p.Name] = p
+		names = append(names, p.Name)
+	}
+	require.Equal(t, []string{"actor", "genre", "name", "released", "starring"}, names)
+
+	name := preds["name"]
+	require.Equal(t, int64(7), name.Triples)
+	require.Equal(t, 6, name.Subjects)
+	require.Equal(t, 7, name.Objects)
+	require.Equal(t, map[string]int64{"string": 7}, name.Types)
+	require.Equal(t, map[string]int64{"en": 3, "de": 1}, name.Langs)
+	require.Equal(t, Distribution{Nodes: 6, Min: 1, Mean: 7.0 / 6, P50: 1, P90: 2, P99: 2, P999: 2, Max: 2}, name.OutDegree)
+	require.Nil(t, name.InDegree)
+
+	released := preds["released"]
+	require.Equal(t, map[string]int64{"datetime": 1, "int": 1}, released.Types)
+	require.Nil(t, released.Langs)
+
+	genre := preds["genre"]
+	require.Equal(t, 2, genre.Subjects)
+	require.Equal(t, 1, genre.Objects)
+	require.Equal(t, map[string]int64{"uid": 2}, genre.Types)
+	require.Equal(t, Distribution{Nodes: 1, Min: 2, Mean: 2, P50: 2, P90: 2, P99: 2, P999: 2, Max: 2}, *genre.InDegree)
+
+	actor := preds["actor"]
+	require.Equal(t, 3, actor.Subjects)
+	require.Equal(t, 2, actor.Objects)
+	require.Equal(t, 2, actor.InDegree.Max)
+
+	// f1 has 3 edges, and the nodes with two come in order of appearance.
+	require.Equal(t, []Supernode{{"f1", 3, 0}, {"p1", 1, 1}, {"p2", 1, 1}}, pr.Supernodes)
+	require.Equal(t, 3, pr.OutDegree.Max)
+	require.Equal(t, 9, pr.OutDegree.Nodes)
+	require.Equal(t, 2, pr.InDegree.Max)
+
+	// The films, performances, actors and genre are connected, and x1 is
+	// on its own.
+	require.Equal(t, Components{
+		Count:   2,
+		Largest: []int{8, 1},
+		Sizes:   []SizeBucket{{1, 1, 1}, {8, 15, 1}},
+	}, pr.Components)
+}
+
+func TestOutput(t *testing.T) {
+	pr := profile(t)
+	var buf bytes.Buffer
+	require.NoError(t, pr.JSON(&buf))
+	var back Profile
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &back))
+	require.Equal(t, *pr, back)
+
+	buf.Reset()
+	require.NoError(t, pr.Markdown(&buf))
+	md := buf.String()
+	require.Contains(t, md, "# Profile of `films.rdf`\n")
+	require.Contains(t, md, "| Triples | 17 |\n")
+	require.Contains(t, md, "| `name` | 7 | 6 | 7 | string 7 | en 3, de 1 | 1 / 2 / 2 |  |\n")
+	require.Contains(t, md, "| `genre` | 2 | 2 | 1 | uid 2 |  | 1 / 1 / 1 | 2 / 2 / 2 |\n")
+	require.Contains(t, md, "| `f1` | 3 | 0 |\n")
+	require.Contains(t, md, "Largest: 8, 1 nodes.\n")
+	require.Contains(t, md, "| 8-15 | 1 |\n")
+}
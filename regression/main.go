@@ -1,58 +1,220 @@
 // This tool is used to extract runnable queries from out docs.
+//
+// It takes {{< runnable >}} blocks and Markdown code fences tagged dql,
+// graphql or rdf, queries and mutations alike, but not graphql fences with a
+// schema. Each one is written to queries/query-<id>.txt, where the id is the
+// slug of the heading above it plus a hash of its content, so that ids don't
+// change when other parts of the docs do. A manifest next to it records
+// where it came from.
+//
+//	go run main.go --out queries ../../dgraph/wiki/content/query-language/*.md
 
 package main
 
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha1"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"unicode"
 
 	"github.com/dgraph-io/dgraph/x"
 )
 
-var file = flag.String("file", "", "File to extract queries from")
+var (
+	file = flag.String("file", "", "File to extract queries from. More files can be given as arguments.")
+	out  = flag.String("out", "queries", "Folder to write the queries to.")
+)
 
-func main() {
-	flag.Parse()
-	f, err := os.Open(*file)
-	x.Check(err)
+// manifest is the part of the replay manifest that is known from the docs.
+type manifest struct {
+	Name    string `json:"name,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	Source  string `json:"source"`
+	Compare string `json:"compare,omitempty"`
+}
+
+type block struct {
+	kind    string // query, mutation or graphql
+	heading string
+	line    int
+	text    bytes.Buffer
+}
 
-	os.Mkdir("queries", 0755)
+func slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	res := []rune(strings.TrimSuffix(b.String(), "-"))
+	if len(res) > 40 {
+		res = []rune(strings.TrimSuffix(string(res[:40]), "-"))
+	}
+	return string(res)
+}
 
-	start := `{{< runnable >}}`
-	end := `{{< /runnable >}}`
-	scanner := bufio.NewScanner(f)
+// hash ignores indentation and blank lines, which change with doc formatting.
+func hash(text string) string {
+	h := sha1.New()
+	for _, l := range strings.Split(text, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			fmt.Fprintln(h, l)
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:8]
+}
+
+// isOperation reports whether GraphQL text is an operation, as opposed to
+// SDL such as type definitions.
+func isOperation(text string) bool {
+	t := strings.TrimSpace(text)
+	for _, p := range []string{"query", "mutation", "subscription", "{"} {
+		if strings.HasPrefix(t, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isMutation(text string) bool {
+	compact := strings.Join(strings.Fields(text), "")
+	return strings.HasPrefix(compact, "{set{") || strings.HasPrefix(compact, "{delete{") ||
+		strings.HasPrefix(compact, "upsert{")
+}
+
+// kindOf classifies a block from its fence tag, which is empty for runnable
+// blocks. It returns "" for graphql fences that hold a schema rather than an
+// operation, which aren't extracted.
+func kindOf(tag, text string) string {
+	switch tag {
+	case "graphql":
+		if !isOperation(text) {
+			return ""
+		}
+		return "graphql"
+	case "rdf":
+		return "mutation"
+	}
+	if isMutation(text) {
+		return "mutation"
+	}
+	return "query"
+}
+
+// id is the id of a block of the file at path.
+func id(path string, b *block) string {
+	base := slug(b.heading)
+	if base == "" {
+		base = slug(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	}
+	return base + "-" + hash(b.text.String())
+}
 
-	counter := 0
-	var b bytes.Buffer
-	var insideRunnable bool
-	for scanner.Scan() {
+func extract(path string) []*block {
+	f, err := os.Open(path)
+	x.Check(err)
+	defer f.Close()
+
+	var blocks []*block
+	var cur *block
+	var tag, closing, heading string
+	inFence := false
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
 		l := scanner.Text()
 		trimmed := strings.TrimSpace(l)
-		if trimmed == start {
-			insideRunnable = true
-			continue
-		} else if trimmed == end {
-			insideRunnable = false
-			// Write to file.
-			counter++
-			err = ioutil.WriteFile(fmt.Sprintf("queries/query-%d.txt", counter), b.Bytes(), 0755)
-			x.Check(err)
-			b.Reset()
-		}
 
-		if !insideRunnable {
+		if cur != nil {
+			if trimmed == closing {
+				if cur.kind = kindOf(tag, cur.text.String()); cur.kind != "" {
+					blocks = append(blocks, cur)
+				}
+				cur = nil
+				continue
+			}
+			cur.text.WriteString(l)
+			cur.text.WriteRune('\n')
 			continue
 		}
 
-		_, err = b.WriteString(l)
-		x.Check(err)
-		_, err = b.WriteRune('\n')
-		x.Check(err)
+		switch {
+		case strings.HasPrefix(trimmed, "{{< runnable") && strings.HasSuffix(trimmed, ">}}"):
+			cur, tag, closing = &block{heading: heading, line: lineNo + 1}, "", `{{< /runnable >}}`
+		case strings.HasPrefix(trimmed, "```"):
+			if inFence {
+				inFence = false
+				break
+			}
+			t := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(trimmed, "```")))
+			switch t {
+			case "dql", "graphql", "rdf":
+				cur, tag, closing = &block{heading: heading, line: lineNo + 1}, t, "```"
+			default:
+				// Skip other fences, so that # comments in them aren't
+				// taken for headings.
+				inFence = true
+			}
+		case !inFence && strings.HasPrefix(trimmed, "#"):
+			heading = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+		}
 	}
 	x.Check(scanner.Err())
+	return blocks
+}
+
+func main() {
+	flag.Parse()
+	files := flag.Args()
+	if *file != "" {
+		files = append([]string{*file}, files...)
+	}
+	x.AssertTruef(len(files) > 0, "Need --file or files as arguments.")
+	x.Check(os.MkdirAll(*out, 0755))
+
+	seen := make(map[string]bool)
+	counts := make(map[string]int)
+	for _, path := range files {
+		for _, b := range extract(path) {
+			text := b.text.String()
+			id := id(path, b)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			counts[b.kind]++
+
+			m := manifest{
+				Name:   b.heading,
+				Kind:   b.kind,
+				Source: fmt.Sprintf("%s:%d", path, b.line),
+			}
+			if m.Kind == "query" {
+				m.Kind = ""
+			}
+			if b.kind == "mutation" {
+				// Mutations return new uids, which differ on every run.
+				m.Compare = "none"
+			}
+			name := filepath.Join(*out, "query-"+id)
+			x.Check(ioutil.WriteFile(name+".txt", []byte(text), 0644))
+			mb, err := json.MarshalIndent(m, "", "  ")
+			x.Check(err)
+			x.Check(ioutil.WriteFile(name+".json", append(mb, '\n'), 0644))
+		}
+	}
+	fmt.Printf("Extracted %d queries, %d mutations and %d GraphQL operations.\n",
+		counts["query"], counts["mutation"], counts["graphql"])
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlug(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Filter on Predicate", "filter-on-predicate"},
+		{"  `uid_in` (Dgraph v1.1+)  ", "uid-in-dgraph-v1-1"},
+		{"Élan, über alles!", "élan-über-alles"},
+		{"----", ""},
+		{"a very long heading that goes on and on about nothing", "a-very-long-heading-that-goes-on-and-on"},
+		// Long headings are cut by runes, not bytes.
+		{"Запросы с фильтрами по нескольким предикатам", "запросы-с-фильтрами-по-нескольким-предик"},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.want, slug(tc.in), tc.in)
+		require.True(t, utf8.ValidString(slug(tc.in)), tc.in)
+	}
+}
+
+func TestHash(t *testing.T) {
+	q := "{\n  me(func: uid(1)) {\n    name\n  }\n}\n"
+	tests := []struct {
+		other string
+		same  bool
+	}{
+		{q, true},
+		{"{\n    me(func: uid(1)) {\n        name\n    }\n}", true},
+		{"\n{\n\n  me(func: uid(1)) {\n    name\n  }\n}\n\n", true},
+		{"{\n  me(func: uid(2)) {\n    name\n  }\n}\n", false},
+		{"{ me(func: uid(1)) { name } }", false},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.same, hash(q) == hash(tc.other), tc.other)
+	}
+	require.Len(t, hash(q), 8)
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct{ tag, text, want string }{
+		{"", "{ me(func: uid(1)) { name } }", "query"},
+		{"dql", "{ me(func: uid(1)) { name } }", "query"},
+		{"", "{\n  set {\n    _:a <name> \"A\" .\n  }\n}", "mutation"},
+		{"dql", "{ delete { <0x1> <name> * . } }", "mutation"},
+		{"dql", "upsert {\n  query { q(func: eq(name, \"A\")) { v as uid } }\n  mutation { set { uid(v) <age> \"1\" . } }\n}", "mutation"},
+		{"rdf", "_:a <name> \"A\" .", "mutation"},
+		{"graphql", "query { getFilm(id: \"0x1\") { name } }", "graphql"},
+		{"graphql", "mutation { addFilm(input: [{name: \"A\"}]) { numUids } }", "graphql"},
+		{"graphql", "\n{ getFilm(id: \"0x1\") { name } }", "graphql"},
+		{"graphql", "subscription { queryFilm { name } }", "graphql"},
+		// Schemas aren't operations.
+		{"graphql", "type Film {\n  name: String! @search(by: [term])\n}", ""},
+		{"graphql", "interface Character { id: ID! }", ""},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.want, kindOf(tc.tag, tc.text), "%s %s", tc.tag, tc.text)
+	}
+}
+
+const doc = "# Functions\n" +
+	"\n" +
+	"## Term matching\n" +
+	"\n" +
+	"{{< runnable >}}\n" +
+	"{ q(func: allofterms(name@en, \"jones indiana\")) { name@en } }\n" +
+	"{{< /runnable >}}\n" +
+	"\n" +
+	"```sh\n" +
+	"# Not a heading\n" +
+	"curl localhost:8080/query\n" +
+	"```\n" +
+	"\n" +
+	"```dql\n" +
+	"{ q(func: anyofterms(name@en, \"jones indiana\")) { name@en } }\n" +
+	"```\n" +
+	"\n" +
+	"```json\n" +
+	"{\"q\": []}\n" +
+	"```\n" +
+	"\n" +
+	"```\n" +
+	"# Not a heading either\n" +
+	"```\n" +
+	"\n" +
+	"### Mutations\n" +
+	"\n" +
+	"```rdf\n" +
+	"_:a <name> \"A\" .\n" +
+	"```\n" +
+	"\n" +
+	"```graphql\n" +
+	"query { getFilm(id: \"0x1\") { name } }\n" +
+	"```\n" +
+	"\n" +
+	"```graphql\n" +
+	"type Film { name: String! }\n" +
+	"```\n" +
+	"\n" +
+	"```go\n" +
+	"txn.Mutate(ctx, mu)\n" +
+	"```\n"
+
+func write(t *testing.T, name, text string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(text), 0644))
+	return path
+}
+
+func TestExtract(t *testing.T) {
+	blocks := extract(write(t, "functions.md", doc))
+	type got struct {
+		kind, heading string
+		line          int
+		text          string
+	}
+	var all []got
+	for _, b := range blocks {
+		all = append(all, got{b.kind, b.heading, b.line, b.text.String()})
+	}
+	require.Equal(t, []got{
+		{"query", "Term matching", 6, "{ q(func: allofterms(name@en, \"jones indiana\")) { name@en } }\n"},
+		// The comment in the sh fence doesn't change the heading.
+		{"query", "Term matching", 15, "{ q(func: anyofterms(name@en, \"jones indiana\")) { name@en } }\n"},
+		{"mutation", "Mutations", 29, "_:a <name> \"A\" .\n"},
+		{"graphql", "Mutations", 33, "query { getFilm(id: \"0x1\") { name } }\n"},
+	}, all)
+}
+
+func TestID(t *testing.T) {
+	ids := func(path string) []string {
+		var out []string
+		for _, b := range extract(path) {
+			out = append(out, id(path, b))
+		}
+		return out
+	}
+	path := write(t, "functions.md", doc)
+	first := ids(path)
+	require.Len(t, first, 4)
+	require.Regexp(t, `^term-matching-[0-9a-f]{8}$`, first[0])
+	require.NotEqual(t, first[0], first[1], "blocks under one heading differ by their hash")
+	require.Equal(t, first, ids(path), "ids are the same on every run")
+
+	// Editing other parts of the doc, or reindenting a block, keeps the ids.
+	edited := "Some intro.\n\n" + doc + "\n## More\n\n```dql\n{ q(func: has(name)) { uid } }\n```\n"
+	edited = strings.Replace(edited, "{ q(func: anyofterms", "  { q(func: anyofterms", 1)
+	require.Equal(t, first, ids(write(t, "functions.md", edited))[:4])
+
+	// Blocks before any heading are named after the file.
+	require.Regexp(t, `^intro-[0-9a-f]{8}$`, ids(write(t, "intro.md", "```dql\n{ q(func: uid(1)) { uid } }\n```\n"))[0])
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Change is a single difference between two responses. Path is slash
+// separated, with array indexes as segments, e.g. me/0/actor.film/3.
+type Change struct {
+	Kind string // added, removed or changed
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case "added":
+		return fmt.Sprintf("+ %s: %s", c.Path, short(c.New))
+	case "removed":
+		return fmt.Sprintf("- %s: %s", c.Path, short(c.Old))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, short(c.Old), short(c.New))
+}
+
+func short(v interface{}) string {
+	b, _ := json.Marshal(v)
+	if len(b) > 80 {
+		return string(b[:77]) + "..."
+	}
+	return string(b)
+}
+
+// Differ compares responses structurally, so that key order, number
+// formatting and the order of unordered results don't count as differences.
+type Differ struct {
+	// Unordered holds paths of arrays compared as multisets. A * segment
+	// matches any key or index.
+	Unordered []string
+	// Ordered holds the names of blocks that have orderasc or orderdesc. If
+	// it is not nil, arrays under any other key are compared as multisets.
+	Ordered map[string]bool
+	// Tolerance is the relative difference allowed between numbers.
+	Tolerance float64
+}
+
+// DiffSummary counts the changes by kind.
+type DiffSummary struct {
+	Added, Removed, Changed int
+}
+
+// Summarize counts changes by kind.
+func Summarize(changes []Change) DiffSummary {
+	var s DiffSummary
+	for _, c := range changes {
+		switch c.Kind {
+		case "added":
+			s.Added++
+		case "removed":
+			s.Removed++
+		default:
+			s.Changed++
+		}
+	}
+	return s
+}
+
+func (s DiffSummary) String() string {
+	return fmt.Sprintf("%d added, %d removed, %d changed", s.Added, s.Removed, s.Changed)
+}
+
+// OrderedBlocks returns the names, or aliases, of the blocks in a query that
+// are sorted with orderasc or orderdesc.
+func OrderedBlocks(query string) map[string]bool {
+	ordered := make(map[string]bool)
+	for _, kw := range []string{"orderasc", "orderdesc"} {
+		for i := 0; ; {
+			j := strings.Index(query[i:], kw)
+			if j < 0 {
+				break
+			}
+			i += j + len(kw)
+			if name := blockName(query, i-len(kw)); name != "" {
+				ordered[name] = true
+			}
+		}
+	}
+	return ordered
+}
+
+func isNameChar(c byte) bool {
+	return c == '.' || c == '_' || c == '~' || c == '@' || c == '-' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// blockName finds the ( enclosing position pos and returns the alias or name
+// in front of it.
+func blockName(q string, pos int) string {
+	depth := 0
+	i := pos - 1
+	for ; i >= 0; i-- {
+		if q[i] == ')' {
+			depth++
+		} else if q[i] == '(' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+	}
+	word := func() string {
+		for i > 0 && (q[i-1] == ' ' || q[i-1] == '\t' || q[i-1] == '\n') {
+			i--
+		}
+		end := i
+		for i > 0 && isNameChar(q[i-1]) {
+			i--
+		}
+		return q[i:end]
+	}
+	name := word()
+	// alias : predicate
+	for i > 0 && (q[i-1] == ' ' || q[i-1] == '\t') {
+		i--
+	}
+	if i > 0 && q[i-1] == ':' {
+		i--
+		if alias := word(); alias != "" {
+			return alias
+		}
+	}
+	return name
+}
+
+func matchPath(pattern string, path []string) bool {
+	p := strings.Split(pattern, "/")
+	if len(p) != len(path) {
+		return false
+	}
+	for i := range p {
+		if p[i] != "*" && p[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Differ) unordered(path []string) bool {
+	for _, u := range d.Unordered {
+		if matchPath(u, path) {
+			return true
+		}
+	}
+	if d.Ordered == nil || len(path) == 0 {
+		return false
+	}
+	return !d.Ordered[path[len(path)-1]]
+}
+
+// DiffJSON compares two JSON documents.
+func (d *Differ) DiffJSON(a, b []byte) ([]Change, error) {
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		return nil, fmt.Errorf("while parsing old response: %v", err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return nil, fmt.Errorf("while parsing new response: %v", err)
+	}
+	return d.Diff(va, vb), nil
+}
+
+// Diff compares two decoded JSON values.
+func (d *Differ) Diff(a, b interface{}) []Change {
+	var out []Change
+	d.diff(nil, a, b, &out)
+	return out
+}
+
+func join(path []string) string {
+	return strings.Join(path, "/")
+}
+
+func with(path []string, seg string) []string {
+	return append(path[:len(path):len(path)], seg)
+}
+
+func (d *Differ) equal(path []string, a, b interface{}) bool {
+	var out []Change
+	d.diff(path, a, b, &out)
+	return len(out) == 0
+}
+
+func (d *Differ) diff(path []string, a, b interface{}, out *[]Change) {
+	switch va := a.(type) {
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(va)+len(vb))
+		for k := range va {
+			keys = append(keys, k)
+		}
+		for k := range vb {
+			if _, ok := va[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := with(path, k)
+			oa, inA := va[k]
+			ob, inB := vb[k]
+			switch {
+			case !inB:
+				*out = append(*out, Change{Kind: "removed", Path: join(p), Old: oa})
+			case !inA:
+				*out = append(*out, Change{Kind: "added", Path: join(p), New: ob})
+			default:
+				d.diff(p, oa, ob, out)
+			}
+		}
+		return
+
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		if d.unordered(path) {
+			d.diffUnordered(path, va, vb, out)
+			return
+		}
+		d.diffOrdered(path, va, vb, out)
+		return
+
+	case float64:
+		vb, ok := b.(float64)
+		if !ok {
+			break
+		}
+		diff := math.Abs(va - vb)
+		if diff > d.Tolerance*math.Max(math.Abs(va), math.Abs(vb)) {
+			*out = append(*out, Change{Kind: "changed", Path: join(path), Old: a, New: b})
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*out = append(*out, Change{Kind: "changed", Path: join(path), Old: a, New: b})
+	}
+}
+
+func (d *Differ) diffOrdered(path []string, a, b []interface{}, out *[]Change) {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		p := with(path, strconv.Itoa(i))
+		switch {
+		case i >= len(b):
+			*out = append(*out, Change{Kind: "removed", Path: join(p), Old: a[i]})
+		case i >= len(a):
+			*out = append(*out, Change{Kind: "added", Path: join(p), New: b[i]})
+		default:
+			d.diff(p, a[i], b[i], out)
+		}
+	}
+}
+
+// diffUnordered pairs up equal elements first. The leftovers are compared in
+// order, so that a changed field in an object shows up as such rather than as
+// a removed and an added object.
+func (d *Differ) diffUnordered(path []string, a, b []interface{}, out *[]Change) {
+	used := make([]bool, len(b))
+	var restA, restB []int
+	for i := range a {
+		found := false
+		for j := range b {
+			if !used[j] && d.equal(with(path, strconv.Itoa(i)), a[i], b[j]) {
+				used[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			restA = append(restA, i)
+		}
+	}
+	for j := range b {
+		if !used[j] {
+			restB = append(restB, j)
+		}
+	}
+	for k := 0; k < len(restA) || k < len(restB); k++ {
+		switch {
+		case k >= len(restB):
+			i := restA[k]
+			*out = append(*out, Change{Kind: "removed", Path: join(with(path, strconv.Itoa(i))), Old: a[i]})
+		case k >= len(restA):
+			j := restB[k]
+			*out = append(*out, Change{Kind: "added", Path: join(with(path, strconv.Itoa(j))), New: b[j]})
+		default:
+			d.diff(with(path, strconv.Itoa(restB[k])), a[restA[k]], b[restB[k]], out)
+		}
+	}
+}
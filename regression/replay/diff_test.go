@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderedBlocks(t *testing.T) {
+	q := `{
+  me(func: uid(G), orderdesc: val(G)) {
+    genres : genre (orderdesc: val(C)) { name@en }
+    director.film (first: -2) {
+      genre (orderasc: name@en) (first: 3) { name@en }
+    }
+  }
+}`
+	require.Equal(t, map[string]bool{"me": true, "genres": true, "genre": true}, OrderedBlocks(q))
+}
+
+func TestDiff(t *testing.T) {
+	old := `{"me": [{"name": "A", "film": [{"n": "x"}, {"n": "y"}], "score": 1.0}]}`
+	d := &Differ{Ordered: map[string]bool{"me": true}, Tolerance: 1e-6}
+
+	// Key order, number formatting and order of unordered arrays don't matter.
+	changes, err := d.DiffJSON([]byte(old),
+		[]byte(`{"me": [{"score": 1.0000000001, "film": [{"n": "y"}, {"n": "x"}], "name": "A"}]}`))
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	changes, err = d.DiffJSON([]byte(old),
+		[]byte(`{"me": [{"name": "B", "film": [{"n": "y"}, {"n": "z"}], "age": 3}]}`))
+	require.NoError(t, err)
+	require.Equal(t, []Change{
+		{Kind: "added", Path: "me/0/age", New: float64(3)},
+		{Kind: "changed", Path: "me/0/film/1/n", Old: "x", New: "z"},
+		{Kind: "changed", Path: "me/0/name", Old: "A", New: "B"},
+		{Kind: "removed", Path: "me/0/score", Old: float64(1)},
+	}, changes)
+	require.Equal(t, DiffSummary{Added: 1, Removed: 1, Changed: 2}, Summarize(changes))
+
+	// Order matters for ordered blocks and configured paths.
+	d = &Differ{Unordered: []string{"me/*/film"}}
+	changes = d.Diff(
+		map[string]interface{}{"me": []interface{}{"a", "b"}},
+		map[string]interface{}{"me": []interface{}{"b", "a"}})
+	require.Len(t, changes, 2)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Latencies are the timings of the repetitions of a query, in milliseconds.
+// They are written to latency-<id>.json next to the responses.
+type Latencies struct {
+	Client []float64 `json:"client_ms"`
+	Server []float64 `json:"server_ms"`
+}
+
+func (l *Latencies) sample(metric string) []float64 {
+	if metric == "client" {
+		return l.Client
+	}
+	return l.Server
+}
+
+func latencyFile(folder, id string) string {
+	return filepath.Join(folder, "latency-"+strings.TrimSuffix(id, filepath.Ext(id))+".json")
+}
+
+func writeLatencies(folder, id string, l *Latencies) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(latencyFile(folder, id), b, 0644)
+}
+
+func readLatencies(folder, id string) (*Latencies, error) {
+	b, err := ioutil.ReadFile(latencyFile(folder, id))
+	if err != nil {
+		return nil, err
+	}
+	var l Latencies
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, fmt.Errorf("%s: %v", latencyFile(folder, id), err)
+	}
+	return &l, nil
+}
+
+func median(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+// mannWhitney returns the one-sided p-value of the Mann-Whitney U test for
+// cur being stochastically larger than base, using the normal approximation
+// with tie and continuity correction.
+func mannWhitney(base, cur []float64) float64 {
+	n1, n2 := float64(len(cur)), float64(len(base))
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	type obs struct {
+		v   float64
+		cur bool
+	}
+	all := make([]obs, 0, len(base)+len(cur))
+	for _, v := range base {
+		all = append(all, obs{v, false})
+	}
+	for _, v := range cur {
+		all = append(all, obs{v, true})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// Rank, giving tied values the average of their ranks.
+	var rankSum, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].cur {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	n := n1 + n2
+	u := rankSum - n1*(n1+1)/2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (u - n1*n2/2 - 0.5) / sigma
+	return 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+// LatencyCheck decides whether a query got slower than the baseline.
+type LatencyCheck struct {
+	// Test is mannwhitney, ratio or none.
+	Test string
+	// Metric is server or client.
+	Metric string
+	// Alpha is the significance level of the Mann-Whitney test.
+	Alpha float64
+	// Slowdown is the ratio of medians above which a query counts as slower.
+	Slowdown float64
+}
+
+// Slower compares the latencies and returns whether cur is slower, with a
+// message describing the comparison.
+func (c LatencyCheck) Slower(base, cur *Latencies) (bool, string) {
+	if c.Test == "none" {
+		return false, ""
+	}
+	b, n := base.sample(c.Metric), cur.sample(c.Metric)
+	mb, mn := median(b), median(n)
+	if len(b) == 0 || len(n) == 0 || mb == 0 {
+		return false, ""
+	}
+	ratio := mn / mb
+	msg := fmt.Sprintf("%s median %.2f ms -> %.2f ms (x%.2f)", c.Metric, mb, mn, ratio)
+	if ratio < c.Slowdown {
+		return false, msg
+	}
+	if c.Test == "ratio" {
+		return true, msg
+	}
+	if !c.resolves(len(b), len(n)) {
+		// Even all runs slower than all of the baseline wouldn't be
+		// significant, so the ratio decides.
+		return true, msg + fmt.Sprintf(", too few runs for mannwhitney at alpha %g", c.Alpha)
+	}
+	p := mannWhitney(b, n)
+	msg += fmt.Sprintf(", p=%.3g", p)
+	return p < c.Alpha, msg
+}
+
+// resolves reports whether the Mann-Whitney test can find a difference
+// between samples of nb and nc latencies significant at c.Alpha, that is
+// whether it does when every latency of one is above all those of the other.
+func (c LatencyCheck) resolves(nb, nc int) bool {
+	b := make([]float64, nb)
+	n := make([]float64, nc)
+	for i := range b {
+		b[i] = float64(i)
+	}
+	for i := range n {
+		n[i] = float64(nb + i)
+	}
+	return mannWhitney(b, n) < c.Alpha
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMannWhitney(t *testing.T) {
+	base := []float64{10, 11, 12, 10, 11, 13, 12, 10}
+	slow := []float64{15, 16, 14, 17, 15, 16, 18, 15}
+	require.Less(t, mannWhitney(base, slow), 0.01)
+	require.Greater(t, mannWhitney(slow, base), 0.99)
+	// Same distribution.
+	require.Greater(t, mannWhitney(base, base), 0.3)
+}
+
+func TestLatencyCheck(t *testing.T) {
+	base := &Latencies{Server: []float64{10, 11, 12, 10, 11, 13, 12, 10}}
+	slow := &Latencies{Server: []float64{15, 16, 14, 17, 15, 16, 18, 15}}
+	c := LatencyCheck{Test: "mannwhitney", Metric: "server", Alpha: 0.05, Slowdown: 1.2}
+
+	slower, msg := c.Slower(base, slow)
+	require.True(t, slower, msg)
+	slower, _ = c.Slower(base, base)
+	require.False(t, slower)
+
+	// Below the threshold it doesn't matter how significant it is.
+	c.Slowdown = 2
+	slower, _ = c.Slower(base, slow)
+	require.False(t, slower)
+
+	// Samples too small for the test to ever be significant are compared by
+	// the ratio.
+	c = LatencyCheck{Test: "mannwhitney", Metric: "server", Alpha: 0.05, Slowdown: 1.2}
+	require.False(t, c.resolves(1, 1))
+	require.False(t, c.resolves(2, 2))
+	require.True(t, c.resolves(5, 5))
+	one := &Latencies{Server: []float64{20}}
+	slower, msg = c.Slower(&Latencies{Server: []float64{10}}, one)
+	require.True(t, slower)
+	require.Contains(t, msg, "too few runs")
+	slower, _ = c.Slower(&Latencies{Server: []float64{10}}, &Latencies{Server: []float64{11}})
+	require.False(t, slower)
+	c.Test = "ratio"
+	slower, _ = c.Slower(&Latencies{Server: []float64{10}}, one)
+	require.True(t, slower)
+}
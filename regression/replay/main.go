@@ -6,9 +6,12 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -18,103 +21,497 @@ import (
 )
 
 var (
-	queries = flag.String("queries", "", "Folder which contains the query files.")
-	baseURL = flag.String("d", "http://localhost:8080/query", "Dgraph server address")
-	src     = flag.String("src", "", "Folder to compare the responses against.")
-	dest    = flag.String("dest", "", "Folder to which responses are written.")
-	c       = flag.Int("c", 1, "No of concurrent workers to run.")
+	queries    = flag.String("queries", "", "Folder which contains the query files.")
+	baseURL    = flag.String("d", "http://localhost:8080/query", "Dgraph server address")
+	graphqlURL = flag.String("graphql", "http://localhost:8080/graphql", "Dgraph GraphQL endpoint, for GraphQL queries.")
+	mutations  = flag.Bool("mutations", false, "Run mutations. They change the data, so they are skipped by default.")
+	src        = flag.String("src", "", "Folder to compare the responses against.")
+	dest       = flag.String("dest", "", "Folder to which responses are written.")
+	c          = flag.Int("c", 1, "No of concurrent workers to run.")
+
+	unordered  = flag.String("unordered", "", "Comma separated paths of arrays to compare ignoring order, e.g. me/*/actor.film. * matches any key or index.")
+	autoOrder  = flag.Bool("auto-order", true, "Compare arrays ignoring order unless their block has orderasc or orderdesc.")
+	tolerance  = flag.Float64("tolerance", 1e-9, "Relative difference allowed between numbers.")
+	maxChanges = flag.Int("max-changes", 20, "Maximum number of differences printed per query.")
+
+	tags        = flag.String("tags", "", "Comma separated tags. Only queries with one of them are run.")
+	skipTags    = flag.String("skip-tags", "", "Comma separated tags. Queries with one of them are skipped.")
+	dataset     = flag.String("dataset", "", "Data set loaded in the cluster. Queries that need another one are skipped.")
+	applySchema = flag.Bool("apply-schema", false, "Apply the schema files named in the manifests before their queries. The queries of a schema all finish before the next one is applied.")
+	timeout     = flag.Duration("timeout", time.Minute, "Default timeout per query.")
+	junitFile   = flag.String("junit", "", "Write a JUnit XML report to this file.")
+	reportFile  = flag.String("report", "", "Write a JSON report to this file.")
+	retries     = flag.Int("retries", 2, "Times to retry a query after a transient failure.")
+	backoff     = flag.Duration("backoff", 200*time.Millisecond, "Wait before the first retry. It doubles after every retry.")
+
+	repeats       = flag.Int("repeat", 1, "Times to run each query to measure its latency.")
+	latencyTest   = flag.String("latency-test", "mannwhitney", "How to tell that a query got slower than in --src: mannwhitney, ratio or none.")
+	latencyMetric = flag.String("latency-metric", "server", "Latency to compare: server (from extensions.server_latency) or client.")
+	alpha         = flag.Float64("alpha", 0.05, "Significance level of the mannwhitney latency test.")
+	slowdown      = flag.Float64("slowdown", 1.2, "Minimum ratio of median latencies for a query to count as slower.")
+	failSlower    = flag.Bool("fail-slower", false, "Count queries that got slower as failures.")
+
+	reference       = flag.String("reference", "", "RDF file to compute the expected answers from with the reference evaluator, instead of --src.")
+	referenceSchema = flag.String("reference-schema", "", "Schema of the --reference data, for the types of values.")
 )
 
-type Query struct {
-	text string
-	no   string
-}
+var (
+	qch chan Query
 
-var qch chan Query
+	resultsMu sync.Mutex
+	results   []Result
+)
 
 type errRes struct {
-	Code    string `json:"code"`
-	Message string `json:"Message"`
+	Code       string `json:"code"`
+	Message    string `json:"Message"`
+	Extensions struct {
+		Code string `json:"code"`
+	} `json:"extensions"`
+}
+
+func (e errRes) code() string {
+	if e.Extensions.Code != "" {
+		return e.Extensions.Code
+	}
+	return e.Code
 }
 
 type Res struct {
-	Errors []errRes    `json:"errors"`
-	Data   interface{} `json:"data"`
-	//	Extensions query.Extensions `json:"extensions"`
+	Errors     []errRes    `json:"errors"`
+	Data       interface{} `json:"data"`
+	Extensions struct {
+		ServerLatency struct {
+			TotalNs int64 `json:"total_ns"`
+		} `json:"server_latency"`
+	} `json:"extensions"`
 }
 
-func getResponse(q string) Res {
-	client := &http.Client{}
-	body := bytes.NewBufferString(q)
-	req, err := http.NewRequest("POST", *baseURL, body)
-	x.Check(err)
+// statusError is a reply with a status other than 200.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.code, strings.TrimSpace(e.body))
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// retryable reports whether a failure is likely transient: a connection
+// error, a 5xx or 429, or a Dgraph error asking to retry. Timeouts are not
+// retried, since a slow query would most likely time out again.
+func retryable(err error, res Res) bool {
+	if err == nil {
+		for _, e := range res.Errors {
+			if strings.Contains(e.Message, "Please retry") {
+				return true
+			}
+		}
+		return false
+	}
+	if isTimeout(err) {
+		return false
+	}
+	if se, ok := err.(*statusError); ok {
+		return se.code >= 500 || se.code == http.StatusTooManyRequests
+	}
+	_, ok := err.(*url.Error)
+	return ok
+}
+
+func getResponse(q string, vars map[string]string, timeout time.Duration) (Res, error) {
+	if len(vars) == 0 {
+		return post(*baseURL, "", []byte(q), timeout)
+	}
+	b, err := json.Marshal(map[string]interface{}{"query": q, "variables": vars})
+	if err != nil {
+		return Res{}, err
+	}
+	return post(*baseURL, "application/json", b, timeout)
+}
+
+func post(url, contentType string, body []byte, timeout time.Duration) (Res, error) {
+	var res Res
+	client := &http.Client{Timeout: timeout}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return res, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
 
 	resp, err := client.Do(req)
-	x.Check(err)
+	if err != nil {
+		return res, err
+	}
 	defer resp.Body.Close()
 
 	responseData, err := ioutil.ReadAll(resp.Body)
-	x.Check(err)
-	//	fmt.Println(string(responseData))
+	if err != nil {
+		return res, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return res, &statusError{code: resp.StatusCode, body: string(responseData)}
+	}
+	if err := json.Unmarshal(responseData, &res); err != nil {
+		return res, fmt.Errorf("while parsing response: %v", err)
+	}
+	return res, nil
+}
 
-	var res Res
-	err = json.Unmarshal(responseData, &res)
-	x.Check(err)
-	x.AssertTruef(len(res.Errors) == 0, "Got errors for: %+v, error: %+v", q, res.Errors)
-	return res
+// send runs q once against the endpoint for its kind.
+func send(q Query) (Res, error) {
+	switch q.manifest.Kind {
+	case "graphql":
+		b, err := json.Marshal(map[string]interface{}{"query": q.text, "variables": q.manifest.Variables})
+		if err != nil {
+			return Res{}, err
+		}
+		return post(*graphqlURL, "application/json", b, q.timeout)
+	case "mutation":
+		text := q.text
+		if !strings.HasPrefix(strings.TrimSpace(text), "{") &&
+			!strings.HasPrefix(strings.TrimSpace(text), "upsert") {
+			// Bare N-Quads from an rdf block.
+			text = "{\n  set {\n" + text + "  }\n}\n"
+		}
+		url := strings.TrimSuffix(*baseURL, "/query") + "/mutate?commitNow=true"
+		return post(url, "application/rdf", []byte(text), q.timeout)
+	}
+	return getResponse(q.text, q.manifest.Variables, q.timeout)
+}
+
+// query runs q, retrying transient failures with exponential backoff.
+func query(q Query) (Res, error) {
+	wait := *backoff
+	for attempt := 0; ; attempt++ {
+		res, err := send(q)
+		if attempt == *retries || !retryable(err, res) {
+			return res, err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
 }
 
 func responseFile(folder, no string) string {
 	return fmt.Sprintf("%s/response-%s", folder, no)
 }
 
+func addResult(r Result) {
+	resultsMu.Lock()
+	results = append(results, r)
+	resultsMu.Unlock()
+}
+
+// checkErrors compares the errors of a response with the error expected by
+// the query, and returns the outcome with a message.
+func checkErrors(q Query, res Res) (string, string) {
+	m := q.manifest
+	expected := m.ExpectedError != "" || m.ExpectedCode != ""
+	switch {
+	case !expected && len(res.Errors) == 0:
+		return outcomePass, ""
+	case !expected:
+		return outcomeUnexpectedError, fmt.Sprintf("got errors: %+v", res.Errors)
+	case len(res.Errors) == 0:
+		return outcomeMismatch, "expected an error, got none"
+	}
+	for _, e := range res.Errors {
+		if strings.Contains(e.Message, m.ExpectedError) &&
+			(m.ExpectedCode == "" || e.code() == m.ExpectedCode) {
+			return outcomeExpectedError, e.Message
+		}
+	}
+	return outcomeUnexpectedError, fmt.Sprintf("expected error %q with code %q, got: %+v",
+		m.ExpectedError, m.ExpectedCode, res.Errors)
+}
+
+// run runs a query and compares the response with the one in --src.
+func run(q Query) Result {
+	r := Result{ID: q.id, Name: q.name(), Tags: q.manifest.Tags, Status: outcomePass}
+	if reason := q.skipReason(); reason != "" {
+		r.Status, r.Message = outcomeSkip, reason
+		return r
+	}
+
+	start := time.Now()
+	res, err := query(q)
+	r.Seconds = time.Since(start).Seconds()
+	switch {
+	case isTimeout(err):
+		r.Status, r.Message = outcomeTimeout, err.Error()
+		return r
+	case err != nil:
+		r.Status, r.Message = outcomeUnexpectedError, err.Error()
+		return r
+	}
+	if r.Status, r.Message = checkErrors(q, res); r.Status != outcomePass {
+		return r
+	}
+
+	d, err := json.Marshal(res.Data)
+	x.Check(err)
+	var indentedRes bytes.Buffer
+	x.Check(json.Indent(&indentedRes, d, "", "  "))
+	x.Check(ioutil.WriteFile(responseFile(*dest, q.id), indentedRes.Bytes(), 0755))
+
+	lat := repeat(q, r.Seconds, res)
+	x.Check(writeLatencies(*dest, q.id, lat))
+	if len(*src) == 0 && *reference == "" {
+		return r
+	}
+
+	if q.manifest.Compare != "none" {
+		var want []byte
+		if *reference != "" {
+			want, err = referenceAnswer(q)
+			if err != nil {
+				// The query uses DQL the reference doesn't cover.
+				r.Message = "not checked against the reference: " + err.Error()
+			}
+		} else if want, err = ioutil.ReadFile(responseFile(*src, q.id)); err != nil {
+			r.Status, r.Message = outcomeMismatch, err.Error()
+			return r
+		}
+		if want != nil {
+			changes, err := compare(q, want, indentedRes.Bytes())
+			if err != nil {
+				r.Status, r.Message = outcomeMismatch, err.Error()
+				return r
+			}
+			if len(changes) > 0 {
+				s := Summarize(changes)
+				r.Status, r.Message = outcomeMismatch, "response doesn't match: "+s.String()
+				r.Added, r.Removed, r.Changed = s.Added, s.Removed, s.Changed
+				r.changes = changes
+				return r
+			}
+		}
+	}
+	if len(*src) == 0 {
+		return r
+	}
+
+	// The answer still matches; check that it didn't get slower.
+	if base, err := readLatencies(*src, q.id); err == nil {
+		slower, msg := latencyCheck().Slower(base, lat)
+		r.Latency = msg
+		if slower {
+			r.Status, r.Message = outcomeSlower, msg
+		}
+	}
+	return r
+}
+
+// repeat runs a query --repeat times in all, counting the run that already
+// took seconds and returned res, and collects the latencies of the runs that
+// succeeded.
+func repeat(q Query, seconds float64, res Res) *Latencies {
+	lat := &Latencies{}
+	add := func(seconds float64, res Res) {
+		lat.Client = append(lat.Client, 1000*seconds)
+		lat.Server = append(lat.Server, float64(res.Extensions.ServerLatency.TotalNs)/1e6)
+	}
+	add(seconds, res)
+	if q.manifest.Kind == "mutation" {
+		return lat
+	}
+	for i := 1; i < *repeats; i++ {
+		start := time.Now()
+		res, err := send(q)
+		if err != nil || len(res.Errors) > 0 {
+			continue
+		}
+		add(time.Since(start).Seconds(), res)
+	}
+	return lat
+}
+
+func latencyCheck() LatencyCheck {
+	return LatencyCheck{
+		Test:     *latencyTest,
+		Metric:   *latencyMetric,
+		Alpha:    *alpha,
+		Slowdown: *slowdown,
+	}
+}
+
 func runQuery(qch chan Query, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for q := range qch {
-		res := getResponse(q.text)
-		if len(*src) == 0 {
-			fmt.Printf("Got reply for query: %s\n", q.no)
-		}
-		d, err := json.Marshal(res.Data)
-		x.Check(err)
-
-		var indentedRes bytes.Buffer
-		err = json.Indent(&indentedRes, d, "", "  ")
-		x.Check(err)
-		err = ioutil.WriteFile(responseFile(*dest, q.no), indentedRes.Bytes(), 0755)
-		x.Check(err)
-		if len(*src) > 0 {
-			r, err := ioutil.ReadFile(responseFile(*src, q.no))
-			x.Check(err)
-			if !bytes.Equal(r, indentedRes.Bytes()) {
-				fmt.Printf("Response for query: %s doesn't match.\n", q.no)
+		r := run(q)
+		switch r.Status {
+		case outcomeSkip:
+			fmt.Printf("Skipped query: %s: %s\n", q.id, r.Message)
+		case outcomePass:
+			if len(*src) == 0 {
+				fmt.Printf("Got reply for query: %s\n", q.id)
 			} else {
-				fmt.Printf("Response matched for query: %s\n", q.no)
+				fmt.Printf("Response matched for query: %s\n", q.id)
+			}
+		case outcomeExpectedError:
+			fmt.Printf("Got expected error for query: %s\n", q.id)
+		case outcomeSlower:
+			fmt.Printf("Response matched for query: %s, but it got slower: %s\n", q.id, r.Message)
+		case outcomeMismatch:
+			if len(r.changes) > 0 {
+				printChanges(q.id, r.changes)
+				break
 			}
+			fmt.Printf("Query %s: %s: %s\n", q.id, r.Status, r.Message)
+		default:
+			fmt.Printf("Query %s: %s: %s\n", q.id, r.Status, r.Message)
+		}
+		if r.failed() {
+			atomic.AddUint32(&failed, 1)
 		}
-		atomic.AddUint32(&count, 1)
-		indentedRes.Reset()
+		if r.Status != outcomeSkip {
+			atomic.AddUint32(&count, 1)
+		}
+		addResult(r)
+	}
+}
+
+// compare diffs two responses according to the compare mode of the query.
+func compare(q Query, old, cur []byte) ([]Change, error) {
+	if q.manifest.Compare == "exact" {
+		if bytes.Equal(old, cur) {
+			return nil, nil
+		}
+		return []Change{{Kind: "changed", Path: "", Old: string(old), New: string(cur)}}, nil
+	}
+	d := differ(q.text)
+	d.Unordered = append(d.Unordered, q.manifest.Unordered...)
+	if q.manifest.Compare == "ordered" {
+		d.Ordered = nil
 	}
+	return d.DiffJSON(old, cur)
 }
 
+var applied = make(map[string]bool)
+
+// alter applies a schema file, once per run.
+func alter(path string) error {
+	if applied[path] {
+		return nil
+	}
+	schema, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(*baseURL, "/query") + "/alter"
+	resp, err := http.Post(url, "application/dql", bytes.NewReader(schema))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var res Res
+	if err := json.Unmarshal(body, &res); err != nil {
+		return fmt.Errorf("while applying %s: %v", path, err)
+	}
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("while applying %s: %+v", path, res.Errors)
+	}
+	applied[path] = true
+	return nil
+}
+
+var all []Query
+
 func walk(path string, info os.FileInfo, err error) error {
 	x.Check(err)
-	if info.IsDir() {
+	if info.IsDir() || filepath.Ext(path) != ".txt" {
 		return nil
 	}
-	b, err := ioutil.ReadFile(path)
+	q, err := loadQuery(path)
 	x.Check(err)
-	name := strings.Split(info.Name(), "-")
-	x.AssertTrue(len(name) >= 2)
-	qch <- Query{
-		text: string(b),
-		no:   name[len(name)-1],
-	}
+	all = append(all, q)
 	return nil
 }
 
-var count uint32
+// schemaOf returns the schema file to apply before q, or "" if none.
+func schemaOf(q Query) string {
+	if !*applySchema || q.manifest.Schema == "" || q.skipReason() != "" {
+		return ""
+	}
+	return filepath.Join(q.dir, q.manifest.Schema)
+}
+
+// bySchema groups the queries by the schema to apply before them, those
+// without one first and the others in the order their schema first comes.
+// It returns the schemas and the queries of each.
+func bySchema(qs []Query) ([]string, [][]Query) {
+	schemas := []string{""}
+	groups := [][]Query{nil}
+	index := map[string]int{"": 0}
+	for _, q := range qs {
+		s := schemaOf(q)
+		i, ok := index[s]
+		if !ok {
+			i = len(schemas)
+			index[s] = i
+			schemas = append(schemas, s)
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], q)
+	}
+	return schemas, groups
+}
+
+// dispatch runs the queries on the workers and waits for them to finish.
+func dispatch(qs []Query) {
+	qch = make(chan Query, 100)
+	var wg sync.WaitGroup
+	for i := 0; i < *c; i++ {
+		wg.Add(1)
+		go runQuery(qch, &wg)
+	}
+	for _, q := range qs {
+		qch <- q
+	}
+	close(qch)
+	wg.Wait()
+}
+
+var count, failed uint32
+
+func differ(query string) *Differ {
+	d := &Differ{Tolerance: *tolerance}
+	if *unordered != "" {
+		d.Unordered = strings.Split(*unordered, ",")
+	}
+	if *autoOrder {
+		d.Ordered = OrderedBlocks(query)
+	}
+	return d
+}
+
+// printChanges prints the report for a query in one go, so that reports from
+// concurrent workers don't interleave.
+func printChanges(no string, changes []Change) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Response for query: %s doesn't match: %s\n", no, Summarize(changes))
+	for i, c := range changes {
+		if i == *maxChanges {
+			fmt.Fprintf(&b, "  ... %d more\n", len(changes)-i)
+			break
+		}
+		fmt.Fprintf(&b, "  %s\n", c)
+	}
+	fmt.Print(b.String())
+}
 
 func printCount() {
 	t := time.NewTicker(time.Second)
@@ -125,21 +522,39 @@ func printCount() {
 
 func main() {
 	flag.Parse()
-	qch = make(chan Query, 100)
 	x.AssertTrue(*dest != "")
 	err := os.MkdirAll(*dest, 0755)
 	x.Check(err)
-
-	var wg sync.WaitGroup
-	numWorkers := *c
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go runQuery(qch, &wg)
+	if *reference != "" {
+		x.Check(loadReference())
+	}
+	if *src != "" && *latencyTest == "mannwhitney" && !latencyCheck().resolves(*repeats, *repeats) {
+		fmt.Printf("--repeat %d is too few runs for mannwhitney at --alpha %g; latencies are compared by --slowdown alone.\n",
+			*repeats, *alpha)
 	}
 
 	//	go printCount()
 	err = filepath.Walk(*queries, walk)
 	x.Check(err)
-	close(qch)
-	wg.Wait()
+	// A schema changes what the queries before it see, so the queries of a
+	// schema all finish before the next one is applied.
+	schemas, groups := bySchema(all)
+	for i, qs := range groups {
+		if schemas[i] != "" {
+			x.Check(alter(schemas[i]))
+		}
+		dispatch(qs)
+	}
+	fmt.Printf("%d of %d queries failed.\n", failed, count)
+
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	if *reportFile != "" {
+		x.Check(writeJSONReport(*reportFile, results))
+	}
+	if *junitFile != "" {
+		x.Check(writeJUnitReport(*junitFile, results))
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
 }
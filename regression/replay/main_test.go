@@ -0,0 +1,206 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/mockdgraph"
+)
+
+func TestGetResponse(t *testing.T) {
+	s := mockdgraph.New(mockdgraph.Config{Seed: 1})
+	s.Start()
+	defer s.Close()
+	*baseURL = s.URL + "/query"
+
+	q := `{ me(func: eq(name@en, "Blade Runner")) { name@en } }`
+	require.NoError(t, s.Respond("/query", q, `{"me":[{"name@en":"Blade Runner"}]}`))
+
+	res, err := getResponse(q, nil, time.Second)
+	require.NoError(t, err)
+	require.Empty(t, res.Errors)
+	require.Equal(t, map[string]interface{}{
+		"me": []interface{}{map[string]interface{}{"name@en": "Blade Runner"}},
+	}, res.Data)
+	require.Len(t, s.Requests(), 1)
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "query-07.txt")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{ q(func: uid(1)) { uid } }`), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "query-07.json"),
+		[]byte(`{"name": "uid lookup", "tags": ["slow"], "timeout": "5s"}`), 0644))
+
+	q, err := loadQuery(path)
+	require.NoError(t, err)
+	require.Equal(t, "07.txt", q.id)
+	require.Equal(t, "uid lookup", q.name())
+	require.Equal(t, 5*time.Second, q.timeout)
+	require.Equal(t, "", q.skipReason())
+
+	*skipTags = "flaky,slow"
+	defer func() { *skipTags = "" }()
+	require.Equal(t, "tagged flaky,slow", q.skipReason())
+
+	junit := filepath.Join(dir, "junit.xml")
+	require.NoError(t, writeJUnitReport(junit, []Result{
+		{ID: "07.txt", Name: "uid lookup", Status: outcomeSkip, Message: "tagged slow"},
+		{ID: "08.txt", Name: "08.txt", Status: outcomeMismatch, Message: "response doesn't match"},
+	}))
+	b, err := ioutil.ReadFile(junit)
+	require.NoError(t, err)
+	require.Contains(t, string(b), `<testsuite name="regression" tests="2" failures="1" skipped="1"`)
+}
+
+func TestOutcomes(t *testing.T) {
+	s := mockdgraph.New(mockdgraph.Config{})
+	s.Start()
+	defer s.Close()
+	*baseURL = s.URL + "/query"
+	*dest = t.TempDir()
+	*backoff = time.Millisecond
+
+	ok := `{ q(func: uid(1)) { uid } }`
+	bad := `{ q(func: uid(1)) { uid`
+	require.NoError(t, s.Respond("/query", ok, `{"q":[{"uid":"0x1"}]}`))
+	s.Fail("/query", bad, "Unexpected end of input")
+
+	q := func(text string, m Manifest) Query {
+		return Query{id: "01.txt", text: text, manifest: m, timeout: time.Second}
+	}
+	tests := []struct {
+		q    Query
+		want string
+	}{
+		{q(ok, Manifest{}), outcomePass},
+		{q(bad, Manifest{}), outcomeUnexpectedError},
+		{q(bad, Manifest{ExpectedError: "end of input"}), outcomeExpectedError},
+		{q(bad, Manifest{ExpectedCode: "ErrorInvalidRequest"}), outcomeExpectedError},
+		{q(bad, Manifest{ExpectedError: "end of input", ExpectedCode: "ErrorAborted"}), outcomeUnexpectedError},
+		{q(ok, Manifest{ExpectedError: "end of input"}), outcomeMismatch},
+		{q(ok, Manifest{Skip: "flaky"}), outcomeSkip},
+	}
+	for _, tc := range tests {
+		r := run(tc.q)
+		require.Equal(t, tc.want, r.Status, "%+v: %s", tc.q.manifest, r.Message)
+	}
+
+	// Transient failures are retried.
+	flaky := mockdgraph.New(mockdgraph.Config{HTTPErrorRate: 0.8, Seed: 1})
+	flaky.Start()
+	defer flaky.Close()
+	*baseURL = flaky.URL + "/query"
+	*retries = 50
+	require.NoError(t, flaky.Respond("/query", ok, `{"q":[{"uid":"0x1"}]}`))
+	r := run(q(ok, Manifest{}))
+	require.Equal(t, outcomePass, r.Status, r.Message)
+	require.Greater(t, len(flaky.Requests()), 1)
+
+	// Slow queries time out.
+	slow := mockdgraph.New(mockdgraph.Config{Latency: 200 * time.Millisecond})
+	slow.Start()
+	defer slow.Close()
+	*baseURL = slow.URL + "/query"
+	tq := q(ok, Manifest{})
+	tq.timeout = 50 * time.Millisecond
+	require.Equal(t, outcomeTimeout, run(tq).Status)
+}
+
+func TestKinds(t *testing.T) {
+	s := mockdgraph.New(mockdgraph.Config{})
+	s.Start()
+	defer s.Close()
+	*baseURL = s.URL + "/query"
+	*graphqlURL = s.URL + "/graphql"
+	*dest = t.TempDir()
+
+	gql := `query { getFilm(id: "0x1") { name } }`
+	require.NoError(t, s.Respond("/graphql", gql, `{"getFilm":{"name":"Blade Runner"}}`))
+	r := run(Query{id: "g.txt", text: gql, manifest: Manifest{Kind: "graphql"}, timeout: time.Second})
+	require.Equal(t, outcomePass, r.Status, r.Message)
+
+	nquads := "_:a <name> \"A\" .\n"
+	m := Query{id: "m.txt", text: nquads, manifest: Manifest{Kind: "mutation"}, timeout: time.Second}
+	require.Equal(t, outcomeSkip, run(m).Status)
+	*mutations = true
+	defer func() { *mutations = false }()
+	require.Equal(t, outcomePass, run(m).Status)
+
+	reqs := s.Requests()
+	last := reqs[len(reqs)-1]
+	require.Equal(t, "/mutate", last.Path)
+	require.Equal(t, "true", last.Params.Get("commitNow"))
+	require.Contains(t, last.Body, "set {\n"+nquads)
+}
+
+func TestReference(t *testing.T) {
+	dir := t.TempDir()
+	rdf := filepath.Join(dir, "data.rdf")
+	require.NoError(t, ioutil.WriteFile(rdf, []byte(`<0x1> <name> "Alien"@en .
+<0x1> <year> "1979" .
+`), 0644))
+	schema := filepath.Join(dir, "data.schema")
+	require.NoError(t, ioutil.WriteFile(schema, []byte("year: int .\n"), 0644))
+	*reference, *referenceSchema = rdf, schema
+	defer func() { *reference, *referenceSchema, ref = "", "", nil }()
+	require.NoError(t, loadReference())
+
+	s := mockdgraph.New(mockdgraph.Config{})
+	s.Start()
+	defer s.Close()
+	*baseURL = s.URL + "/query"
+	*dest = t.TempDir()
+
+	q := `{ q(func: uid(0x1)) { name@en year } }`
+	require.NoError(t, s.Respond("/query", q, `{"q":[{"name@en":"Alien","year":1979}]}`))
+	r := run(Query{id: "r.txt", text: q, timeout: time.Second})
+	require.Equal(t, outcomePass, r.Status, r.Message)
+
+	require.NoError(t, s.Respond("/query", q, `{"q":[{"name@en":"Aliens","year":1979}]}`))
+	r = run(Query{id: "r.txt", text: q, timeout: time.Second})
+	require.Equal(t, outcomeMismatch, r.Status)
+	require.Equal(t, 1, r.Changed)
+
+	// Queries the reference can't evaluate pass unchecked.
+	cascade := `{ q(func: uid(0x1)) @cascade { name@en } }`
+	require.NoError(t, s.Respond("/query", cascade, `{"q":[{"name@en":"Alien"}]}`))
+	r = run(Query{id: "c.txt", text: cascade, timeout: time.Second})
+	require.Equal(t, outcomePass, r.Status)
+	require.Contains(t, r.Message, "not checked against the reference")
+
+	// A reference that can't be loaded is an error.
+	*reference = filepath.Join(dir, "missing.rdf")
+	require.Error(t, loadReference())
+	*reference = schema
+	require.Error(t, loadReference(), "a schema isn't RDF")
+}
+
+func TestBySchema(t *testing.T) {
+	q := func(id, schema string) Query {
+		return Query{id: id, dir: "q", manifest: Manifest{Schema: schema}}
+	}
+	qs := []Query{q("1", "a.schema"), q("2", ""), q("3", "b.schema"), q("4", "a.schema"), q("5", "")}
+
+	schemas, groups := bySchema(qs)
+	require.Equal(t, []string{""}, schemas, "schemas are only applied with --apply-schema")
+	require.Len(t, groups[0], 5)
+
+	*applySchema = true
+	defer func() { *applySchema = false }()
+	schemas, groups = bySchema(qs)
+	require.Equal(t, []string{"", filepath.Join("q", "a.schema"), filepath.Join("q", "b.schema")}, schemas)
+	var ids [][]string
+	for _, g := range groups {
+		var s []string
+		for _, q := range g {
+			s = append(s, q.id)
+		}
+		ids = append(ids, s)
+	}
+	require.Equal(t, [][]string{{"2", "5"}, {"1", "4"}, {"3"}}, ids)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Manifest configures a query. It lives next to the query, with the same name
+// and a .json extension, e.g. query-01.json for query-01.txt. All fields are
+// optional.
+type Manifest struct {
+	Name string   `json:"name,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	// Kind is query (the default), mutation or graphql. Mutations are DQL
+	// mutations or bare N-Quads, which are run as a set mutation.
+	Kind string `json:"kind,omitempty"`
+	// Source is the doc file and line the query was extracted from.
+	Source string `json:"source,omitempty"`
+	// Dataset is the data set the query needs, e.g. 21million. The query is
+	// skipped if replay runs with a different --dataset.
+	Dataset string `json:"dataset,omitempty"`
+	// Schema is a schema file, relative to the manifest, that is applied
+	// before the query when replay runs with --apply-schema.
+	Schema    string            `json:"schema,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	// ExpectedError is a substring of the error message the query must fail
+	// with, and ExpectedCode its code, e.g. ErrorInvalidRequest. Either is
+	// enough to expect an error.
+	ExpectedError string `json:"expected_error,omitempty"`
+	ExpectedCode  string `json:"expected_error_code,omitempty"`
+	// Timeout is a duration like 30s. Defaults to --timeout.
+	Timeout string `json:"timeout,omitempty"`
+	// Compare is structural (the default), ordered, exact or none.
+	Compare string `json:"compare,omitempty"`
+	// Unordered adds to the --unordered paths.
+	Unordered []string `json:"unordered,omitempty"`
+	// Skip is the reason the query is skipped, if it is.
+	Skip string `json:"skip,omitempty"`
+}
+
+// Query is a query file with its manifest.
+type Query struct {
+	// id identifies the responses of the query, e.g. 01 for query-01.txt.
+	id       string
+	text     string
+	dir      string
+	manifest Manifest
+	timeout  time.Duration
+}
+
+func (q Query) name() string {
+	if q.manifest.Name != "" {
+		return q.manifest.Name
+	}
+	return q.id
+}
+
+func hasTag(tags []string, list string) bool {
+	for _, want := range strings.Split(list, ",") {
+		for _, t := range tags {
+			if t == strings.TrimSpace(want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipReason returns why the query shouldn't run, or "".
+func (q Query) skipReason() string {
+	m := q.manifest
+	switch {
+	case m.Skip != "":
+		return m.Skip
+	case m.Kind == "mutation" && !*mutations:
+		return "mutation, run with --mutations"
+	case *tags != "" && !hasTag(m.Tags, *tags):
+		return "not tagged " + *tags
+	case *skipTags != "" && hasTag(m.Tags, *skipTags):
+		return "tagged " + *skipTags
+	case *dataset != "" && m.Dataset != "" && m.Dataset != *dataset:
+		return "needs dataset " + m.Dataset
+	}
+	return ""
+}
+
+// loadQuery reads a query file and its manifest, if there is one.
+func loadQuery(path string) (Query, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Query{}, err
+	}
+	base := filepath.Base(path)
+	id := strings.TrimPrefix(strings.TrimSuffix(base, filepath.Ext(base)), "query-")
+	// Responses have always been written as response-<id>.txt.
+	q := Query{id: id + ".txt", text: string(b), dir: filepath.Dir(path), timeout: *timeout}
+
+	mpath := strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+	mb, err := ioutil.ReadFile(mpath)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return q, err
+	}
+	if err := json.Unmarshal(mb, &q.manifest); err != nil {
+		return q, fmt.Errorf("%s: %v", mpath, err)
+	}
+	switch q.manifest.Compare {
+	case "", "structural", "ordered", "exact", "none":
+	default:
+		return q, fmt.Errorf("%s: unknown compare mode %q", mpath, q.manifest.Compare)
+	}
+	switch q.manifest.Kind {
+	case "", "query", "mutation", "graphql":
+	default:
+		return q, fmt.Errorf("%s: unknown kind %q", mpath, q.manifest.Kind)
+	}
+	if q.manifest.Timeout != "" {
+		if q.timeout, err = time.ParseDuration(q.manifest.Timeout); err != nil {
+			return q, fmt.Errorf("%s: %v", mpath, err)
+		}
+	}
+	return q, nil
+}
+
+// Outcomes of a query.
+const (
+	outcomePass            = "pass"
+	outcomeExpectedError   = "expected-error"
+	outcomeUnexpectedError = "unexpected-error"
+	outcomeTimeout         = "timeout"
+	outcomeMismatch        = "mismatch"
+	outcomeSlower          = "slower"
+	outcomeSkip            = "skip"
+)
+
+// Result is the outcome of a query, as written to the JSON report.
+type Result struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Tags    []string `json:"tags,omitempty"`
+	Status  string   `json:"status"`
+	Message string   `json:"message,omitempty"`
+	Seconds float64  `json:"seconds"`
+	Added   int      `json:"added,omitempty"`
+	Removed int      `json:"removed,omitempty"`
+	Changed int      `json:"changed,omitempty"`
+	// Latency compares the latency with the baseline's.
+	Latency string `json:"latency,omitempty"`
+
+	changes []Change
+}
+
+func (r Result) failed() bool {
+	switch r.Status {
+	case outcomePass, outcomeExpectedError, outcomeSkip:
+		return false
+	case outcomeSlower:
+		return *failSlower
+	}
+	return true
+}
+
+func writeJSONReport(path string, results []Result) error {
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+func writeJUnitReport(path string, results []Result) error {
+	s := junitSuite{Name: "regression", Tests: len(results)}
+	for _, r := range results {
+		c := junitCase{Name: r.Name, Classname: "regression." + r.ID, Time: r.Seconds}
+		switch {
+		case r.Status == outcomeSkip:
+			s.Skipped++
+			c.Skipped = &junitMessage{Message: r.Message}
+		case r.failed():
+			s.Failures++
+			c.Failure = &junitMessage{Message: r.Status + ": " + r.Message}
+		}
+		s.Time += r.Seconds
+		s.Cases = append(s.Cases, c)
+	}
+	b, err := xml.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), b...), 0644)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/dgraph-io/benchmarks/dqlref"
+	"github.com/dgraph-io/benchmarks/memgraph"
+)
+
+var (
+	ref *dqlref.Evaluator
+	// refMu serializes evaluations, which share the evaluator's caches.
+	refMu sync.Mutex
+)
+
+// loadReference loads the --reference data, before any query is run, so that
+// a bad file stops the run rather than leaving every query unchecked.
+func loadReference() error {
+	var types map[string]string
+	if *referenceSchema != "" {
+		schema, err := ioutil.ReadFile(*referenceSchema)
+		if err != nil {
+			return err
+		}
+		types = dqlref.ParseTypes(string(schema))
+	}
+	g, err := memgraph.Load(*reference)
+	if err != nil {
+		return fmt.Errorf("while loading %s: %v", *reference, err)
+	}
+	ref = dqlref.New(g, types)
+	return nil
+}
+
+// referenceAnswer evaluates a query against the --reference data and returns
+// the data as JSON. It fails for queries using DQL the reference doesn't
+// cover.
+func referenceAnswer(q Query) ([]byte, error) {
+	refMu.Lock()
+	res, err := ref.Run(q.text)
+	refMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(res)
+}
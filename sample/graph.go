@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// typePred is the predicate holding the types of a node.
+const typePred = "dgraph.type"
+
+// graph is the structure of a data set: its nodes, the edges between them
+// and the type of each. Values aren't kept; the sample is written by reading
+// the data set again.
+type graph struct {
+	ids map[string]int32
+	// typ is the first type of each node, as an index in types, or -1.
+	typ     []int32
+	types   []string
+	typeIdx map[string]int32
+	// src and dst are the ends of every edge.
+	src, dst []int32
+	// The edges leaving node n are outAdj[outOff[n]:outOff[n+1]], and those
+	// reaching it inAdj[inOff[n]:inOff[n+1]]. Set by index.
+	outOff, outAdj []int32
+	inOff, inAdj   []int32
+
+	// match is a value nodes are looked for by, if set, and matched the
+	// nodes found.
+	match   *match
+	matched []int32
+}
+
+// match is a value of a predicate, in a language if lang is set.
+type match struct {
+	pred, lang, value string
+}
+
+// parseMatch parses pred=value or pred@lang=value.
+func parseMatch(s string) (*match, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return nil, fmt.Errorf("expected pred=value, got %q", s)
+	}
+	m := &match{pred: s[:i], value: s[i+1:]}
+	if j := strings.Index(m.pred, "@"); j > 0 {
+		m.pred, m.lang = m.pred[:j], m.pred[j+1:]
+	}
+	return m, nil
+}
+
+func (m *match) matches(nq nquad.NQuad) bool {
+	return nq.Predicate == m.pred && nq.ObjectValue == m.value && (m.lang == "" || nq.Lang == m.lang)
+}
+
+func newGraph() *graph {
+	return &graph{ids: make(map[string]int32), typeIdx: make(map[string]int32)}
+}
+
+func (g *graph) len() int {
+	return len(g.typ)
+}
+
+// node returns the index of the node with id, adding it if it's new.
+func (g *graph) node(id string) int32 {
+	n, ok := g.ids[id]
+	if !ok {
+		n = int32(len(g.typ))
+		g.ids[id] = n
+		g.typ = append(g.typ, -1)
+	}
+	return n
+}
+
+// add adds the nodes and the edge of nq, or the type it gives its subject.
+func (g *graph) add(nq nquad.NQuad) {
+	s := g.node(nq.Subject)
+	if nq.IsEdge() {
+		g.src = append(g.src, s)
+		g.dst = append(g.dst, g.node(nq.ObjectId))
+		return
+	}
+	if g.match != nil && g.match.matches(nq) {
+		g.matched = append(g.matched, s)
+	}
+	if nq.Predicate != typePred || g.typ[s] >= 0 {
+		return
+	}
+	t, ok := g.typeIdx[nq.ObjectValue]
+	if !ok {
+		t = int32(len(g.types))
+		g.typeIdx[nq.ObjectValue] = t
+		g.types = append(g.types, nq.ObjectValue)
+	}
+	g.typ[s] = t
+}
+
+// csr indexes the edges from -> to by their from end.
+func csr(n int, from, to []int32) (off, adj []int32) {
+	off = make([]int32, n+1)
+	for _, f := range from {
+		off[f+1]++
+	}
+	for i := 1; i <= n; i++ {
+		off[i] += off[i-1]
+	}
+	adj = make([]int32, len(from))
+	next := append([]int32(nil), off[:n]...)
+	for i, f := range from {
+		adj[next[f]] = to[i]
+		next[f]++
+	}
+	return off, adj
+}
+
+// index builds the adjacency lists, once every N-Quad was added.
+func (g *graph) index() {
+	g.outOff, g.outAdj = csr(g.len(), g.src, g.dst)
+	g.inOff, g.inAdj = csr(g.len(), g.dst, g.src)
+}
+
+func (g *graph) out(n int32) []int32 {
+	return g.outAdj[g.outOff[n]:g.outOff[n+1]]
+}
+
+func (g *graph) in(n int32) []int32 {
+	return g.inAdj[g.inOff[n]:g.inOff[n+1]]
+}
+
+// neighbours calls fn for the nodes edges from n lead to, and unless outOnly
+// is set for those with edges to n.
+func (g *graph) neighbours(n int32, outOnly bool, fn func(int32)) {
+	for _, m := range g.out(n) {
+		fn(m)
+	}
+	if outOnly {
+		return
+	}
+	for _, m := range g.in(n) {
+		fn(m)
+	}
+}
+
+// loadGraph reads the graph of the files. With m set, the nodes with its
+// value are collected in matched.
+func loadGraph(files []string, m *match) (*graph, error) {
+	g := newGraph()
+	g.match = m
+	for _, path := range files {
+		r, err := nquad.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			nq, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("%s:%d: %v", path, r.Line(), err)
+			}
+			g.add(nq)
+			if r.Line()%1000000 == 0 {
+				log.Printf("Read %d lines of %s", r.Line(), path)
+			}
+		}
+		r.Close()
+	}
+	g.index()
+	return g, nil
+}
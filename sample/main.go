@@ -0,0 +1,163 @@
+// This tool samples an RDF or JSON data set, plain or gzipped, into a smaller
+// one for benchmarks. Unlike filtering by entity, as finder and neo -mod do,
+// it picks the nodes by walking the graph, so that the sample stays
+// connected:
+//
+//	go run . -strategy forestfire -n 100000 -output 100k.rdf.gz ../data/21million.rdf.gz
+//	go run . -strategy khop -hops 2 -seed-match 'name@en=Blade Runner' ../data/21million.rdf.gz
+//
+// The strategies are
+//
+//	random      nodes picked uniformly at random
+//	bfs         a breadth first walk from the seeds
+//	forestfire  forest fire sampling from the seeds, burning -burn of the
+//	            neighbours of each node on average
+//	khop        the nodes within -hops of the seeds, nearest first
+//	type        random nodes of every dgraph.type, at the same rate
+//
+// bfs and forestfire start again from a random node when the walk runs out
+// of nodes; seeds are given with -seeds or -seed-match, or picked at random.
+//
+// The sample has every N-Quad of the nodes picked, except edges to nodes
+// that weren't, so it doesn't refer to nodes it has no data for. Its degree
+// distributions are compared with those of the data set, with the
+// Kolmogorov-Smirnov statistic, and printed to stderr.
+//
+// The data set is read twice, first for its structure, which is held in
+// memory, about 16 bytes per edge besides the ids of the nodes, and then to
+// write the sample.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+var (
+	input      = flag.String("input", "", "Input RDF or JSON file, plain or gzipped.")
+	output     = flag.String("output", "sample.rdf.gz", "Output RDF file, gzipped if it ends in .gz.")
+	strategy   = flag.String("strategy", strategyForestFire, "How to pick nodes: random, bfs, forestfire, khop or type.")
+	numNodes   = flag.Int("n", 0, "Number of nodes to sample. Overrides -fraction.")
+	fraction   = flag.Float64("fraction", 0.01, "Share of the nodes to sample. Unless -n is set, khop takes all nodes within -hops.")
+	seeds      = flag.String("seeds", "", "Comma separated ids of nodes to start from, as they are in the data.")
+	seedMatch  = flag.String("seed-match", "", "Start from the nodes with a value, given as pred=value, or pred@lang=value for a language.")
+	hops       = flag.Int("hops", 2, "Hops from the seeds for khop.")
+	burn       = flag.Float64("burn", 0.7, "Forward burning probability of forestfire.")
+	outOnly    = flag.Bool("out", false, "Follow edges only forwards, from subject to object.")
+	randomSeed = flag.Int64("random-seed", 1, "Seed of the random choices, for the same data set to give the same sample.")
+)
+
+// write writes the N-Quads of the files whose nodes are all kept to w. It
+// returns the number written.
+func write(g *graph, keep []bool, files []string, w io.Writer) (int, error) {
+	bw := bufio.NewWriterSize(w, 1<<20)
+	written := 0
+	for _, path := range files {
+		err := nquad.Each(path, func(nq nquad.NQuad) error {
+			if !keep[g.ids[nq.Subject]] || nq.IsEdge() && !keep[g.ids[nq.ObjectId]] {
+				return nil
+			}
+			written++
+			bw.WriteString(nq.String())
+			return bw.WriteByte('\n')
+		})
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, bw.Flush()
+}
+
+// seedNodes returns the nodes of the -seeds ids and of -seed-match.
+func seedNodes(g *graph, ids string) ([]int32, error) {
+	var out []int32
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		n, ok := g.ids[strings.Trim(id, "<>")]
+		if !ok {
+			return nil, fmt.Errorf("no node %s in the data", id)
+		}
+		out = append(out, n)
+	}
+	return append(out, g.matched...), nil
+}
+
+func main() {
+	flag.Parse()
+	files := flag.Args()
+	if *input != "" {
+		files = append([]string{*input}, files...)
+	}
+	if len(files) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var m *match
+	if *seedMatch != "" {
+		var err error
+		if m, err = parseMatch(*seedMatch); err != nil {
+			log.Fatalf("-seed-match: %v", err)
+		}
+	}
+
+	g, err := loadGraph(files, m)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Read %d nodes and %d edges", g.len(), len(g.src))
+	o := options{
+		nodes:   *numNodes,
+		hops:    *hops,
+		burn:    *burn,
+		outOnly: *outOnly,
+		rng:     rand.New(rand.NewSource(*randomSeed)),
+	}
+	if o.seeds, err = seedNodes(g, *seeds); err != nil {
+		log.Fatal(err)
+	}
+	if *seedMatch != "" && len(g.matched) == 0 {
+		log.Fatalf("No node has %s", *seedMatch)
+	}
+	if o.nodes == 0 && *strategy != strategyKHop {
+		o.nodes = int(*fraction * float64(g.len()))
+	}
+	keep, err := sample(g, *strategy, o)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var w io.WriteCloser = f
+	if strings.HasSuffix(*output, ".gz") {
+		w = gzip.NewWriter(f)
+	}
+	n, err := write(g, keep, files, w)
+	if err == nil && w != f {
+		err = w.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %d N-Quads to %s", n, *output)
+	if err := compare(g, keep).write(os.Stderr); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+)
+
+// report compares a sample with the graph it was taken from.
+type report struct {
+	// Nodes and edges of the graph and of the sample.
+	nodes, edges [2]int
+	// The Kolmogorov-Smirnov statistic of the out, in and total degree
+	// distributions of the sample against those of the graph: the largest
+	// distance between their cumulative distributions, from 0 for the same
+	// distribution to 1.
+	ksOut, ksIn, ksTotal float64
+	// critical is the statistic above which the distributions differ at a
+	// 5% significance level.
+	critical float64
+	// meanDegree is the mean out degree of the graph and of the sample.
+	meanDegree [2]float64
+	// components is the number of weakly connected components of the
+	// sample, and largest the share of its nodes in the largest.
+	components int
+	largest    float64
+}
+
+// ks returns the two sample Kolmogorov-Smirnov statistic of a and b, which
+// it sorts.
+func ks(a, b []int) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	sort.Ints(a)
+	sort.Ints(b)
+	var d float64
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		// Move past every value equal to the smallest of the two, so that
+		// the distributions are compared between distinct values.
+		x := a[i]
+		if b[j] < x {
+			x = b[j]
+		}
+		for i < len(a) && a[i] == x {
+			i++
+		}
+		for j < len(b) && b[j] == x {
+			j++
+		}
+		diff := math.Abs(float64(i)/float64(len(a)) - float64(j)/float64(len(b)))
+		if diff > d {
+			d = diff
+		}
+	}
+	return d
+}
+
+// find returns the root of the set of n, halving paths on the way.
+func find(parent []int32, n int32) int32 {
+	for parent[n] != n {
+		parent[n] = parent[parent[n]]
+		n = parent[n]
+	}
+	return n
+}
+
+// compare reports on the sample of g given by keep.
+func compare(g *graph, keep []bool) *report {
+	r := &report{}
+	r.nodes[0], r.edges[0] = g.len(), len(g.src)
+
+	idx := make([]int32, g.len())
+	var parent []int32
+	for n, k := range keep {
+		if k {
+			idx[n] = int32(len(parent))
+			parent = append(parent, int32(len(parent)))
+		}
+	}
+	r.nodes[1] = len(parent)
+	out := make([]int, len(parent))
+	in := make([]int, len(parent))
+	for i, s := range g.src {
+		d := g.dst[i]
+		if !keep[s] || !keep[d] {
+			continue
+		}
+		r.edges[1]++
+		out[idx[s]]++
+		in[idx[d]]++
+		a, b := find(parent, idx[s]), find(parent, idx[d])
+		if a != b {
+			parent[a] = b
+		}
+	}
+
+	sizes := make(map[int32]int)
+	for i := range parent {
+		sizes[find(parent, int32(i))]++
+	}
+	r.components = len(sizes)
+	for _, n := range sizes {
+		if f := float64(n) / float64(len(parent)); f > r.largest {
+			r.largest = f
+		}
+	}
+
+	srcOut := make([]int, g.len())
+	srcIn := make([]int, g.len())
+	srcTotal := make([]int, g.len())
+	total := make([]int, len(parent))
+	for n := 0; n < g.len(); n++ {
+		srcOut[n] = int(g.outOff[n+1] - g.outOff[n])
+		srcIn[n] = int(g.inOff[n+1] - g.inOff[n])
+		srcTotal[n] = srcOut[n] + srcIn[n]
+	}
+	for i := range total {
+		total[i] = out[i] + in[i]
+	}
+	r.ksOut = ks(srcOut, out)
+	r.ksIn = ks(srcIn, in)
+	r.ksTotal = ks(srcTotal, total)
+	if n, m := float64(r.nodes[0]), float64(r.nodes[1]); n > 0 && m > 0 {
+		r.critical = 1.358 * math.Sqrt((n+m)/(n*m))
+		r.meanDegree = [2]float64{float64(r.edges[0]) / n, float64(r.edges[1]) / m}
+	}
+	return r
+}
+
+func (r *report) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tsource\tsample")
+	fmt.Fprintf(tw, "nodes\t%d\t%d\n", r.nodes[0], r.nodes[1])
+	fmt.Fprintf(tw, "edges\t%d\t%d\n", r.edges[0], r.edges[1])
+	fmt.Fprintf(tw, "mean degree\t%.2f\t%.2f\n", r.meanDegree[0], r.meanDegree[1])
+	fmt.Fprintf(tw, "components\t\t%d\n", r.components)
+	fmt.Fprintf(tw, "largest component\t\t%.1f%%\n", 100*r.largest)
+	fmt.Fprintf(tw, "KS out degree\t\t%.4f\n", r.ksOut)
+	fmt.Fprintf(tw, "KS in degree\t\t%.4f\n", r.ksIn)
+	fmt.Fprintf(tw, "KS degree\t\t%.4f\n", r.ksTotal)
+	fmt.Fprintf(tw, "KS critical value (5%%)\t\t%.4f\n", r.critical)
+	return tw.Flush()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// films writes a data set of n films, each starring three of 2n actors
+// through performance nodes, and returns its path.
+func films(t *testing.T, n int) string {
+	var buf bytes.Buffer
+	rng := rand.New(rand.NewSource(7))
+	for f := 0; f < n; f++ {
+		fmt.Fprintf(&buf, "<f%d> <name> \"Film %d\"@en .\n", f, f)
+		fmt.Fprintf(&buf, "<f%d> <dgraph.type> \"Film\" .\n", f)
+		for i := 0; i < 3; i++ {
+			a := rng.Intn(2 * n)
+			fmt.Fprintf(&buf, "<f%d> <starring> <p%d.%d> (role=\"lead\") .\n", f, f, i)
+			fmt.Fprintf(&buf, "<p%d.%d> <performance.actor> <a%d> .\n", f, i, a)
+			fmt.Fprintf(&buf, "<p%d.%d> <dgraph.type> \"Performance\" .\n", f, i)
+		}
+	}
+	for a := 0; a < 2*n; a++ {
+		fmt.Fprintf(&buf, "<a%d> <name> \"Actor %d\" .\n", a, a)
+		fmt.Fprintf(&buf, "<a%d> <dgraph.type> \"Actor\" .\n", a)
+	}
+	path := filepath.Join(t.TempDir(), "films.rdf")
+	require.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+	return path
+}
+
+// check writes the sample and checks that it has every N-Quad of the nodes
+// kept, and no edge to a node that wasn't.
+func check(t *testing.T, g *graph, keep []bool, path string) []nquad.NQuad {
+	var buf bytes.Buffer
+	n, err := write(g, keep, []string{path}, &buf)
+	require.NoError(t, err)
+	var out []nquad.NQuad
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		nq, err := nquad.Parse(line)
+		require.NoError(t, err)
+		out = append(out, nq)
+	}
+	require.Len(t, out, n)
+
+	subjects := make(map[string]bool)
+	for _, nq := range out {
+		require.True(t, keep[g.ids[nq.Subject]], nq.String())
+		subjects[nq.Subject] = true
+	}
+	for _, nq := range out {
+		if nq.IsEdge() {
+			require.True(t, subjects[nq.ObjectId], "dangling %s", nq.String())
+		}
+	}
+	// Every node kept has its values.
+	for id, n := range g.ids {
+		if keep[n] {
+			require.True(t, subjects[id], id)
+		}
+	}
+	return out
+}
+
+func count(keep []bool) int {
+	n := 0
+	for _, k := range keep {
+		if k {
+			n++
+		}
+	}
+	return n
+}
+
+func TestStrategies(t *testing.T) {
+	path := films(t, 50)
+	g, err := loadGraph([]string{path}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 50+150+100, g.len())
+	require.Equal(t, 300, len(g.src))
+
+	for _, s := range []string{strategyRandom, strategyBFS, strategyForestFire, strategyType} {
+		t.Run(s, func(t *testing.T) {
+			o := options{nodes: 60, burn: 0.7, rng: rand.New(rand.NewSource(1))}
+			keep, err := sample(g, s, o)
+			require.NoError(t, err)
+			require.Equal(t, 60, count(keep))
+			check(t, g, keep, path)
+
+			again, err := sample(g, s, options{nodes: 60, burn: 0.7, rng: rand.New(rand.NewSource(1))})
+			require.NoError(t, err)
+			require.Equal(t, keep, again, "the same seed gives the same sample")
+		})
+	}
+
+	_, err = sample(g, strategyKHop, options{hops: 1})
+	require.Error(t, err)
+	_, err = sample(g, strategyForestFire, options{nodes: 10, burn: 1})
+	require.Error(t, err)
+	_, err = sample(g, "snowball", options{})
+	require.Error(t, err)
+}
+
+func TestWalksStayConnected(t *testing.T) {
+	path := films(t, 200)
+	g, err := loadGraph([]string{path}, nil)
+	require.NoError(t, err)
+	seed := []int32{g.ids["f0"]}
+
+	for _, s := range []string{strategyBFS, strategyForestFire} {
+		keep, err := sample(g, s, options{nodes: 40, seeds: seed, burn: 0.7, rng: rand.New(rand.NewSource(1))})
+		require.NoError(t, err)
+		require.True(t, keep[seed[0]], s)
+		r := compare(g, keep)
+		require.Equal(t, 40, r.nodes[1], s)
+		// A walk only leaves its component once it ran out of nodes.
+		require.True(t, r.largest > 0.5, "%s: %+v", s, r)
+	}
+
+	keep, err := sample(g, strategyRandom, options{nodes: 40, rng: rand.New(rand.NewSource(1))})
+	require.NoError(t, err)
+	require.True(t, compare(g, keep).components > 20)
+}
+
+func TestKHop(t *testing.T) {
+	path := films(t, 20)
+	m, err := parseMatch("name@en=Film 3")
+	require.NoError(t, err)
+	g, err := loadGraph([]string{path}, m)
+	require.NoError(t, err)
+	require.Equal(t, []int32{g.ids["f3"]}, g.matched)
+
+	ids := func(keep []bool) []string {
+		var out []string
+		for id, n := range g.ids {
+			if keep[n] {
+				out = append(out, id)
+			}
+		}
+		sort.Strings(out)
+		return out
+	}
+	keep, err := sample(g, strategyKHop, options{seeds: g.matched, hops: 1, outOnly: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"f3", "p3.0", "p3.1", "p3.2"}, ids(keep))
+	out := check(t, g, keep, path)
+	// The edges to the actors are left out.
+	require.Len(t, out, 2+3+3)
+
+	keep, err = sample(g, strategyKHop, options{seeds: g.matched, hops: 2, outOnly: true})
+	require.NoError(t, err)
+	require.Len(t, ids(keep), 4+3)
+	check(t, g, keep, path)
+
+	// Capped, the nearest nodes come first.
+	keep, err = sample(g, strategyKHop, options{seeds: g.matched, hops: 2, nodes: 3})
+	require.NoError(t, err)
+	require.Equal(t, []string{"f3", "p3.0", "p3.1"}, ids(keep))
+
+	_, err = parseMatch("name")
+	require.Error(t, err)
+}
+
+func TestTypes(t *testing.T) {
+	path := films(t, 100)
+	g, err := loadGraph([]string{path}, nil)
+	require.NoError(t, err)
+	keep, err := sample(g, strategyType, options{nodes: 60, rng: rand.New(rand.NewSource(1))})
+	require.NoError(t, err)
+	byType := make(map[string]int)
+	for n, k := range keep {
+		if k {
+			byType[g.types[g.typ[n]]]++
+		}
+	}
+	// 10% of 100 films, 300 performances and 200 actors.
+	require.Equal(t, map[string]int{"Film": 10, "Performance": 30, "Actor": 20}, byType)
+}
+
+func TestKS(t *testing.T) {
+	require.Equal(t, 0.0, ks([]int{1, 2, 3}, []int{3, 2, 1}))
+	require.Equal(t, 1.0, ks([]int{1, 1}, []int{2, 2, 2}))
+	require.InDelta(t, 0.5, ks([]int{0, 0, 1, 1}, []int{1, 1}), 1e-9)
+	require.Equal(t, 0.0, ks(nil, []int{1}))
+
+	path := films(t, 50)
+	g, err := loadGraph([]string{path}, nil)
+	require.NoError(t, err)
+	all := make([]bool, g.len())
+	for i := range all {
+		all[i] = true
+	}
+	r := compare(g, all)
+	require.Equal(t, r.nodes[0], r.nodes[1])
+	require.Equal(t, r.edges[0], r.edges[1])
+	require.Equal(t, 0.0, r.ksOut)
+	require.Equal(t, 0.0, r.ksIn)
+	require.Equal(t, 0.0, r.ksTotal)
+	var buf bytes.Buffer
+	require.NoError(t, r.write(&buf))
+	require.Contains(t, buf.String(), "KS degree")
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// The sampling strategies.
+const (
+	strategyRandom     = "random"
+	strategyBFS        = "bfs"
+	strategyForestFire = "forestfire"
+	strategyKHop       = "khop"
+	strategyType       = "type"
+)
+
+// options are the parameters of a strategy.
+type options struct {
+	// nodes is the number of nodes to sample. khop takes every node within
+	// hops of the seeds if it is 0.
+	nodes int
+	seeds []int32
+	hops  int
+	// burn is the forest fire forward burning probability.
+	burn float64
+	// outOnly has bfs, forestfire and khop follow edges only forwards.
+	outOnly bool
+	rng     *rand.Rand
+}
+
+// sample picks nodes of g with strategy, and returns whether each node is
+// in the sample.
+func sample(g *graph, strategy string, o options) ([]bool, error) {
+	if o.nodes > g.len() {
+		o.nodes = g.len()
+	}
+	switch strategy {
+	case strategyRandom:
+		return sampleRandom(g, o), nil
+	case strategyBFS:
+		return sampleBFS(g, o), nil
+	case strategyForestFire:
+		if o.burn < 0 || o.burn >= 1 {
+			return nil, fmt.Errorf("the burning probability must be in [0, 1), got %v", o.burn)
+		}
+		return sampleForestFire(g, o), nil
+	case strategyKHop:
+		if len(o.seeds) == 0 {
+			return nil, fmt.Errorf("khop needs seeds")
+		}
+		return sampleKHop(g, o), nil
+	case strategyType:
+		return sampleTypes(g, o), nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q", strategy)
+}
+
+// sampleRandom picks nodes uniformly at random. The sample keeps the edges
+// between them, which for a small sample of a sparse graph are few.
+func sampleRandom(g *graph, o options) []bool {
+	keep := make([]bool, g.len())
+	for _, n := range o.rng.Perm(g.len())[:o.nodes] {
+		keep[n] = true
+	}
+	return keep
+}
+
+// seeder hands out the seeds, then random nodes not yet in the sample, to
+// start traversals from.
+type seeder struct {
+	seeds []int32
+	perm  []int
+	rng   *rand.Rand
+}
+
+func (s *seeder) next(g *graph, keep []bool) (int32, bool) {
+	for len(s.seeds) > 0 {
+		n := s.seeds[0]
+		s.seeds = s.seeds[1:]
+		if !keep[n] {
+			return n, true
+		}
+	}
+	if s.perm == nil {
+		s.perm = s.rng.Perm(g.len())
+	}
+	for len(s.perm) > 0 {
+		n := int32(s.perm[0])
+		s.perm = s.perm[1:]
+		if !keep[n] {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// sampleBFS walks the graph breadth first from the seeds, and from random
+// nodes once the nodes reached from them are exhausted.
+func sampleBFS(g *graph, o options) []bool {
+	keep := make([]bool, g.len())
+	seeds := &seeder{seeds: o.seeds, rng: o.rng}
+	count := 0
+	var queue []int32
+	visit := func(n int32) {
+		if !keep[n] && count < o.nodes {
+			keep[n] = true
+			count++
+			queue = append(queue, n)
+		}
+	}
+	for count < o.nodes {
+		if len(queue) == 0 {
+			s, ok := seeds.next(g, keep)
+			if !ok {
+				break
+			}
+			visit(s)
+			continue
+		}
+		n := queue[0]
+		queue = queue[1:]
+		g.neighbours(n, o.outOnly, visit)
+	}
+	return keep
+}
+
+// sampleForestFire is the forest fire sampling of Leskovec and Faloutsos,
+// "Sampling from Large Graphs". From a seed, every burning node sets fire to
+// a geometrically distributed number of its neighbours not yet burnt, with
+// mean burn/(1-burn), picked at random. When the fire dies out it starts
+// again from a new seed.
+func sampleForestFire(g *graph, o options) []bool {
+	keep := make([]bool, g.len())
+	seeds := &seeder{seeds: o.seeds, rng: o.rng}
+	count := 0
+	var queue, fresh []int32
+	burn := func(n int32) {
+		keep[n] = true
+		count++
+		queue = append(queue, n)
+	}
+	for count < o.nodes {
+		if len(queue) == 0 {
+			s, ok := seeds.next(g, keep)
+			if !ok {
+				break
+			}
+			burn(s)
+			continue
+		}
+		n := queue[0]
+		queue = queue[1:]
+		fresh = fresh[:0]
+		g.neighbours(n, o.outOnly, func(m int32) {
+			if !keep[m] {
+				fresh = append(fresh, m)
+			}
+		})
+		x := 0
+		if o.burn > 0 {
+			x = int(math.Log(1-o.rng.Float64()) / math.Log(o.burn))
+		}
+		for i := 0; i < x && i < len(fresh) && count < o.nodes; i++ {
+			j := i + o.rng.Intn(len(fresh)-i)
+			fresh[i], fresh[j] = fresh[j], fresh[i]
+			// A node listed twice, for two edges, burns once.
+			if !keep[fresh[i]] {
+				burn(fresh[i])
+			}
+		}
+	}
+	return keep
+}
+
+// sampleKHop takes the nodes within o.hops of the seeds, nearest first, up
+// to o.nodes if it is set.
+func sampleKHop(g *graph, o options) []bool {
+	keep := make([]bool, g.len())
+	count := 0
+	full := func() bool { return o.nodes > 0 && count >= o.nodes }
+	var level []int32
+	for _, s := range o.seeds {
+		if !keep[s] && !full() {
+			keep[s] = true
+			count++
+			level = append(level, s)
+		}
+	}
+	for hop := 0; hop < o.hops && len(level) > 0 && !full(); hop++ {
+		var next []int32
+		for _, n := range level {
+			g.neighbours(n, o.outOnly, func(m int32) {
+				if !keep[m] && !full() {
+					keep[m] = true
+					count++
+					next = append(next, m)
+				}
+			})
+		}
+		level = next
+	}
+	return keep
+}
+
+// sampleTypes samples every type, and the nodes without one, at the same
+// rate, so that the sample has the types in the proportions of the graph.
+// Each type keeps at least one node.
+func sampleTypes(g *graph, o options) []bool {
+	keep := make([]bool, g.len())
+	if g.len() == 0 {
+		return keep
+	}
+	strata := make(map[int32][]int32)
+	for n, t := range g.typ {
+		strata[t] = append(strata[t], int32(n))
+	}
+	// Go through the strata in a fixed order, for the seed to give the same
+	// sample every time.
+	var types []int32
+	for t := range strata {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	rate := float64(o.nodes) / float64(g.len())
+	for _, t := range types {
+		nodes := strata[t]
+		k := int(math.Round(rate * float64(len(nodes))))
+		if k == 0 && o.nodes > 0 {
+			k = 1
+		}
+		for _, i := range o.rng.Perm(len(nodes))[:k] {
+			keep[nodes[i]] = true
+		}
+	}
+	return keep
+}
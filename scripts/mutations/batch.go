@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// The modes of the mutations.
+const (
+	modeSet    = "set"
+	modeDelete = "delete"
+	modeUpsert = "upsert"
+	modeCond   = "cond"
+)
+
+// builder turns batches of N-Quads into mutation bodies for /mutate.
+//
+// set and delete send the N-Quads as they are. With a key predicate, which
+// should be an @upsert predicate such as xid, upsert sends an upsert block
+// that looks up every node of the batch with a key by it, so that existing
+// nodes are updated rather than created again, and delete deletes from the
+// nodes found that way. cond is upsert with the mutation of each node
+// guarded by cond, by default only creating the nodes that don't exist.
+type builder struct {
+	mode string
+	key  string
+	// keys maps node ids to their key value.
+	keys map[string]string
+	// cond is the condition of the mutation of a node in cond mode, with %s
+	// for the variable holding the node.
+	cond string
+}
+
+// op is the mutation operation of the mode.
+func (b *builder) op() string {
+	if b.mode == modeDelete {
+		return "delete"
+	}
+	return "set"
+}
+
+// keyed reports whether batches are sent as upsert blocks.
+func (b *builder) keyed() bool {
+	return b.key != "" && b.mode != modeSet
+}
+
+func (b *builder) body(batch []nquad.NQuad) string {
+	var sb strings.Builder
+	if !b.keyed() {
+		fmt.Fprintf(&sb, "{\n  %s {\n", b.op())
+		for _, nq := range batch {
+			sb.WriteString("    " + nq.String() + "\n")
+		}
+		sb.WriteString("  }\n}\n")
+		return sb.String()
+	}
+
+	// The variable of each node with a key, in order of appearance.
+	vars := make(map[string]string)
+	var order []string
+	ref := func(id string) string {
+		if _, ok := b.keys[id]; !ok {
+			return id
+		}
+		v, ok := vars[id]
+		if !ok {
+			v = fmt.Sprintf("u%d", len(vars))
+			vars[id] = v
+			order = append(order, id)
+		}
+		return "uid(" + v + ")"
+	}
+	// The N-Quads of each node with a key, and of the rest.
+	byNode := make(map[string][]string)
+	var rest []string
+	for _, nq := range batch {
+		s := nq.Subject
+		if k, ok := b.keys[s]; ok && b.op() == "set" && nq.Predicate == b.key && nq.ObjectValue == k {
+			// Added below, for every node of the batch.
+			ref(s)
+			continue
+		}
+		nq.Subject = ref(nq.Subject)
+		if nq.IsEdge() {
+			nq.ObjectId = ref(nq.ObjectId)
+		}
+		if _, ok := b.keys[s]; ok {
+			byNode[s] = append(byNode[s], nq.String())
+		} else {
+			rest = append(rest, nq.String())
+		}
+	}
+	if b.op() == "set" {
+		// New nodes get their key, wherever the data has it.
+		for _, id := range order {
+			kq := nquad.NQuad{Subject: "uid(" + vars[id] + ")", Predicate: b.key, ObjectValue: b.keys[id]}
+			byNode[id] = append([]string{kq.String()}, byNode[id]...)
+		}
+	}
+
+	sb.WriteString("upsert {\n  query {\n")
+	for _, id := range order {
+		fmt.Fprintf(&sb, "    %s as var(func: eq(%s, %s))\n", vars[id], b.key, nquad.Quote(b.keys[id]))
+	}
+	sb.WriteString("  }\n")
+	block := func(cond string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		sb.WriteString("  mutation")
+		if cond != "" {
+			sb.WriteString(" @if(" + cond + ")")
+		}
+		fmt.Fprintf(&sb, " {\n    %s {\n", b.op())
+		for _, l := range lines {
+			sb.WriteString("      " + l + "\n")
+		}
+		sb.WriteString("    }\n  }\n")
+	}
+	if b.mode == modeCond {
+		for _, id := range order {
+			block(fmt.Sprintf(b.cond, vars[id]), byNode[id])
+		}
+	} else {
+		var all []string
+		for _, id := range order {
+			all = append(all, byNode[id]...)
+		}
+		block("", all)
+	}
+	block("", rest)
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// readKeys reads the key value of every node from the files. Nodes with
+// more than one keep the first.
+func readKeys(files []string, key string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, path := range files {
+		err := nquad.Each(path, func(nq nquad.NQuad) error {
+			if nq.Predicate != key || nq.IsEdge() {
+				return nil
+			}
+			if _, ok := keys[nq.Subject]; !ok {
+				keys[nq.Subject] = nq.ObjectValue
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The classes of errors. Aborted transactions and transient failures, such
+// as a 503 or a dropped connection, are retried; the rest are not.
+const (
+	classAborted   = "aborted"
+	classTransient = "transient"
+	classOther     = "other"
+)
+
+// mutationError is a failed mutation with its class.
+type mutationError struct {
+	class string
+	msg   string
+}
+
+func (e *mutationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.class, e.msg)
+}
+
+// classOf returns the class of an error returned by client.send.
+func classOf(err error) string {
+	if me, ok := err.(*mutationError); ok {
+		return me.class
+	}
+	return classOther
+}
+
+type response struct {
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// budget limits the retries of a run to a share of its requests, so that a
+// struggling cluster isn't flooded with retries. The first min retries are
+// always allowed.
+type budget struct {
+	ratio    float64
+	min      int64
+	requests int64
+	retries  int64
+}
+
+func (b *budget) request() {
+	atomic.AddInt64(&b.requests, 1)
+}
+
+// take reports whether a retry is allowed, and counts it if so.
+func (b *budget) take() bool {
+	for {
+		r := atomic.LoadInt64(&b.retries)
+		if b.ratio >= 0 && float64(r) >= float64(b.min)+b.ratio*float64(atomic.LoadInt64(&b.requests)) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.retries, r, r+1) {
+			return true
+		}
+	}
+}
+
+// client sends mutations to an alpha, retrying aborts and transient
+// failures with exponential backoff.
+type client struct {
+	url        string
+	http       *http.Client
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	budget     *budget
+	stats      *stats
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newClient(alpha string, stats *stats) *client {
+	return &client{
+		url:        strings.TrimSuffix(strings.TrimSuffix(alpha, "/"), "/query") + "/mutate?commitNow=true",
+		http:       &http.Client{Timeout: time.Minute},
+		retries:    10,
+		backoff:    10 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+		budget:     &budget{ratio: 0.2, min: 10},
+		stats:      stats,
+		rnd:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// send posts one mutation body.
+func (c *client) send(ctx context.Context, body string) error {
+	req, err := http.NewRequest("POST", c.url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/rdf")
+	res, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &mutationError{classTransient, err.Error()}
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return &mutationError{classTransient, err.Error()}
+	}
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return &mutationError{classTransient, fmt.Sprintf("%s: %s", res.Status, bytes.TrimSpace(b))}
+	case res.StatusCode != http.StatusOK:
+		return &mutationError{classOther, fmt.Sprintf("%s: %s", res.Status, bytes.TrimSpace(b))}
+	}
+	var r response
+	if err := json.Unmarshal(b, &r); err != nil {
+		return &mutationError{classOther, fmt.Sprintf("while parsing response: %v", err)}
+	}
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	e := r.Errors[0]
+	if e.Extensions.Code == "ErrorAborted" || strings.Contains(e.Message, "Transaction has been aborted") {
+		return &mutationError{classAborted, e.Message}
+	}
+	return &mutationError{classOther, e.Message}
+}
+
+// wait returns the backoff before retry attempt, doubling from c.backoff up
+// to c.maxBackoff, with up to half of it random so that workers that were
+// aborted together don't retry together.
+func (c *client) wait(attempt int) time.Duration {
+	d := c.backoff
+	for i := 0; i < attempt && d < c.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	c.mu.Lock()
+	j := time.Duration(c.rnd.Int63n(int64(d)/2 + 1))
+	c.mu.Unlock()
+	return d/2 + j
+}
+
+// mutate sends a batch of n N-Quads, retrying as long as the error class,
+// the retries of the batch and the budget of the run allow.
+func (c *client) mutate(ctx context.Context, body string, n int) error {
+	for attempt := 0; ; attempt++ {
+		c.budget.request()
+		err := c.send(ctx, body)
+		c.stats.attempt(err)
+		if err == nil {
+			c.stats.done(n)
+			return nil
+		}
+		class := classOf(err)
+		switch {
+		case class == classOther, ctx.Err() != nil:
+			return err
+		case attempt >= c.retries:
+			return fmt.Errorf("giving up after %d retries: %v", attempt, err)
+		case !c.budget.take():
+			return fmt.Errorf("retry budget used up: %v", err)
+		}
+		c.stats.retry()
+		select {
+		case <-time.After(c.wait(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
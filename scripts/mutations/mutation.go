@@ -1,142 +1,264 @@
-// This script is used to load data into Dgraph from an RDF file by performing
-// mutations using the HTTP interface.
+// This script loads RDF or JSON data into Dgraph with mutations over the
+// HTTP interface, and measures the throughput and abort rate of mutation
+// workloads. Batches are sent to /mutate with commitNow as plain set or
+// delete mutations, as upsert blocks keyed on an @upsert predicate, or as
+// conditional upserts that only create missing nodes.
 //
 // You can run the script like
-// go build . && ./mutations --rdf $GOPATH/src/github.com/dgraph-io/benchmarks/data/names.gz --concurrent 100
+//
+//	go build . && ./mutations -r ../../data/21million.rdf.gz -c 100
+//	./mutations -r ../../data/1million.rdf.gz -mode upsert -key xid
+//	./mutations -r deletes.rdf -mode delete
+//
+// Aborted transactions and transient failures are retried with exponential
+// backoff, up to -retries times per batch and -retry-budget of the requests
+// of the run. Any other error stops the run.
+//
+// The position in the input after the last batch acknowledged, together
+// with every batch before it, is recorded in -checkpoint. A load that died
+// continues from there with -resume:
+//
+//	./mutations -r ../../data/1million.rdf.gz -mode upsert -key xid -resume
+//
+// The batches that were in flight are sent again, which upsert mode makes
+// safe.
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"compress/gzip"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
-	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
-	"github.com/dgraph-io/dgraph/x"
+	"github.com/dgraph-io/benchmarks/checkpoint"
+	"github.com/dgraph-io/benchmarks/nquad"
 )
 
 var (
-	file       = flag.String("r", "", "Location of rdf file to load")
-	dgraph     = flag.String("d", "http://127.0.0.1:8080/query", "Dgraph server address")
-	concurrent = flag.Int("c", 500, "Number of concurrent requests to make to Dgraph")
-	numRdf     = flag.Int("m", 100, "Number of RDF N-Quads to send as part of a mutation.")
+	file        = flag.String("r", "", "Location of the RDF or JSON file to load, plain or gzipped.")
+	dgraph      = flag.String("d", "http://127.0.0.1:8080", "Dgraph server address")
+	concurrent  = flag.Int("c", 500, "Number of concurrent requests to make to Dgraph")
+	numRdf      = flag.Int("m", 100, "Number of RDF N-Quads to send as part of a mutation.")
+	mode        = flag.String("mode", modeSet, "Mutations to run: set, delete, upsert or cond.")
+	key         = flag.String("key", "", "@upsert predicate identifying nodes, for upsert and cond, and optionally delete.")
+	cond        = flag.String("cond", "eq(len(%s), 0)", "Condition of the mutation of each node in cond mode, with %s for the variable of the node.")
+	retries     = flag.Int("retries", 10, "Times to retry a batch after an abort or a transient failure.")
+	backoff     = flag.Duration("backoff", 10*time.Millisecond, "Wait before the first retry. It doubles after every retry.")
+	maxBackoff  = flag.Duration("max-backoff", 5*time.Second, "Longest wait between retries.")
+	retryBudget = flag.Float64("retry-budget", 0.2, "Retries allowed as a share of the requests of the run, after the first 10. Negative means no limit.")
+	interval    = flag.Duration("interval", 10*time.Second, "How often to print progress.")
+	cpFile      = flag.String("checkpoint", "mutations.checkpoint", "File to record the position of the load in, every 1000 acknowledged batches or every second. Empty for none.")
+	resume      = flag.Bool("resume", false, "Resume from the -checkpoint file, if there is one.")
 )
 
-func body(rdf string) string {
-	return fmt.Sprintf("mutation { set { %s } }", rdf)
+// config is what a run needs, from the flags.
+type config struct {
+	files      []string
+	batch      int
+	concurrent int
+	builder    *builder
+	// start is the checkpoint to resume from, or nil, and tracker records
+	// new ones, if set.
+	start   *checkpoint.Checkpoint
+	tracker *checkpoint.Tracker
 }
 
-type response struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+// batch is a batch of N-Quads with its place in the input.
+type batch struct {
+	seq    uint64
+	nquads []nquad.NQuad
+	// file is the file the batch is from, offset the uncompressed bytes of
+	// it read up to the end of the batch and read the N-Quads.
+	file   string
+	offset int64
+	read   int64
 }
 
-var hc http.Client
-var r response
-
-func makeRequest(mutation chan string, c *uint64, wg *sync.WaitGroup) {
-	var counter uint64
-	for m := range mutation {
-		counter = atomic.AddUint64(c, 1)
-		if counter%100 == 0 {
-			fmt.Printf("Request: %v\n", counter)
-		}
-	RETRY:
-		req, err := http.NewRequest("POST", *dgraph, strings.NewReader(body(m)))
-		x.Check(err)
-		res, err := hc.Do(req)
+// read sends the N-Quads of the files to out in batches, from the
+// checkpoint start if it is set. Batches don't span files.
+func read(ctx context.Context, files []string, size int, start *checkpoint.Checkpoint, out chan<- batch) error {
+	defer close(out)
+	files, err := start.Files(files)
+	if err != nil {
+		return err
+	}
+	var seq uint64
+	if start != nil {
+		seq = start.Seq
+	}
+	for i, path := range files {
+		r, err := nquad.Open(path)
 		if err != nil {
-			fmt.Printf("Retrying req: %d. Error: %v\n", counter, err)
-			time.Sleep(5 * time.Millisecond)
-			goto RETRY
+			return err
 		}
-
-		body, err := ioutil.ReadAll(res.Body)
-		x.Check(err)
-		x.Check(json.Unmarshal(body, &r))
-		if r.Code != "ErrorOk" {
-			log.Fatalf("Error while performing mutation: %v, err: %v", m, r.Message)
+		var read int64
+		if i == 0 && start != nil {
+			if err := start.Skip(r); err != nil {
+				r.Close()
+				return fmt.Errorf("while resuming %s: %v", path, err)
+			}
+			read = start.NQuads
+		}
+		b := batch{file: path}
+		send := func() bool {
+			seq++
+			b.seq, b.offset, b.read = seq, r.Offset(), read
+			select {
+			case out <- b:
+				b = batch{file: path, nquads: make([]nquad.NQuad, 0, size)}
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			nq, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				r.Close()
+				return fmt.Errorf("%s:%d: %v", path, r.Line(), err)
+			}
+			read++
+			b.nquads = append(b.nquads, nq)
+			if len(b.nquads) == size && !send() {
+				r.Close()
+				return ctx.Err()
+			}
 		}
+		if len(b.nquads) > 0 && !send() {
+			r.Close()
+			return ctx.Err()
+		}
+		r.Close()
 	}
-	wg.Done()
+	return nil
 }
 
-// Reads a single line from a buffered reader. The line is read into the
-// passed in buffer to minimize allocations. This is the preferred
-// method for loading long lines which could be longer than the buffer
-// size of bufio.Scanner.
-func readLine(r *bufio.Reader, buf *bytes.Buffer) error {
-	isPrefix := true
-	var err error
-	for isPrefix && err == nil {
-		var line []byte
-		// The returned line is an internal buffer in bufio and is only
-		// valid until the next call to ReadLine. It needs to be copied
-		// over to our own buffer.
-		line, isPrefix, err = r.ReadLine()
-		if err == nil {
-			buf.Write(line)
+// run sends the batches with cfg.concurrent workers until the files are
+// done or a batch fails. Acknowledged batches are passed to cfg.tracker.
+func run(ctx context.Context, cfg config, c *client) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	batches := make(chan batch, 3*cfg.concurrent)
+
+	var once sync.Once
+	var first error
+	fail := func(err error) {
+		once.Do(func() {
+			first = err
+			cancel()
+		})
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := c.mutate(ctx, cfg.builder.body(b.nquads), len(b.nquads)); err != nil {
+					fail(err)
+					continue
+				}
+				if cfg.tracker == nil {
+					continue
+				}
+				if err := cfg.tracker.Ack(b.seq, b.file, b.offset, b.read); err != nil {
+					fail(fmt.Errorf("while saving the checkpoint: %v", err))
+				}
+			}
+		}()
+	}
+	if err := read(ctx, cfg.files, cfg.batch, cfg.start, batches); err != nil && ctx.Err() == nil {
+		fail(err)
+	}
+	wg.Wait()
+	if cfg.tracker != nil {
+		if err := cfg.tracker.Flush(); err != nil {
+			fail(fmt.Errorf("while saving the checkpoint: %v", err))
 		}
 	}
-	return err
+	return first
 }
 
 func main() {
 	flag.Parse()
-	f, err := os.Open(*file)
-	x.Check(err)
-	defer f.Close()
-	gr, err := gzip.NewReader(f)
-	x.Check(err)
-
-	hc = http.Client{Timeout: time.Minute}
-	mutation := make(chan string, 3*(*concurrent))
-
-	var count uint64 = 0
-	var wg sync.WaitGroup
-	for i := 0; i < *concurrent; i++ {
-		wg.Add(1)
-		go makeRequest(mutation, &count, &wg)
+	files := flag.Args()
+	if *file != "" {
+		files = append([]string{*file}, files...)
 	}
-
-	var buf bytes.Buffer
-	bufReader := bufio.NewReader(gr)
-	num := 0
-	var rdfCount uint64 = 0
-	for {
-		err = readLine(bufReader, &buf)
-		if err != nil {
-			break
+	if len(files) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	b := &builder{mode: *mode, key: *key, cond: *cond}
+	switch *mode {
+	case modeSet, modeDelete:
+	case modeUpsert, modeCond:
+		if *key == "" {
+			log.Fatalf("-mode %s needs -key", *mode)
 		}
-		buf.WriteRune('\n')
-
-		if num >= *numRdf {
-			mutation <- buf.String()
-			buf.Reset()
-			num = 0
+	default:
+		log.Fatalf("Unknown -mode %q, want set, delete, upsert or cond", *mode)
+	}
+	if b.keyed() {
+		var err error
+		if b.keys, err = readKeys(files, *key); err != nil {
+			log.Fatal(err)
 		}
-		rdfCount++
-		num++
+		log.Printf("Read the %s of %d nodes", *key, len(b.keys))
 	}
-	if err != io.EOF {
-		log.Fatalf("Error while reading file: %+v", err)
+
+	cfg := config{files: files, batch: *numRdf, concurrent: *concurrent, builder: b}
+	if *resume {
+		cp, err := checkpoint.Load(*cpFile)
+		switch {
+		case os.IsNotExist(err):
+			log.Printf("No checkpoint in %s, starting from the beginning", *cpFile)
+		case err != nil:
+			log.Fatal(err)
+		default:
+			log.Printf("Resuming after batch %d, at byte %d of %s", cp.Seq, cp.Offset, cp.File)
+			cfg.start = cp
+		}
+		if !b.keyed() && *mode == modeSet {
+			log.Printf("The batches in flight when the load stopped are sent again. Use -mode upsert for them not to create duplicate nodes.")
+		}
 	}
-	if buf.Len() > 0 {
-		mutation <- buf.String()
+	if *cpFile != "" {
+		cfg.tracker = checkpoint.NewTracker(*cpFile, cfg.start)
 	}
-	close(mutation)
 
-	wg.Wait()
-	fmt.Println("Number of RDF's parsed: ", rdfCount)
-	fmt.Println("Number of mutations run: ", count)
+	st := newStats()
+	c := newClient(*dgraph, st)
+	c.retries, c.backoff, c.maxBackoff = *retries, *backoff, *maxBackoff
+	c.budget.ratio = *retryBudget
+
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(*interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				log.Println(st)
+			case <-done:
+				return
+			}
+		}
+	}()
+	err := run(context.Background(), cfg, c)
+	close(done)
+	fmt.Println(st)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
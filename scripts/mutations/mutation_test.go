@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/checkpoint"
+	"github.com/dgraph-io/benchmarks/mockdgraph"
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+const people = `_:a <xid> "alice" .
+_:a <name> "Alice" .
+_:a <friend> _:b .
+_:b <xid> "bob" .
+_:b <name> "Bob" .
+_:c <name> "Carol" .
+_:c <friend> _:a .
+`
+
+func parse(t *testing.T, rdf string) []nquad.NQuad {
+	var out []nquad.NQuad
+	for _, l := range strings.Split(strings.TrimSpace(rdf), "\n") {
+		nq, err := nquad.Parse(l)
+		require.NoError(t, err)
+		out = append(out, nq)
+	}
+	return out
+}
+
+func TestBody(t *testing.T) {
+	nqs := parse(t, people)
+	b := &builder{mode: modeDelete}
+	require.True(t, strings.HasPrefix(b.body(nqs), "{\n  delete {\n    _:a <xid> \"alice\" .\n"))
+
+	keys := map[string]string{"_:a": "alice", "_:b": "bob"}
+	b = &builder{mode: modeUpsert, key: "xid", keys: keys}
+	require.Equal(t, `upsert {
+  query {
+    u0 as var(func: eq(xid, "alice"))
+    u1 as var(func: eq(xid, "bob"))
+  }
+  mutation {
+    set {
+      uid(u0) <xid> "alice" .
+      uid(u0) <name> "Alice" .
+      uid(u0) <friend> uid(u1) .
+      uid(u1) <xid> "bob" .
+      uid(u1) <name> "Bob" .
+    }
+  }
+  mutation {
+    set {
+      _:c <name> "Carol" .
+      _:c <friend> uid(u0) .
+    }
+  }
+}
+`, b.body(nqs))
+
+	b = &builder{mode: modeCond, key: "xid", keys: keys, cond: "eq(len(%s), 0)"}
+	body := b.body(nqs[3:5])
+	require.Contains(t, body, "  mutation @if(eq(len(u0), 0)) {\n    set {\n      uid(u0) <xid> \"bob\" .\n")
+	require.NotContains(t, body, "alice")
+
+	// Deletes don't add the key.
+	b = &builder{mode: modeDelete, key: "xid", keys: keys}
+	body = b.body(nqs[1:2])
+	require.Contains(t, body, "    delete {\n      uid(u0) <name> \"Alice\" .\n    }\n")
+	require.NotContains(t, body, "<xid>")
+}
+
+func writeRDF(t *testing.T, rdf string) string {
+	path := filepath.Join(t.TempDir(), "data.rdf")
+	require.NoError(t, ioutil.WriteFile(path, []byte(rdf), 0644))
+	return path
+}
+
+func testClient(url string) *client {
+	c := newClient(url, newStats())
+	c.backoff, c.maxBackoff = 0, 0
+	return c
+}
+
+func TestRunAborts(t *testing.T) {
+	s := mockdgraph.New(mockdgraph.Config{AbortRate: 0.5, Seed: 1})
+	s.Start()
+	defer s.Close()
+
+	c := testClient(s.URL)
+	c.retries, c.budget.ratio = 50, -1
+	cfg := config{files: []string{writeRDF(t, people)}, batch: 2, concurrent: 2, builder: &builder{mode: modeSet}}
+	require.NoError(t, run(context.Background(), cfg, c))
+
+	require.Equal(t, int64(7), c.stats.nquads)
+	require.Equal(t, int64(4), c.stats.batches)
+	require.True(t, c.stats.aborts > 0)
+	require.Equal(t, c.stats.attempts, c.stats.batches+c.stats.retries)
+	require.Equal(t, int(c.stats.attempts), len(s.Requests()))
+	require.Equal(t, float64(c.stats.aborts)/float64(c.stats.attempts), c.stats.AbortRate())
+	for _, r := range s.Requests() {
+		require.Equal(t, "/mutate", r.Path)
+		require.Equal(t, "true", r.Params.Get("commitNow"))
+		require.Equal(t, "application/rdf", r.ContentType)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	// Other errors aren't retried.
+	s := mockdgraph.New(mockdgraph.Config{})
+	s.Start()
+	defer s.Close()
+	b := &builder{mode: modeSet}
+	nqs := parse(t, people)
+	s.Fail("/mutate", b.body(nqs), "syntax error")
+	c := testClient(s.URL)
+	cfg := config{files: []string{writeRDF(t, people)}, batch: 100, concurrent: 1, builder: b}
+	err := run(context.Background(), cfg, c)
+	require.Error(t, err)
+	require.Equal(t, classOther, classOf(err))
+	require.Len(t, s.Requests(), 1)
+
+	// Retries stop when the budget is used up.
+	aborts := mockdgraph.New(mockdgraph.Config{AbortRate: 1, Seed: 1})
+	aborts.Start()
+	defer aborts.Close()
+	c = testClient(aborts.URL)
+	c.budget.ratio, c.budget.min = 0, 3
+	err = run(context.Background(), cfg, c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "retry budget used up")
+	require.Len(t, aborts.Requests(), 4)
+	require.Equal(t, int64(4), c.stats.aborts)
+	require.Equal(t, 1.0, c.stats.AbortRate())
+
+	// And after the retries of the batch.
+	aborts.Reset()
+	c = testClient(aborts.URL)
+	c.retries = 2
+	err = run(context.Background(), cfg, c)
+	require.Contains(t, err.Error(), "giving up after 2 retries")
+	require.Len(t, aborts.Requests(), 3)
+}
+
+func TestTransient(t *testing.T) {
+	s := mockdgraph.New(mockdgraph.Config{HTTPErrorRate: 0.5, Seed: 2})
+	s.Start()
+	defer s.Close()
+	c := testClient(s.URL)
+	c.retries, c.budget.ratio = 50, -1
+	cfg := config{files: []string{writeRDF(t, people)}, batch: 1, concurrent: 3, builder: &builder{mode: modeSet}}
+	require.NoError(t, run(context.Background(), cfg, c))
+	require.Equal(t, int64(7), c.stats.batches)
+	require.True(t, c.stats.transient > 0)
+	require.Equal(t, int64(0), c.stats.aborts)
+}
+
+func TestResume(t *testing.T) {
+	data := writeRDF(t, people)
+	cpFile := filepath.Join(t.TempDir(), "mutations.checkpoint")
+	b := &builder{mode: modeSet}
+	nqs := parse(t, people)
+
+	// The third batch fails, so the checkpoint is after the second.
+	s := mockdgraph.New(mockdgraph.Config{})
+	s.Start()
+	defer s.Close()
+	s.Fail("/mutate", b.body(nqs[4:6]), "syntax error")
+	cfg := config{files: []string{data}, batch: 2, concurrent: 1, builder: b,
+		tracker: checkpoint.NewTracker(cpFile, nil)}
+	require.Error(t, run(context.Background(), cfg, testClient(s.URL)))
+	require.Len(t, s.Requests(), 3)
+	cp, err := checkpoint.Load(cpFile)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), cp.Seq)
+	require.Equal(t, int64(4), cp.NQuads)
+	require.Equal(t, data, cp.File)
+
+	// Resuming sends the rest.
+	s2 := mockdgraph.New(mockdgraph.Config{})
+	s2.Start()
+	defer s2.Close()
+	cfg.start, cfg.tracker = cp, checkpoint.NewTracker(cpFile, cp)
+	c := testClient(s2.URL)
+	require.NoError(t, run(context.Background(), cfg, c))
+	reqs := s2.Requests()
+	require.Len(t, reqs, 2)
+	require.Equal(t, b.body(nqs[4:6]), reqs[0].Body)
+	require.Equal(t, b.body(nqs[6:]), reqs[1].Body)
+	require.Equal(t, int64(3), c.stats.nquads)
+	cp, err = checkpoint.Load(cpFile)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), cp.Seq)
+	require.Equal(t, int64(7), cp.NQuads)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// stats counts the work of a run. It is updated by all workers.
+type stats struct {
+	start time.Time
+
+	nquads    int64
+	batches   int64
+	attempts  int64
+	aborts    int64
+	transient int64
+	retries   int64
+}
+
+func newStats() *stats {
+	return &stats{start: time.Now()}
+}
+
+// attempt counts a request and the class of its error, if any.
+func (s *stats) attempt(err error) {
+	atomic.AddInt64(&s.attempts, 1)
+	if err == nil {
+		return
+	}
+	switch classOf(err) {
+	case classAborted:
+		atomic.AddInt64(&s.aborts, 1)
+	case classTransient:
+		atomic.AddInt64(&s.transient, 1)
+	}
+}
+
+func (s *stats) retry() {
+	atomic.AddInt64(&s.retries, 1)
+}
+
+// done counts a batch of n N-Quads that was committed.
+func (s *stats) done(n int) {
+	atomic.AddInt64(&s.batches, 1)
+	atomic.AddInt64(&s.nquads, int64(n))
+}
+
+// Rate is the number of N-Quads committed per second so far.
+func (s *stats) Rate() float64 {
+	secs := time.Since(s.start).Seconds()
+	if secs == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&s.nquads)) / secs
+}
+
+// AbortRate is the share of requests that were aborted.
+func (s *stats) AbortRate() float64 {
+	a := atomic.LoadInt64(&s.attempts)
+	if a == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&s.aborts)) / float64(a)
+}
+
+func (s *stats) String() string {
+	return fmt.Sprintf("%d N-Quads in %d batches, %.0f N-Quads/s, %d requests, %d aborted (%.1f%%), %d transient failures, %d retries",
+		atomic.LoadInt64(&s.nquads), atomic.LoadInt64(&s.batches), s.Rate(),
+		atomic.LoadInt64(&s.attempts), atomic.LoadInt64(&s.aborts), 100*s.AbortRate(),
+		atomic.LoadInt64(&s.transient), atomic.LoadInt64(&s.retries))
+}
@@ -0,0 +1,263 @@
+// This tool streams the N-Quads of RDF or JSON data sets, plain or gzipped,
+// through a pipeline of stages and writes them out as RDF. It replaces the
+// scripts that listed and renamed the types of 21million.rdf.gz:
+//
+//	# The types, with the number of nodes of each.
+//	go run . --report types ../../data/21million.rdf.gz
+//	# The predicates of the nodes of each type, or of one with --type.
+//	go run . --report preds --type Film ../../data/21million.rdf.gz
+//	# Rename the types.
+//	go run . --strict --stage rename-type:@21million-types.tsv \
+//		--out 21million-new.rdf.gz ../../data/21million.rdf.gz
+//
+// Stages are given with --stage, in order, e.g.
+//
+//	--stage drop-pred:starring --stage add-type:director.film=Director
+//
+// Run with -h for all of them. Reports are of the transformed data.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, " ") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+var (
+	stages   stringList
+	out      = flag.String("out", "", "Output RDF file, gzipped if it ends in .gz, or - for stdout.")
+	strict   = flag.Bool("strict", false, "Fail on types and values missing from the mappings of rename-type and map-values.")
+	report   = flag.String("report", "", "Report on the output: types, or preds per type.")
+	typeName = flag.String("type", "", "Limit --report preds to this type.")
+)
+
+func init() {
+	flag.Var(&stages, "stage", "Stage to apply, as name:argument. Can be repeated.")
+}
+
+// typeReport counts the nodes of each type and the predicates they have.
+type typeReport struct {
+	types map[uint64][]string
+	preds map[uint64]map[string]bool
+}
+
+func newTypeReport() *typeReport {
+	return &typeReport{
+		types: make(map[uint64][]string),
+		preds: make(map[uint64]map[string]bool),
+	}
+}
+
+func (r *typeReport) add(nq nquad.NQuad, withPreds bool) {
+	s := nquad.Fingerprint(nq.Subject)
+	if nq.Predicate == typePred {
+		r.types[s] = append(r.types[s], nq.ObjectValue)
+	}
+	if !withPreds {
+		return
+	}
+	if r.preds[s] == nil {
+		r.preds[s] = make(map[string]bool)
+	}
+	r.preds[s][nq.Predicate] = true
+}
+
+// counts returns the number of nodes of each type.
+func (r *typeReport) counts() map[string]int {
+	out := make(map[string]int)
+	for _, ts := range r.types {
+		for _, t := range ts {
+			out[t]++
+		}
+	}
+	return out
+}
+
+// predsOf returns the predicates of the nodes of each type, sorted.
+func (r *typeReport) predsOf() map[string][]string {
+	sets := make(map[string]map[string]bool)
+	for s, ts := range r.types {
+		for _, t := range ts {
+			if sets[t] == nil {
+				sets[t] = make(map[string]bool)
+			}
+			for p := range r.preds[s] {
+				sets[t][p] = true
+			}
+		}
+	}
+	out := make(map[string][]string)
+	for t, set := range sets {
+		for p := range set {
+			out[t] = append(out[t], p)
+		}
+		sort.Strings(out[t])
+	}
+	return out
+}
+
+func sortedKeys(m map[string]int) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (r *typeReport) print(w io.Writer, kind, only string) {
+	counts := r.counts()
+	switch kind {
+	case "types":
+		for _, t := range sortedKeys(counts) {
+			fmt.Fprintf(w, "%s\t%d\n", t, counts[t])
+		}
+	case "preds":
+		preds := r.predsOf()
+		for _, t := range sortedKeys(counts) {
+			if only != "" && t != only {
+				continue
+			}
+			fmt.Fprintf(w, "%s\n", t)
+			for _, p := range preds[t] {
+				fmt.Fprintf(w, "\t%s\n", p)
+			}
+		}
+	}
+}
+
+// output opens the output file, gzipped by its name.
+func output(path string) (io.Writer, func() error, error) {
+	if path == "-" {
+		w := bufio.NewWriter(os.Stdout)
+		return w, w.Flush, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := bufio.NewWriterSize(f, 1<<20)
+	if !strings.HasSuffix(path, ".gz") {
+		return w, func() error {
+			if err := w.Flush(); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		}, nil
+	}
+	gz := gzip.NewWriter(w)
+	return gz, func() error {
+		for _, c := range []func() error{gz.Close, w.Flush, f.Close} {
+			if err := c(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// transform runs the N-Quads of the files through p into sink.
+func transform(files []string, p *Pipeline, sink emitFunc) (int, error) {
+	n := 0
+	for _, path := range files {
+		r, err := nquad.Open(path)
+		if err != nil {
+			return n, err
+		}
+		for {
+			nq, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				r.Close()
+				return n, fmt.Errorf("%s:%d: %v", path, r.Line(), err)
+			}
+			n++
+			if err := p.Run(nq, sink); err != nil {
+				r.Close()
+				return n, fmt.Errorf("%s:%d: %v", path, r.Line(), err)
+			}
+		}
+		r.Close()
+	}
+	return n, nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: transform [flags] file...\n")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, stageHelp)
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || (*out == "" && *report == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *report != "" && *report != "types" && *report != "preds" {
+		log.Fatalf("Unknown --report %q, want types or preds", *report)
+	}
+
+	p := &Pipeline{}
+	for _, spec := range stages {
+		s, err := parseStage(spec, *strict)
+		if err != nil {
+			log.Fatal(err)
+		}
+		p.Add(s)
+	}
+
+	var w io.Writer
+	closeOut := func() error { return nil }
+	if *out != "" {
+		var err error
+		if w, closeOut, err = output(*out); err != nil {
+			log.Fatal(err)
+		}
+	}
+	rep := newTypeReport()
+	written := 0
+	sink := func(nq nquad.NQuad) error {
+		if *report != "" {
+			rep.add(nq, *report == "preds")
+		}
+		if w == nil {
+			return nil
+		}
+		written++
+		_, err := fmt.Fprintln(w, nq)
+		return err
+	}
+	read, err := transform(flag.Args(), p, sink)
+	if err == nil {
+		err = closeOut()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *out != "" {
+		log.Printf("Read %d N-Quads, wrote %d to %s", read, written, *out)
+	}
+	if *report != "" {
+		rep.print(os.Stdout, *report, *typeName)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// typePred is the predicate holding the types of a node.
+const typePred = "dgraph.type"
+
+// emitFunc passes an N-Quad on to the next stage.
+type emitFunc func(nquad.NQuad) error
+
+// Stage transforms N-Quads. It may drop an N-Quad, change it, or emit more.
+type Stage interface {
+	Apply(nq nquad.NQuad, emit emitFunc) error
+}
+
+// stageFunc adapts a function to a Stage.
+type stageFunc func(nq nquad.NQuad, emit emitFunc) error
+
+func (f stageFunc) Apply(nq nquad.NQuad, emit emitFunc) error {
+	return f(nq, emit)
+}
+
+// Pipeline runs N-Quads through stages in order.
+type Pipeline struct {
+	stages []Stage
+}
+
+// Add appends a stage.
+func (p *Pipeline) Add(s Stage) {
+	p.stages = append(p.stages, s)
+}
+
+// Run passes nq through the stages and the N-Quads that come out to sink.
+func (p *Pipeline) Run(nq nquad.NQuad, sink emitFunc) error {
+	return p.run(0, nq, sink)
+}
+
+func (p *Pipeline) run(i int, nq nquad.NQuad, sink emitFunc) error {
+	if i == len(p.stages) {
+		return sink(nq)
+	}
+	return p.stages[i].Apply(nq, func(out nquad.NQuad) error {
+		return p.run(i+1, out, sink)
+	})
+}
+
+// readPairs reads a mapping of old to new values: either inline, as
+// old=new,old=new, or from a file given as @path with one old<TAB>new pair per
+// line. Blank lines and lines starting with # are skipped.
+func readPairs(arg string) (map[string]string, error) {
+	m := make(map[string]string)
+	if !strings.HasPrefix(arg, "@") {
+		for _, kv := range strings.Split(arg, ",") {
+			i := strings.Index(kv, "=")
+			if i <= 0 {
+				return nil, fmt.Errorf("expected old=new, got %q", kv)
+			}
+			m[kv[:i]] = kv[i+1:]
+		}
+		return m, nil
+	}
+	err := readLines(arg[1:], func(no int, line string) error {
+		kv := strings.SplitN(line, "\t", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("%s:%d: expected old<TAB>new", arg[1:], no)
+		}
+		m[kv[0]] = kv[1]
+		return nil
+	})
+	return m, err
+}
+
+// readSet reads node ids, inline as a,b,c or one per line from @path. Angle
+// brackets are optional.
+func readSet(arg string) (map[string]bool, error) {
+	set := make(map[string]bool)
+	add := func(id string) {
+		set[strings.Trim(strings.TrimSpace(id), "<>")] = true
+	}
+	if !strings.HasPrefix(arg, "@") {
+		for _, id := range strings.Split(arg, ",") {
+			add(id)
+		}
+		return set, nil
+	}
+	err := readLines(arg[1:], func(_ int, line string) error {
+		add(line)
+		return nil
+	})
+	return set, err
+}
+
+func readLines(path string, fn func(no int, line string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 1<<16), 1<<24)
+	no := 0
+	for s.Scan() {
+		no++
+		line := strings.TrimRight(s.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(no, line); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// renameType renames the values of dgraph.type. With strict, a type missing
+// from the mapping is an error.
+func renameType(m map[string]string, strict bool) Stage {
+	return stageFunc(func(nq nquad.NQuad, emit emitFunc) error {
+		if nq.Predicate == typePred && !nq.IsEdge() {
+			t, ok := m[nq.ObjectValue]
+			switch {
+			case ok:
+				nq.ObjectValue = t
+			case strict:
+				return fmt.Errorf("no conversion for type %s", nq.ObjectValue)
+			}
+		}
+		return emit(nq)
+	})
+}
+
+func renamePred(m map[string]string) Stage {
+	return stageFunc(func(nq nquad.NQuad, emit emitFunc) error {
+		if p, ok := m[nq.Predicate]; ok {
+			nq.Predicate = p
+		}
+		return emit(nq)
+	})
+}
+
+func dropPred(preds map[string]bool) Stage {
+	return stageFunc(func(nq nquad.NQuad, emit emitFunc) error {
+		if preds[nq.Predicate] {
+			return nil
+		}
+		return emit(nq)
+	})
+}
+
+// filterSubjects keeps the N-Quads whose subject is in set, or with drop
+// those whose subject is not.
+func filterSubjects(set map[string]bool, drop bool) Stage {
+	return stageFunc(func(nq nquad.NQuad, emit emitFunc) error {
+		if set[nq.Subject] == drop {
+			return nil
+		}
+		return emit(nq)
+	})
+}
+
+// addType gives the type typ to every node with a value or edge for pred,
+// once per node.
+func addType(pred, typ string) Stage {
+	seen := make(map[uint64]bool)
+	return stageFunc(func(nq nquad.NQuad, emit emitFunc) error {
+		if err := emit(nq); err != nil {
+			return err
+		}
+		if nq.Predicate != pred {
+			return nil
+		}
+		s := nquad.Fingerprint(nq.Subject)
+		if seen[s] {
+			return nil
+		}
+		seen[s] = true
+		return emit(nquad.NQuad{Subject: nq.Subject, Predicate: typePred, ObjectValue: typ})
+	})
+}
+
+// mapValues rewrites the values of pred, or of every predicate for *, through
+// a mapping. With strict, a value missing from the mapping is an error.
+func mapValues(pred string, m map[string]string, strict bool) Stage {
+	return stageFunc(func(nq nquad.NQuad, emit emitFunc) error {
+		if nq.IsEdge() || (pred != "*" && nq.Predicate != pred) {
+			return emit(nq)
+		}
+		v, ok := m[nq.ObjectValue]
+		switch {
+		case ok:
+			nq.ObjectValue = v
+		case strict:
+			return fmt.Errorf("no mapping for %s value %q", nq.Predicate, nq.ObjectValue)
+		}
+		return emit(nq)
+	})
+}
+
+// stageHelp documents the stages -stage takes.
+const stageHelp = `Stages, applied in the order given:
+  rename-type:old=new,...     rename dgraph.type values, or :@file of old<TAB>new lines
+  rename-pred:old=new,...     rename predicates, or :@file
+  drop-pred:p,...             drop predicates
+  keep-subjects:id,...        keep only these subjects, or :@file of ids, one per line
+  drop-subjects:id,...        drop these subjects, or :@file
+  add-type:pred=Type          type every node with pred as Type
+  map-values:pred=@file       rewrite the values of pred, or * for all, through a mapping file`
+
+// parseStage builds a stage from name:argument.
+func parseStage(spec string, strict bool) (Stage, error) {
+	i := strings.Index(spec, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("stage %q: expected name:argument", spec)
+	}
+	name, arg := spec[:i], spec[i+1:]
+	switch name {
+	case "rename-type":
+		m, err := readPairs(arg)
+		if err != nil {
+			return nil, err
+		}
+		return renameType(m, strict), nil
+	case "rename-pred":
+		m, err := readPairs(arg)
+		if err != nil {
+			return nil, err
+		}
+		return renamePred(m), nil
+	case "drop-pred":
+		set, err := readSet(arg)
+		if err != nil {
+			return nil, err
+		}
+		return dropPred(set), nil
+	case "keep-subjects", "drop-subjects":
+		set, err := readSet(arg)
+		if err != nil {
+			return nil, err
+		}
+		return filterSubjects(set, name == "drop-subjects"), nil
+	case "add-type":
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("add-type: expected pred=Type, got %q", arg)
+		}
+		return addType(kv[0], kv[1]), nil
+	case "map-values":
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[1], "@") {
+			return nil, fmt.Errorf("map-values: expected pred=@file, got %q", arg)
+		}
+		m, err := readPairs(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		return mapValues(kv[0], m, strict), nil
+	}
+	return nil, fmt.Errorf("unknown stage %q", name)
+}
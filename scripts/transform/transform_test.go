@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+const data = `<m1> <dgraph.type> "film" .
+<m1> <name> "The Big Sleep" .
+<m1> <genre> "noir" .
+<m1> <director.film> <d1> .
+<d1> <name> "Howard Hawks" .
+<d1> <director.film> <m1> .
+<d1> <director.film> <m2> .
+<x1> <name> "Dropped" .
+`
+
+// run transforms the N-Quads in text and returns the output lines.
+func run(t *testing.T, text string, specs ...string) []string {
+	p := &Pipeline{}
+	for _, spec := range specs {
+		s, err := parseStage(spec, true)
+		require.NoError(t, err)
+		p.Add(s)
+	}
+	path := filepath.Join(t.TempDir(), "data.rdf")
+	require.NoError(t, ioutil.WriteFile(path, []byte(text), 0644))
+	var out []string
+	_, err := transform([]string{path}, p, func(nq nquad.NQuad) error {
+		out = append(out, nq.String())
+		return nil
+	})
+	require.NoError(t, err)
+	return out
+}
+
+func TestStages(t *testing.T) {
+	dir := t.TempDir()
+	genres := filepath.Join(dir, "genres.tsv")
+	require.NoError(t, ioutil.WriteFile(genres, []byte("# genres\nnoir\tFilm noir\n"), 0644))
+	ids := filepath.Join(dir, "ids.txt")
+	require.NoError(t, ioutil.WriteFile(ids, []byte("<x1>\n"), 0644))
+
+	out := run(t, data,
+		"rename-type:film=Film",
+		"rename-pred:director.film=directed",
+		"drop-subjects:@"+ids,
+		"map-values:genre=@"+genres,
+		"add-type:directed=Director",
+		"drop-pred:genre2",
+	)
+	require.Equal(t, []string{
+		`<m1> <dgraph.type> "Film" .`,
+		`<m1> <name> "The Big Sleep" .`,
+		`<m1> <genre> "Film noir" .`,
+		`<m1> <directed> <d1> .`,
+		`<m1> <dgraph.type> "Director" .`,
+		`<d1> <name> "Howard Hawks" .`,
+		`<d1> <directed> <m1> .`,
+		`<d1> <dgraph.type> "Director" .`,
+		`<d1> <directed> <m2> .`,
+	}, out)
+
+	out = run(t, data, "keep-subjects:m1,<d1>", "drop-pred:director.film")
+	require.Len(t, out, 4)
+
+	// Strict mappings fail on what they don't know.
+	p := &Pipeline{}
+	s, err := parseStage("rename-type:movie=Film", true)
+	require.NoError(t, err)
+	p.Add(s)
+	path := filepath.Join(dir, "data.rdf")
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+	_, err = transform([]string{path}, p, func(nquad.NQuad) error { return nil })
+	require.Contains(t, err.Error(), "no conversion for type film")
+
+	for _, spec := range []string{"rename", "add-type:name", "map-values:name=a=b", "nope:x", "rename-type:@missing.tsv"} {
+		_, err := parseStage(spec, false)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestLiteralsWithSpaces(t *testing.T) {
+	// The old scripts split lines on spaces.
+	text := "<a> <dgraph.type> \"film noir\" .\n<a> <name> \"A \\\"quoted\\\" name\"@en (since=\"2010 or so\") .\n"
+	out := run(t, text, `rename-type:film noir=FilmNoir`)
+	require.Equal(t, `<a> <dgraph.type> "FilmNoir" .`, out[0])
+	require.Equal(t, `<a> <name> "A \"quoted\" name"@en (since="2010 or so") .`, out[1])
+}
+
+func TestJSONAndGzip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json.gz")
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`[{"uid": "_:m", "dgraph.type": "film", "name": "Heat"}]`))
+	require.NoError(t, gz.Close())
+	require.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+
+	p := &Pipeline{}
+	s, err := parseStage("rename-type:@21million-types.tsv", true)
+	require.NoError(t, err)
+	p.Add(s)
+
+	outPath := filepath.Join(dir, "out.rdf.gz")
+	w, closeOut, err := output(outPath)
+	require.NoError(t, err)
+	rep := newTypeReport()
+	n, err := transform([]string{path}, p, func(nq nquad.NQuad) error {
+		rep.add(nq, true)
+		_, err := w.Write([]byte(nq.String() + "\n"))
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.NoError(t, closeOut())
+
+	r, err := nquad.Open(outPath)
+	require.NoError(t, err)
+	defer r.Close()
+	nq, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "Film", nq.ObjectValue)
+
+	var report bytes.Buffer
+	rep.print(&report, "types", "")
+	require.Equal(t, "Film\t1\n", report.String())
+	report.Reset()
+	rep.print(&report, "preds", "Film")
+	require.Equal(t, "Film\n\tdgraph.type\n\tname\n", report.String())
+}
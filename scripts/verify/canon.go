@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	farm "github.com/dgryski/go-farm"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// Canon maps the nodes of a file to canonical uids, so that files with
+// different uids for the same nodes, such as a data set and an export of it,
+// can be compared. A node with a value for the xid predicate is identified by
+// that value. Other nodes, and nodes sharing an xid, are identified by a hash
+// of their outgoing triples, where edges to nodes with an xid count the xid.
+// Nodes with the same outgoing triples get the same uid, and so do nodes
+// without any: they can't be told apart.
+type Canon struct {
+	// XID is the number of nodes identified by their xid, Structural of those
+	// identified by their triples, and Ambiguous of the latter that share
+	// their uid with another node.
+	XID, Structural, Ambiguous int
+
+	ids map[uint64]uint64 // fingerprint of the node id to canonical uid
+}
+
+// leaf is the canonical uid of nodes that are never a subject.
+var leaf = farm.Fingerprint64([]byte("verify: leaf"))
+
+// uid returns the canonical uid of a node. A nil Canon keeps the uids.
+func (c *Canon) uid(id string) uint64 {
+	fp := nquad.Fingerprint(id)
+	if c == nil {
+		return fp
+	}
+	if u, ok := c.ids[fp]; ok {
+		return u
+	}
+	return leaf
+}
+
+func hashString(s string) uint64 {
+	return farm.Fingerprint64([]byte(s))
+}
+
+// NewCanon reads a file twice: for the xids, then for the triples of the
+// nodes without a unique xid. pred is the xid predicate, or "" to identify
+// all nodes by their triples.
+func NewCanon(path, pred string) (*Canon, error) {
+	// The smallest xid of each node.
+	xids := make(map[uint64]string)
+	if pred != "" {
+		_, err := readFile(path, func(nq nquad.NQuad) error {
+			if nq.Predicate != pred || nq.IsEdge() {
+				return nil
+			}
+			s := nquad.Fingerprint(nq.Subject)
+			if x, ok := xids[s]; !ok || nq.ObjectValue < x {
+				xids[s] = nq.ObjectValue
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	c := &Canon{ids: make(map[uint64]uint64, len(xids))}
+	shared := make(map[string]int)
+	for _, x := range xids {
+		shared[x]++
+	}
+	for s, x := range xids {
+		if shared[x] == 1 {
+			c.ids[s] = hashString("xid\x00" + x)
+			c.XID++
+		}
+	}
+
+	// The sum of the hashes of the outgoing triples, which doesn't depend on
+	// their order.
+	sums := make(map[uint64]uint64)
+	var b [8]byte
+	_, err := readFile(path, func(nq nquad.NQuad) error {
+		s := nquad.Fingerprint(nq.Subject)
+		if _, ok := c.ids[s]; ok {
+			return nil
+		}
+		r := convert(nq, nil)
+		obj := r.v
+		if nq.IsEdge() {
+			obj = "edge"
+			if o, ok := c.ids[nquad.Fingerprint(nq.ObjectId)]; ok {
+				binary.BigEndian.PutUint64(b[:], o)
+				obj = string(b[:])
+			}
+		}
+		sums[s] += hashString(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s", r.p, r.lang, obj, r.typ, r.facets))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[uint64]int, len(sums))
+	for _, sum := range sums {
+		seen[sum]++
+	}
+	for s, sum := range sums {
+		c.ids[s] = sum
+		c.Structural++
+		if seen[sum] > 1 {
+			c.Ambiguous++
+		}
+	}
+	return c, nil
+}
+
+func (c *Canon) String() string {
+	return fmt.Sprintf("%d nodes by xid, %d by their triples, %d of them ambiguous",
+		c.XID, c.Structural, c.Ambiguous)
+}
+
+// readFile calls fn for the N-Quads of a plain or gzipped RDF file, up to
+// --head of them, and returns how many there were.
+func readFile(path string, fn func(nquad.NQuad) error) (int, error) {
+	r, err := nquad.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	count := 0
+	for *head < 0 || count < *head {
+		nq, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("%s:%d: %v", path, r.Line(), err)
+		}
+		count++
+		if err := fn(nq); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
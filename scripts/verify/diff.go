@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// The kinds of difference.
+const (
+	srcOnly = "src-only"
+	dstOnly = "dst-only"
+	changed = "changed"
+)
+
+// Counts are the differences found for a predicate.
+type Counts struct {
+	Matches int `json:"matches"`
+	SrcOnly int `json:"src_only"`
+	DstOnly int `json:"dst_only"`
+	Changed int `json:"changed"`
+}
+
+// Summary maps predicates to their counts.
+type Summary map[string]*Counts
+
+func (s Summary) get(pred string) *Counts {
+	c, ok := s[pred]
+	if !ok {
+		c = &Counts{}
+		s[pred] = c
+	}
+	return c
+}
+
+// Total adds up the counts of all predicates.
+func (s Summary) Total() Counts {
+	var t Counts
+	for _, c := range s {
+		t.Matches += c.Matches
+		t.SrcOnly += c.SrcOnly
+		t.DstOnly += c.DstOnly
+		t.Changed += c.Changed
+	}
+	return t
+}
+
+// Preds returns the predicates, sorted.
+func (s Summary) Preds() []string {
+	out := make([]string, 0, len(s))
+	for p := range s {
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Report writes the differences. For changed triples both src and dst are
+// set, otherwise the one the triple is in.
+type Report interface {
+	Add(kind string, src, dst R) error
+	Close(Summary) error
+}
+
+// rdfReport writes the differences as N-Quads labelled with their kind: src
+// and dst for triples in only one file, and changed-src and changed-dst for
+// the two sides of a change. The summary follows as comments.
+type rdfReport struct {
+	w *bufio.Writer
+}
+
+func (r *rdfReport) Add(kind string, src, dst R) error {
+	switch kind {
+	case srcOnly:
+		fmt.Fprintln(r.w, src.NQuad("src"))
+	case dstOnly:
+		fmt.Fprintln(r.w, dst.NQuad("dst"))
+	default:
+		fmt.Fprintln(r.w, src.NQuad("changed-src"))
+		fmt.Fprintln(r.w, dst.NQuad("changed-dst"))
+	}
+	return nil
+}
+
+func (r *rdfReport) Close(s Summary) error {
+	fmt.Fprintf(r.w, "# %s\tmatches\tsrc-only\tdst-only\tchanged\n", "predicate")
+	for _, p := range s.Preds() {
+		c := s[p]
+		fmt.Fprintf(r.w, "# %s\t%d\t%d\t%d\t%d\n", p, c.Matches, c.SrcOnly, c.DstOnly, c.Changed)
+	}
+	return r.w.Flush()
+}
+
+// value is one side of a difference in the JSON report.
+type value struct {
+	Object string            `json:"object,omitempty"`
+	Value  *string           `json:"value,omitempty"`
+	Type   string            `json:"type,omitempty"`
+	Facets map[string]string `json:"facets,omitempty"`
+}
+
+func valueOf(r R) *value {
+	v := &value{Object: r.oo, Type: r.typ}
+	if r.oo == "" {
+		v.Value = &r.v
+	}
+	for _, f := range r.NQuad("").Facets {
+		if v.Facets == nil {
+			v.Facets = make(map[string]string)
+		}
+		v.Facets[f.Key] = f.Value
+	}
+	return v
+}
+
+type jsonDiff struct {
+	Kind      string `json:"kind"`
+	Subject   string `json:"subject"`
+	Predicate string `json:"predicate"`
+	Lang      string `json:"lang,omitempty"`
+	Src       *value `json:"src,omitempty"`
+	Dst       *value `json:"dst,omitempty"`
+}
+
+// jsonReport writes {"diffs": [...], "summary": {...}}, one difference per
+// line.
+type jsonReport struct {
+	w *bufio.Writer
+	n int
+}
+
+func (r *jsonReport) Add(kind string, src, dst R) error {
+	d := jsonDiff{Kind: kind}
+	one := src
+	if kind == dstOnly {
+		one = dst
+	}
+	d.Subject, d.Predicate, d.Lang = one.os, one.p, one.lang
+	if kind != dstOnly {
+		d.Src = valueOf(src)
+	}
+	if kind != srcOnly {
+		d.Dst = valueOf(dst)
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if r.n == 0 {
+		r.w.WriteString("{\"diffs\": [\n")
+	} else {
+		r.w.WriteString(",\n")
+	}
+	r.n++
+	_, err = r.w.Write(b)
+	return err
+}
+
+func (r *jsonReport) Close(s Summary) error {
+	if r.n == 0 {
+		r.w.WriteString("{\"diffs\": [")
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.w, "\n],\n\"summary\": %s}\n", b)
+	return r.w.Flush()
+}
+
+func newReport(format string, w io.Writer) (Report, error) {
+	bw := bufio.NewWriterSize(w, 1<<20)
+	switch format {
+	case "rdf":
+		return &rdfReport{w: bw}, nil
+	case "json":
+		return &jsonReport{w: bw}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, want rdf or json", format)
+}
+
+// groups reads the triples of an iterator that share a subject, predicate
+// and language.
+type groups struct {
+	it   Iterator
+	next R
+	ok   bool
+}
+
+func newGroups(it Iterator) (*groups, error) {
+	g := &groups{it: it}
+	return g, g.advance()
+}
+
+func (g *groups) advance() error {
+	r, err := g.it.Next()
+	if err == io.EOF {
+		g.ok = false
+		return nil
+	}
+	g.next, g.ok = r, err == nil
+	return err
+}
+
+// group returns the next group, in order.
+func (g *groups) group() ([]R, error) {
+	out := []R{g.next}
+	for {
+		if err := g.advance(); err != nil {
+			return nil, err
+		}
+		if !g.ok || !sameKey(g.next, out[0]) {
+			return out, nil
+		}
+		out = append(out, g.next)
+	}
+}
+
+// diffGroup compares the triples of src and dst with the same key. Those in
+// both match. Then the values left on each side are paired up as changes,
+// and the rest are only on one side. Edges are never changes.
+func diffGroup(src, dst []R, sum Summary, rep Report) error {
+	var ls, ld []R
+	i, j := 0, 0
+	pred := ""
+	if len(src) > 0 {
+		pred = src[0].p
+	} else {
+		pred = dst[0].p
+	}
+	c := sum.get(pred)
+	for i < len(src) || j < len(dst) {
+		switch {
+		case i < len(src) && j < len(dst) && equal(src[i], dst[j]):
+			c.Matches++
+			i++
+			j++
+		case j == len(dst) || i < len(src) && less(src[i], dst[j]):
+			ls = append(ls, src[i])
+			i++
+		default:
+			ld = append(ld, dst[j])
+			j++
+		}
+	}
+	var vs, vd []R
+	for _, r := range ls {
+		if r.oo == "" {
+			vs = append(vs, r)
+		} else {
+			c.SrcOnly++
+			if err := rep.Add(srcOnly, r, R{}); err != nil {
+				return err
+			}
+		}
+	}
+	for _, r := range ld {
+		if r.oo == "" {
+			vd = append(vd, r)
+		} else {
+			c.DstOnly++
+			if err := rep.Add(dstOnly, R{}, r); err != nil {
+				return err
+			}
+		}
+	}
+	for k := 0; k < len(vs) || k < len(vd); k++ {
+		var err error
+		switch {
+		case k < len(vs) && k < len(vd):
+			c.Changed++
+			err = rep.Add(changed, vs[k], vd[k])
+		case k < len(vs):
+			c.SrcOnly++
+			err = rep.Add(srcOnly, vs[k], R{})
+		default:
+			c.DstOnly++
+			err = rep.Add(dstOnly, R{}, vd[k])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compare walks both sorted streams a group of triples at a time and reports
+// every difference. It returns the counts per predicate.
+func compare(srcl, dstl Iterator, rep Report) (Summary, error) {
+	sum := make(Summary)
+	gs, err := newGroups(srcl)
+	if err != nil {
+		return nil, err
+	}
+	gd, err := newGroups(dstl)
+	if err != nil {
+		return nil, err
+	}
+	for gs.ok || gd.ok {
+		var s, d []R
+		switch {
+		case gs.ok && gd.ok && sameKey(gs.next, gd.next):
+			if s, err = gs.group(); err == nil {
+				d, err = gd.group()
+			}
+		case !gd.ok || gs.ok && lessKey(gs.next, gd.next):
+			s, err = gs.group()
+		default:
+			d, err = gd.group()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := diffGroup(s, d, sum, rep); err != nil {
+			return nil, err
+		}
+	}
+	return sum, rep.Close(sum)
+}
@@ -1,193 +1,138 @@
+// This tool diffs two RDF files, e.g. a bulk loader export and the source
+// data set. Both files are sorted by subject, predicate, language, object and
+// value with an external merge sort, so files much larger than memory can be
+// compared:
+//
+//	go run . --src 21million.rdf.gz --dst export.rdf.gz --mem 2048
+//
+// Triples only in --src, only in --dst, and values that changed for the same
+// subject, predicate and language are written to --out, as RDF or JSON, with
+// counts per predicate. Language tags, datatypes and facets are compared.
+//
+// An export has new uids, so nodes can't be matched by their ids. With
+// --match xid they are matched by the value of an xid predicate:
+//
+//	go run . --src 1million.rdf.gz --dst export.rdf.gz --match xid --xid name
+//
+// Nodes without a unique xid, or all nodes with --match structure, are matched
+// by a hash of their outgoing triples. The ids in --out are those of the
+// files.
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"compress/gzip"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
 	"os"
-	"sort"
+	"runtime"
+	"text/tabwriter"
 
-	"github.com/Sirupsen/logrus"
-	"github.com/dgraph-io/dgraph/query/graph"
-	"github.com/dgraph-io/dgraph/rdf"
-	"github.com/dgraph-io/dgraph/x"
+	"github.com/dgraph-io/benchmarks/nquad"
 )
 
 var (
-	src  = flag.String("src", "", "Gzipped RDF data file.")
-	dst  = flag.String("dst", "", "Gzipped RDF data file.")
-	out  = flag.String("out", "diff.rdf", "Output differences to this file.")
-	head = flag.Int("head", -1, "Number of lines to read from head. -1 means read all.")
-	glog = logrus.WithField("pkg", "verify")
+	src     = flag.String("src", "", "RDF data file, plain or gzipped.")
+	dst     = flag.String("dst", "", "RDF data file, plain or gzipped.")
+	out     = flag.String("out", "diff.rdf", "Output differences to this file.")
+	format  = flag.String("format", "rdf", "Format of --out: rdf, with the kind of difference as the label, or json.")
+	head    = flag.Int("head", -1, "Number of lines to read from head. -1 means read all.")
+	mem     = flag.Int64("mem", 1024, "Memory for sorting each file, in MB. The rest is spilled to --tmp.")
+	workers = flag.Int("workers", runtime.NumCPU(), "Number of runs sorted in parallel.")
+	tmp     = flag.String("tmp", os.TempDir(), "Folder for the sorted runs.")
+	fanIn   = flag.Int("fan-in", 64, "Number of runs merged at once.")
+	match   = flag.String("match", "uid", "How nodes of the two files are matched: uid, by their ids; xid, by the value of --xid, or else their triples; structure, by their triples.")
+	xid     = flag.String("xid", "xid", "Predicate that identifies nodes for --match xid, e.g. xid or name.")
 )
 
-type R struct {
-	s uint64
-	p string
-	o uint64
-	v string
-
-	os string
-	oo string
-}
-
-func (r R) String() string {
-	return fmt.Sprintf("%x %s %x %s [%s,%s]", r.s, r.p, r.o, r.v, r.os, r.oo)
-}
-
-type ByR []R
-
-func (b ByR) Len() int {
-	return len(b)
-}
-
-func equal(a, b R) bool {
-	if a.s != b.s ||
-		a.p != b.p ||
-		a.o != b.o ||
-		a.v != b.v {
-		return false
+// sortFile reads an RDF file into a sorter and returns the triples in order,
+// with their count. The caller closes the sorter.
+func sortFile(path string) (*Sorter, Iterator, int, error) {
+	var c *Canon
+	if *match != "uid" {
+		pred := *xid
+		if *match == "structure" {
+			pred = ""
+		}
+		var err error
+		if c, err = NewCanon(path, pred); err != nil {
+			return nil, nil, 0, err
+		}
+		fmt.Printf("%s: %s\n", path, c)
 	}
-	return true
+	s, err := NewSorter(*tmp, *mem<<20, *workers)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	s.FanIn = *fanIn
+	count, err := readFile(path, func(nq nquad.NQuad) error {
+		return s.Add(convert(nq, c))
+	})
+	if err != nil {
+		return s, nil, 0, err
+	}
+	it, err := s.Sort()
+	return s, it, count, err
 }
 
-func less(bi, bj R) bool {
-	if bi.s != bj.s {
-		return bi.s < bj.s
+func run() error {
+	switch *match {
+	case "uid", "xid", "structure":
+	default:
+		return fmt.Errorf("unknown --match %q, want uid, xid or structure", *match)
 	}
-	if bi.p != bj.p {
-		return bi.p < bj.p
+	ss, srcl, srcCount, err := sortFile(*src)
+	if ss != nil {
+		defer ss.Close()
 	}
-	if bi.o != bj.o {
-		return bi.o < bj.o
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Source done, %d runs\n", ss.Runs())
+	ds, dstl, dstCount, err := sortFile(*dst)
+	if ds != nil {
+		defer ds.Close()
 	}
-	return bi.v < bj.v
-}
-
-func (b ByR) Less(i int, j int) bool {
-	bi := b[i]
-	bj := b[j]
-	return less(bi, bj)
-}
-
-func (b ByR) Swap(i int, j int) {
-	b[i], b[j] = b[j], b[i]
-}
-
-func getReader(fname string) (*os.File, *bufio.Reader) {
-	f, err := os.Open(fname)
 	if err != nil {
-		glog.WithError(err).Fatal("Unable to open file")
+		return err
 	}
+	fmt.Printf("Src: [%d] Dst: [%d]\n", srcCount, dstCount)
 
-	r, err := gzip.NewReader(f)
+	fmt.Println("Comparing now")
+	f, err := os.Create(*out)
 	if err != nil {
-		glog.WithError(err).Fatal("Unable to open file")
+		return err
 	}
-
-	return f, bufio.NewReader(r)
-}
-
-func convert(n graph.NQuad) R {
-	r := R{}
-	var err error
-	r.os = n.Subject
-	r.s = rdf.GetUid(n.Subject)
-	x.Checkf(err, "Subject: %v", n.Subject)
-	r.p = n.Predicate
-
-	if len(n.ObjectId) > 0 {
-		r.o = rdf.GetUid(n.ObjectId)
-		x.Checkf(err, "Object: %v", n.ObjectId)
-		r.oo = n.ObjectId
+	defer f.Close()
+	rep, err := newReport(*format, f)
+	if err != nil {
+		return err
 	}
-	r.v = n.ObjectValue.GetStrVal()
-	return r
+	sum, err := compare(srcl, dstl, rep)
+	if err != nil {
+		return err
+	}
+	printSummary(sum)
+	return f.Close()
 }
 
-func compare(srcl, dstl []R) {
-	var buf bytes.Buffer
-	var ps, ds, loop, matches int
-	for ps < len(srcl) && ds < len(dstl) {
-		loop++
-		if loop%100 == 0 {
-			//fmt.Printf(".")
-		}
-		s := srcl[ps]
-		d := dstl[ds]
-		if equal(s, d) {
-			//fmt.Printf("Found match: %v\n", s)
-			matches++
-			ps++
-			ds++
-		} else if less(s, d) {
-			// s < d, advance s
-			buf.WriteString(s.String())
-			buf.WriteRune('\n')
-			ps++
-		} else {
-			ds++
-		}
+func printSummary(sum Summary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "predicate\tmatches\tsrc-only\tdst-only\tchanged\t")
+	for _, p := range sum.Preds() {
+		c := sum[p]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t\n", p, c.Matches, c.SrcOnly, c.DstOnly, c.Changed)
 	}
-	fmt.Printf("Found matches: %v\n", matches)
-	x.Check(ioutil.WriteFile(*out, buf.Bytes(), 0644))
+	t := sum.Total()
+	fmt.Fprintf(w, "total\t%d\t%d\t%d\t%d\t\n", t.Matches, t.SrcOnly, t.DstOnly, t.Changed)
+	w.Flush()
 }
 
 func main() {
 	flag.Parse()
-	logrus.SetLevel(logrus.DebugLevel)
-	var srcl, dstl []R
-	f, bufReader := getReader(*src)
-	var err error
-
-	srcCount := 0
-	var strBuf bytes.Buffer
-	for {
-		err = x.ReadLine(bufReader, &strBuf)
-		if err != nil {
-			break
-		}
-		srcCount++
-		rnq, err := rdf.Parse(strBuf.String())
-		x.Checkf(err, "Unable to parse line: [%v]", strBuf.String())
-		srcl = append(srcl, convert(rnq))
-	}
-	if err != nil && err != io.EOF {
-		err := x.Errorf("Error while reading file: %v", err)
-		log.Fatalf("%+v", err)
-	}
-	x.Check(f.Close())
-	fmt.Println("Source done")
-
-	f, bufReader = getReader(*dst)
-	dstCount := 0
-	for {
-		err = x.ReadLine(bufReader, &strBuf)
-		if err != nil {
-			break
-		}
-		dstCount++
-		rnq, err := rdf.Parse(strBuf.String())
-		x.Checkf(err, "Unable to parse line: [%v]", strBuf.String())
-		dstl = append(dstl, convert(rnq))
+	if *src == "" || *dst == "" {
+		log.Fatal("Both --src and --dst are required.")
 	}
-	if err != nil && err != io.EOF {
-		err := x.Errorf("Error while reading file: %v", err)
-		log.Fatalf("%+v", err)
+	if err := run(); err != nil {
+		log.Fatal(err)
 	}
-	x.Check(f.Close())
-
-	fmt.Printf("Src: [%d] Dst: [%d]\n", srcCount, dstCount)
-	sort.Sort(ByR(srcl))
-	sort.Sort(ByR(dstl))
-	fmt.Println("Comparing now")
-	//for i := 0; i < 100; i++ {
-	//fmt.Printf("[S,D] %v %v\n", srcl[i], dstl[i])
-	//}
-	compare(srcl, dstl)
 }
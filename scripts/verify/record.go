@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+// R is an N-Quad reduced to what is compared: subject, predicate, language,
+// object uid, value, datatype and facets. The node ids are kept for the
+// report.
+type R struct {
+	s    uint64
+	p    string
+	lang string
+	o    uint64
+	v    string
+	typ  string
+	// facets are key=value pairs sorted by key, separated by NUL.
+	facets string
+
+	os string
+	oo string
+}
+
+// NQuad returns the N-Quad r stands for, with a label.
+func (r R) NQuad(label string) nquad.NQuad {
+	nq := nquad.NQuad{
+		Subject:     r.os,
+		Predicate:   r.p,
+		ObjectId:    r.oo,
+		ObjectValue: r.v,
+		Datatype:    r.typ,
+		Lang:        r.lang,
+		Label:       label,
+	}
+	if r.facets != "" {
+		for _, kv := range strings.Split(r.facets, "\x00") {
+			i := strings.Index(kv, "=")
+			nq.Facets = append(nq.Facets, nquad.Facet{Key: kv[:i], Value: kv[i+1:]})
+		}
+	}
+	return nq
+}
+
+func (r R) String() string {
+	return r.NQuad("").String()
+}
+
+// size estimates the memory a record takes, for the sort budget.
+func (r R) size() int64 {
+	return 128 + int64(len(r.p)+len(r.lang)+len(r.v)+len(r.typ)+len(r.facets)+len(r.os)+len(r.oo))
+}
+
+// sameKey reports whether a and b have the same subject, predicate and
+// language, the triples among which a value can change.
+func sameKey(a, b R) bool {
+	return a.s == b.s && a.p == b.p && a.lang == b.lang
+}
+
+func equal(a, b R) bool {
+	if !sameKey(a, b) ||
+		a.o != b.o ||
+		a.v != b.v ||
+		a.typ != b.typ ||
+		a.facets != b.facets {
+		return false
+	}
+	return true
+}
+
+func lessKey(bi, bj R) bool {
+	if bi.s != bj.s {
+		return bi.s < bj.s
+	}
+	if bi.p != bj.p {
+		return bi.p < bj.p
+	}
+	return bi.lang < bj.lang
+}
+
+func less(bi, bj R) bool {
+	if !sameKey(bi, bj) {
+		return lessKey(bi, bj)
+	}
+	if bi.o != bj.o {
+		return bi.o < bj.o
+	}
+	if bi.v != bj.v {
+		return bi.v < bj.v
+	}
+	if bi.typ != bj.typ {
+		return bi.typ < bj.typ
+	}
+	return bi.facets < bj.facets
+}
+
+// xsd is the long form of the xs: prefix.
+const xsd = "http://www.w3.org/2001/XMLSchema#"
+
+// datatype normalizes a datatype IRI. Plain literals are strings, so
+// xs:string is dropped, as exports add it.
+func datatype(t string) string {
+	if strings.HasPrefix(t, xsd) {
+		t = "xs:" + t[len(xsd):]
+	}
+	if t == "xs:string" {
+		return ""
+	}
+	return t
+}
+
+// convert reduces an N-Quad, with the uids of c.
+func convert(n nquad.NQuad, c *Canon) R {
+	r := R{}
+	r.os = n.Subject
+	r.s = c.uid(n.Subject)
+	r.p = n.Predicate
+	if n.IsEdge() {
+		r.o = c.uid(n.ObjectId)
+		r.oo = n.ObjectId
+	}
+	r.v = n.ObjectValue
+	r.lang = n.Lang
+	r.typ = datatype(n.Datatype)
+	if len(n.Facets) > 0 {
+		kvs := make([]string, len(n.Facets))
+		for i, f := range n.Facets {
+			kvs[i] = f.Key + "=" + f.Value
+		}
+		sort.Strings(kvs)
+		r.facets = strings.Join(kvs, "\x00")
+	}
+	return r
+}
+
+// encode appends r to a run file: the uids as varints, then the strings,
+// each after its length.
+func encode(w *bufio.Writer, r R) error {
+	var b [binary.MaxVarintLen64]byte
+	for _, u := range []uint64{r.s, r.o} {
+		if _, err := w.Write(b[:binary.PutUvarint(b[:], u)]); err != nil {
+			return err
+		}
+	}
+	for _, s := range []string{r.p, r.lang, r.v, r.typ, r.facets, r.os, r.oo} {
+		if _, err := w.Write(b[:binary.PutUvarint(b[:], uint64(len(s)))]); err != nil {
+			return err
+		}
+		if _, err := w.WriteString(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decode reads a record written by encode. It returns io.EOF at the end of
+// the run.
+func decode(rd *bufio.Reader) (R, error) {
+	var r R
+	var err error
+	if r.s, err = binary.ReadUvarint(rd); err != nil {
+		return r, err
+	}
+	if r.o, err = binary.ReadUvarint(rd); err != nil {
+		return r, io.ErrUnexpectedEOF
+	}
+	for _, s := range []*string{&r.p, &r.lang, &r.v, &r.typ, &r.facets, &r.os, &r.oo} {
+		n, err := binary.ReadUvarint(rd)
+		if err != nil {
+			return r, io.ErrUnexpectedEOF
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return r, io.ErrUnexpectedEOF
+		}
+		*s = string(b)
+	}
+	return r, nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Iterator yields records in order. Next returns io.EOF after the last one.
+type Iterator interface {
+	Next() (R, error)
+}
+
+// Sorter sorts more records than fit in memory. Records are collected into
+// chunks of a bounded size, which workers sort in parallel and spill to disk
+// as runs. Sort then merges the runs, in several passes if there are more
+// than FanIn of them.
+type Sorter struct {
+	// FanIn is the number of runs merged at once.
+	FanIn int
+
+	dir    string
+	chunk  int64 // bytes per chunk
+	buf    []R
+	size   int64
+	spills int
+	merged *mergeIter
+
+	work    chan []R
+	workers int
+	wg      sync.WaitGroup
+
+	mu   sync.Mutex
+	runs []string
+	next int // number of the next run file
+	err  error
+}
+
+// NewSorter returns a sorter that keeps about mem bytes of records in memory
+// and spills the rest to a new directory in tmp, with workers sorting runs
+// in parallel.
+func NewSorter(tmp string, mem int64, workers int) (*Sorter, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	dir, err := ioutil.TempDir(tmp, "verify-")
+	if err != nil {
+		return nil, err
+	}
+	s := &Sorter{
+		FanIn: 64,
+		dir:   dir,
+		// The chunk being filled and those being sorted share the budget.
+		chunk:   mem / int64(workers+1),
+		work:    make(chan []R),
+		workers: workers,
+	}
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	return s, nil
+}
+
+func (s *Sorter) worker() {
+	defer s.wg.Done()
+	for chunk := range s.work {
+		sort.Slice(chunk, func(i, j int) bool { return less(chunk[i], chunk[j]) })
+		path, err := s.writeRun(&sliceIter{recs: chunk})
+		s.mu.Lock()
+		if err != nil && s.err == nil {
+			s.err = err
+		}
+		s.runs = append(s.runs, path)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Sorter) runPath() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	return filepath.Join(s.dir, fmt.Sprintf("run-%06d", s.next))
+}
+
+// writeRun writes the records of it to a new run file.
+func (s *Sorter) writeRun(it Iterator) (string, error) {
+	path := s.runPath()
+	f, err := os.Create(path)
+	if err != nil {
+		return path, err
+	}
+	w := bufio.NewWriterSize(f, 1<<20)
+	for {
+		r, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return path, err
+		}
+		if err := encode(w, r); err != nil {
+			f.Close()
+			return path, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return path, err
+	}
+	return path, f.Close()
+}
+
+// Add adds a record. It blocks while all the workers are busy.
+func (s *Sorter) Add(r R) error {
+	s.buf = append(s.buf, r)
+	s.size += r.size()
+	if s.size >= s.chunk {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *Sorter) spill() error {
+	s.mu.Lock()
+	err := s.err
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.work <- s.buf
+	s.buf, s.size = nil, 0
+	s.spills++
+	return nil
+}
+
+// Runs returns the number of runs spilled to disk so far.
+func (s *Sorter) Runs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.runs)
+}
+
+// Sort returns the records in order. No records may be added after it.
+func (s *Sorter) Sort() (Iterator, error) {
+	if s.spills == 0 {
+		// Everything fit in memory.
+		close(s.work)
+		s.wg.Wait()
+		sort.Slice(s.buf, func(i, j int) bool { return less(s.buf[i], s.buf[j]) })
+		return &sliceIter{recs: s.buf}, nil
+	}
+	if len(s.buf) > 0 {
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+	}
+	close(s.work)
+	s.wg.Wait()
+	if s.err != nil {
+		return nil, s.err
+	}
+	sort.Strings(s.runs)
+	for len(s.runs) > s.FanIn {
+		if err := s.mergePass(); err != nil {
+			return nil, err
+		}
+	}
+	m, err := openMerge(s.runs)
+	s.merged = m
+	return m, err
+}
+
+// mergePass merges the runs in groups of FanIn, with the groups merged in
+// parallel.
+func (s *Sorter) mergePass() error {
+	var groups [][]string
+	for i := 0; i < len(s.runs); i += s.FanIn {
+		end := i + s.FanIn
+		if end > len(s.runs) {
+			end = len(s.runs)
+		}
+		groups = append(groups, s.runs[i:end])
+	}
+	out := make([]string, len(groups))
+	errs := make([]error, len(groups))
+	sem := make(chan struct{}, s.workers)
+	var wg sync.WaitGroup
+	for i, g := range groups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, g []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			m, err := openMerge(g)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			out[i], errs[i] = s.writeRun(m)
+			if err := m.Close(); err != nil && errs[i] == nil {
+				errs[i] = err
+			}
+			for _, path := range g {
+				os.Remove(path)
+			}
+		}(i, g)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	s.runs = out
+	return nil
+}
+
+// Close removes the runs.
+func (s *Sorter) Close() error {
+	if s.merged != nil {
+		s.merged.Close()
+	}
+	return os.RemoveAll(s.dir)
+}
+
+type sliceIter struct {
+	recs []R
+	i    int
+}
+
+func (it *sliceIter) Next() (R, error) {
+	if it.i >= len(it.recs) {
+		return R{}, io.EOF
+	}
+	it.i++
+	return it.recs[it.i-1], nil
+}
+
+// runFile is an open run file with its next record.
+type runFile struct {
+	f   *os.File
+	rd  *bufio.Reader
+	cur R
+}
+
+// mergeIter merges sorted runs with a heap of their next records.
+type mergeIter struct {
+	runs []*runFile
+}
+
+func openMerge(paths []string) (*mergeIter, error) {
+	m := &mergeIter{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		r := &runFile{f: f, rd: bufio.NewReaderSize(f, 256<<10)}
+		r.cur, err = decode(r.rd)
+		if err == io.EOF {
+			f.Close()
+			continue
+		}
+		if err != nil {
+			f.Close()
+			m.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		m.runs = append(m.runs, r)
+	}
+	heap.Init(m)
+	return m, nil
+}
+
+func (m *mergeIter) Len() int           { return len(m.runs) }
+func (m *mergeIter) Less(i, j int) bool { return less(m.runs[i].cur, m.runs[j].cur) }
+func (m *mergeIter) Swap(i, j int)      { m.runs[i], m.runs[j] = m.runs[j], m.runs[i] }
+func (m *mergeIter) Push(x interface{}) { m.runs = append(m.runs, x.(*runFile)) }
+func (m *mergeIter) Pop() interface{} {
+	r := m.runs[len(m.runs)-1]
+	m.runs = m.runs[:len(m.runs)-1]
+	return r
+}
+
+func (m *mergeIter) Next() (R, error) {
+	if len(m.runs) == 0 {
+		return R{}, io.EOF
+	}
+	top := m.runs[0]
+	out := top.cur
+	var err error
+	top.cur, err = decode(top.rd)
+	switch {
+	case err == io.EOF:
+		top.f.Close()
+		heap.Pop(m)
+	case err != nil:
+		return R{}, fmt.Errorf("%s: %v", top.f.Name(), err)
+	default:
+		heap.Fix(m, 0)
+	}
+	return out, nil
+}
+
+// Close closes the runs that were not read to the end.
+func (m *mergeIter) Close() error {
+	for _, r := range m.runs {
+		r.f.Close()
+	}
+	m.runs = nil
+	return nil
+}
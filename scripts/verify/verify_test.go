@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+func records(n int, seed int64) []R {
+	rng := rand.New(rand.NewSource(seed))
+	out := make([]R, n)
+	for i := range out {
+		nq := nquad.NQuad{
+			Subject:   fmt.Sprintf("n%d", rng.Intn(n/4+1)),
+			Predicate: fmt.Sprintf("p%d", rng.Intn(5)),
+		}
+		if rng.Intn(2) == 0 {
+			nq.ObjectId = fmt.Sprintf("n%d", rng.Intn(n))
+		} else {
+			nq.ObjectValue = strings.Repeat("v", rng.Intn(20))
+		}
+		out[i] = convert(nq, nil)
+	}
+	return out
+}
+
+func drain(t *testing.T, it Iterator) []R {
+	var out []R
+	for {
+		r, err := it.Next()
+		if err == io.EOF {
+			return out
+		}
+		require.NoError(t, err)
+		out = append(out, r)
+	}
+}
+
+func TestSorter(t *testing.T) {
+	recs := records(5000, 1)
+	want := append([]R(nil), recs...)
+	sort.Slice(want, func(i, j int) bool { return less(want[i], want[j]) })
+
+	for _, tc := range []struct {
+		mem   int64
+		fanIn int
+	}{
+		{1 << 30, 64}, // in memory
+		{64 << 10, 64},
+		{16 << 10, 4}, // several merge passes
+	} {
+		s, err := NewSorter(t.TempDir(), tc.mem, 3)
+		require.NoError(t, err)
+		s.FanIn = tc.fanIn
+		for _, r := range recs {
+			require.NoError(t, s.Add(r))
+		}
+		it, err := s.Sort()
+		require.NoError(t, err)
+		got := drain(t, it)
+		require.Len(t, got, len(want))
+		for i := range want {
+			require.True(t, equal(want[i], got[i]), "%d: %v != %v", i, want[i], got[i])
+		}
+		require.Equal(t, tc.mem < 1<<30, s.spills > 0)
+		require.NoError(t, s.Close())
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	r := R{s: 1 << 60, p: "name", o: 7, v: "Alice\nBob", os: "a", oo: "_:b"}
+	require.NoError(t, encode(w, r))
+	require.NoError(t, encode(w, R{}))
+	require.NoError(t, w.Flush())
+	rd := bufio.NewReader(&b)
+	got, err := decode(rd)
+	require.NoError(t, err)
+	require.Equal(t, r, got)
+	got, err = decode(rd)
+	require.NoError(t, err)
+	require.Equal(t, R{}, got)
+	_, err = decode(rd)
+	require.Equal(t, io.EOF, err)
+}
+
+// sorted parses N-Quads into a sorted iterator.
+func sorted(t *testing.T, text string) Iterator {
+	var recs []R
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		nq, err := nquad.Parse(line)
+		require.NoError(t, err)
+		recs = append(recs, convert(nq, nil))
+	}
+	sort.Slice(recs, func(i, j int) bool { return less(recs[i], recs[j]) })
+	return &sliceIter{recs: recs}
+}
+
+const (
+	srcRDF = `<a> <name> "Alice" .
+<a> <name> "Alicia"@es .
+<a> <friend> <b> .
+<a> <age> "30"^^<xs:int> .
+<b> <name> "Bob" .
+<b> <friend> <a> (since=2010) .
+<c> <name> "Carol" .`
+	dstRDF = `<b> <name> "Bob"^^<xs:string> .
+<a> <name> "Alice" .
+<a> <name> "Alicia"@fr .
+<a> <age> "30"^^<http://www.w3.org/2001/XMLSchema#float> .
+<b> <friend> <a> (since=2011) .
+<d> <name> "Dave" .`
+)
+
+func TestCompare(t *testing.T) {
+	var out bytes.Buffer
+	rep, err := newReport("rdf", &out)
+	require.NoError(t, err)
+	sum, err := compare(sorted(t, srcRDF), sorted(t, dstRDF), rep)
+	require.NoError(t, err)
+
+	require.Equal(t, Counts{Matches: 2, SrcOnly: 2, DstOnly: 2}, *sum["name"])
+	require.Equal(t, Counts{SrcOnly: 2, DstOnly: 1}, *sum["friend"])
+	require.Equal(t, Counts{Changed: 1}, *sum["age"])
+	require.Equal(t, Counts{Matches: 2, SrcOnly: 4, DstOnly: 3, Changed: 1}, sum.Total())
+
+	lines := out.String()
+	for _, want := range []string{
+		`<a> <friend> <b> <src> .`,
+		`<b> <friend> <a> <src> (since=2010) .`,
+		`<b> <friend> <a> <dst> (since=2011) .`,
+		`<a> <name> "Alicia"@es <src> .`,
+		`<a> <name> "Alicia"@fr <dst> .`,
+		`<a> <age> "30"^^<xs:int> <changed-src> .`,
+		`<a> <age> "30"^^<xs:float> <changed-dst> .`,
+		`<c> <name> "Carol" <src> .`,
+		"# age\t0\t0\t0\t1",
+	} {
+		require.Contains(t, lines, want)
+	}
+	require.Contains(t, lines, `<d> <name> "Dave" <dst> .`)
+
+	// The diff lines are valid N-Quads.
+	for _, line := range strings.Split(strings.TrimSpace(lines), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			_, err := nquad.Parse(line)
+			require.NoError(t, err, line)
+		}
+	}
+}
+
+func TestCompareJSON(t *testing.T) {
+	var out bytes.Buffer
+	rep, err := newReport("json", &out)
+	require.NoError(t, err)
+	_, err = compare(sorted(t, srcRDF), sorted(t, dstRDF), rep)
+	require.NoError(t, err)
+
+	var res struct {
+		Diffs   []jsonDiff
+		Summary Summary
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &res), out.String())
+	require.Len(t, res.Diffs, 8)
+	require.Equal(t, 1, res.Summary["age"].Changed)
+	for _, d := range res.Diffs {
+		if d.Kind != changed {
+			continue
+		}
+		require.Equal(t, "age", d.Predicate)
+		require.Equal(t, "xs:int", d.Src.Type)
+		require.Equal(t, "xs:float", d.Dst.Type)
+		require.Equal(t, "30", *d.Dst.Value)
+	}
+
+	// No differences at all.
+	out.Reset()
+	rep, _ = newReport("json", &out)
+	sum, err := compare(sorted(t, srcRDF), sorted(t, srcRDF), rep)
+	require.NoError(t, err)
+	require.Equal(t, 7, sum.Total().Matches)
+	require.NoError(t, json.Unmarshal(out.Bytes(), &res), out.String())
+	require.Empty(t, res.Diffs)
+
+	_, err = newReport("csv", &out)
+	require.Error(t, err)
+}
+
+func TestSortFile(t *testing.T) {
+	path := t.TempDir() + "/data.rdf"
+	var b strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, "<n%d> <name> \"%d\" .\n", 99-i, i)
+	}
+	require.NoError(t, ioutil.WriteFile(path, []byte(b.String()), 0644))
+	*mem, *tmp = 0, t.TempDir()
+	s, it, count, err := sortFile(path)
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, 100, count)
+	require.Len(t, drain(t, it), 100)
+	require.Equal(t, 100, s.spills)
+}
+
+func TestCanon(t *testing.T) {
+	dir := t.TempDir()
+	srcPath, dstPath := dir+"/src.rdf", dir+"/dst.rdf"
+	require.NoError(t, ioutil.WriteFile(srcPath, []byte(`<_:alice> <xid> "alice" .
+<_:alice> <name> "Alice" .
+<_:alice> <friend> <_:bob> .
+<_:bob> <xid> "bob" .
+<_:bob> <name> "Bob" .
+<_:bob> <address> <_:addr> .
+<_:addr> <city> "Paris" .
+<_:carol> <name> "Carol" .
+<_:carol> <friend> <_:alice> .
+`), 0644))
+	// An export, with new uids and Carol's friend changed.
+	require.NoError(t, ioutil.WriteFile(dstPath, []byte(`<0x1> <xid> "alice" .
+<0x1> <name> "Alice" .
+<0x1> <friend> <0x2> .
+<0x2> <xid> "bob" .
+<0x2> <name> "Bob" .
+<0x2> <address> <0x3> .
+<0x3> <city> "Paris" .
+<0x4> <name> "Carol" .
+<0x4> <friend> <0x2> .
+`), 0644))
+
+	c, err := NewCanon(srcPath, "xid")
+	require.NoError(t, err)
+	require.Equal(t, 2, c.XID)
+	require.Equal(t, 2, c.Structural)
+	require.Equal(t, 0, c.Ambiguous)
+	d, err := NewCanon(dstPath, "xid")
+	require.NoError(t, err)
+	require.Equal(t, c.uid("_:bob"), d.uid("0x2"))
+	require.Equal(t, c.uid("_:addr"), d.uid("0x3"))
+	// Carol's triples differ, so her hash does too.
+	require.NotEqual(t, c.uid("_:carol"), d.uid("0x4"))
+
+	diff := func(m string) Counts {
+		*match, *xid, *mem, *tmp = m, "xid", 1, t.TempDir()
+		defer func() { *match, *mem = "uid", 1024 }()
+		ss, srcl, _, err := sortFile(srcPath)
+		require.NoError(t, err)
+		defer ss.Close()
+		ds, dstl, _, err := sortFile(dstPath)
+		require.NoError(t, err)
+		defer ds.Close()
+		var out bytes.Buffer
+		rep, _ := newReport("rdf", &out)
+		sum, err := compare(srcl, dstl, rep)
+		require.NoError(t, err)
+		return sum.Total()
+	}
+	require.Equal(t, Counts{SrcOnly: 9, DstOnly: 9}, diff("uid"))
+	// Only Carol's two triples differ, as a whole node.
+	require.Equal(t, Counts{Matches: 7, SrcOnly: 2, DstOnly: 2}, diff("xid"))
+	// Without xids, edges don't count in the hash, so Carol matches and only
+	// her friend differs.
+	require.Equal(t, Counts{Matches: 8, SrcOnly: 1, DstOnly: 1}, diff("structure"))
+}
@@ -0,0 +1,403 @@
+package main
+
+// Coordinated runs spread the load over several machines, so that a single
+// client box doesn't become the bottleneck. The coordinator hands the same
+// workload to every worker, starts them together once all have registered,
+// and merges the latency histograms they stream back into one report.
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/benchmarks/loadgen"
+)
+
+var (
+	coordinatorAddr = flag.String("coordinator", "", "Run as coordinator on this address, e.g. :7070. It sends no queries itself.")
+	numWorkers      = flag.Int("workers", 1, "Number of workers the coordinator waits for before starting.")
+	workerOf        = flag.String("worker", "", "Run as a worker of the coordinator at this URL, e.g. http://10.0.0.5:7070")
+	workerName      = flag.String("name", "", "Name of this worker in reports. Defaults to hostname-pid.")
+	registerTimeout = flag.Duration("register-timeout", 10*time.Minute, "How long the coordinator waits for all workers to register.")
+	workerTimeout   = flag.Duration("worker-timeout", 30*time.Second, "The coordinator gives up on a worker that sent nothing for this long after the start.")
+)
+
+// spec is the workload the coordinator hands to every worker. numuser is per
+// worker. Metrics is the address workers serve metrics on, unless they are
+// given their own.
+type spec struct {
+	NumUser    int
+	NumSec     float64
+	Servers    []string
+	Actors     []string
+	Directors  []string
+	Validation loadgen.ValidationFlags
+	Metrics    string
+}
+
+// snapshot holds the cumulative counts of a worker.
+type snapshot struct {
+	Worker   string
+	Requests uint64
+	Errors   map[string]uint64
+	Server   *loadgen.Histogram
+	Client   *loadgen.Histogram
+	Done     bool
+}
+
+type coordinator struct {
+	spec spec
+	// want is the number of workers to wait for, and a worker that sent
+	// nothing for timeout after the start is given up on.
+	want    int
+	timeout time.Duration
+
+	sync.Mutex
+	workers  map[string]*snapshot
+	seen     map[string]time.Time // when each worker was last heard from
+	lost     map[string]bool
+	started  time.Time
+	finished bool
+	release  chan struct{} // closed once all workers have registered
+	done     chan struct{} // closed once all workers are done or lost
+}
+
+func newCoordinator(sp spec, want int, timeout time.Duration) *coordinator {
+	return &coordinator{
+		spec:    sp,
+		want:    want,
+		timeout: timeout,
+		workers: make(map[string]*snapshot),
+		seen:    make(map[string]time.Time),
+		lost:    make(map[string]bool),
+		release: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (c *coordinator) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", c.register)
+	mux.HandleFunc("/barrier", c.barrier)
+	mux.HandleFunc("/snapshot", c.snapshot)
+	return mux
+}
+
+func postJSON(url string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *coordinator) register(w http.ResponseWriter, r *http.Request) {
+	var req struct{ Name string }
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.Lock()
+	if len(c.workers) == c.want {
+		c.Unlock()
+		http.Error(w, "all workers have registered", http.StatusConflict)
+		return
+	}
+	name := req.Name
+	for i := 2; c.workers[name] != nil; i++ {
+		name = fmt.Sprintf("%s-%d", req.Name, i)
+	}
+	c.workers[name] = &snapshot{Worker: name}
+	log.Printf("Worker %s registered from %s (%d/%d)", name, r.RemoteAddr, len(c.workers), c.want)
+	if len(c.workers) == c.want {
+		c.started = time.Now()
+		for n := range c.workers {
+			c.seen[n] = c.started
+		}
+		close(c.release)
+	}
+	c.Unlock()
+
+	json.NewEncoder(w).Encode(struct {
+		Name string
+		Spec spec
+	}{name, c.spec})
+}
+
+// barrier blocks until every worker has registered.
+func (c *coordinator) barrier(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-c.release:
+	case <-r.Context().Done():
+	}
+}
+
+func (c *coordinator) snapshot(w http.ResponseWriter, r *http.Request) {
+	var s snapshot
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	old, ok := c.workers[s.Worker]
+	if !ok {
+		http.Error(w, "unknown worker "+s.Worker, http.StatusBadRequest)
+		return
+	}
+	if old.Done {
+		return
+	}
+	c.workers[s.Worker] = &s
+	c.seen[s.Worker] = time.Now()
+	c.checkDone()
+}
+
+// checkDone closes done once every worker is done. It is called with the
+// lock held.
+func (c *coordinator) checkDone() {
+	if c.finished {
+		return
+	}
+	for _, o := range c.workers {
+		if !o.Done {
+			return
+		}
+	}
+	c.finished = true
+	close(c.done)
+}
+
+// expire gives up on the workers not heard from for the timeout as of now,
+// e.g. because they died, keeping their last counts. It returns their names.
+func (c *coordinator) expire(now time.Time) []string {
+	c.Lock()
+	defer c.Unlock()
+	var names []string
+	for name, s := range c.workers {
+		if s.Done || now.Sub(c.seen[name]) < c.timeout {
+			continue
+		}
+		s.Done = true
+		c.lost[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		c.checkDone()
+	}
+	return names
+}
+
+// merged adds up the latest snapshots of all workers.
+func (c *coordinator) merged() (total snapshot, done int) {
+	c.Lock()
+	defer c.Unlock()
+	total.Errors = make(map[string]uint64)
+	total.Server = loadgen.NewHistogram()
+	total.Client = loadgen.NewHistogram()
+	for _, s := range c.workers {
+		total.Requests += s.Requests
+		for k, v := range s.Errors {
+			total.Errors[k] += v
+		}
+		total.Server.Merge(s.Server)
+		total.Client.Merge(s.Client)
+		if s.Done {
+			done++
+		}
+	}
+	return total, done
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func runCoordinator() {
+	c := newCoordinator(spec{
+		NumUser:    *numUser,
+		NumSec:     *numSec,
+		Servers:    serverList,
+		Actors:     actors,
+		Directors:  directors,
+		Validation: validation,
+		Metrics:    *metricsAddr,
+	}, *numWorkers, *workerTimeout)
+	go func() {
+		log.Fatal(http.ListenAndServe(*coordinatorAddr, c.handler()))
+	}()
+	log.Printf("Waiting for %d workers on %s", *numWorkers, *coordinatorAddr)
+
+	select {
+	case <-c.release:
+	case <-time.After(*registerTimeout):
+		c.Lock()
+		log.Fatalf("Only %d of %d workers registered in %s", len(c.workers), c.want, *registerTimeout)
+	}
+	tick := time.NewTicker(5 * time.Second)
+	defer tick.Stop()
+	for running := true; running; {
+		select {
+		case now := <-tick.C:
+			for _, name := range c.expire(now) {
+				log.Printf("Worker %s sent nothing for %s, leaving it out", name, c.timeout)
+			}
+			s, done := c.merged()
+			log.Printf("%d requests, p95 %.2f ms, %d/%d workers done",
+				s.Requests, ms(s.Server.Quantile(0.95)), done, *numWorkers)
+		case <-c.done:
+			running = false
+		}
+	}
+	elapsed := time.Since(c.started)
+
+	total, _ := c.merged()
+	if total.Requests == 0 {
+		log.Fatalf("No successful queries. Errors: %v", total.Errors)
+	}
+	var names []string
+	c.Lock()
+	for name := range c.workers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("------------------------------------------------------------------------")
+	for _, name := range names {
+		s := c.workers[name]
+		lost := ""
+		if c.lost[name] {
+			lost = " (lost, counts up to its last snapshot)"
+		}
+		fmt.Printf("%s : %d requests, p95 %.2f ms%s\n", name, s.Requests, ms(s.Server.Quantile(0.95)), lost)
+	}
+	c.Unlock()
+	fmt.Println("\nWorkers, NumUser per worker :", *numWorkers, *numUser)
+	fmt.Println("Throughput (num request per second) : ", float64(total.Requests)/(numRounds*(*numSec)))
+	fmt.Println("Wall clock (s) : ", elapsed.Seconds())
+	fmt.Println("Total number of queries : ", total.Requests)
+	fmt.Println("Avg time (ms) : ", ms(total.Server.Mean()))
+	fmt.Println("Client avg time (ms) : ", ms(total.Client.Mean()))
+	fmt.Println("50, 95, 99 percentile latency : ", ms(total.Server.Quantile(0.5)),
+		ms(total.Server.Quantile(0.95)), ms(total.Server.Quantile(0.99)))
+	fmt.Println("Client 50, 95, 99 percentile latency : ", ms(total.Client.Quantile(0.5)),
+		ms(total.Client.Quantile(0.95)), ms(total.Client.Quantile(0.99)))
+	fmt.Println("Min, Max : ", 1000*total.Server.Min, 1000*total.Server.Max)
+	fmt.Println("Errors : ", total.Errors)
+	fmt.Println("------------------------------------------------------------------------")
+}
+
+// currentSnapshot copies the counts under the lock, since users keep
+// recording while it is sent.
+func currentSnapshot(name string, done bool) []byte {
+	hists.Lock()
+	defer hists.Unlock()
+	b, err := json.Marshal(snapshot{
+		Worker:   name,
+		Requests: atomic.LoadUint64(&numRequests),
+		Errors:   errCounts.Map(),
+		Server:   hists.server,
+		Client:   hists.client,
+		Done:     done,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return b
+}
+
+func runWorker() {
+	name := *workerName
+	if name == "" {
+		host, _ := os.Hostname()
+		name = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	var reg struct {
+		Name string
+		Spec spec
+	}
+	if err := postJSON(*workerOf+"/register", struct{ Name string }{name}, &reg); err != nil {
+		log.Fatalf("While registering: %v", err)
+	}
+	*numUser = reg.Spec.NumUser
+	*numSec = reg.Spec.NumSec
+	serverList = reg.Spec.Servers
+	actors = reg.Spec.Actors
+	directors = reg.Spec.Directors
+	validation = reg.Spec.Validation
+	var err error
+	if validators, err = validation.Validators(); err != nil {
+		log.Fatal(err)
+	}
+	addr := *metricsAddr
+	if addr == "" {
+		addr = reg.Spec.Metrics
+	}
+	if addr != "" {
+		loadgen.ServeMetrics(addr)
+	}
+	log.Printf("Registered as %s, waiting for the other workers", reg.Name)
+
+	resp, err := http.Get(*workerOf + "/barrier")
+	if err != nil {
+		log.Fatalf("While waiting at the barrier: %v", err)
+	}
+	resp.Body.Close()
+
+	send := func(done bool) error {
+		resp, err := http.Post(*workerOf+"/snapshot", "application/json",
+			bytes.NewReader(currentSnapshot(reg.Name, done)))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	stop := make(chan struct{})
+	go func() {
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				if err := send(false); err != nil {
+					log.Printf("While sending snapshot: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	initChans()
+	go func() {
+		// Latencies are in the histograms; the coordinator reports them.
+		for range latC {
+		}
+	}()
+	runRounds()
+	close(stop)
+	if err := send(true); err != nil {
+		log.Fatalf("While sending final snapshot: %v", err)
+	}
+	fmt.Println("DONE! Errors : ", errCounts.String())
+}
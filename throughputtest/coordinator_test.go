@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/benchmarks/loadgen"
+	"github.com/dgraph-io/benchmarks/mockdgraph"
+)
+
+// TestWorkerProcess is the worker started by TestCoordinator, as a separate
+// process since the workload lives in globals.
+func TestWorkerProcess(t *testing.T) {
+	if os.Getenv("THROUGHPUTTEST_WORKER") != "1" {
+		t.Skip("only run as a worker of TestCoordinator")
+	}
+	runWorker()
+}
+
+func startWorker(t *testing.T, url, name string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestWorkerProcess$", "-worker", url, "-name", name)
+	cmd.Env = append(os.Environ(), "THROUGHPUTTEST_WORKER=1")
+	require.NoError(t, cmd.Start())
+	return cmd
+}
+
+func TestCoordinator(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs worker processes for a few seconds")
+	}
+	alpha := mockdgraph.New(mockdgraph.Config{})
+	alpha.Start()
+	defer alpha.Close()
+
+	// The mock answers {} to every query, which has a single node, so the
+	// validation passed on by the coordinator fails every response.
+	var v loadgen.ValidationFlags
+	v.MinNodes = 2
+	c := newCoordinator(spec{
+		NumUser:    2,
+		NumSec:     0.2,
+		Servers:    []string{alpha.URL + "/query"},
+		Actors:     []string{"0x1", "0x2"},
+		Directors:  []string{"0x3"},
+		Validation: v,
+	}, 2, time.Minute)
+	ts := httptest.NewServer(c.handler())
+	defer ts.Close()
+
+	workers := []*exec.Cmd{startWorker(t, ts.URL, "w"), startWorker(t, ts.URL, "w")}
+	select {
+	case <-c.done:
+	case <-time.After(time.Minute):
+		t.Fatal("the workers didn't finish")
+	}
+	for _, w := range workers {
+		require.NoError(t, w.Wait())
+	}
+
+	c.Lock()
+	require.Len(t, c.workers, 2)
+	require.Contains(t, c.workers, "w")
+	require.Contains(t, c.workers, "w-2", "names are made unique")
+	var sum uint64
+	for _, s := range c.workers {
+		require.True(t, s.Done)
+		require.True(t, s.Requests > 0)
+		sum += s.Requests
+	}
+	c.Unlock()
+
+	total, done := c.merged()
+	require.Equal(t, 2, done)
+	require.Equal(t, sum, total.Requests)
+	require.Equal(t, total.Requests, total.Errors["validation"])
+	require.Equal(t, len(alpha.Requests()), int(total.Requests))
+
+	// A third worker is turned away.
+	resp, err := http.Post(ts.URL+"/register", "application/json", bytes.NewBufferString(`{"Name": "late"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestLostWorker(t *testing.T) {
+	c := newCoordinator(spec{}, 2, time.Minute)
+	ts := httptest.NewServer(c.handler())
+	defer ts.Close()
+	post := func(path string, in interface{}) {
+		require.NoError(t, postJSON(ts.URL+path, in, nil))
+	}
+	post("/register", struct{ Name string }{"a"})
+	post("/register", struct{ Name string }{"b"})
+	<-c.release
+
+	s := snapshot{Worker: "a", Requests: 5, Server: loadgen.NewHistogram(), Client: loadgen.NewHistogram(), Done: true}
+	post("/snapshot", s)
+	s.Worker, s.Requests, s.Done = "b", 3, false
+	post("/snapshot", s)
+
+	// b died after its snapshot; it is given up on once silent for long
+	// enough, and its last counts are kept.
+	require.Empty(t, c.expire(time.Now()))
+	require.Equal(t, []string{"b"}, c.expire(time.Now().Add(2*time.Minute)))
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("the run isn't over")
+	}
+	total, done := c.merged()
+	require.Equal(t, 2, done)
+	require.Equal(t, uint64(8), total.Requests)
+
+	// A late snapshot of b changes nothing.
+	s.Requests, s.Done = 10, true
+	post("/snapshot", s)
+	total, _ = c.merged()
+	require.Equal(t, uint64(8), total.Requests)
+}
@@ -0,0 +1,276 @@
+// This tool generates the parameter files used by throughputtest, such as
+// listofdirectors_uid, instead of hand written curl scripts. It finds entities
+// with a given predicate, either by querying a loaded cluster or by scanning an
+// RDF dump, and samples them with a seed so that runs can be reproduced.
+//
+// Every Director with at least 5 films, sampled in proportion to a zipf
+// distribution over the number of films:
+//
+//	./paramgen --alpha http://localhost:8080/query --pred director.film \
+//		--type Director --min-degree 5 --strategy zipf --n 1000 --seed 7 \
+//		--out ../listofdirectors_uid
+//
+// The same from an RDF dump whose nodes are uids, such as a dgraph export:
+//
+//	./paramgen --rdf export/g01.rdf.gz --pred director.film --type Director ...
+//
+// throughputtest queries uid(...), so a dump with blank nodes or IRIs, such
+// as 1million.rdf.gz, is refused: load it and take the entities from the
+// cluster with --alpha instead.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/benchmarks/nquad"
+)
+
+var (
+	alpha     = flag.String("alpha", "", "Dgraph query endpoint to take entities from, e.g. http://localhost:8080/query")
+	rdfFile   = flag.String("rdf", "", "RDF file, plain or gzipped, to take entities from instead of a cluster.")
+	pred      = flag.String("pred", "", "Entities must have this predicate. Their degree is the number of its values.")
+	typ       = flag.String("type", "", "Entities must have this dgraph.type.")
+	minDegree = flag.Int("min-degree", 1, "Minimum degree of an entity.")
+	maxDegree = flag.Int("max-degree", 0, "Maximum degree of an entity. 0 means no limit.")
+	strategy  = flag.String("strategy", "uniform", "Sampling strategy: uniform, zipf or stratified.")
+	zipfS     = flag.Float64("zipf-s", 1.1, "Exponent of the zipf distribution over entities ranked by degree.")
+	num       = flag.Int("n", 1000, "Number of parameters to generate.")
+	seed      = flag.Int64("seed", 0, "Random seed. 0 picks one from the clock, which is then recorded in the output.")
+	out       = flag.String("out", "", "Output file. Defaults to stdout.")
+)
+
+type entity struct {
+	id     string
+	degree int
+}
+
+func fromCluster() ([]entity, error) {
+	filter := ""
+	if *typ != "" {
+		filter = fmt.Sprintf(" @filter(type(%s))", *typ)
+	}
+	q := fmt.Sprintf(`{
+  q(func: has(%s))%s {
+    uid
+    degree: count(%s)
+  }
+}`, *pred, filter, *pred)
+
+	resp, err := http.Post(*alpha, "application/dql", bytes.NewBufferString(q))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Data struct {
+			Q []struct {
+				Uid    string `json:"uid"`
+				Degree int    `json:"degree"`
+			} `json:"q"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("while parsing response: %v", err)
+	}
+	if len(res.Errors) > 0 {
+		return nil, fmt.Errorf("query failed: %s", res.Errors[0].Message)
+	}
+	var ents []entity
+	for _, e := range res.Data.Q {
+		ents = append(ents, entity{id: e.Uid, degree: e.Degree})
+	}
+	return ents, nil
+}
+
+func fromRDF() ([]entity, error) {
+	degree := make(map[string]int)
+	typed := make(map[string]bool)
+	err := nquad.Each(*rdfFile, func(nq nquad.NQuad) error {
+		switch {
+		case nq.Predicate == *pred:
+			degree[nq.Subject]++
+		case *typ != "" && nq.Predicate == "dgraph.type" && nq.ObjectValue == *typ:
+			typed[nq.Subject] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ents []entity
+	for id, d := range degree {
+		if *typ != "" && !typed[id] {
+			continue
+		}
+		ents = append(ents, entity{id: id, degree: d})
+	}
+	return ents, nil
+}
+
+// isUid reports whether id is a uid, 0x followed by hex digits.
+func isUid(id string) bool {
+	if !strings.HasPrefix(id, "0x") {
+		return false
+	}
+	_, err := strconv.ParseUint(id[2:], 16, 64)
+	return err == nil
+}
+
+// uniform samples without replacement.
+func uniform(r *rand.Rand, ents []entity, n int) []entity {
+	r.Shuffle(len(ents), func(i, j int) { ents[i], ents[j] = ents[j], ents[i] })
+	if n > len(ents) {
+		n = len(ents)
+	}
+	return ents[:n]
+}
+
+// zipf ranks entities by degree and samples ranks with replacement, so that
+// the highest degree entities are queried most often.
+func zipf(r *rand.Rand, ents []entity, n int) []entity {
+	z := rand.NewZipf(r, *zipfS, 1, uint64(len(ents)-1))
+	out := make([]entity, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, ents[z.Uint64()])
+	}
+	return out
+}
+
+// stratified splits entities into buckets by the power of two of their degree
+// and samples the same number from each bucket, without replacement.
+func stratified(r *rand.Rand, ents []entity, n int) []entity {
+	buckets := make(map[int][]entity)
+	for _, e := range ents {
+		// Degree 0 gets a bucket of its own, below that of degree 1.
+		b := -1
+		if e.degree > 0 {
+			b = int(math.Log2(float64(e.degree)))
+		}
+		buckets[b] = append(buckets[b], e)
+	}
+	keys := make([]int, 0, len(buckets))
+	for k := range buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	var out []entity
+	for i, k := range keys {
+		// Spread what is left over the remaining buckets, so that small
+		// buckets don't reduce the total.
+		want := (n - len(out)) / (len(keys) - i)
+		out = append(out, uniform(r, buckets[k], want)...)
+	}
+	return out
+}
+
+func main() {
+	flag.Parse()
+	if *pred == "" || (*alpha == "") == (*rdfFile == "") {
+		log.Fatal("Need --pred, and exactly one of --alpha and --rdf.")
+	}
+	if *strategy == "zipf" && *zipfS <= 1 {
+		log.Fatal("--zipf-s must be greater than 1.")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	var ents []entity
+	var err error
+	if *alpha != "" {
+		ents, err = fromCluster()
+	} else {
+		ents, err = fromRDF()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var filtered []entity
+	for _, e := range ents {
+		if e.degree < *minDegree || (*maxDegree > 0 && e.degree > *maxDegree) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	if len(filtered) == 0 {
+		log.Fatal("No entities match.")
+	}
+	for _, e := range filtered {
+		if !isUid(e.id) {
+			log.Fatalf("Node %s of %s is not a uid, and throughputtest can only query uids. "+
+				"Load the data and take the entities from the cluster with --alpha instead.", e.id, *rdfFile)
+		}
+	}
+	// Sort first, so that the sample only depends on the seed.
+	sort.Slice(filtered, func(i, j int) bool {
+		if filtered[i].degree != filtered[j].degree {
+			return filtered[i].degree > filtered[j].degree
+		}
+		return filtered[i].id < filtered[j].id
+	})
+
+	r := rand.New(rand.NewSource(*seed))
+	var sample []entity
+	switch *strategy {
+	case "uniform":
+		sample = uniform(r, filtered, *num)
+	case "zipf":
+		sample = zipf(r, filtered, *num)
+	case "stratified":
+		sample = stratified(r, filtered, *num)
+	default:
+		log.Fatalf("Unknown strategy: %s", *strategy)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			log.Fatal(err)
+		}
+	}
+	bw := bufio.NewWriter(w)
+	source := *alpha
+	if source == "" {
+		source = *rdfFile
+	}
+	// Lines starting with # are skipped by throughputtest and pbbenchmark.
+	fmt.Fprintf(bw, "# paramgen %s\n", strings.Join(os.Args[1:], " "))
+	fmt.Fprintf(bw, "# source=%s pred=%s type=%s strategy=%s seed=%d candidates=%d\n",
+		source, *pred, *typ, *strategy, *seed, len(filtered))
+	for _, e := range sample {
+		fmt.Fprintln(bw, e.id)
+	}
+	if err := bw.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	// Only close the file opened above, not stdout.
+	if w != os.Stdout {
+		if err := w.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("Wrote %d parameters from %d candidates with seed %d", len(sample), len(filtered), *seed)
+}
@@ -15,13 +15,20 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/dgraph-io/benchmarks/loadgen"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
 	numUser           = flag.Int("numuser", 1, "number of users hitting simultaneously")
 	numSec            = flag.Float64("numsec", 10, "number number of seconds each user streams requests")
 	serverAddr        = flag.String("ip", ":10001", "IP addr of server")
+	metricsAddr       = flag.String("metrics", "", "Serve client metrics for Prometheus on this address, e.g. :9099")
+	actorFile         = flag.String("actors", "listofactors_uid", "File with actor uids, one per line. Lines starting with # are skipped.")
+	directorFile      = flag.String("directors", "listofdirectors_uid", "File with director uids, one per line. Lines starting with # are skipped.")
 	countC            chan int
 	jsonP             chan float64
 	serverP           chan float64
@@ -30,8 +37,23 @@ var (
 	latC              chan float64
 	actors, directors []string
 	serverList        []string
+	validation        loadgen.ValidationFlags
+	validators        loadgen.Validators
+	errCounts         loadgen.ErrorCounts
+	metrics           = loadgen.NewMetrics(prometheus.DefaultRegisterer)
+	numRequests       uint64
+	hists             = struct {
+		sync.Mutex
+		server, client *loadgen.Histogram
+	}{server: loadgen.NewHistogram(), client: loadgen.NewHistogram()}
 )
 
+const numRounds = 3
+
+func init() {
+	validation.Register(flag.CommandLine)
+}
+
 var qa1 = `{
 				debug(func: uid(`
 var qa2 = `)) {
@@ -107,7 +129,6 @@ func runUser(wg *sync.WaitGroup) {
 	client := &http.Client{Transport: &http.Transport{
 		MaxIdleConnsPerHost: 100,
 	}}
-	var dat map[string]interface{}
 	var latency map[string]interface{}
 	var extensions map[string]interface{}
 
@@ -115,61 +136,95 @@ func runUser(wg *sync.WaitGroup) {
 
 	for time.Now().Sub(tix).Seconds() < *numSec {
 		var choose = rand.Intn(2)
-		var query string
+		var query, key, template string
 		if choose == 1 {
-			var ridx = rand.Intn(len(actors))
-			query = qa1 + actors[ridx] + qa2
+			key = actors[rand.Intn(len(actors))]
+			query = qa1 + key + qa2
+			template = "actor"
 		} else {
-			var ridx = rand.Intn(len(directors))
-			query = qd1 + directors[ridx] + qd2
+			key = directors[rand.Intn(len(directors))]
+			query = qd1 + key + qd2
+			template = "director"
+		}
+		fail := func(c loadgen.ErrorClass) {
+			errCounts.Add(c)
+			metrics.Error(template, c)
 		}
 
 		r, _ := http.NewRequest("POST", serverList[rand.Intn(len(serverList))], bytes.NewBufferString(query))
+		done := metrics.Start(template)
+		t0 := time.Now()
 		resp, err := client.Do(r)
 
 		count++
+		atomic.AddUint64(&numRequests, 1)
 
+		if err != nil {
+			done()
+			log.Printf("Error while querying: %v", err)
+			fail(loadgen.TransportError)
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		done()
+		clientLat := time.Since(t0)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			log.Printf("Couldn't read response. Status: %v, err: %v", resp.Status, err)
+			fail(loadgen.TransportError)
+			continue
+		}
+		var dat map[string]interface{}
+		err = json.Unmarshal(body, &dat)
 		if err != nil {
 			log.Fatal(err)
-		} else {
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				log.Fatalf("Couldn't parse response body. %+v", err)
-			}
-			resp.Body.Close()
-			err = json.Unmarshal(body, &dat)
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			var ok bool
-
-			temp := dat["extensions"]
-			extensions, ok = temp.(map[string]interface{})
-			if !ok {
-				log.Print("no 'extensions' in response data")
-				log.Fatalf("%#v", dat)
-			}
-
-			temp = extensions["server_latency"]
-			latency, ok = temp.(map[string]interface{})
-			if !ok {
-				log.Print("no 'server_latency' in extension data'")
-				log.Fatalf("%#v", extensions)
-			}
-
-			pro := time.Duration(latency["encoding_ns"].(float64)) * time.Nanosecond
-			proT += pro
-			js := time.Duration(latency["parsing_ns"].(float64)) * time.Nanosecond
-			jsonT += js
-			par := time.Duration(latency["processing_ns"].(float64)) * time.Nanosecond
-			parT += par
-
-			tot := pro + js + par
-			totT += tot
-
-			latC <- tot.Seconds()
 		}
+		if errs, ok := dat["errors"]; ok {
+			log.Printf("Got errors for %s: %v", key, errs)
+			fail(loadgen.ServerError)
+			continue
+		}
+
+		var ok bool
+
+		temp := dat["extensions"]
+		extensions, ok = temp.(map[string]interface{})
+		if !ok {
+			log.Print("no 'extensions' in response data")
+			log.Fatalf("%#v", dat)
+		}
+
+		temp = extensions["server_latency"]
+		latency, ok = temp.(map[string]interface{})
+		if !ok {
+			log.Print("no 'server_latency' in extension data'")
+			log.Fatalf("%#v", extensions)
+		}
+
+		// A person may be both an actor and a director, so the template is
+		// part of the key of the golden response.
+		if err := validators.Validate(&loadgen.Result{Key: template + "-" + key, Data: dat["data"]}); err != nil {
+			log.Print(err)
+			fail(loadgen.ValidationFailure)
+			continue
+		}
+
+		pro := time.Duration(latency["encoding_ns"].(float64)) * time.Nanosecond
+		proT += pro
+		js := time.Duration(latency["parsing_ns"].(float64)) * time.Nanosecond
+		jsonT += js
+		par := time.Duration(latency["processing_ns"].(float64)) * time.Nanosecond
+		parT += par
+
+		tot := pro + js + par
+		totT += tot
+		metrics.Observe(template, clientLat, tot)
+		hists.Lock()
+		hists.server.Record(tot)
+		hists.client.Record(clientLat)
+		hists.Unlock()
+
+		latC <- tot.Seconds()
 	}
 	countC <- count
 	totalP <- totT.Seconds()
@@ -177,63 +232,89 @@ func runUser(wg *sync.WaitGroup) {
 	wg.Done()
 }
 
+// readParams reads one parameter per line, skipping the comments written by
+// paramgen.
+func readParams(f *os.File) []string {
+	var params []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if len(l) == 0 || strings.HasPrefix(l, "#") {
+			continue
+		}
+		params = append(params, l)
+	}
+	return params
+}
+
+func initChans() {
+	countC = make(chan int, 5*(*numUser))
+	serverP = make(chan float64, 5*(*numUser))
+	totalP = make(chan float64, 5*(*numUser))
+	parsingP = make(chan float64, 5*(*numUser))
+	jsonP = make(chan float64, 5*(*numUser))
+	latC = make(chan float64, 100000)
+}
+
+// runRounds runs all the users numRounds times, with a pause in between.
+func runRounds() {
+	var wg sync.WaitGroup
+	for r := 0; r < numRounds; r++ {
+		if r > 0 {
+			time.Sleep(1 * time.Second)
+		}
+		wg.Add(*numUser)
+		fmt.Printf("Run %d of %d\n", r+1, numRounds)
+		for i := 0; i < *numUser; i++ {
+			go runUser(&wg)
+		}
+		wg.Wait()
+	}
+}
+
 func main() {
 	flag.Parse()
+	// Workers get the validation and metrics flags from the coordinator.
+	if *workerOf != "" {
+		runWorker()
+		return
+	}
+	var err error
+	if validators, err = validation.Validators(); err != nil {
+		log.Fatal(err)
+	}
+	// The coordinator sends no queries, so it has no metrics to serve.
+	if *metricsAddr != "" && *coordinatorAddr == "" {
+		loadgen.ServeMetrics(*metricsAddr)
+	}
+
 	var meanLat, sdLat, serTi, jsonTi, parTi, totTi float64
 	var totCount int
-	var wg sync.WaitGroup
 	var allLat []float64
 	serverList = strings.Split(*serverAddr, ",")
-	actorfile, err := os.Open("listofactors_uid")
-	directorfile, err1 := os.Open("listofdirectors_uid")
+	actorfile, err := os.Open(*actorFile)
+	directorfile, err1 := os.Open(*directorFile)
 	if err != nil || err1 != nil {
-		return
+		log.Fatalf("Couldn't open parameter files: %v, %v", err, err1)
 	}
 	defer actorfile.Close()
 	defer directorfile.Close()
 
-	scanner := bufio.NewScanner(actorfile)
-	for scanner.Scan() {
-		actors = append(actors, scanner.Text())
-	}
-	scanner = bufio.NewScanner(directorfile)
-	for scanner.Scan() {
-		directors = append(directors, scanner.Text())
-	}
+	actors = readParams(actorfile)
+	directors = readParams(directorfile)
 
-	countC = make(chan int, 5*(*numUser))
-	serverP = make(chan float64, 5*(*numUser))
-	totalP = make(chan float64, 5*(*numUser))
-	parsingP = make(chan float64, 5*(*numUser))
-	jsonP = make(chan float64, 5*(*numUser))
-	latC = make(chan float64, 100000)
+	if *coordinatorAddr != "" {
+		runCoordinator()
+		return
+	}
 
+	initChans()
 	go func() {
 		for t := range latC {
 			allLat = append(allLat, t)
 		}
 	}()
-	wg.Add(*numUser)
-	fmt.Println("First run")
-	for i := 0; i < *numUser; i++ {
-		go runUser(&wg)
-	}
-
-	wg.Wait()
-	time.Sleep(1 * time.Second)
-	wg.Add(*numUser)
-	fmt.Println("Second run")
-	for i := 0; i < *numUser; i++ {
-		go runUser(&wg)
-	}
-	wg.Wait()
-	time.Sleep(1 * time.Second)
-	wg.Add(*numUser)
-	fmt.Println("Third run")
-	for i := 0; i < *numUser; i++ {
-		go runUser(&wg)
-	}
-	wg.Wait()
+	runRounds()
 
 	close(countC)
 	close(serverP)
@@ -257,6 +338,9 @@ func main() {
 	for it := range totalP {
 		totTi += it
 	}
+	if len(allLat) == 0 {
+		log.Fatalf("No successful queries. Errors: %s", errCounts.String())
+	}
 
 	meanLat = serTi / float64(totCount)
 	for _, it := range allLat {
@@ -267,10 +351,11 @@ func main() {
 
 	fmt.Println("------------------------------------------------------------------------")
 	fmt.Println("\nNumUser :", *numUser)
-	fmt.Println("Throughput (num request per second) : ", float64(totCount)/(3*(*numSec)))
+	fmt.Println("Throughput (num request per second) : ", float64(totCount)/(numRounds*(*numSec)))
 	fmt.Println("Total number of queries : ", totCount)
 	fmt.Println("Avg time (ms) : ", 1000*totTi/float64(totCount))
 	fmt.Println("95 percentile latency : ", 1000*allLat[int(len(allLat)/2)], 1000*allLat[int(95*len(allLat)/100)])
 	fmt.Println("Min, Max : ", 1000*allLat[0], 1000*allLat[len(allLat)-1])
+	fmt.Println("Errors : ", errCounts.String())
 	fmt.Println("------------------------------------------------------------------------")
 }